@@ -62,3 +62,7 @@ func SetSfaMode(wf *aw.Workflow, id string) error {
 func SetApikey(wf *aw.Workflow, enabled string) error {
 	return wf.Config.Set("USE_APIKEY", enabled, false).Do()
 }
+
+func SetSearchAllAccounts(wf *aw.Workflow, enabled string) error {
+	return wf.Config.Set("SEARCH_ALL_ACCOUNTS", enabled, false).Do()
+}
@@ -0,0 +1,289 @@
+package alfred
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/deanishe/awgo/keychain"
+	"github.com/deanishe/awgo/util"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	SecretStoreKeychain = "keychain"
+	SecretStoreFile     = "file"
+	SecretStoreMemory   = "memory"
+
+	secretsFileName = "secrets"
+	saltSize        = 16
+
+	// the scrypt parameters recommended for interactive logins, the key is derived on every run
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ErrSecretNotFound is returned by all stores if a secret doesn't exist
+var ErrSecretNotFound = keychain.ErrNotFound
+
+// SecretStore keeps secrets like the session token and the cache key
+type SecretStore interface {
+	Get(key string) (string, error)
+	Set(key string, value string) error
+	Delete(key string) error
+}
+
+// NewSecretStore returns the store configured with SECRET_STORE
+// The macOS keychain is used by default
+func NewSecretStore(wf *aw.Workflow, kind string, fileKey string) (SecretStore, error) {
+	switch kind {
+	case "", SecretStoreKeychain:
+		return wf.Keychain, nil
+	case SecretStoreFile:
+		return NewFileStore(filepath.Join(wf.DataDir(), secretsFileName), fileKey)
+	case SecretStoreMemory:
+		return NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("unknown secret store %q", kind)
+}
+
+// MemoryStore keeps the secrets only as long as the process runs, it's meant for tests
+type MemoryStore struct {
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{secrets: map[string]string{}}
+}
+
+func (s *MemoryStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.secrets[key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+func (s *MemoryStore) Set(key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[key] = value
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.secrets[key]; !ok {
+		return ErrSecretNotFound
+	}
+	delete(s.secrets, key)
+	return nil
+}
+
+// FileStore keeps the secrets in a file which is encrypted with secretbox.
+// The key is derived from SECRET_STORE_KEY with scrypt and a random salt which is saved
+// next to the secrets file. If SECRET_STORE_KEY isn't set a random key is generated and
+// saved next to the secrets file.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+	key  [32]byte
+}
+
+func NewFileStore(path string, passphrase string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	if passphrase != "" {
+		return s, s.derivePassphraseKey(passphrase)
+	}
+
+	keyPath := fmt.Sprintf("%s.key", path)
+	key, err := os.ReadFile(keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		key = make([]byte, len(s.key))
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+			return nil, err
+		}
+		if err := util.WriteFile(keyPath, key, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if len(key) != len(s.key) {
+		return nil, fmt.Errorf("invalid key in %s", keyPath)
+	}
+	copy(s.key[:], key)
+	return s, nil
+}
+
+// derivePassphraseKey derives the key from the passphrase and the salt saved next to the secrets file
+func (s *FileStore) derivePassphraseKey(passphrase string) error {
+	saltPath := fmt.Sprintf("%s.salt", s.path)
+	salt, err := os.ReadFile(saltPath)
+	if err == nil {
+		if len(salt) != saltSize {
+			return fmt.Errorf("invalid salt in %s", saltPath)
+		}
+		return s.setPassphraseKey(passphrase, salt)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	salt = make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(saltPath), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(saltPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errors.Is(err, os.ErrExist) {
+		// another run of the workflow created the salt meanwhile
+		return s.derivePassphraseKey(passphrase)
+	} else if err != nil {
+		return err
+	}
+	if _, err := f.Write(salt); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return s.setPassphraseKey(passphrase, salt)
+}
+
+func (s *FileStore) setPassphraseKey(passphrase string, salt []byte) error {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, len(s.key))
+	if err != nil {
+		return err
+	}
+	copy(s.key[:], key)
+	return nil
+}
+
+func (s *FileStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	value, ok := secrets[key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+func (s *FileStore) Set(key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	secrets[key] = value
+	return s.save(secrets)
+}
+
+func (s *FileStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[key]; !ok {
+		return ErrSecretNotFound
+	}
+	delete(secrets, key)
+	return s.save(secrets)
+}
+
+func (s *FileStore) load() (map[string]string, error) {
+	secrets := map[string]string{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return secrets, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	if len(data) < len(nonce) {
+		return nil, fmt.Errorf("secrets file %s is corrupt", s.path)
+	}
+	copy(nonce[:], data[:len(nonce)])
+	plain, ok := secretbox.Open(nil, data[len(nonce):], &nonce, &s.key)
+	if !ok {
+		return nil, fmt.Errorf("unable to decrypt secrets file %s", s.path)
+	}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func (s *FileStore) save(secrets map[string]string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return err
+	}
+	data := secretbox.Seal(nonce[:], plain, &nonce, &s.key)
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	return util.WriteFile(s.path, data, 0600)
+}
+
+// NamespacedStore keeps the secrets of one account apart from the others by appending
+// the account name to every key
+type NamespacedStore struct {
+	store     SecretStore
+	namespace string
+}
+
+// NewNamespacedStore returns store as it is for an empty namespace, so the secrets of the
+// default account keep their names
+func NewNamespacedStore(store SecretStore, namespace string) SecretStore {
+	if namespace == "" {
+		return store
+	}
+	return &NamespacedStore{store: store, namespace: namespace}
+}
+
+func (s *NamespacedStore) key(key string) string {
+	return fmt.Sprintf("%s@%s", key, s.namespace)
+}
+
+func (s *NamespacedStore) Get(key string) (string, error) {
+	return s.store.Get(s.key(key))
+}
+
+func (s *NamespacedStore) Set(key string, value string) error {
+	return s.store.Set(s.key(key), value)
+}
+
+func (s *NamespacedStore) Delete(key string) error {
+	return s.store.Delete(s.key(key))
+}
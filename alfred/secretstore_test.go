@@ -0,0 +1,189 @@
+package alfred
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretStores(t *testing.T) {
+	dir := t.TempDir()
+	fileStore, err := NewFileStore(filepath.Join(dir, "secrets"), "")
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	passphraseStore, err := NewFileStore(filepath.Join(dir, "secrets-passphrase"), "passphrase")
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		store SecretStore
+	}{
+		{name: "memory", store: NewMemoryStore()},
+		{name: "file", store: fileStore},
+		{name: "file with passphrase", store: passphraseStore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.store.Get("token"); !errors.Is(err, ErrSecretNotFound) {
+				t.Errorf("Get() on empty store error = %v, want %v", err, ErrSecretNotFound)
+			}
+			if err := tt.store.Set("token", "session-token"); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			if err := tt.store.Set("encryptPassword", "cache-key"); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			got, err := tt.store.Get("token")
+			if err != nil || got != "session-token" {
+				t.Errorf("Get() = %q, %v, want %q", got, err, "session-token")
+			}
+			if err := tt.store.Delete("token"); err != nil {
+				t.Errorf("Delete() error = %v", err)
+			}
+			if _, err := tt.store.Get("token"); !errors.Is(err, ErrSecretNotFound) {
+				t.Errorf("Get() after Delete() error = %v, want %v", err, ErrSecretNotFound)
+			}
+			if err := tt.store.Delete("token"); !errors.Is(err, ErrSecretNotFound) {
+				t.Errorf("Delete() of missing secret error = %v, want %v", err, ErrSecretNotFound)
+			}
+			got, err = tt.store.Get("encryptPassword")
+			if err != nil || got != "cache-key" {
+				t.Errorf("Get() = %q, %v, want %q", got, err, "cache-key")
+			}
+		})
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets")
+
+	store, err := NewFileStore(path, "")
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	if err := SetToken(store, "session-token"); err != nil {
+		t.Fatalf("SetToken() error = %v", err)
+	}
+
+	// a new store reuses the generated key
+	reopened, err := NewFileStore(path, "")
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	if got, err := GetToken(reopened); err != nil || got != "session-token" {
+		t.Errorf("GetToken() = %q, %v, want %q", got, err, "session-token")
+	}
+
+	for _, p := range []string{path, path + ".key"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s has mode %v, want 0600", p, info.Mode().Perm())
+		}
+	}
+
+	// the secrets can't be read with another key
+	wrongKey, err := NewFileStore(path, "wrong passphrase")
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	if _, err := GetToken(wrongKey); err == nil {
+		t.Errorf("GetToken() with wrong key should fail")
+	}
+
+	if err := RemoveToken(reopened); err != nil {
+		t.Errorf("RemoveToken() error = %v", err)
+	}
+	if _, err := GetToken(store); err == nil {
+		t.Errorf("GetToken() after RemoveToken() should fail")
+	}
+}
+
+func TestFileStore_passphrase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets")
+
+	store, err := NewFileStore(path, "passphrase")
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	if err := SetToken(store, "session-token"); err != nil {
+		t.Fatalf("SetToken() error = %v", err)
+	}
+	salt, err := os.ReadFile(path + ".salt")
+	if err != nil || len(salt) != saltSize {
+		t.Fatalf("salt = %x, %v", salt, err)
+	}
+	if info, err := os.Stat(path + ".salt"); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("salt file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	reopened, err := NewFileStore(path, "passphrase")
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	if got, err := GetToken(reopened); err != nil || got != "session-token" {
+		t.Errorf("GetToken() = %q, %v, want %q", got, err, "session-token")
+	}
+
+	// the same passphrase with another salt results in another key
+	other, err := NewFileStore(filepath.Join(dir, "other"), "passphrase")
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	if other.key == store.key {
+		t.Errorf("the key doesn't depend on the salt")
+	}
+}
+
+func TestNamespacedStore(t *testing.T) {
+	store := NewMemoryStore()
+	if got := NewNamespacedStore(store, ""); got != store {
+		t.Errorf("NewNamespacedStore() with empty namespace should return the store itself")
+	}
+
+	personal := NewNamespacedStore(store, "personal")
+	work := NewNamespacedStore(store, "work")
+	if err := SetToken(personal, "personal-token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetToken(work, "work-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		store   SecretStore
+		want    string
+		wantErr bool
+	}{
+		{name: "personal", store: personal, want: "personal-token"},
+		{name: "work", store: work, want: "work-token"},
+		{name: "default", store: store, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetToken(tt.store)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if err := RemoveToken(work); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GetToken(personal); err != nil || got != "personal-token" {
+		t.Errorf("removing the token of one account changed another, got %q, %v", got, err)
+	}
+}
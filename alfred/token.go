@@ -2,26 +2,25 @@ package alfred
 
 import (
 	"fmt"
-	aw "github.com/deanishe/awgo"
 )
 
 const tokenKey = "token"
 
-func GetToken(wf *aw.Workflow) (string, error) {
+func GetToken(store SecretStore) (string, error) {
 	var err error
 
-	token, err := wf.Keychain.Get(tokenKey)
+	token, err := store.Get(tokenKey)
 	if err != nil {
-		return "", fmt.Errorf("token not found in the keychain")
+		return "", fmt.Errorf("token not found in the secret store")
 	}
 
 	return token, nil
 }
 
-func SetToken(wf *aw.Workflow, token string) error {
-	return wf.Keychain.Set(tokenKey, token)
+func SetToken(store SecretStore, token string) error {
+	return store.Set(tokenKey, token)
 }
 
-func RemoveToken(wf *aw.Workflow) error {
-	return wf.Keychain.Delete(tokenKey)
+func RemoveToken(store SecretStore) error {
+	return store.Delete(tokenKey)
 }
@@ -0,0 +1,242 @@
+// Package generator creates random passwords and passphrases like the Bitwarden clients
+package generator
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// The character sets of the Bitwarden password generator
+const (
+	Lowercase = "abcdefghijklmnopqrstuvwxyz"
+	Uppercase = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	Numbers   = "0123456789"
+	Special   = "!@#$%^&*"
+
+	// Ambiguous are the characters which are easily mixed up
+	Ambiguous = "Il1O0"
+)
+
+// MinWordlistSize is the smallest word list which is accepted for passphrases
+const MinWordlistSize = 1000
+
+// MaxLength is the longest password which is generated, the same as in the Bitwarden clients
+const MaxLength = 128
+
+var (
+	ErrNoCharacters = errors.New("no character set selected")
+	ErrLength       = errors.New("the length is too short for the selected character sets")
+	ErrLengthMax    = fmt.Errorf("the length is longer than %d characters", MaxLength)
+	ErrWordlist     = errors.New("the word list is too short")
+)
+
+// PasswordOptions are the settings of a random password
+type PasswordOptions struct {
+	Length         int
+	Lowercase      bool
+	Uppercase      bool
+	Numbers        bool
+	Special        bool
+	AvoidAmbiguous bool
+}
+
+// PassphraseOptions are the settings of a passphrase
+type PassphraseOptions struct {
+	Words      int
+	Separator  string
+	Capitalize bool
+	// IncludeNumber appends a random digit to one of the words
+	IncludeNumber bool
+}
+
+// Generator draws the random values from its source, crypto/rand by default
+type Generator struct {
+	rand io.Reader
+}
+
+// New returns a generator reading from source, if source is nil crypto/rand is used
+func New(source io.Reader) *Generator {
+	if source == nil {
+		source = rand.Reader
+	}
+	return &Generator{rand: source}
+}
+
+// charsets returns the enabled character sets without the ambiguous characters if requested
+func (o PasswordOptions) charsets() []string {
+	var sets []string
+	for _, set := range []struct {
+		enabled bool
+		chars   string
+	}{
+		{o.Lowercase, Lowercase},
+		{o.Uppercase, Uppercase},
+		{o.Numbers, Numbers},
+		{o.Special, Special},
+	} {
+		if !set.enabled {
+			continue
+		}
+		chars := set.chars
+		if o.AvoidAmbiguous {
+			chars = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(Ambiguous, r) {
+					return -1
+				}
+				return r
+			}, chars)
+		}
+		sets = append(sets, chars)
+	}
+	return sets
+}
+
+// Password returns a random password which contains at least one character of every enabled set
+func (g *Generator) Password(o PasswordOptions) (string, error) {
+	sets := o.charsets()
+	if len(sets) == 0 {
+		return "", ErrNoCharacters
+	}
+	if o.Length < len(sets) {
+		return "", ErrLength
+	}
+	if o.Length > MaxLength {
+		return "", ErrLengthMax
+	}
+
+	all := strings.Join(sets, "")
+	password := make([]byte, 0, o.Length)
+	for _, set := range sets {
+		c, err := g.pick(set)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+	for len(password) < o.Length {
+		c, err := g.pick(all)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	// the required characters would otherwise always be at the start
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := g.intn(i + 1)
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+	return string(password), nil
+}
+
+// Passphrase returns words which are picked randomly from the word list
+func (g *Generator) Passphrase(wordlist []string, o PassphraseOptions) (string, error) {
+	if len(wordlist) < MinWordlistSize {
+		return "", ErrWordlist
+	}
+	if o.Words < 1 {
+		return "", fmt.Errorf("invalid number of words %d", o.Words)
+	}
+
+	words := make([]string, o.Words)
+	for i := range words {
+		n, err := g.intn(len(wordlist))
+		if err != nil {
+			return "", err
+		}
+		words[i] = wordlist[n]
+		if o.Capitalize {
+			runes := []rune(words[i])
+			runes[0] = unicode.ToUpper(runes[0])
+			words[i] = string(runes)
+		}
+	}
+	if o.IncludeNumber {
+		i, err := g.intn(len(words))
+		if err != nil {
+			return "", err
+		}
+		digit, err := g.pick(Numbers)
+		if err != nil {
+			return "", err
+		}
+		words[i] += string(digit)
+	}
+	return strings.Join(words, o.Separator), nil
+}
+
+// PasswordEntropy returns the entropy in bits of the passwords generated with the options
+func PasswordEntropy(o PasswordOptions) float64 {
+	size := len(strings.Join(o.charsets(), ""))
+	if size == 0 || o.Length < 1 {
+		return 0
+	}
+	return float64(o.Length) * math.Log2(float64(size))
+}
+
+// PassphraseEntropy returns the entropy in bits of the passphrases generated from a word list
+// of the given size, the capitalisation doesn't add any
+func PassphraseEntropy(wordlistSize int, o PassphraseOptions) float64 {
+	if wordlistSize < 1 || o.Words < 1 {
+		return 0
+	}
+	bits := float64(o.Words) * math.Log2(float64(wordlistSize))
+	if o.IncludeNumber {
+		bits += math.Log2(float64(len(Numbers))) + math.Log2(float64(o.Words))
+	}
+	return bits
+}
+
+// ParseWordlist reads a word list with one word per line. The dice numbers in front of the
+// words of the EFF word lists are skipped, as are empty lines and duplicates.
+func ParseWordlist(r io.Reader) ([]string, error) {
+	var words []string
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		word := fields[len(fields)-1]
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) < MinWordlistSize {
+		return nil, ErrWordlist
+	}
+	return words, nil
+}
+
+// intn returns a uniform random number in [0, n)
+func (g *Generator) intn(n int) (int, error) {
+	i, err := rand.Int(g.rand, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+func (g *Generator) pick(chars string) (byte, error) {
+	i, err := g.intn(len(chars))
+	if err != nil {
+		return 0, err
+	}
+	return chars[i], nil
+}
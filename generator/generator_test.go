@@ -0,0 +1,193 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// newTestGenerator returns a generator with a seeded, deterministic source
+func newTestGenerator(seed int64) *Generator {
+	return New(mathrand.New(mathrand.NewSource(seed)))
+}
+
+// testWordlist returns a word list with n distinct words
+func testWordlist(n int) []string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("word%d", i)
+	}
+	return words
+}
+
+func TestPassword(t *testing.T) {
+	all := PasswordOptions{Length: 20, Lowercase: true, Uppercase: true, Numbers: true, Special: true}
+	tests := []struct {
+		name    string
+		opts    PasswordOptions
+		wantErr error
+	}{
+		{name: "all character sets", opts: all},
+		{name: "only numbers", opts: PasswordOptions{Length: 8, Numbers: true}},
+		{name: "avoid ambiguous", opts: PasswordOptions{Length: 64, Lowercase: true, Uppercase: true, Numbers: true, AvoidAmbiguous: true}},
+		{name: "shortest length", opts: PasswordOptions{Length: 4, Lowercase: true, Uppercase: true, Numbers: true, Special: true}},
+		{name: "too short", opts: PasswordOptions{Length: 3, Lowercase: true, Uppercase: true, Numbers: true, Special: true}, wantErr: ErrLength},
+		{name: "longest length", opts: PasswordOptions{Length: MaxLength, Lowercase: true}},
+		{name: "too long", opts: PasswordOptions{Length: MaxLength + 1, Lowercase: true}, wantErr: ErrLengthMax},
+		{name: "no character sets", opts: PasswordOptions{Length: 20}, wantErr: ErrNoCharacters},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := int64(0); seed < 50; seed++ {
+				got, err := newTestGenerator(seed).Password(tt.opts)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Password() error = %v, want %v", err, tt.wantErr)
+				}
+				if tt.wantErr != nil {
+					return
+				}
+				if len(got) != tt.opts.Length {
+					t.Errorf("Password() = %q, want length %d", got, tt.opts.Length)
+				}
+				for _, set := range tt.opts.charsets() {
+					if !strings.ContainsAny(got, set) {
+						t.Errorf("Password() = %q, no character of %q", got, set)
+					}
+				}
+				if strings.Trim(got, strings.Join(tt.opts.charsets(), "")) != "" {
+					t.Errorf("Password() = %q contains characters of disabled sets", got)
+				}
+				if tt.opts.AvoidAmbiguous && strings.ContainsAny(got, Ambiguous) {
+					t.Errorf("Password() = %q contains ambiguous characters", got)
+				}
+			}
+		})
+	}
+
+	// the same source gives the same password
+	first, _ := newTestGenerator(1).Password(all)
+	second, _ := newTestGenerator(1).Password(all)
+	other, _ := newTestGenerator(2).Password(all)
+	if first != second || first == other {
+		t.Errorf("Password() is not deterministic: %q, %q, %q", first, second, other)
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	wordlist := testWordlist(MinWordlistSize)
+	tests := []struct {
+		name     string
+		wordlist []string
+		opts     PassphraseOptions
+		wantErr  bool
+	}{
+		{name: "words", wordlist: wordlist, opts: PassphraseOptions{Words: 5, Separator: "-"}},
+		{name: "capitalize", wordlist: wordlist, opts: PassphraseOptions{Words: 3, Separator: " ", Capitalize: true}},
+		{name: "include number", wordlist: wordlist, opts: PassphraseOptions{Words: 4, Separator: ".", IncludeNumber: true}},
+		{name: "no words", wordlist: wordlist, opts: PassphraseOptions{Words: 0}, wantErr: true},
+		{name: "short word list", wordlist: testWordlist(10), opts: PassphraseOptions{Words: 5}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTestGenerator(1).Passphrase(tt.wordlist, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Passphrase() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			words := strings.Split(got, tt.opts.Separator)
+			if len(words) != tt.opts.Words {
+				t.Fatalf("Passphrase() = %q, want %d words", got, tt.opts.Words)
+			}
+			numbers := 0
+			for _, word := range words {
+				if !strings.HasPrefix(strings.ToLower(word), "word") {
+					t.Errorf("Passphrase() = %q, %q is not in the word list", got, word)
+				}
+				if tt.opts.Capitalize != unicode.IsUpper([]rune(word)[0]) {
+					t.Errorf("Passphrase() = %q, capitalize %v", got, tt.opts.Capitalize)
+				}
+				// the words of the list end with their index, the extra digit makes it unknown
+				if !contains(tt.wordlist, strings.ToLower(word)) {
+					numbers++
+				}
+			}
+			if tt.opts.IncludeNumber && numbers > 1 {
+				t.Errorf("Passphrase() = %q, more than one word with a number", got)
+			}
+			again, _ := newTestGenerator(1).Passphrase(tt.wordlist, tt.opts)
+			if again != got {
+				t.Errorf("Passphrase() is not deterministic: %q, %q", got, again)
+			}
+		})
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{name: "numbers", got: PasswordEntropy(PasswordOptions{Length: 10, Numbers: true}), want: 10 * math.Log2(10)},
+		{name: "all character sets", got: PasswordEntropy(PasswordOptions{Length: 20, Lowercase: true, Uppercase: true, Numbers: true, Special: true}), want: 20 * math.Log2(70)},
+		{name: "avoid ambiguous", got: PasswordEntropy(PasswordOptions{Length: 20, Lowercase: true, Uppercase: true, Numbers: true, AvoidAmbiguous: true}), want: 20 * math.Log2(57)},
+		{name: "no character sets", got: PasswordEntropy(PasswordOptions{Length: 20}), want: 0},
+		{name: "eff passphrase", got: PassphraseEntropy(7776, PassphraseOptions{Words: 5}), want: 5 * math.Log2(7776)},
+		{name: "passphrase with number", got: PassphraseEntropy(7776, PassphraseOptions{Words: 4, IncludeNumber: true}), want: 4*math.Log2(7776) + math.Log2(10) + 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if math.Abs(tt.got-tt.want) > 1e-9 {
+				t.Errorf("entropy = %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWordlist(t *testing.T) {
+	var eff, plain strings.Builder
+	for i := 0; i < MinWordlistSize; i++ {
+		fmt.Fprintf(&eff, "%05d\tword%d\n", i, i)
+		fmt.Fprintf(&plain, "word%d\n\n", i)
+	}
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr bool
+	}{
+		{name: "eff format", data: eff.String(), want: MinWordlistSize},
+		{name: "one word per line", data: plain.String(), want: MinWordlistSize},
+		{name: "duplicates", data: plain.String() + "word1\nword2\n", want: MinWordlistSize},
+		{name: "too short", data: "11111\tabacus\n11112\tabdomen\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWordlist(strings.NewReader(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWordlist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("ParseWordlist() = %d words, want %d", len(got), tt.want)
+			}
+			if !tt.wantErr && got[1] != "word1" {
+				t.Errorf("ParseWordlist() second word = %q", got[1])
+			}
+		})
+	}
+}
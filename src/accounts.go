@@ -0,0 +1,388 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
+	aw "github.com/deanishe/awgo"
+)
+
+const (
+	ACCOUNTS_NAME       = "accounts.json"
+	ACTIVE_ACCOUNT_NAME = "active-account"
+	DEFAULT_SERVER      = "https://bitwarden.com"
+)
+
+var (
+	// accounts are the named accounts from the accounts.json in the workflow data folder,
+	// if there are none the workflow uses the EMAIL, SERVER_URL and BW_DATA_PATH like before
+	accounts      []Account
+	activeAccount Account
+	// rootSecrets is the store without the account namespace
+	rootSecrets alfred.SecretStore
+	// searchAccount is set while the items of all accounts are added to the search
+	searchAccount  string
+	accountNameRgx = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+func loadAccounts() {
+	accounts = nil
+	if !wf.Data.Exists(ACCOUNTS_NAME) {
+		return
+	}
+	if err := wf.Data.LoadJSON(ACCOUNTS_NAME, &accounts); err != nil {
+		log.Printf("Couldn't load the accounts, error: %s", err)
+	}
+}
+
+func saveAccounts() error {
+	return wf.Data.StoreJSON(ACCOUNTS_NAME, accounts)
+}
+
+func getAccount(name string) (Account, bool) {
+	for _, acc := range accounts {
+		if acc.Name == name {
+			return acc, true
+		}
+	}
+	return Account{}, false
+}
+
+// selectAccount activates the account set with BW_ACCOUNT, the one selected in the
+// account switcher or the first account
+func selectAccount() {
+	if len(accounts) == 0 {
+		return
+	}
+	name := conf.Account
+	if name == "" && wf.Data.Exists(ACTIVE_ACCOUNT_NAME) {
+		data, err := wf.Data.Load(ACTIVE_ACCOUNT_NAME)
+		if err != nil {
+			log.Println(err)
+		}
+		name = strings.TrimSpace(string(data))
+	}
+	acc, ok := getAccount(name)
+	if !ok {
+		if name != "" {
+			log.Printf("Account %q not found, using account %q", name, accounts[0].Name)
+		}
+		acc = accounts[0]
+	}
+	activateAccount(acc)
+}
+
+// activateAccount points the Bitwarden CLI, the secret store and the caches to the account
+func activateAccount(acc Account) {
+	activeAccount = acc
+	secrets = alfred.NewNamespacedStore(rootSecrets, acc.Name)
+	if acc.Name == "" {
+		return
+	}
+	conf.Email = acc.Email
+	conf.Server = acc.Server
+	if conf.Server == "" {
+		conf.Server = DEFAULT_SERVER
+	}
+	appDataDir := accountAppDataDir(acc)
+	conf.BwDataPath = filepath.Join(appDataDir, "data.json")
+	// runCmd passes the environment on to the Bitwarden CLI
+	if err := os.Setenv("BITWARDENCLI_APPDATA_DIR", appDataDir); err != nil {
+		log.Println(err)
+	}
+}
+
+func accountAppDataDir(acc Account) string {
+	if acc.AppDataDir != "" {
+		return acc.AppDataDir
+	}
+	return filepath.Join(wf.DataDir(), "accounts", acc.Name)
+}
+
+// forEachAccount activates every account one after another, afterwards the previously active account is restored
+func forEachAccount(fn func(acc Account)) {
+	if len(accounts) == 0 {
+		fn(activeAccount)
+		return
+	}
+	previous := activeAccount
+	for _, acc := range accounts {
+		activateAccount(acc)
+		bwData = BwData{}
+		if err := loadBitwardenJSON(); err != nil {
+			log.Print(err.Error())
+		}
+		fn(acc)
+	}
+	activateAccount(previous)
+	bwData = BwData{}
+	if err := loadBitwardenJSON(); err != nil {
+		log.Print(err.Error())
+	}
+}
+
+// accountCacheName namespaces the cache names, the default account keeps the old names
+func accountCacheName(account string, name string) string {
+	if account == "" {
+		return name
+	}
+	return fmt.Sprintf("%s-%s", name, account)
+}
+
+func cacheName(name string) string {
+	return accountCacheName(activeAccount.Name, name)
+}
+
+// Filter the accounts in Alfred
+func runAccounts() {
+	wf.Configure(aw.SuppressUIDs(true))
+
+	for _, acc := range accounts {
+		subtitle := fmt.Sprintf("%s on %s", acc.Email, acc.Server)
+		icon := iconUser
+		if acc.Name == activeAccount.Name {
+			subtitle = fmt.Sprintf("Active, %s", subtitle)
+			icon = iconOn
+		}
+		it := wf.NewItem(acc.Name).
+			Subtitle(subtitle).
+			UID(acc.Name).
+			Valid(true).
+			Icon(icon).
+			Var("action", "-switchaccount").
+			Var("notification", fmt.Sprintf("Switched to account %s", acc.Name)).
+			Arg(acc.Name)
+		it.NewModifier(aw.ModCmd).
+			Subtitle(fmt.Sprintf("Remove account %s, the Bitwarden CLI data is kept", acc.Name)).
+			Var("action", "-removeaccount").
+			Var("notification", fmt.Sprintf("Removed account %s", acc.Name)).
+			Arg(acc.Name)
+	}
+
+	if len(accounts) > 1 {
+		enable := !conf.SearchAllAccounts
+		title := "Search All Accounts"
+		if !enable {
+			title = "Search Only the Active Account"
+		}
+		wf.NewItem(title).
+			Subtitle(fmt.Sprintf("Currently searching all accounts: %t", conf.SearchAllAccounts)).
+			UID("allaccounts").
+			Valid(true).
+			Icon(iconBw).
+			Var("notification", fmt.Sprintf("Search all accounts: %t", enable)).
+			Var("action", "-setconfigs").
+			Var("action2", "allaccounts").
+			Arg(strconv.FormatBool(enable))
+	}
+
+	fields := strings.Fields(opts.Query)
+	if len(fields) >= 2 {
+		server := DEFAULT_SERVER
+		if len(fields) > 2 {
+			server = strings.Join(fields[2:], " ")
+		}
+		wf.NewItem(fmt.Sprintf("Add Account %s", fields[0])).
+			Subtitle(fmt.Sprintf("Email %s, server %s", fields[1], server)).
+			UID("addaccount").
+			Valid(true).
+			Icon(iconUser).
+			Var("action", "-addaccount").
+			Var("notification", fmt.Sprintf("Added account %s", fields[0])).
+			Arg(opts.Query).
+			Match(opts.Query)
+	} else {
+		wf.NewItem("Add Account").
+			Subtitle("Type: <name> <email> [<server url>]").
+			UID("addaccount").
+			Valid(false).
+			Icon(iconUser)
+	}
+
+	if opts.Query != "" {
+		wf.Filter(opts.Query)
+	}
+	wf.SendFeedback()
+}
+
+func runSwitchAccount() {
+	wf.Configure(aw.TextErrors(true))
+	name := cli.Arg(0)
+	if _, ok := getAccount(name); !ok {
+		wf.Fatal(fmt.Sprintf("Account %q not found.", name))
+	}
+	if err := wf.Data.Store(ACTIVE_ACCOUNT_NAME, []byte(name)); err != nil {
+		wf.FatalError(err)
+	}
+	fmt.Printf("Switched to account %s", name)
+}
+
+func runAddAccount() {
+	wf.Configure(aw.TextErrors(true))
+	if cli.NArg() < 2 {
+		wf.Fatal("Usage: -addaccount <name> <email> [<server url>]")
+	}
+	acc := Account{Name: cli.Arg(0), Email: cli.Arg(1), Server: DEFAULT_SERVER}
+	if cli.NArg() > 2 {
+		acc.Server = strings.Join(cli.Args()[2:], " ")
+	}
+	if !accountNameRgx.MatchString(acc.Name) {
+		wf.Fatal("The account name may only contain letters, numbers, - and _.")
+	}
+	if _, ok := getAccount(acc.Name); ok {
+		wf.Fatal(fmt.Sprintf("Account %q exists already.", acc.Name))
+	}
+
+	appDataDir := accountAppDataDir(acc)
+	if err := os.MkdirAll(appDataDir, 0700); err != nil {
+		wf.FatalError(err)
+	}
+	// every account has its own data.json, so the server has to be set for each of them
+	activateAccount(acc)
+	command := fmt.Sprintf("%s config server %s", conf.BwExec, acc.Server)
+	message := fmt.Sprintf("Unable to set Bitwarden server %s", acc.Server)
+	if _, err := runCmd(command, message); err != nil {
+		wf.FatalError(err)
+	}
+
+	accounts = append(accounts, acc)
+	if err := saveAccounts(); err != nil {
+		wf.FatalError(err)
+	}
+	if len(accounts) == 1 {
+		if err := wf.Data.Store(ACTIVE_ACCOUNT_NAME, []byte(acc.Name)); err != nil {
+			log.Println(err)
+		}
+	}
+	fmt.Printf("Added account %s", acc.Name)
+}
+
+func runRemoveAccount() {
+	wf.Configure(aw.TextErrors(true))
+	name := cli.Arg(0)
+	acc, ok := getAccount(name)
+	if !ok {
+		wf.Fatal(fmt.Sprintf("Account %q not found.", name))
+	}
+
+	// remove the token and the caches, the Bitwarden CLI data directory stays untouched
+	activateAccount(acc)
+	if err := alfred.RemoveToken(secrets); err != nil {
+		log.Println(err)
+	}
+	removeApiTokens()
+	removeProtectedKey()
+	for _, cache := range []string{CACHE_NAME, FOLDER_CACHE_NAME, ORGANIZATION_CACHE_NAME, COLLECTION_CACHE_NAME, SYNC_CACHE_NAME, AUTO_FETCH_CACHE, DOMAINS_CACHE_NAME, BREACH_CACHE_NAME, TOTP_VIEW_CACHE_NAME} {
+		if err := wf.Cache.Store(cacheName(cache), nil); err != nil {
+			log.Println(err)
+		}
+	}
+
+	var remaining []Account
+	for _, a := range accounts {
+		if a.Name != name {
+			remaining = append(remaining, a)
+		}
+	}
+	accounts = remaining
+	if err := saveAccounts(); err != nil {
+		wf.FatalError(err)
+	}
+	if wf.Data.Exists(ACTIVE_ACCOUNT_NAME) {
+		if data, err := wf.Data.Load(ACTIVE_ACCOUNT_NAME); err == nil && strings.TrimSpace(string(data)) == name {
+			if err := wf.Data.Store(ACTIVE_ACCOUNT_NAME, nil); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	fmt.Printf("Removed account %s", name)
+}
+
+// updateActiveAccount saves changed settings of the active account
+func updateActiveAccount(update func(acc *Account)) error {
+	for i := range accounts {
+		if accounts[i].Name == activeAccount.Name {
+			update(&accounts[i])
+			activeAccount = accounts[i]
+			return saveAccounts()
+		}
+	}
+	return fmt.Errorf("account %q not found", activeAccount.Name)
+}
+
+// runSearchAllAccounts adds the cached items of every account to the search,
+// the account name is passed on to the following actions with BW_ACCOUNT
+func runSearchAllAccounts() {
+	wf.Configure(aw.SuppressUIDs(true))
+	wf.Configure(aw.MaxResults(conf.MaxResults))
+
+	forEachAccount(func(acc Account) {
+		if bwData.UserId == "" || bwData.ProtectedKey == "" || !wf.Cache.Exists(cacheName(CACHE_NAME)) {
+			it := wf.NewItem(fmt.Sprintf("%s: Locked", acc.Name)).
+				Subtitle(fmt.Sprintf("↩ to unlock %s", acc.Email)).
+				UID(fmt.Sprintf("account-%s", acc.Name)).
+				Valid(true).
+				Icon(iconWarning).
+				Var("action", "-unlock").
+				Var("BW_ACCOUNT", acc.Name)
+			if bwData.UserId == "" {
+				it.Title(fmt.Sprintf("%s: Not logged in", acc.Name)).
+					Subtitle(fmt.Sprintf("↩ to login %s", acc.Email)).
+					Var("action", "-login")
+			} else if bwData.ProtectedKey != "" {
+				it.Title(fmt.Sprintf("%s: Cache Expired or not Existed", acc.Name)).
+					Subtitle("↩ to sync now").
+					Icon(iconReload).
+					Var("action", "-sync").
+					Var("action2", "-force").
+					Arg("-background")
+			}
+			return
+		}
+
+		data, err := Decrypt()
+		if isCacheError(err) {
+			log.Printf("The items cache of account %s can't be used: %s", acc.Name, err)
+			wf.NewItem(fmt.Sprintf("%s: Cache Invalid", acc.Name)).
+				Subtitle("↩ to sync now").
+				UID(fmt.Sprintf("account-%s", acc.Name)).
+				Valid(true).
+				Icon(iconReload).
+				Var("action", "-sync").
+				Var("action2", "-force").
+				Var("BW_ACCOUNT", acc.Name).
+				Arg("-background")
+			return
+		} else if err != nil {
+			log.Printf("Error decrypting data of account %s: %s", acc.Name, err)
+			return
+		}
+		var items []Item
+		if err := json.Unmarshal(data, &items); err != nil {
+			log.Printf("Couldn't load the items cache of account %s, error: %s", acc.Name, err)
+			return
+		}
+
+		sortItems(items, loadUsageStats())
+		searchAccount = acc.Name
+		for _, item := range items {
+			addItemsToWorkflow(item, false)
+		}
+		searchAccount = ""
+	})
+
+	if wf.IsEmpty() {
+		wf.NewItem("No Secrets Found").Subtitle("Try a different query or sync manually").Icon(iconWarning).Valid(false)
+	}
+	wf.SendFeedback()
+}
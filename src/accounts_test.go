@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
+)
+
+func Test_accountCacheName(t *testing.T) {
+	tests := []struct {
+		name    string
+		account string
+		cache   string
+		want    string
+	}{
+		{name: "default account", account: "", cache: CACHE_NAME, want: "bw-items"},
+		{name: "named account", account: "work", cache: CACHE_NAME, want: "bw-items-work"},
+		{name: "folders of named account", account: "personal", cache: FOLDER_CACHE_NAME, want: "bw-items-folders-personal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accountCacheName(tt.account, tt.cache); got != tt.want {
+				t.Errorf("accountCacheName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_activateAccount(t *testing.T) {
+	oldConf, oldSecrets, oldRootSecrets, oldAccount := conf, secrets, rootSecrets, activeAccount
+	oldAppDataDir, hadAppDataDir := os.LookupEnv("BITWARDENCLI_APPDATA_DIR")
+	defer func() {
+		conf, secrets, rootSecrets, activeAccount = oldConf, oldSecrets, oldRootSecrets, oldAccount
+		if hadAppDataDir {
+			os.Setenv("BITWARDENCLI_APPDATA_DIR", oldAppDataDir)
+		} else {
+			os.Unsetenv("BITWARDENCLI_APPDATA_DIR")
+		}
+	}()
+	rootSecrets = alfred.NewMemoryStore()
+
+	tests := []struct {
+		name           string
+		account        Account
+		wantEmail      string
+		wantServer     string
+		wantAppDataDir string
+	}{
+		{
+			name:           "self hosted",
+			account:        Account{Name: "work", Email: "me@example.com", Server: "https://bw.example.com", AppDataDir: "/tmp/bw-work"},
+			wantEmail:      "me@example.com",
+			wantServer:     "https://bw.example.com",
+			wantAppDataDir: "/tmp/bw-work",
+		},
+		{
+			name:           "default app data dir",
+			account:        Account{Name: "personal", Email: "me@test.com"},
+			wantEmail:      "me@test.com",
+			wantServer:     DEFAULT_SERVER,
+			wantAppDataDir: filepath.Join(wf.DataDir(), "accounts", "personal"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			activateAccount(tt.account)
+			if conf.Email != tt.wantEmail || conf.Server != tt.wantServer {
+				t.Errorf("activateAccount() email = %v, server = %v", conf.Email, conf.Server)
+			}
+			if got := os.Getenv("BITWARDENCLI_APPDATA_DIR"); got != tt.wantAppDataDir {
+				t.Errorf("activateAccount() BITWARDENCLI_APPDATA_DIR = %v, want %v", got, tt.wantAppDataDir)
+			}
+			if want := filepath.Join(tt.wantAppDataDir, "data.json"); conf.BwDataPath != want {
+				t.Errorf("activateAccount() BwDataPath = %v, want %v", conf.BwDataPath, want)
+			}
+			if err := alfred.SetToken(secrets, tt.account.Name); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// every account has its own token
+	for _, name := range []string{"work", "personal"} {
+		got, err := alfred.GetToken(alfred.NewNamespacedStore(rootSecrets, name))
+		if err != nil || got != name {
+			t.Errorf("token of account %s = %q, %v", name, got, err)
+		}
+	}
+}
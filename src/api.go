@@ -0,0 +1,420 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
+)
+
+const (
+	SYNC_MODE_CLI   = "cli"
+	SYNC_MODE_API   = "api"
+	SYNC_MODE_LOCAL = "local"
+)
+
+// the tokens renewed by the API sync mode, the data.json of the Bitwarden CLI isn't changed
+const (
+	API_ACCESS_TOKEN_NAME  = "api-access-token"
+	API_REFRESH_TOKEN_NAME = "api-refresh-token"
+)
+
+var errUnauthorized = errors.New("access token is invalid or expired")
+
+// apiClient talks directly to the Bitwarden server instead of using the Bitwarden CLI
+type apiClient struct {
+	apiURL      string
+	identityURL string
+	httpClient  *http.Client
+}
+
+func newApiClient(server string) *apiClient {
+	apiURL, identityURL := parseServerUrls(server)
+	return &apiClient{
+		apiURL:      apiURL,
+		identityURL: identityURL,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// parseServerUrls returns the api and identity url for the configured SERVER_URL.
+// The SERVER_URL is passed to "bw config server" as well so it can contain separate domains
+// e.g. "https://bw.example.com --api http://localhost:4000 --identity http://localhost:33656"
+func parseServerUrls(server string) (string, string) {
+	fields := strings.Fields(server)
+	base := "https://bitwarden.com"
+	if len(fields) > 0 && !strings.HasPrefix(fields[0], "--") {
+		base = strings.TrimRight(fields[0], "/")
+	}
+
+	apiURL := fmt.Sprintf("%s/api", base)
+	identityURL := fmt.Sprintf("%s/identity", base)
+	if u, err := url.Parse(base); err == nil {
+		// the Bitwarden cloud uses separate sub domains
+		switch u.Host {
+		case "bitwarden.com", "vault.bitwarden.com":
+			apiURL = "https://api.bitwarden.com"
+			identityURL = "https://identity.bitwarden.com"
+		case "bitwarden.eu", "vault.bitwarden.eu":
+			apiURL = "https://api.bitwarden.eu"
+			identityURL = "https://identity.bitwarden.eu"
+		}
+	}
+
+	for i := 0; i < len(fields)-1; i++ {
+		switch fields[i] {
+		case "--api":
+			apiURL = strings.TrimRight(fields[i+1], "/")
+		case "--identity":
+			identityURL = strings.TrimRight(fields[i+1], "/")
+		}
+	}
+	return apiURL, identityURL
+}
+
+// refreshAccessToken gets a new access token from the identity server
+func (c *apiClient) refreshAccessToken(refreshToken string) (tokenResponse, error) {
+	var token tokenResponse
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {"cli"},
+		"refresh_token": {refreshToken},
+	}
+	res, err := c.httpClient.PostForm(fmt.Sprintf("%s/connect/token", c.identityURL), form)
+	if err != nil {
+		return token, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return token, responseError("refreshing the access token", res)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return token, fmt.Errorf("failed to decode token response, %s", err)
+	}
+	if token.AccessToken == "" {
+		return token, fmt.Errorf("no access token received")
+	}
+	return token, nil
+}
+
+// sync gets the complete encrypted vault of the user
+func (c *apiClient) sync(accessToken string) (syncResponse, error) {
+	var sync syncResponse
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/sync", c.apiURL), nil)
+	if err != nil {
+		return sync, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return sync, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return sync, errUnauthorized
+	}
+	if res.StatusCode != http.StatusOK {
+		return sync, responseError("syncing the vault", res)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&sync); err != nil {
+		return sync, fmt.Errorf("failed to decode sync response, %s", err)
+	}
+	return sync, nil
+}
+
+func responseError(action string, res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return fmt.Errorf("%s failed with status %d: %s", action, res.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// runGetItemsApi gets all items and folders from the Bitwarden server and decrypts them
+// with the key of the current session
+func runGetItemsApi(token string) ([]Item, []Folder, error) {
+	userKey, err := MakeDecryptKeyFromSession(bwData.ProtectedKey, token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error making source key, %s", err)
+	}
+
+	client := newApiClient(conf.Server)
+	var sync syncResponse
+	err = errUnauthorized
+	accessToken, _ := secrets.Get(API_ACCESS_TOKEN_NAME)
+	if accessToken == "" {
+		accessToken = bwData.Tokens.AccessToken
+	}
+	if accessToken != "" {
+		sync, err = client.sync(accessToken)
+	}
+	if errors.Is(err, errUnauthorized) {
+		accessToken, err = refreshApiTokens(client)
+		if err != nil {
+			return nil, nil, err
+		}
+		sync, err = client.sync(accessToken)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	keys := vaultKeys{user: userKey}
+	if len(sync.Profile.Organizations) > 0 {
+		keys.orgs, err = decryptOrgKeys(sync.Profile.orgKeys(), sync.Profile.PrivateKey, userKey)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	items, folders, err := decryptSyncResponse(sync, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if orgs, collections, err := decryptCollections(sync, keys); err != nil {
+		log.Printf("Couldn't decrypt the collections, error: %s", err)
+	} else {
+		populateCacheCollections(orgs, collections)
+	}
+	if err := wf.Cache.StoreJSON(cacheName(DOMAINS_CACHE_NAME), sync.Domains.groups()); err != nil {
+		log.Printf("Couldn't store the equivalent domains, error: %s", err)
+	}
+	debugLog(fmt.Sprintf("Found %d items via the API.", len(items)))
+	return items, folders, nil
+}
+
+// refreshApiTokens renews the access token and stores the new tokens in the secret store.
+// The stored refresh token is tried first, the one of the data.json is newer after a new login.
+func refreshApiTokens(client *apiClient) (string, error) {
+	var refreshTokens []string
+	if token, _ := secrets.Get(API_REFRESH_TOKEN_NAME); token != "" {
+		refreshTokens = append(refreshTokens, token)
+	}
+	if token := bwData.Tokens.RefreshToken; token != "" && (len(refreshTokens) == 0 || refreshTokens[0] != token) {
+		refreshTokens = append(refreshTokens, token)
+	}
+	if len(refreshTokens) == 0 {
+		return "", fmt.Errorf("no refresh token found to renew the access token")
+	}
+
+	var err error
+	for _, refreshToken := range refreshTokens {
+		debugLog("Refreshing the access token.")
+		var token tokenResponse
+		token, err = client.refreshAccessToken(refreshToken)
+		if err != nil {
+			continue
+		}
+		// the server only sends a new refresh token if it rotates them
+		if token.RefreshToken == "" {
+			token.RefreshToken = refreshToken
+		}
+		if err := secrets.Set(API_ACCESS_TOKEN_NAME, token.AccessToken); err != nil {
+			log.Printf("Couldn't store the access token, error: %s", err)
+		}
+		if err := secrets.Set(API_REFRESH_TOKEN_NAME, token.RefreshToken); err != nil {
+			log.Printf("Couldn't store the refresh token, error: %s", err)
+		}
+		return token.AccessToken, nil
+	}
+	return "", err
+}
+
+// removeApiTokens removes the tokens renewed by the API sync mode
+func removeApiTokens() {
+	for _, key := range []string{API_ACCESS_TOKEN_NAME, API_REFRESH_TOKEN_NAME} {
+		if err := secrets.Delete(key); err != nil && !errors.Is(err, alfred.ErrSecretNotFound) {
+			log.Println(err)
+		}
+	}
+}
+
+// decryptSyncResponse converts the response into the same structure as returned by the Bitwarden CLI
+func decryptSyncResponse(sync syncResponse, keys vaultKeys) ([]Item, []Folder, error) {
+	var items []Item
+	for _, cipher := range sync.Ciphers {
+		// items in the trash are not listed by the Bitwarden CLI either
+		if cipher.DeletedDate != nil {
+			continue
+		}
+		item, err := decryptCipher(cipher, keys, false)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decrypting item %s, %s", cipher.Id, err)
+		}
+		items = append(items, item)
+	}
+
+	var folders []Folder
+	for _, f := range sync.Folders {
+		name, err := DecryptString(f.Name, keys.user)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decrypting folder %s, %s", f.Id, err)
+		}
+		folders = append(folders, Folder{Object: "folder", Id: f.Id, Name: name})
+	}
+	// the Bitwarden CLI always lists the "No Folder" folder without an id
+	folders = append(folders, Folder{Object: "folder", Id: "", Name: "No Folder"})
+
+	return items, folders, nil
+}
+
+// groups returns the equivalent domains of the user and the global ones which aren't excluded,
+// like the Bitwarden clients save them
+func (d *syncDomains) groups() [][]string {
+	groups := [][]string{}
+	if d == nil {
+		return groups
+	}
+	groups = append(groups, d.EquivalentDomains...)
+	for _, global := range d.GlobalEquivalentDomains {
+		if !global.Excluded && len(global.Domains) > 0 {
+			groups = append(groups, global.Domains)
+		}
+	}
+	return groups
+}
+
+// orgKeys returns the encrypted keys of the organizations by organization id
+func (p syncProfile) orgKeys() map[string]string {
+	keys := make(map[string]string, len(p.Organizations))
+	for _, org := range p.Organizations {
+		keys[org.Id] = org.Key
+	}
+	return keys
+}
+
+// vaultKeys holds the keys which are needed to decrypt the ciphers of a vault
+type vaultKeys struct {
+	user CryptoKey
+	orgs map[string]CryptoKey
+}
+
+// cipherKey returns the key a cipher is encrypted with
+func (k vaultKeys) cipherKey(cipher encryptedCipher) (CryptoKey, error) {
+	key := k.user
+	if cipher.OrganizationId != "" {
+		orgKey, ok := k.orgs[cipher.OrganizationId]
+		if !ok {
+			return key, fmt.Errorf("no key found for organization %s", cipher.OrganizationId)
+		}
+		key = orgKey
+	}
+	// newer clients encrypt every cipher with its own key
+	if cipher.Key != "" {
+		cs, err := NewCipherString(cipher.Key)
+		if err != nil {
+			return key, err
+		}
+		return cs.DecryptKey(key, AesCbc256_HmacSha256_B64)
+	}
+	return key, nil
+}
+
+type cipherDecrypter struct {
+	key CryptoKey
+	err error
+}
+
+// str decrypts s, after the first error all further values are returned as they are
+func (d *cipherDecrypter) str(s string) string {
+	if d.err != nil || s == "" {
+		return s
+	}
+	value, err := DecryptString(s, d.key)
+	if err != nil {
+		d.err = err
+		return s
+	}
+	return value
+}
+
+// decryptCipher decrypts all values of a cipher. If withSecrets is false the secret values
+// (password, totp, card code and hidden fields) stay encrypted, which is enough for the cache.
+func decryptCipher(cipher encryptedCipher, keys vaultKeys, withSecrets bool) (Item, error) {
+	key, err := keys.cipherKey(cipher)
+	if err != nil {
+		return Item{}, err
+	}
+	d := &cipherDecrypter{key: key}
+	secret := func(s string) string {
+		if withSecrets {
+			return d.str(s)
+		}
+		return s
+	}
+
+	item := cipher.Item
+	item.Object = "item"
+	item.Name = d.str(item.Name)
+	item.Notes = d.str(item.Notes)
+
+	item.Login.Username = d.str(item.Login.Username)
+	item.Login.Password = secret(item.Login.Password)
+	item.Login.Totp = secret(item.Login.Totp)
+	item.Login.Uris = nil
+	for _, uri := range cipher.Login.Uris {
+		item.Login.Uris = append(item.Login.Uris, Uri{Match: uri.Match, Uri: d.str(uri.Uri)})
+	}
+
+	item.Card = CardInfo{
+		CardHolderName: d.str(item.Card.CardHolderName),
+		Brand:          d.str(item.Card.Brand),
+		Number:         d.str(item.Card.Number),
+		ExpMonth:       d.str(item.Card.ExpMonth),
+		ExpYear:        d.str(item.Card.ExpYear),
+		Code:           secret(item.Card.Code),
+	}
+
+	item.Identity = Identity{
+		Title:          d.str(item.Identity.Title),
+		FirstName:      d.str(item.Identity.FirstName),
+		MiddleName:     d.str(item.Identity.MiddleName),
+		LastName:       d.str(item.Identity.LastName),
+		Address1:       d.str(item.Identity.Address1),
+		Address2:       d.str(item.Identity.Address2),
+		Address3:       d.str(item.Identity.Address3),
+		City:           d.str(item.Identity.City),
+		State:          d.str(item.Identity.State),
+		PostalCode:     d.str(item.Identity.PostalCode),
+		Country:        d.str(item.Identity.Country),
+		Company:        d.str(item.Identity.Company),
+		Email:          d.str(item.Identity.Email),
+		Phone:          d.str(item.Identity.Phone),
+		Ssn:            d.str(item.Identity.Ssn),
+		Username:       d.str(item.Identity.Username),
+		PassportNumber: d.str(item.Identity.PassportNumber),
+		LicenseNumber:  d.str(item.Identity.LicenseNumber),
+	}
+
+	item.Fields = nil
+	for _, field := range cipher.Fields {
+		value := d.str
+		if field.Type == 1 {
+			value = secret
+		}
+		item.Fields = append(item.Fields, Field{Name: d.str(field.Name), Value: value(field.Value), Type: field.Type})
+	}
+
+	item.Attachments = nil
+	for _, att := range cipher.Attachments {
+		att.FileName = d.str(att.FileName)
+		item.Attachments = append(item.Attachments, att)
+	}
+
+	if d.err != nil {
+		return Item{}, d.err
+	}
+	return item, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// newTestKey returns a random AesCbc256_HmacSha256_B64 key
+func newTestKey(t *testing.T) CryptoKey {
+	t.Helper()
+	key := make([]byte, 64)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	ck, err := NewCryptoKey(key, AesCbc256_HmacSha256_B64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ck
+}
+
+// encryptTestString encrypts s the same way the Bitwarden clients do
+func encryptTestString(t *testing.T, s string, key CryptoKey) string {
+	t.Helper()
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatal(err)
+	}
+	padding := aes.BlockSize - len(s)%aes.BlockSize
+	plain := append([]byte(s), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	block, err := aes.NewCipher(key.EncKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ct, plain)
+
+	mac := hmac.New(sha256.New, key.MacKey)
+	mac.Write(iv)
+	mac.Write(ct)
+
+	b64 := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("%d.%s|%s|%s", AesCbc256_HmacSha256_B64, b64(iv), b64(ct), b64(mac.Sum(nil)))
+}
+
+func Test_parseServerUrls(t *testing.T) {
+	tests := []struct {
+		name         string
+		server       string
+		wantApi      string
+		wantIdentity string
+	}{
+		{
+			name:         "bitwarden cloud",
+			server:       "https://bitwarden.com",
+			wantApi:      "https://api.bitwarden.com",
+			wantIdentity: "https://identity.bitwarden.com",
+		},
+		{
+			name:         "bitwarden eu cloud",
+			server:       "https://vault.bitwarden.eu",
+			wantApi:      "https://api.bitwarden.eu",
+			wantIdentity: "https://identity.bitwarden.eu",
+		},
+		{
+			name:         "self hosted",
+			server:       "https://bw.example.com/",
+			wantApi:      "https://bw.example.com/api",
+			wantIdentity: "https://bw.example.com/identity",
+		},
+		{
+			name:         "separate domains",
+			server:       "https://bw.example.com --api http://localhost:4000 --identity http://localhost:33656",
+			wantApi:      "http://localhost:4000",
+			wantIdentity: "http://localhost:33656",
+		},
+		{
+			name:         "empty",
+			server:       "",
+			wantApi:      "https://api.bitwarden.com",
+			wantIdentity: "https://identity.bitwarden.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotApi, gotIdentity := parseServerUrls(tt.server)
+			if gotApi != tt.wantApi {
+				t.Errorf("parseServerUrls() api = %v, want %v", gotApi, tt.wantApi)
+			}
+			if gotIdentity != tt.wantIdentity {
+				t.Errorf("parseServerUrls() identity = %v, want %v", gotIdentity, tt.wantIdentity)
+			}
+		})
+	}
+}
+
+func Test_apiClient_sync(t *testing.T) {
+	key := newTestKey(t)
+	itemKey := newTestKey(t)
+	itemKeyBytes := append(append([]byte{}, itemKey.EncKey...), itemKey.MacKey...)
+
+	response := fmt.Sprintf(`{
+		"profile": {"id": "user-1", "email": "bitwarden@test.com"},
+		"folders": [{"id": "folder-1", "name": %q}],
+		"ciphers": [
+			{"id": "item-1", "folderId": "folder-1", "type": 1, "name": %q, "favorite": true,
+			 "login": {"username": %q, "password": %q, "uris": [{"uri": %q, "match": null}]},
+			 "fields": [{"name": %q, "value": %q, "type": 1}]},
+			{"id": "item-2", "type": 2, "name": %q, "notes": %q, "key": %q, "secureNote": {"type": 0}},
+			{"id": "item-3", "type": 2, "name": %q, "deletedDate": "2022-02-28T16:58:54.900Z"}
+		]
+	}`,
+		encryptTestString(t, "Work", key),
+		encryptTestString(t, "GitHub", key),
+		encryptTestString(t, "octocat", key),
+		encryptTestString(t, "secret-password", key),
+		encryptTestString(t, "https://github.com", key),
+		encryptTestString(t, "pin", key),
+		encryptTestString(t, "1234", key),
+		encryptTestString(t, "Server", itemKey),
+		encryptTestString(t, "ssh root@example.com", itemKey),
+		encryptTestString(t, string(itemKeyBytes), key),
+		encryptTestString(t, "Deleted", key),
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identity/connect/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(tokenResponse{AccessToken: "new-access-token", TokenType: "Bearer"})
+	})
+	mux.HandleFunc("/api/sync", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer new-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := newApiClient(server.URL)
+	if _, err := client.sync("expired-access-token"); err != errUnauthorized {
+		t.Fatalf("sync() with expired token error = %v, want %v", err, errUnauthorized)
+	}
+	token, err := client.refreshAccessToken("refresh-token")
+	if err != nil {
+		t.Fatalf("refreshAccessToken() error = %v", err)
+	}
+	sync, err := client.sync(token.AccessToken)
+	if err != nil {
+		t.Fatalf("sync() error = %v", err)
+	}
+
+	items, folders, err := decryptSyncResponse(sync, vaultKeys{user: key})
+	if err != nil {
+		t.Fatalf("decryptSyncResponse() error = %v", err)
+	}
+
+	wantFolders := []Folder{
+		{Object: "folder", Id: "folder-1", Name: "Work"},
+		{Object: "folder", Id: "", Name: "No Folder"},
+	}
+	if !reflect.DeepEqual(folders, wantFolders) {
+		t.Errorf("decryptSyncResponse() folders = %v, want %v", folders, wantFolders)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("decryptSyncResponse() got %d items, want 2", len(items))
+	}
+	login := items[0]
+	if login.Name != "GitHub" || login.Login.Username != "octocat" || !login.Favorite || login.FolderId != "folder-1" {
+		t.Errorf("decryptSyncResponse() login = %+v", login)
+	}
+	if len(login.Login.Uris) != 1 || login.Login.Uris[0].Uri != "https://github.com" {
+		t.Errorf("decryptSyncResponse() uris = %+v", login.Login.Uris)
+	}
+	// secrets are not decrypted for the cache
+	if login.Login.Password == "" || login.Login.Password == "secret-password" {
+		t.Errorf("decryptSyncResponse() password should stay encrypted, got %q", login.Login.Password)
+	}
+	if len(login.Fields) != 1 || login.Fields[0].Name != "pin" || login.Fields[0].Value == "1234" {
+		t.Errorf("decryptSyncResponse() fields = %+v", login.Fields)
+	}
+	note := items[1]
+	if note.Name != "Server" || note.Notes != "ssh root@example.com" {
+		t.Errorf("decryptSyncResponse() note with item key = %+v", note)
+	}
+}
+
+func Test_decryptCipher_withSecrets(t *testing.T) {
+	key := newTestKey(t)
+	cipher := encryptedCipher{
+		Item: Item{
+			Id:   "item-1",
+			Type: 1,
+			Name: encryptTestString(t, "GitHub", key),
+			Login: Login{
+				Password: encryptTestString(t, "secret-password", key),
+				Totp:     encryptTestString(t, "JBSWY3DPEHPK3PXP", key),
+			},
+		},
+	}
+	item, err := decryptCipher(cipher, vaultKeys{user: key}, true)
+	if err != nil {
+		t.Fatalf("decryptCipher() error = %v", err)
+	}
+	if item.Login.Password != "secret-password" || item.Login.Totp != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("decryptCipher() login = %+v", item.Login)
+	}
+
+	if _, err := decryptCipher(cipher, vaultKeys{user: newTestKey(t)}, true); err == nil {
+		t.Errorf("decryptCipher() with wrong key should fail")
+	}
+	cipher.OrganizationId = "org-1"
+	if _, err := decryptCipher(cipher, vaultKeys{user: key}, true); err == nil {
+		t.Errorf("decryptCipher() without organization key should fail")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"time"
+)
+
+// API Types
+
+// encryptedCipher is a cipher as it is returned by /api/sync and as it is
+// stored in the data.json of the Bitwarden CLI. All string values are
+// CipherStrings, the structure is the same as the one of a decrypted Item.
+type encryptedCipher struct {
+	Item
+	Key         string     `json:"key"`
+	DeletedDate *time.Time `json:"deletedDate"`
+}
+
+type syncFolder struct {
+	Id           string    `json:"id"`
+	Name         string    `json:"name"`
+	RevisionDate time.Time `json:"revisionDate"`
+}
+
+type syncCollection struct {
+	Id             string `json:"id"`
+	OrganizationId string `json:"organizationId"`
+	// Name is encrypted with the organization key
+	Name string `json:"name"`
+}
+
+type syncProfile struct {
+	Id            string             `json:"id"`
+	Email         string             `json:"email"`
+	Key           string             `json:"key"`
+	PrivateKey    string             `json:"privateKey"`
+	Organizations []syncOrganization `json:"organizations"`
+}
+
+type syncOrganization struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// Key is the organization key encrypted with the public key of the user
+	Key string `json:"key"`
+}
+
+type globalEquivalentDomains struct {
+	Type     int      `json:"type"`
+	Domains  []string `json:"domains"`
+	Excluded bool     `json:"excluded"`
+}
+
+type syncDomains struct {
+	EquivalentDomains       [][]string                `json:"equivalentDomains"`
+	GlobalEquivalentDomains []globalEquivalentDomains `json:"globalEquivalentDomains"`
+}
+
+type syncResponse struct {
+	Profile     syncProfile       `json:"profile"`
+	Folders     []syncFolder      `json:"folders"`
+	Ciphers     []encryptedCipher `json:"ciphers"`
+	Collections []syncCollection  `json:"collections"`
+	Domains     *syncDomains      `json:"domains"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
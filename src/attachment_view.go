@@ -0,0 +1,338 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+)
+
+const (
+	// ATTACHMENT_VIEWS_NAME is the manifest of the attachments which were opened and aren't removed yet
+	ATTACHMENT_VIEWS_NAME = "attachment-views.json"
+	// ATTACHMENT_VIEWS_JOB removes the opened attachments when they expire
+	ATTACHMENT_VIEWS_JOB = "attachments"
+	// ATTACHMENT_VIEWS_POLL is how often the cleanup job checks the manifest again
+	ATTACHMENT_VIEWS_POLL = 30 * time.Second
+)
+
+// errNoAttachmentsFolder is returned for views outside of the attachments folder, they are never removed
+var errNoAttachmentsFolder = errors.New("not an attachments folder")
+
+// attachmentView is an attachment which was decrypted into its own private folder to open it
+type attachmentView struct {
+	Dir      string    `json:"dir"`
+	FileName string    `json:"fileName"`
+	Expires  time.Time `json:"expires"`
+}
+
+// attachmentViewsDir returns the folder in which the opened attachments are decrypted,
+// only the current user can access it
+func attachmentViewsDir() (string, error) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("%s-attachments", WORKFLOW_NAME))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() || info.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("%s is not a folder", dir)
+	}
+	// fails if the folder was created by another user
+	if err := os.Chmod(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func loadAttachmentViews() []attachmentView {
+	var views []attachmentView
+	if !wf.Data.Exists(ATTACHMENT_VIEWS_NAME) {
+		return views
+	}
+	if err := wf.Data.LoadJSON(ATTACHMENT_VIEWS_NAME, &views); err != nil {
+		log.Printf("Couldn't load the opened attachments, error: %s", err)
+	}
+	return views
+}
+
+func storeAttachmentViews(views []attachmentView) error {
+	if len(views) == 0 {
+		return wf.Data.Store(ATTACHMENT_VIEWS_NAME, nil)
+	}
+	return wf.Data.StoreJSON(ATTACHMENT_VIEWS_NAME, views)
+}
+
+// updateAttachmentViews replaces the views of the manifest with the ones returned by fn.
+// The manifest is locked meanwhile, the cleanup job and the opening of an attachment change it at the same time.
+func updateAttachmentViews(fn func(views []attachmentView) []attachmentView) ([]attachmentView, error) {
+	lock, err := os.OpenFile(filepath.Join(wf.DataDir(), ATTACHMENT_VIEWS_NAME+".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	views := fn(loadAttachmentViews())
+	return views, storeAttachmentViews(views)
+}
+
+// lockAttachmentViewsJob locks the lock file of the cleanup job with the flock operation how.
+// The job holds it until it found no opened attachments while the manifest was locked, so an
+// attachment which is opened afterwards needs a new job.
+func lockAttachmentViewsJob(how int) (*os.File, error) {
+	lock, err := os.OpenFile(filepath.Join(wf.DataDir(), ATTACHMENT_VIEWS_JOB+".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(lock.Fd()), how); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return lock, nil
+}
+
+// shredFile overwrites the file with zeros before it is removed
+func shredFile(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().IsRegular() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		zeros := make([]byte, 64*1024)
+		for written := int64(0); written < info.Size(); {
+			n := int64(len(zeros))
+			if remaining := info.Size() - written; remaining < n {
+				n = remaining
+			}
+			if _, err := f.Write(zeros[:n]); err != nil {
+				f.Close()
+				return err
+			}
+			written += n
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return os.Remove(path)
+}
+
+// removeAttachmentView shreds the files of the view and removes its folder, folders outside
+// of the attachments folder are never touched
+func removeAttachmentView(view attachmentView, base string) error {
+	if filepath.Dir(filepath.Clean(view.Dir)) != base {
+		return fmt.Errorf("%s is %w", view.Dir, errNoAttachmentsFolder)
+	}
+	var shredErr error
+	err := filepath.Walk(view.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			if err := shredFile(path); err != nil {
+				shredErr = err
+			}
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if shredErr != nil {
+		return shredErr
+	}
+	return os.RemoveAll(view.Dir)
+}
+
+// removeExpiredAttachmentViews removes the opened attachments which expired, or all of them,
+// and returns the ones which are kept. Views which couldn't be removed are kept to try again.
+func removeExpiredAttachmentViews(views []attachmentView, base string, all bool) []attachmentView {
+	now := time.Now()
+	var remaining []attachmentView
+	for _, view := range views {
+		if !all && now.Before(view.Expires) {
+			remaining = append(remaining, view)
+			continue
+		}
+		if err := removeAttachmentView(view, base); errors.Is(err, errNoAttachmentsFolder) {
+			log.Printf("Skipping the opened attachment %s, error: %s", view.FileName, err)
+			continue
+		} else if err != nil {
+			log.Printf("Couldn't remove the opened attachment %s, trying again later, error: %s", view.FileName, err)
+			remaining = append(remaining, view)
+			continue
+		}
+		debugLog(fmt.Sprintf("Removed the opened attachment %s.", view.FileName))
+	}
+	return remaining
+}
+
+// cleanupAttachmentViews removes the opened attachments which expired, or all of them,
+// and returns the ones which are kept. done runs while the manifest is still locked if none are left.
+func cleanupAttachmentViews(all bool, done func()) []attachmentView {
+	base, err := attachmentViewsDir()
+	if err != nil {
+		log.Printf("Couldn't access the attachments folder, error: %s", err)
+		return loadAttachmentViews()
+	}
+	remaining, err := updateAttachmentViews(func(views []attachmentView) []attachmentView {
+		remaining := removeExpiredAttachmentViews(views, base, all)
+		if len(remaining) == 0 && done != nil {
+			done()
+		}
+		return remaining
+	})
+	if err != nil {
+		log.Printf("Couldn't update the opened attachments, error: %s", err)
+	}
+	return remaining
+}
+
+// startAttachmentViewsCleanup starts the job which removes the opened attachments when they expire
+func startAttachmentViewsCleanup() {
+	lock, err := lockAttachmentViewsJob(syscall.LOCK_EX | syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		// the running job finds the new attachment in the manifest
+		return
+	} else if err != nil {
+		log.Printf("Couldn't check the cleanup of the opened attachments, error: %s", err)
+	} else {
+		lock.Close()
+	}
+	// a job which released its lock is about to exit
+	for i := 0; wf.IsRunning(ATTACHMENT_VIEWS_JOB) && i < 20; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	cmd := exec.Command(os.Args[0], "-cleanattachments")
+	if err := wf.RunInBackground(ATTACHMENT_VIEWS_JOB, cmd); err != nil {
+		log.Printf("Couldn't start the cleanup of the opened attachments, error: %s", err)
+	}
+}
+
+// addOpenAttachmentModifier lets cmd open the attachment, it is removed again after ATTACHMENT_VIEW_AGE
+func addOpenAttachmentModifier(it *aw.Item, item Item, att Attachments) {
+	it.NewModifier(aw.ModCmd).
+		Subtitle(fmt.Sprintf("Open %s, it's removed after %.0f minutes", att.FileName, conf.AttachmentViewMaxAge.Minutes())).
+		Arg(" ").
+		Var("action", "-openattachment").
+		Var("action2", fmt.Sprintf("-id %s", item.Id)).
+		Var("action3", fmt.Sprintf("-attachment %s", att.Id)).
+		Var("notification", fmt.Sprintf("Opening %s", att.FileName))
+}
+
+// runOpenAttachment decrypts the attachment of item id into a private folder and opens it,
+// the file is tracked so it can be removed when it expires or the vault is locked
+func runOpenAttachment() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	if opts.Id == "" || opts.Attachment == "" {
+		wf.Fatal("No id or attachment sent.")
+		return
+	}
+	cleanupAttachmentViews(false, nil)
+
+	base, err := attachmentViewsDir()
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	dir, err := os.MkdirTemp(base, "view-")
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	// the trailing separator saves the file with its name in the folder
+	args := []string{conf.BwExec, "get", "attachment", opts.Attachment, "--itemid", opts.Id, "--output", dir + string(os.PathSeparator), "--session", token, "--raw"}
+	if _, err := runCmdArgs(args, "Failed to get the attachment."); err != nil {
+		os.RemoveAll(dir)
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || entries[0].IsDir() {
+		os.RemoveAll(dir)
+		wf.Fatal("The attachment wasn't saved.")
+		return
+	}
+	path := filepath.Join(dir, entries[0].Name())
+	if err := os.Chmod(path, 0600); err != nil {
+		log.Println(err)
+	}
+
+	view := attachmentView{Dir: dir, FileName: entries[0].Name(), Expires: time.Now().Add(conf.AttachmentViewMaxAge)}
+	if _, err := updateAttachmentViews(func(views []attachmentView) []attachmentView {
+		return append(views, view)
+	}); err != nil {
+		// without the manifest nobody would remove it
+		os.RemoveAll(dir)
+		wf.FatalError(err)
+		return
+	}
+	startAttachmentViewsCleanup()
+
+	if out, err := exec.Command("open", path).CombinedOutput(); err != nil {
+		log.Printf("Error is:\n%s", out)
+		wf.FatalError(fmt.Errorf("couldn't open %s, %s", entries[0].Name(), strings.TrimSpace(fmt.Sprintf("%s %s", err, out))))
+		return
+	}
+	fmt.Printf("Opened %s, it's removed after %.0f minutes.", entries[0].Name(), conf.AttachmentViewMaxAge.Minutes())
+}
+
+// runCleanAttachments removes the opened attachments when they expire, it runs until all are removed.
+// With -force all opened attachments are removed at once.
+func runCleanAttachments() {
+	wf.Configure(aw.TextErrors(true))
+	lock, err := lockAttachmentViewsJob(syscall.LOCK_EX | syscall.LOCK_NB)
+	if err != nil {
+		// the job which holds the lock removes the ones which aren't expired yet
+		debugLog(fmt.Sprintf("The cleanup job is locked, error: %s", err))
+		cleanupAttachmentViews(opts.Force, nil)
+		return
+	}
+	defer lock.Close()
+	// an attachment which is opened after the manifest was found empty starts a new job
+	stopped := func() {
+		syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+	}
+	for {
+		remaining := cleanupAttachmentViews(opts.Force, stopped)
+		if len(remaining) == 0 {
+			return
+		}
+		wait := ATTACHMENT_VIEWS_POLL
+		for _, view := range remaining {
+			// the views which couldn't be removed are tried again after the poll interval
+			if until := time.Until(view.Expires); until > 0 && until < wait {
+				wait = until
+			}
+		}
+		time.Sleep(wait + time.Second)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_shredFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "passport.pdf")
+	if err := os.WriteFile(file, []byte(strings.Repeat("secret", 20000)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// a hard link keeps the inode, it shows that the content was overwritten
+	link := filepath.Join(dir, "link")
+	if err := os.Link(file, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := shredFile(file); err != nil {
+		t.Fatalf("shredFile() error = %v", err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("file still exists, %v", err)
+	}
+	data, err := os.ReadFile(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 120000 || strings.Trim(string(data), "\x00") != "" {
+		t.Errorf("content wasn't overwritten, %d bytes", len(data))
+	}
+}
+
+func Test_removeAttachmentView(t *testing.T) {
+	base := t.TempDir()
+	other := t.TempDir()
+	for _, dir := range []string{filepath.Join(base, "view-1"), filepath.Join(other, "view-2")} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "scan.pdf"), []byte("scan"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		wantErr bool
+		removed bool
+	}{
+		{name: "attachments folder", dir: filepath.Join(base, "view-1"), removed: true},
+		{name: "already removed", dir: filepath.Join(base, "view-3"), removed: true},
+		{name: "outside of the attachments folder", dir: filepath.Join(other, "view-2"), wantErr: true},
+		{name: "the attachments folder itself", dir: base, wantErr: true},
+		{name: "relative path", dir: filepath.Join(base, "view-1", "..", "..", filepath.Base(other), "view-2"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := removeAttachmentView(attachmentView{Dir: tt.dir, FileName: "scan.pdf"}, base)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("removeAttachmentView() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			_, err = os.Stat(tt.dir)
+			if removed := os.IsNotExist(err); removed != tt.removed {
+				t.Errorf("removed = %v, want %v", removed, tt.removed)
+			}
+		})
+	}
+}
+
+func Test_removeExpiredAttachmentViews(t *testing.T) {
+	base := t.TempDir()
+	view := func(name string, expires time.Duration) attachmentView {
+		return attachmentView{Dir: filepath.Join(base, name), FileName: name, Expires: time.Now().Add(expires)}
+	}
+	for _, name := range []string{"expired", "open"} {
+		if err := os.Mkdir(filepath.Join(base, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expired := view("expired", -time.Minute)
+	open := view("open", time.Minute)
+	// the name is too long for the file system, it can't be removed
+	failing := view(strings.Repeat("x", 300), -time.Minute)
+	outside := attachmentView{Dir: t.TempDir(), FileName: "outside", Expires: time.Now().Add(-time.Minute)}
+
+	tests := []struct {
+		name string
+		all  bool
+		want []string
+	}{
+		{name: "expired", want: []string{"open", failing.FileName}},
+		{name: "all", all: true, want: []string{failing.FileName}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range removeExpiredAttachmentViews([]attachmentView{expired, open, failing, outside}, base, tt.all) {
+				got = append(got, v.FileName)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("removeExpiredAttachmentViews() kept %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := os.Stat(outside.Dir); err != nil {
+		t.Errorf("the folder outside of the attachments folder was removed, %v", err)
+	}
+}
+
+func Test_updateAttachmentViews(t *testing.T) {
+	t.Cleanup(func() {
+		if err := storeAttachmentViews(nil); err != nil {
+			t.Error(err)
+		}
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := updateAttachmentViews(func(views []attachmentView) []attachmentView {
+				// like the shredding of the cleanup, the others have to wait meanwhile
+				time.Sleep(time.Millisecond)
+				return append(views, attachmentView{FileName: fmt.Sprintf("file-%d", i)})
+			}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if views := loadAttachmentViews(); len(views) != 20 {
+		t.Errorf("updateAttachmentViews() lost updates, %d views", len(views))
+	}
+}
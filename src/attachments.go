@@ -0,0 +1,227 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/jychri/tilde"
+)
+
+const (
+	// ATTACHMENT_MAX_SIZE is the largest file Bitwarden accepts as attachment
+	ATTACHMENT_MAX_SIZE = 500 * 1024 * 1024
+	// ATTACHMENT_FILE_ENV is set by the file action to the path of the file which is attached
+	ATTACHMENT_FILE_ENV = "attachment_file"
+)
+
+// formatFileSize returns the size like Bitwarden shows it as sizeName of an attachment
+func formatFileSize(size int64) string {
+	units := []string{"Bytes", "KB", "MB", "GB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%s %s", strconv.FormatFloat(math.Round(value*10)/10, 'f', -1, 64), units[unit])
+}
+
+// attachmentFile returns the absolute path of the file and an error if Bitwarden can't attach it
+func attachmentFile(path string) (string, os.FileInfo, error) {
+	// paths which aren't absolute are relative to the home folder
+	path = tilde.Abs(strings.TrimSpace(path))
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return path, nil, fmt.Errorf("%s doesn't exist", path)
+	} else if err != nil {
+		return path, nil, err
+	}
+	if info.IsDir() {
+		return path, info, fmt.Errorf("%s is a folder, only files can be attached", filepath.Base(path))
+	}
+	if info.Size() > ATTACHMENT_MAX_SIZE {
+		return path, info, fmt.Errorf("%s has %s, attachments can have up to %s", filepath.Base(path), formatFileSize(info.Size()), formatFileSize(ATTACHMENT_MAX_SIZE))
+	}
+	return path, info, nil
+}
+
+// addAttachFileItem asks for the path of a file which is attached to the item
+func addAttachFileItem(item Item) {
+	wf.NewItem("Attach a File…").
+		Subtitle(fmt.Sprintf("Upload a file to %s, the path is typed next", item.Name)).
+		Valid(true).
+		Icon(iconPaperClip).
+		Arg("").
+		Var("action", "-attach").
+		Var("action2", fmt.Sprintf("-id %s", item.Id)).
+		Var("action3", " ").
+		Var("title", fmt.Sprintf("Attach a file to %s", item.Name))
+}
+
+// addDeleteAttachmentModifier lets alt delete the attachment after a confirmation
+func addDeleteAttachmentModifier(it *aw.Item, item Item, att Attachments) {
+	it.NewModifier(aw.ModOpt).
+		Subtitle(fmt.Sprintf("Delete attachment %s permanently", att.FileName)).
+		Arg("").
+		Var("action", "-confirmdelete").
+		Var("action2", fmt.Sprintf("-id %s", item.Id)).
+		Var("action3", fmt.Sprintf("-attachment %s", att.Id)).
+		Var("name", att.FileName).
+		Var("title", "Delete attachment permanently?")
+}
+
+// addAttachErrorItem shows why the file can't be attached
+func addAttachErrorItem(path string, err error) {
+	wf.NewItem(fmt.Sprintf("Can't attach %s", filepath.Base(path))).
+		Subtitle(err.Error()).
+		Icon(iconWarning).
+		Valid(false)
+}
+
+// addAttachItem adds the item which uploads the file at path to item
+func addAttachItem(path string, info os.FileInfo, item Item) {
+	wf.NewItem(fmt.Sprintf("Attach %s to %s", info.Name(), item.Name)).
+		Subtitle(fmt.Sprintf("%s ∙ ⏎ upload the file", formatFileSize(info.Size()))).
+		Match(item.Name).
+		Icon(iconPaperClip).
+		Arg(base64.StdEncoding.EncodeToString([]byte(path))).
+		Var("action", "-attachfile").
+		Var("action2", fmt.Sprintf("-id %s", item.Id)).
+		Var("action3", " ").
+		Var("notification", fmt.Sprintf("Uploading %s", info.Name())).
+		Valid(true)
+}
+
+// runAttach shows the file typed in Alfred which is attached to item id
+func runAttach() {
+	wf.Configure(aw.SuppressUIDs(true))
+	if _, ok := unlockedToken(); !ok {
+		return
+	}
+	item, ok := cachedItem(opts.Id)
+	if !ok {
+		wf.Fatal(fmt.Sprintf("Item %s not found, sync the vault.", opts.Id))
+		return
+	}
+	path := strings.Join(cli.Args(), " ")
+	if strings.TrimSpace(path) == "" {
+		wf.NewItem("Type the path of the file").
+			Subtitle(fmt.Sprintf("Attachments can have up to %s", formatFileSize(ATTACHMENT_MAX_SIZE))).
+			Icon(iconPaperClip).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+	if path, info, err := attachmentFile(path); err != nil {
+		addAttachErrorItem(path, err)
+	} else {
+		addAttachItem(path, info, item)
+	}
+	wf.SendFeedback()
+}
+
+// runAttachTo shows the items the file of the file action can be attached to, filtered by the query
+func runAttachTo() {
+	wf.Configure(aw.SuppressUIDs(true))
+	if _, ok := unlockedToken(); !ok {
+		return
+	}
+	path, info, err := attachmentFile(os.Getenv(ATTACHMENT_FILE_ENV))
+	if err != nil {
+		addAttachErrorItem(path, err)
+		wf.SendFeedback()
+		return
+	}
+	items, err := loadCacheItems()
+	if err != nil {
+		log.Printf("Couldn't load the items cache, error: %s", err)
+	}
+	sortItems(items, loadUsageStats())
+	for _, item := range items {
+		addAttachItem(path, info, item)
+	}
+	if query := strings.TrimSpace(strings.Join(cli.Args(), " ")); query != "" {
+		wf.Filter(query)
+	}
+	wf.WarnEmpty("No Items Found", "Try a different query or sync manually")
+	wf.SendFeedback()
+}
+
+// runAttachFile uploads the file with the base64 encoded path to item id and updates the item in the cache
+func runAttachFile() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+	decoded, err := base64.StdEncoding.DecodeString(cli.Arg(0))
+	if err != nil {
+		wf.Fatal("Invalid file sent.")
+		return
+	}
+	path, _, err := attachmentFile(string(decoded))
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+
+	// the path is passed as one argument, it can contain spaces
+	args := []string{conf.BwExec, "create", "attachment", "--file", path, "--itemid", opts.Id, "--session", token}
+	result, err := runCmdArgs(args, "Failed to attach the file.")
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	var item Item
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &item); err != nil {
+		wf.FatalError(fmt.Errorf("invalid response of bw create attachment, %s", err))
+		return
+	}
+	if err := storeCacheItem(item); err != nil {
+		log.Printf("Error updating the item in the cache: %s", err)
+		fmt.Printf("Attached %s to %s. It shows up after the next sync.", filepath.Base(path), item.Name)
+		return
+	}
+	fmt.Printf("Attached %s to %s.", filepath.Base(path), item.Name)
+}
+
+// runDeleteAttachment deletes the attachment of item id and removes it from the item in the cache
+func runDeleteAttachment() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	if opts.Id == "" || opts.Attachment == "" {
+		wf.Fatal("No id or attachment sent.")
+		return
+	}
+	name := strings.TrimSpace(os.Getenv("name"))
+	if name == "" {
+		name = opts.Attachment
+	}
+	args := fmt.Sprintf("%s delete attachment %s --itemid %s --session %s", conf.BwExec, opts.Attachment, opts.Id, token)
+	if _, err := runCmd(args, "Failed to delete the attachment."); err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	if err := deleteCacheAttachment(opts.Id, opts.Attachment); err != nil {
+		log.Printf("Error removing the attachment from the cache: %s", err)
+	}
+	fmt.Printf("Deleted attachment %s.", name)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_formatFileSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{size: 0, want: "0 Bytes"},
+		{size: 12, want: "12 Bytes"},
+		{size: 1536, want: "1.5 KB"},
+		{size: 10 * 1024 * 1024, want: "10 MB"},
+		{size: ATTACHMENT_MAX_SIZE, want: "500 MB"},
+		{size: 3 * 1024 * 1024 * 1024, want: "3 GB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := formatFileSize(tt.size); got != tt.want {
+				t.Errorf("formatFileSize(%d) = %q, want %q", tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_attachmentFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "my contract.pdf")
+	if err := os.WriteFile(file, []byte("contract"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	big := filepath.Join(dir, "big.bin")
+	if err := os.WriteFile(big, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// sparse, it doesn't take up the space
+	if err := os.Truncate(big, ATTACHMENT_MAX_SIZE+1); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{name: "file", path: file},
+		{name: "surrounding spaces", path: " " + file + " "},
+		{name: "missing file", path: filepath.Join(dir, "missing.pdf"), wantErr: "doesn't exist"},
+		{name: "folder", path: dir, wantErr: "is a folder"},
+		{name: "too large", path: big, wantErr: "big.bin has 500 MB, attachments can have up to 500 MB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, info, err := attachmentFile(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("attachmentFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("attachmentFile() error = %v", err)
+			}
+			if path != file || info.Size() != 8 {
+				t.Errorf("attachmentFile() = %q, %d bytes", path, info.Size())
+			}
+		})
+	}
+}
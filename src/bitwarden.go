@@ -5,6 +5,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -24,6 +25,8 @@ const (
 	NOT_UNLOCKED_MSG  = "Not unlocked. Need to unlock first."
 )
 
+var errNotUnlocked = errors.New(NOT_UNLOCKED_MSG)
+
 // Scan for projects and cache results
 func runSync(force bool, last bool) {
 
@@ -56,7 +59,7 @@ func runSync(force bool, last bool) {
 		return
 
 	} else {
-		token, err := alfred.GetToken(wf)
+		token, err := alfred.GetToken(secrets)
 		if err != nil {
 			wf.Fatal("Get Token error")
 		}
@@ -86,21 +89,24 @@ func runSync(force bool, last bool) {
 			return
 		}
 
-		_, err = runCmd(args, message)
-		if err != nil {
-			wf.FatalError(err)
+		// the API sync mode gets the items from the server itself
+		if conf.SyncMode != SYNC_MODE_API {
+			_, err = runCmd(args, message)
+			if err != nil {
+				wf.FatalError(err)
+			}
 		}
-		// Printing the "Last sync date" or the message "synced"
-		fmt.Println(output)
-
 		// Writing the sync-cache to ensure that the sync completed
-		err = wf.Cache.Store(SYNC_CACHE_NAME, []byte("sync-cache"))
+		err = wf.Cache.Store(cacheName(SYNC_CACHE_NAME), []byte("sync-cache"))
 		if err != nil {
 			log.Println(err)
 		}
 
-		// Creating the items cache
-		runCache()
+		// Updating the items cache
+		changes := runCache()
+
+		// Printing the message "synced" with the changes of the items
+		fmt.Printf("%s %s\n", output, changes)
 
 		// If we ran the sync via the daemon
 		// don't open the search
@@ -116,10 +122,36 @@ func runSync(force bool, last bool) {
 func runLock() {
 	wf.Configure(aw.TextErrors(true))
 
-	err := alfred.RemoveToken(wf)
+	// the opened attachments are readable without unlocking the vault
+	cleanupAttachmentViews(true, nil)
+
+	// the auto lock locks every account
+	if opts.AllAccounts {
+		var lockErr error
+		forEachAccount(func(acc Account) {
+			if err := lockAccount(); err != nil {
+				lockErr = err
+			}
+		})
+		if lockErr != nil {
+			wf.FatalError(lockErr)
+		}
+		fmt.Println("Locked")
+		return
+	}
+
+	if err := lockAccount(); err != nil {
+		wf.FatalError(err)
+	}
+	fmt.Println("Locked")
+}
+
+func lockAccount() error {
+	err := alfred.RemoveToken(secrets)
 	if err != nil {
 		log.Println(err)
 	}
+	removeProtectedKey()
 
 	message := "Locking Bitwarden failed."
 	err = clearCache()
@@ -129,25 +161,70 @@ func runLock() {
 
 	args := fmt.Sprintf("%s lock", conf.BwExec)
 	_, err = runCmd(args, message)
+	return err
+}
+
+// sessionToken returns the session token if the vault is unlocked, errNotUnlocked otherwise
+func sessionToken() (string, error) {
+	if bwData.UserId == "" || bwData.ProtectedKey == "" {
+		return "", errNotUnlocked
+	}
+	token, err := alfred.GetToken(secrets)
 	if err != nil {
-		wf.FatalError(err)
+		debugLog(fmt.Sprintf("Get Token error: %s", err))
+		return "", errNotUnlocked
 	}
-	fmt.Println("Locked")
+	return token, nil
+}
+
+// actionToken returns the session token for the actions which run as script
+func actionToken() (string, bool) {
+	wf.Configure(aw.TextErrors(true))
+	token, err := sessionToken()
+	if err != nil {
+		wf.Fatal(NOT_UNLOCKED_MSG)
+		return "", false
+	}
+	return token, true
 }
 
-func getItems() {
+func getItems() cacheChanges {
 	wf.Configure(aw.TextErrors(true))
-	token, err := alfred.GetToken(wf)
+	token, err := alfred.GetToken(secrets)
 	if err != nil {
 		wf.Fatal("Get Token error")
 	}
 
-	items := runGetItems(token)
-	folders := runGetFolders(token)
+	var items []Item
+	var folders []Folder
+	switch conf.SyncMode {
+	case SYNC_MODE_API:
+		items, folders, err = runGetItemsApi(token)
+		if err != nil {
+			log.Printf("Failed to get items via the API, falling back to the Bitwarden CLI. Err: %s", err)
+		}
+	case SYNC_MODE_LOCAL:
+		items, folders, err = runGetItemsLocal(token)
+		if err != nil {
+			log.Printf("Failed to decrypt the items of the data.json, falling back to the Bitwarden CLI. Err: %s", err)
+		}
+	}
+	if (conf.SyncMode != SYNC_MODE_API && conf.SyncMode != SYNC_MODE_LOCAL) || err != nil {
+		items = runGetItems(token)
+		folders = runGetFolders(token)
+		populateCacheCollections(runGetCollections(token))
+	}
+	if conf.SyncMode != SYNC_MODE_API || err != nil {
+		// the equivalent domains are read from the data.json of the Bitwarden CLI then
+		if err := wf.Cache.Store(cacheName(DOMAINS_CACHE_NAME), nil); err != nil {
+			log.Println(err)
+		}
+	}
 
 	// prepare cached struct which excludes all secret data
-	populateCacheItems(items)
+	changes := populateCacheItems(items)
 	populateCacheFolders(folders)
+	return changes
 }
 
 // runGetItems uses the Bitwarden CLI to get all items and returns them to the calling function
@@ -210,9 +287,9 @@ func runGetItem(quiet ...bool) string {
 		return ""
 	}
 
-	// get the token from keychain
+	// get the token from the secret store
 	wf.Configure(aw.TextErrors(true))
-	token, err := alfred.GetToken(wf)
+	token, err := alfred.GetToken(secrets)
 	if err != nil {
 		wf.Fatal("Get Token error")
 		return ""
@@ -224,12 +301,7 @@ func runGetItem(quiet ...bool) string {
 	// handle attachments later, via Bitwarden CLI
 	// this decrypts the secrets in the data.json
 	if bwData.UserId != "" && (attachment == "") {
-		sourceKey, err := MakeDecryptKeyFromSession(bwData.ProtectedKey, token)
-		if err != nil {
-			log.Printf("Error making source key is:\n%s", err)
-			isDecryptSecretFromJsonFailed = true
-		}
-
+		var sourceKey CryptoKey
 		encryptedSecret := ""
 		if bwData.path != "" {
 			data, err := os.ReadFile(bwData.path)
@@ -237,6 +309,11 @@ func runGetItem(quiet ...bool) string {
 				log.Print("Error reading file ", bwData.path)
 				isDecryptSecretFromJsonFailed = true
 			}
+			keys, err := loadVaultKeys(data, token)
+			if err != nil {
+				log.Printf("Error making source key is:\n%s", err)
+				isDecryptSecretFromJsonFailed = true
+			}
 			// replace starting bracket with dot as gsub uses a dot for the first group in an array
 			gjsonPath := jsonPath
 			gjsonPath = strings.Replace(gjsonPath, "[", ".", -1)
@@ -245,19 +322,30 @@ func runGetItem(quiet ...bool) string {
 				gjsonPath = "login.totp"
 			}
 
-			var value gjson.Result
+			var cipherValue gjson.Result
 			if bwData.ActiveUserId != "" {
 				// different location for version 1.21.1 and above
-				value = gjson.Get(string(data), fmt.Sprintf("%s.data.ciphers.encrypted.%s.%s", bwData.UserId, id, gjsonPath))
+				cipherValue = gjson.Get(string(data), fmt.Sprintf("%s.data.ciphers.encrypted.%s", bwData.UserId, id))
 			} else {
-				value = gjson.Get(string(data), fmt.Sprintf("ciphers_%s.%s.%s", bwData.UserId, id, gjsonPath))
+				cipherValue = gjson.Get(string(data), fmt.Sprintf("ciphers_%s.%s", bwData.UserId, id))
 			}
+			value := cipherValue.Get(gjsonPath)
 			if value.Exists() {
 				encryptedSecret = value.String()
 			} else {
 				log.Print("Error, value for gjson not found.")
 				isDecryptSecretFromJsonFailed = true
 			}
+
+			// items of organizations and items with their own key are not encrypted with the user key
+			var cipher encryptedCipher
+			if err := json.Unmarshal([]byte(cipherValue.Raw), &cipher); err == nil {
+				sourceKey, err = keys.cipherKey(cipher)
+				if err != nil {
+					log.Printf("Error getting the key of the item:\n%s", err)
+					isDecryptSecretFromJsonFailed = true
+				}
+			}
 		}
 
 		decryptedString, err := DecryptString(encryptedSecret, sourceKey)
@@ -266,7 +354,12 @@ func runGetItem(quiet ...bool) string {
 			isDecryptSecretFromJsonFailed = true
 		}
 		if totp {
-			decryptedString, err = otpKey(decryptedString)
+			decryptedString, err = otpCode(id, token, "login.totp", decryptedString)
+			// the Bitwarden CLI would return a TOTP of the HOTP key
+			if errors.Is(err, errOtpCounter) {
+				wf.FatalError(err)
+				return ""
+			}
 			if err != nil {
 				log.Print("Error getting totp key, ", err)
 				isDecryptSecretFromJsonFailed = true
@@ -328,12 +421,16 @@ func runGetItem(quiet ...bool) string {
 	}
 	if len(quiet) == 0 {
 		fmt.Print(receivedItem)
+		if attachment == "" && receivedItem != "" {
+			recordUsage(id, usageAction(jsonPath, totp))
+		}
 	}
 	return receivedItem
 }
 
 func runGetTotp() {
 	secret := ""
+	jsonPath := opts.Query
 	if opts.Query == "" {
 		wf.Configure(aw.TextErrors(true))
 
@@ -352,7 +449,7 @@ func runGetTotp() {
 		}
 
 		wf.Configure(aw.TextErrors(true))
-		token, err := alfred.GetToken(wf)
+		token, err := alfred.GetToken(secrets)
 		if err != nil {
 			wf.Fatal("Get Token error")
 			return
@@ -376,19 +473,19 @@ func runGetTotp() {
 		if err != nil {
 			log.Println(err)
 		}
+		// items without custom fields don't have the fields key, the totp is then received via the Bitwarden CLI
 		fieldsInterface, err := jsonpath.JsonPathLookup(item, "$.fields")
 		if err != nil {
 			log.Println(err)
-			return
 		}
 
 		fields, ok := fieldsInterface.([]interface{})
-		if !ok {
+		if !ok && fieldsInterface != nil {
 			log.Println("fields is not an array")
 			return
 		}
 
-		for _, fieldInterface := range fields {
+		for i, fieldInterface := range fields {
 			field, ok := fieldInterface.(map[string]interface{})
 			if !ok {
 				continue
@@ -396,6 +493,7 @@ func runGetTotp() {
 
 			if field["name"] == "TOTP" {
 				secret = field["value"].(string)
+				jsonPath = fmt.Sprintf("fields[%d].value", i)
 			}
 		}
 		if secret == "" {
@@ -410,16 +508,28 @@ func runGetTotp() {
 			}
 			if len(result) > 0 {
 				fmt.Print(strings.TrimSpace(strings.Join(result, " ")))
+				recordUsage(id, "totp")
 			}
 			return
 		}
 	} else {
 		secret = runGetItem(true)
 	}
-	if totp, err := otpKey(secret); err != nil {
+	if secret == "" {
+		return
+	}
+	token, err := alfred.GetToken(secrets)
+	if err != nil {
+		wf.Fatal("Get Token error")
+		return
+	}
+	if totp, err := otpCode(opts.Id, token, jsonPath, secret); errors.Is(err, errOtpCounter) {
+		wf.FatalError(err)
+	} else if err != nil {
 		log.Print("Error getting totp key, ", err)
 	} else {
 		fmt.Print(totp)
+		recordUsage(opts.Id, "totp")
 	}
 }
 
@@ -464,26 +574,41 @@ func runUnlock() {
 		wf.Fatal("No Password returned.")
 	}
 
-	os.Setenv("PASS", pw)
-
-	// Unlock Bitwarden now
-	message := "Unlocking Bitwarden failed."
-	args := fmt.Sprintf("%s unlock --raw --passwordenv PASS", conf.BwExec)
-	debugLog(fmt.Sprintf("bw unlock command is %s", args))
-	tokenReturn, err := runCmd(args, message)
-	os.Unsetenv("PASS")
-	if err != nil {
-		wf.FatalError(err)
+	token := ""
+	if conf.NativeUnlock {
+		var err error
+		token, err = runNativeUnlock(pw)
+		if errors.Is(err, errWrongPassword) {
+			wf.Fatal("Unlocking Bitwarden failed. Invalid master password.")
+		}
+		if err != nil {
+			log.Printf("Failed to unlock without the Bitwarden CLI, falling back to the Bitwarden CLI. Err: %s", err)
+		}
 	}
 
-	// set the password from the returned slice
-	token := ""
-	if len(tokenReturn) > 0 {
-		token = tokenReturn[0]
-	} else {
-		wf.Fatal("No token returned after unlocking.")
+	if token == "" {
+		os.Setenv("PASS", pw)
+
+		// Unlock Bitwarden now
+		message := "Unlocking Bitwarden failed."
+		args := fmt.Sprintf("%s unlock --raw --passwordenv PASS", conf.BwExec)
+		debugLog(fmt.Sprintf("bw unlock command is %s", args))
+		tokenReturn, err := runCmd(args, message)
+		os.Unsetenv("PASS")
+		if err != nil {
+			wf.FatalError(err)
+		}
+
+		// set the password from the returned slice
+		if len(tokenReturn) > 0 {
+			token = tokenReturn[0]
+		} else {
+			wf.Fatal("No token returned after unlocking.")
+		}
+		// the data.json holds the protected key of this session
+		removeProtectedKey()
 	}
-	err = alfred.SetToken(wf, token)
+	err := alfred.SetToken(secrets, token)
 	if err != nil {
 		log.Println(err)
 	}
@@ -491,14 +616,14 @@ func runUnlock() {
 	if conf.UseApikey {
 		// Writing the sync-cache because we have unlocked the vault in apikey mode
 		// Items should be present
-		err = wf.Cache.Store(SYNC_CACHE_NAME, []byte("sync-cache"))
+		err = wf.Cache.Store(cacheName(SYNC_CACHE_NAME), []byte("sync-cache"))
 		if err != nil {
 			log.Println(err)
 		}
 	}
 
 	// Creating the items cache
-	if wf.Cache.Exists(SYNC_CACHE_NAME) {
+	if wf.Cache.Exists(cacheName(SYNC_CACHE_NAME)) {
 		runCache()
 		searchAlfred(conf.BwKeyword)
 	}
@@ -614,14 +739,14 @@ func runLogin() {
 	} else {
 		wf.Fatal("No token returned after unlocking.")
 	}
-	err = alfred.SetToken(wf, token)
+	err = alfred.SetToken(secrets, token)
 	if err != nil {
 		log.Println(err)
 	}
 
 	// Writing the sync-cache because data is synced for Yubikey and Authenticator login
 	// Just the APIKEY login needs a separate unlock and therefore sync
-	err = wf.Cache.Store(SYNC_CACHE_NAME, []byte("sync-cache"))
+	err = wf.Cache.Store(cacheName(SYNC_CACHE_NAME), []byte("sync-cache"))
 	if err != nil {
 		log.Println(err)
 	}
@@ -636,15 +761,26 @@ func runLogin() {
 // Logout from Bitwarden
 func runLogout() {
 	wf.Configure(aw.TextErrors(true))
+	cleanupAttachmentViews(true, nil)
 
-	err := alfred.RemoveToken(wf)
+	err := alfred.RemoveToken(secrets)
 	if err != nil {
 		log.Println(err)
 	}
+	removeApiTokens()
+	removeProtectedKey()
 
 	args := fmt.Sprintf("%s logout", conf.BwExec)
 
-	err = wf.ClearCache()
+	// keep the caches of the other accounts
+	if activeAccount.Name != "" {
+		err = clearCache()
+		if err == nil {
+			err = wf.Cache.Store(cacheName(SYNC_CACHE_NAME), nil)
+		}
+	} else {
+		err = wf.ClearCache()
+	}
 	if err != nil {
 		log.Println(err)
 	}
@@ -656,12 +792,8 @@ func runLogout() {
 	fmt.Println("Logged Out")
 }
 
-func runCache() {
-	err := clearCache()
-	if err != nil {
-		log.Print("Error while deleting Caches ", err)
-	}
-
+// runCache updates the caches, the existing caches are kept until the new ones are ready
+func runCache() cacheChanges {
 	wf.Configure(aw.TextErrors(true))
 	email := conf.Email
 	if email == "" {
@@ -669,5 +801,5 @@ func runCache() {
 		wf.Fatal("No email configured.")
 	}
 
-	getItems()
+	return getItems()
 }
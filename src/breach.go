@@ -0,0 +1,395 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+)
+
+const (
+	// BREACH_CACHE_NAME is the cache of the breach check, it is encrypted like the items cache
+	BREACH_CACHE_NAME = "bw-items-breaches"
+	// BREACH_PROGRESS_NAME is the progress of the running breach check, or the error it failed with
+	BREACH_PROGRESS_NAME = "bw-items-breaches-progress"
+	// BREACH_JOB checks the passwords in the background
+	BREACH_JOB = "breach-check"
+	// BREACH_CONCURRENCY is the number of range requests which are made at the same time
+	BREACH_CONCURRENCY = 4
+	// BREACH_FORCED_VAR is passed to the reruns of the script filter, the forced check is only started once
+	BREACH_FORCED_VAR = "breach_forced"
+)
+
+// breachProgress is written by the breach check job, the script filter shows it while the job runs
+type breachProgress struct {
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+	Error string `json:"error,omitempty"`
+}
+
+// breachResult is the number of breaches a password of a login was found in. The hash is
+// kept to notice a changed password, it is only stored in the encrypted cache.
+type breachResult struct {
+	ItemId string `json:"itemId"`
+	Name   string `json:"name"`
+	Hash   string `json:"hash"`
+	Count  int    `json:"count"`
+}
+
+// breachClient queries a Have I Been Pwned compatible range API. Only the first five
+// characters of the SHA-1 hash of a password are sent (k-anonymity), the matching suffix
+// is searched in the response.
+type breachClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func newBreachClient(baseURL string) *breachClient {
+	return &breachClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// passwordHash returns the upper case SHA-1 hex of the password like the range API uses it
+func passwordHash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// rangeCounts returns the breach counts of the hash suffixes with the prefix
+func (c *breachClient) rangeCounts(prefix string) (map[string]int, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/range/%s", c.baseURL, prefix), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", WORKFLOW_NAME)
+	// padded responses hide how many suffixes exist for the prefix, padding has a count of 0
+	req.Header.Set("Add-Padding", "true")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("range request failed with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return parseRangeResponse(resp.Body)
+}
+
+// parseRangeResponse parses the "SUFFIX:COUNT" lines of a range response
+func parseRangeResponse(r io.Reader) (map[string]int, error) {
+	counts := map[string]int{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		suffix, count, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid line in range response: %q", line)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil {
+			return nil, fmt.Errorf("invalid count in range response: %q", line)
+		}
+		counts[strings.ToUpper(suffix)] = n
+	}
+	return counts, scanner.Err()
+}
+
+// cachedBreachResults returns the breach results of the logins with a password. Results of the
+// cache are reused if the password didn't change, the others are returned by hash prefix to request them.
+func cachedBreachResults(items []Item, cached []breachResult) ([]breachResult, map[string][]int) {
+	known := map[string]breachResult{}
+	for _, result := range cached {
+		known[result.ItemId+":"+result.Hash] = result
+	}
+	results := []breachResult{}
+	pending := map[string][]int{}
+	for _, item := range items {
+		if item.Type != 1 || item.Login.Password == "" {
+			continue
+		}
+		hash := passwordHash(item.Login.Password)
+		if result, ok := known[item.Id+":"+hash]; ok {
+			result.Name = item.Name
+			results = append(results, result)
+			continue
+		}
+		pending[hash[:5]] = append(pending[hash[:5]], len(results))
+		results = append(results, breachResult{ItemId: item.Id, Name: item.Name, Hash: hash})
+	}
+	return results, pending
+}
+
+// checkBreaches returns the breach results of the logins with a password. Each hash prefix which
+// isn't cached is only requested once, up to BREACH_CONCURRENCY at the same time. progress gets
+// the number of finished requests.
+func checkBreaches(client *breachClient, items []Item, cached []breachResult, progress func(done int, total int)) ([]breachResult, error) {
+	results, pending := cachedBreachResults(items, cached)
+	prefixes := make([]string, 0, len(pending))
+	for prefix := range pending {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	counts := make([]map[string]int, len(prefixes))
+	errs := make([]error, len(prefixes))
+	limit := make(chan struct{}, BREACH_CONCURRENCY)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	for i, prefix := range prefixes {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(i int, prefix string) {
+			defer wg.Done()
+			counts[i], errs[i] = client.rangeCounts(prefix)
+			<-limit
+			if progress != nil {
+				mu.Lock()
+				done++
+				progress(done, len(prefixes))
+				mu.Unlock()
+			}
+		}(i, prefix)
+	}
+	wg.Wait()
+
+	for i, prefix := range prefixes {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for _, index := range pending[prefix] {
+			results[index].Count = counts[i][results[index].Hash[5:]]
+		}
+	}
+	debugLog(fmt.Sprintf("Checked %d passwords with %d range requests", len(results), len(prefixes)))
+	return results, nil
+}
+
+// loadBreachCache returns the results of the breach cache if it isn't older than maxAge
+func loadBreachCache(maxAge time.Duration) []breachResult {
+	name := cacheName(BREACH_CACHE_NAME)
+	if !wf.Cache.Exists(name) || wf.Cache.Expired(name, maxAge) {
+		return nil
+	}
+	blob, err := wf.Cache.Load(name)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	data, err := openCache(blob, bwData.UserId, sessionCacheKey)
+	if err != nil {
+		log.Printf("The breach cache can't be used: %s", err)
+		return nil
+	}
+	var results []breachResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		log.Printf("The breach cache can't be used: %s", err)
+		return nil
+	}
+	return results
+}
+
+// storeBreachCache stores the results encrypted with the session like the items cache
+func storeBreachCache(results []breachResult) error {
+	data, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	sealed, err := sealCache(data, bwData.UserId, sessionCacheKey)
+	if err != nil {
+		return err
+	}
+	return wf.Cache.Store(cacheName(BREACH_CACHE_NAME), sealed)
+}
+
+func loadBreachProgress() breachProgress {
+	var progress breachProgress
+	name := cacheName(BREACH_PROGRESS_NAME)
+	if !wf.Cache.Exists(name) {
+		return progress
+	}
+	if err := wf.Cache.LoadJSON(name, &progress); err != nil {
+		log.Printf("Couldn't load the progress of the breach check, error: %s", err)
+	}
+	return progress
+}
+
+func storeBreachProgress(progress breachProgress) {
+	if err := wf.Cache.StoreJSON(cacheName(BREACH_PROGRESS_NAME), progress); err != nil {
+		log.Printf("Couldn't store the progress of the breach check, error: %s", err)
+	}
+}
+
+// startBreachCheck starts the job which requests the passwords which aren't cached
+func startBreachCheck(force bool) {
+	if err := wf.Cache.Store(cacheName(BREACH_PROGRESS_NAME), nil); err != nil {
+		log.Println(err)
+	}
+	args := []string{"-breach-check", "-background"}
+	if force {
+		args = append(args, "-force")
+	}
+	if err := wf.RunInBackground(BREACH_JOB, exec.Command(os.Args[0], args...)); err != nil {
+		log.Printf("Couldn't start the breach check, error: %s", err)
+	}
+}
+
+// addBreachProgressItem shows how many range requests the running job finished, the script filter reruns meanwhile
+func addBreachProgressItem() {
+	wf.Rerun(0.5)
+	subtitle := "Only the first 5 characters of the password hashes are sent"
+	if progress := loadBreachProgress(); progress.Total > 0 {
+		subtitle = fmt.Sprintf("%d of %d requests done", progress.Done, progress.Total)
+	}
+	wf.NewItem("Checking the passwords for breaches…").
+		Subtitle(subtitle).
+		Icon(ReloadIcon()).
+		Valid(false)
+}
+
+// runBreachCheckJob checks the passwords in the background and stores the results in the breach cache,
+// errors are stored with the progress for the script filter
+func runBreachCheckJob() {
+	wf.Configure(aw.TextErrors(true))
+	fail := func(err error) {
+		log.Printf("Error checking the passwords: %s", err)
+		storeBreachProgress(breachProgress{Error: err.Error()})
+	}
+	token, err := sessionToken()
+	if err != nil {
+		fail(err)
+		return
+	}
+	items, _, err := loadLoginsWithSecrets(token)
+	if err != nil {
+		fail(err)
+		return
+	}
+	var cached []breachResult
+	if !opts.Force {
+		cached = loadBreachCache(time.Duration(conf.BreachCacheAge) * time.Minute)
+	}
+	results, err := checkBreaches(newBreachClient(conf.BreachApiUrl), items, cached, func(done int, total int) {
+		storeBreachProgress(breachProgress{Done: done, Total: total})
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+	if err := storeBreachCache(results); err != nil {
+		fail(err)
+		return
+	}
+	if err := wf.Cache.Store(cacheName(BREACH_PROGRESS_NAME), nil); err != nil {
+		log.Println(err)
+	}
+}
+
+// runBreachCheck lists the logins whose password was found in a data breach. The passwords which
+// aren't cached are checked by a job in the background, its progress is shown until it is done.
+func runBreachCheck() {
+	if opts.Background {
+		runBreachCheckJob()
+		return
+	}
+	wf.Configure(aw.SuppressUIDs(true))
+	token, ok := unlockedToken()
+	if !ok {
+		return
+	}
+	if wf.IsRunning(BREACH_JOB) {
+		addBreachProgressItem()
+		wf.SendFeedback()
+		return
+	}
+	if progress := loadBreachProgress(); progress.Error != "" {
+		if err := wf.Cache.Store(cacheName(BREACH_PROGRESS_NAME), nil); err != nil {
+			log.Println(err)
+		}
+		wf.NewItem("Can't check the passwords for breaches").
+			Subtitle(progress.Error).
+			Icon(iconWarning).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+
+	items, skipped, err := loadLoginsWithSecrets(token)
+	if err != nil {
+		wf.NewItem("Can't check the vault").
+			Subtitle(err.Error()).
+			Icon(iconWarning).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+	// the reruns of a forced check use the results of its job
+	force := opts.Force && os.Getenv(BREACH_FORCED_VAR) == ""
+	var cached []breachResult
+	if !force {
+		cached = loadBreachCache(time.Duration(conf.BreachCacheAge) * time.Minute)
+	}
+	results, pending := cachedBreachResults(items, cached)
+	if force || len(pending) > 0 {
+		startBreachCheck(force)
+		if opts.Force {
+			wf.Var(BREACH_FORCED_VAR, "true")
+		}
+		addBreachProgressItem()
+		wf.SendFeedback()
+		return
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Count != results[j].Count {
+			return results[i].Count > results[j].Count
+		}
+		return results[i].Name < results[j].Name
+	})
+	breached := 0
+	for _, result := range results {
+		if result.Count == 0 {
+			continue
+		}
+		breached++
+		wf.NewItem(fmt.Sprintf("Breached password: %s", result.Name)).
+			Subtitle(fmt.Sprintf("Found %d times in data breaches ∙ ⏎ show details", result.Count)).
+			Match(result.Name).
+			Icon(iconWarning).
+			Var("action", fmt.Sprintf("-id %s", result.ItemId)).
+			Var("action2", " ").
+			Var("action3", " ").
+			Arg(" ").
+			Valid(true)
+	}
+	if breached == 0 {
+		wf.NewItem("No breached passwords found").
+			Subtitle(fmt.Sprintf("Checked %d passwords", len(results))).
+			Icon(iconOn).
+			Valid(false)
+	}
+	addSkippedLoginsItem(skipped)
+	wf.SendFeedback()
+}
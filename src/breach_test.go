@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRangeRequests are the prefixes the test range API was requested with
+type testRangeRequests struct {
+	mu       sync.Mutex
+	prefixes []string
+}
+
+func (r *testRangeRequests) add(prefix string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prefixes = append(r.prefixes, prefix)
+}
+
+func (r *testRangeRequests) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.prefixes...)
+}
+
+func (r *testRangeRequests) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prefixes = nil
+}
+
+// newTestRangeServer returns a range API which knows the passwords with their counts and
+// records the requested prefixes
+func newTestRangeServer(t *testing.T, breached map[string]int) (*httptest.Server, *testRangeRequests) {
+	t.Helper()
+	requests := &testRangeRequests{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := strings.TrimPrefix(r.URL.Path, "/range/")
+		requests.add(prefix)
+		// padding entries of the real API have a count of 0
+		fmt.Fprintf(w, "%s:0\r\n", strings.Repeat("F", 35))
+		for password, count := range breached {
+			if hash := passwordHash(password); hash[:5] == prefix {
+				fmt.Fprintf(w, "%s:%d\r\n", hash[5:], count)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func Test_passwordHash(t *testing.T) {
+	if got := passwordHash("password"); got != "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8" {
+		t.Errorf("passwordHash() = %s", got)
+	}
+}
+
+func Test_parseRangeResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]int
+		wantErr bool
+	}{
+		{name: "counts", data: "1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n011053FD0102E94D6AE2F8B83D76FAF94F6:1\r\n", want: map[string]int{"1E4C9B93F3F0682250B6CF8331B7EE68FD8": 9545824, "011053FD0102E94D6AE2F8B83D76FAF94F6": 1}},
+		{name: "lower case and empty lines", data: "\n1e4c9b93f3f0682250b6cf8331b7ee68fd8:3\n\n", want: map[string]int{"1E4C9B93F3F0682250B6CF8331B7EE68FD8": 3}},
+		{name: "empty", data: "", want: map[string]int{}},
+		{name: "no count", data: "1E4C9B93F3F0682250B6CF8331B7EE68FD8\n", wantErr: true},
+		{name: "invalid count", data: "1E4C9B93F3F0682250B6CF8331B7EE68FD8:many\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRangeResponse(strings.NewReader(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRangeResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRangeResponse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkBreaches(t *testing.T) {
+	server, requests := newTestRangeServer(t, map[string]int{"password": 42, "letmein": 7})
+	login := func(id string, name string, password string) Item {
+		item := Item{Id: id, Name: name, Type: 1}
+		item.Login.Password = password
+		return item
+	}
+	items := []Item{
+		login("item-1", "GitHub", "password"),
+		login("item-2", "GitLab", "password"),
+		login("item-3", "Forum", "letmein"),
+		login("item-4", "Bank", "x7#Kq9!vR2@mZ4$w"),
+		login("item-5", "Empty", ""),
+		{Id: "item-6", Name: "Notes", Type: 2, Notes: "password"},
+	}
+
+	client := newBreachClient(server.URL + "/")
+	var progress []string
+	got, err := checkBreaches(client, items, nil, func(done int, total int) {
+		progress = append(progress, fmt.Sprintf("%d/%d", done, total))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, result := range got {
+		counts[result.ItemId] = result.Count
+	}
+	if want := map[string]int{"item-1": 42, "item-2": 42, "item-3": 7, "item-4": 0}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("checkBreaches() = %v, want %v", counts, want)
+	}
+	// the same password is only requested once and only with the prefix
+	if len(requests.list()) != 3 {
+		t.Errorf("requests = %v, want one per prefix", requests.list())
+	}
+	if strings.Join(progress, ",") != "1/3,2/3,3/3" {
+		t.Errorf("progress = %v", progress)
+	}
+	for _, prefix := range requests.list() {
+		if len(prefix) != 5 {
+			t.Errorf("requested %q, want only the first 5 characters of the hash", prefix)
+		}
+	}
+
+	// cached results are used as long as the password is the same
+	requests.reset()
+	items[3] = login("item-4", "Bank", "letmein")
+	got, err = checkBreaches(client, items, got, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests.list()) != 1 || requests.list()[0] != passwordHash("letmein")[:5] {
+		t.Errorf("requests with cache = %v, want only the changed password", requests.list())
+	}
+	for _, result := range got {
+		if result.ItemId == "item-4" && result.Count != 7 {
+			t.Errorf("changed password count = %d, want 7", result.Count)
+		}
+	}
+
+	server.Close()
+	if _, err := checkBreaches(newBreachClient(server.URL), items, nil, nil); err == nil {
+		t.Error("checkBreaches() without a server returned no error")
+	}
+}
+
+func Test_checkBreaches_concurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	var items []Item
+	for i := 0; i < 20; i++ {
+		item := Item{Id: fmt.Sprintf("item-%d", i), Type: 1}
+		item.Login.Password = fmt.Sprintf("password-%d", i)
+		items = append(items, item)
+	}
+	if _, err := checkBreaches(newBreachClient(server.URL), items, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning > BREACH_CONCURRENCY {
+		t.Errorf("%d requests at the same time, want at most %d", maxRunning, BREACH_CONCURRENCY)
+	}
+}
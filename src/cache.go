@@ -37,147 +37,403 @@ func isItemIdFound(itemId []string, item Item) bool {
 	return false
 }
 
-func populateCacheItems(items []Item) {
+// populateCacheItems updates the encrypted items cache with the synced items. Only the
+// items which were added or changed since the last sync (by id and revision date) are
+// prepared for the cache again, the cache is replaced once when everything is ready so it
+// stays searchable during the sync.
+func populateCacheItems(items []Item) cacheChanges {
 	start := time.Now()
 
-	var cacheItems []Item
-
 	skipItems := strings.Split(conf.SkipTypes, ",")
 
 	debugLog(fmt.Sprintf("Total Items # %d", len(items)))
 
+	var syncedItems []Item
 	for _, item := range items {
 		if isItemIdFound(skipItems, item) {
-			return
-		}
-		var tempItem Item
-		tempItem.Object = item.Object
-		tempItem.Id = item.Id
-		tempItem.OrganizationId = item.OrganizationId
-		tempItem.FolderId = item.FolderId
-		tempItem.Type = item.Type
-		tempItem.Name = item.Name
-		tempItem.Favorite = item.Favorite
-		tempItem.CollectionIds = item.CollectionIds
-		tempItem.RevisionDate = item.RevisionDate
-
-		// special cases because we don't want to cache secrets
-		if item.Type == 2 {
-			noteValue := ""
-			if item.Notes != "" {
-				noteValue = "✳︎✳︎✳︎✳︎✳︎"
-			}
-			tempItem.Notes = noteValue
-		} else {
-			tempItem.Notes = item.Notes
+			continue
 		}
-		shortNumber := item.Card.Number
-		if item.Card.Number != "" {
-			shortNumber = fmt.Sprintf("*%s", shortNumber[len(shortNumber)-4:])
+		syncedItems = append(syncedItems, item)
+	}
+
+	cached, loadErr := loadCacheItems()
+	if loadErr != nil {
+		log.Printf("Couldn't load the items cache, creating it from scratch: %s", loadErr)
+		cached = nil
+	}
+	cacheItems, changes := diffCacheItems(cached, syncedItems)
+
+	debugLog(fmt.Sprintf("Total cacheItems # %d, %s", len(cacheItems), changes))
+
+	if changes.changed() || loadErr != nil || !wf.Cache.Exists(cacheName(CACHE_NAME)) {
+		data, err := json.Marshal(cacheItems)
+		if err != nil {
+			log.Println(err)
 		}
-		codeValue := "✳︎✳︎✳︎✳︎✳︎"
-		if item.Card.Code == "" {
-			codeValue = ""
+
+		Encrypt(data)
+	}
+
+	if conf.IconCacheEnabled && (wf.Data.Expired(ICON_CACHE_NAME, conf.IconMaxCacheAge) || !wf.Data.Exists(ICON_CACHE_NAME)) {
+		getIcon()
+	}
+
+	// calculate to duration
+	elapsed := time.Since(start)
+	debugLog(fmt.Sprintf("Function exec time took %s", elapsed))
+	return changes
+}
+
+// cacheChanges counts the differences between the items cache and the synced items
+type cacheChanges struct {
+	Added   int
+	Updated int
+	Deleted int
+}
+
+func (c cacheChanges) changed() bool {
+	return c.Added+c.Updated+c.Deleted > 0
+}
+
+func (c cacheChanges) String() string {
+	if !c.changed() {
+		return "no changes"
+	}
+	return fmt.Sprintf("%d added, %d updated, %d deleted", c.Added, c.Updated, c.Deleted)
+}
+
+// loadCacheItems returns the items of the encrypted items cache
+func loadCacheItems() ([]Item, error) {
+	var items []Item
+	if !wf.Cache.Exists(cacheName(CACHE_NAME)) {
+		return items, nil
+	}
+	data, err := Decrypt()
+	if err != nil {
+		return items, err
+	}
+	err = json.Unmarshal(data, &items)
+	return items, err
+}
+
+// storeCacheItem adds the item to the items cache or replaces it, so a created or changed
+// item shows up without a sync
+func storeCacheItem(item Item) error {
+	if isItemIdFound(strings.Split(conf.SkipTypes, ","), item) {
+		return nil
+	}
+	cached, err := loadCacheItems()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range cached {
+		if cached[i].Id == item.Id {
+			cached[i] = cacheItem(item)
+			replaced = true
 		}
-		tempItem.Card = CardInfo{
-			CardHolderName: item.Card.CardHolderName,
-			Brand:          item.Card.Brand,
-			Number:         shortNumber,
-			ExpMonth:       item.Card.ExpMonth,
-			ExpYear:        item.Card.ExpYear,
-			Code:           codeValue,
+	}
+	if !replaced {
+		cached = append(cached, cacheItem(item))
+	}
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	if _, ok := Encrypt(data); !ok {
+		return fmt.Errorf("error storing the items cache")
+	}
+	return nil
+}
+
+// deleteCacheItem removes the item from the items cache, so a deleted item disappears without a sync
+func deleteCacheItem(id string) error {
+	cached, err := loadCacheItems()
+	if err != nil {
+		return err
+	}
+	remaining := make([]Item, 0, len(cached))
+	for _, item := range cached {
+		if item.Id != id {
+			remaining = append(remaining, item)
 		}
-		tempItem.SecureNote = item.SecureNote
-		passwordValue := "✳︎✳︎✳︎✳︎✳︎"
-		if item.Login.Password == "" {
-			passwordValue = ""
+	}
+	if len(remaining) == len(cached) {
+		return nil
+	}
+	data, err := json.Marshal(remaining)
+	if err != nil {
+		return err
+	}
+	if _, ok := Encrypt(data); !ok {
+		return fmt.Errorf("error storing the items cache")
+	}
+	return nil
+}
+
+// deleteCacheAttachment removes the attachment from item id in the items cache
+func deleteCacheAttachment(id string, attachmentId string) error {
+	cached, err := loadCacheItems()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i := range cached {
+		if cached[i].Id != id {
+			continue
 		}
-		totpValue := "✳︎✳︎✳︎✳︎✳︎"
-		if item.Login.Totp == "" {
-			totpValue = ""
+		var remaining []Attachments
+		for _, att := range cached[i].Attachments {
+			if att.Id != attachmentId {
+				remaining = append(remaining, att)
+			}
 		}
-		tempItem.Login = Login{
-			Uris:                 item.Login.Uris,
-			Username:             item.Login.Username,
-			Password:             passwordValue,
-			Totp:                 totpValue,
-			PasswordRevisionDate: item.Login.PasswordRevisionDate,
+		changed = len(remaining) != len(cached[i].Attachments)
+		cached[i].Attachments = remaining
+	}
+	if !changed {
+		return nil
+	}
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	if _, ok := Encrypt(data); !ok {
+		return fmt.Errorf("error storing the items cache")
+	}
+	return nil
+}
+
+// upsertFolder replaces the folder with the same id or adds it in the order of the Bitwarden
+// CLI, sorted by name with the "No Folder" folder last
+func upsertFolder(folders []Folder, folder Folder) []Folder {
+	result := make([]Folder, 0, len(folders)+1)
+	for _, f := range folders {
+		if f.Id != folder.Id {
+			result = append(result, f)
 		}
-		tempItem.Identity = Identity{
-			Title:          item.Identity.Title,
-			FirstName:      item.Identity.FirstName,
-			MiddleName:     item.Identity.MiddleName,
-			LastName:       item.Identity.LastName,
-			Address1:       item.Identity.Address1,
-			Address2:       item.Identity.Address2,
-			Address3:       item.Identity.Address3,
-			City:           item.Identity.City,
-			State:          item.Identity.State,
-			PostalCode:     item.Identity.PostalCode,
-			Country:        item.Identity.Country,
-			Company:        item.Identity.Company,
-			Email:          item.Identity.Email,
-			Phone:          item.Identity.Email,
-			Ssn:            item.Identity.Ssn,
-			Username:       item.Identity.Username,
-			PassportNumber: item.Identity.PassportNumber,
-			LicenseNumber:  item.Identity.LicenseNumber,
+	}
+	index := len(result)
+	for i, f := range result {
+		if f.Id == "" || strings.ToLower(f.Name) > strings.ToLower(folder.Name) {
+			index = i
+			break
 		}
-		var tempFields []Field
-		for _, field := range item.Fields {
-			if field.Type == 1 {
-				valueContent := "✳︎✳︎✳︎✳︎✳︎"
-				if field.Value == "" {
-					valueContent = ""
-				}
-				tempFields = append(tempFields, Field{
-					Name:  field.Name,
-					Value: valueContent,
-					Type:  field.Type,
-				})
-			} else {
-				tempFields = append(tempFields, Field{
-					Name:  field.Name,
-					Value: field.Value,
-					Type:  field.Type,
-				})
-			}
+	}
+	result = append(result[:index], append([]Folder{folder}, result[index:]...)...)
+	return result
+}
+
+// loadCacheFolders returns the folders of the folders cache
+func loadCacheFolders() ([]Folder, error) {
+	var folders []Folder
+	if err := wf.Cache.LoadJSON(cacheName(FOLDER_CACHE_NAME), &folders); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+// storeCacheFolder adds the created or renamed folder to the folders cache
+func storeCacheFolder(folder Folder) error {
+	folders, err := loadCacheFolders()
+	if err != nil {
+		return err
+	}
+	return wf.Cache.StoreJSON(cacheName(FOLDER_CACHE_NAME), upsertFolder(folders, folder))
+}
+
+// deleteCacheFolder removes the folder from the folders cache and moves its items to "No Folder"
+// in the items cache like Bitwarden does
+func deleteCacheFolder(id string) error {
+	folders, err := loadCacheFolders()
+	if err != nil {
+		return err
+	}
+	remaining := make([]Folder, 0, len(folders))
+	for _, folder := range folders {
+		if folder.Id != id {
+			remaining = append(remaining, folder)
 		}
-		tempItem.Fields = tempFields
-
-		// handling attachments slice here
-		var tempAttachments []Attachments
-		for _, att := range item.Attachments {
-			tempAttachments = append(tempAttachments, Attachments{
-				Id:       att.Id,
-				FileName: att.FileName,
-				Size:     att.Size,
-				SizeName: att.SizeName,
-				Url:      att.Url,
-			})
+	}
+	if err := wf.Cache.StoreJSON(cacheName(FOLDER_CACHE_NAME), remaining); err != nil {
+		return err
+	}
+
+	cached, err := loadCacheItems()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i := range cached {
+		if cached[i].FolderId == id {
+			cached[i].FolderId = ""
+			changed = true
 		}
-		tempItem.Attachments = tempAttachments
+	}
+	if !changed {
+		return nil
+	}
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	if _, ok := Encrypt(data); !ok {
+		return fmt.Errorf("error storing the items cache")
+	}
+	return nil
+}
 
-		// last step: appending cached items
-		cacheItems = append(cacheItems, tempItem)
+// diffCacheItems returns the new content of the items cache in the order of the synced items.
+// Cached items with the same revision date are kept, only new and changed items are converted.
+func diffCacheItems(cached []Item, items []Item) ([]Item, cacheChanges) {
+	var changes cacheChanges
+	cachedById := make(map[string]Item, len(cached))
+	for _, item := range cached {
+		cachedById[item.Id] = item
 	}
 
-	debugLog(fmt.Sprintf("Total cacheItems # %d", len(cacheItems)))
+	cacheItems := make([]Item, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		seen[item.Id] = true
+		old, ok := cachedById[item.Id]
+		switch {
+		case !ok:
+			changes.Added++
+		case old.RevisionDate.IsZero() || !old.RevisionDate.Equal(item.RevisionDate):
+			changes.Updated++
+		default:
+			cacheItems = append(cacheItems, old)
+			continue
+		}
+		cacheItems = append(cacheItems, cacheItem(item))
+	}
+	for id := range cachedById {
+		if !seen[id] {
+			changes.Deleted++
+		}
+	}
+	return cacheItems, changes
+}
 
-	data, err := json.Marshal(cacheItems)
-	if err != nil {
-		log.Println(err)
+// shortCardNumber keeps only the last 4 digits of the card number, shorter numbers are masked completely
+func shortCardNumber(number string) string {
+	if number == "" {
+		return ""
+	}
+	if len(number) <= 4 {
+		return "✳︎✳︎✳︎✳︎✳︎"
 	}
+	return fmt.Sprintf("*%s", number[len(number)-4:])
+}
 
-	Encrypt(data)
+// cacheItem returns a copy of the item without secrets
+func cacheItem(item Item) Item {
+	var tempItem Item
+	tempItem.Object = item.Object
+	tempItem.Id = item.Id
+	tempItem.OrganizationId = item.OrganizationId
+	tempItem.FolderId = item.FolderId
+	tempItem.Type = item.Type
+	tempItem.Name = item.Name
+	tempItem.Favorite = item.Favorite
+	tempItem.CollectionIds = item.CollectionIds
+	tempItem.RevisionDate = item.RevisionDate
 
-	if conf.IconCacheEnabled && (wf.Data.Expired(ICON_CACHE_NAME, conf.IconMaxCacheAge) || !wf.Data.Exists(ICON_CACHE_NAME)) {
-		getIcon()
+	// special cases because we don't want to cache secrets
+	if item.Type == 2 {
+		noteValue := ""
+		if item.Notes != "" {
+			noteValue = "✳︎✳︎✳︎✳︎✳︎"
+		}
+		tempItem.Notes = noteValue
+	} else {
+		tempItem.Notes = item.Notes
+	}
+	codeValue := "✳︎✳︎✳︎✳︎✳︎"
+	if item.Card.Code == "" {
+		codeValue = ""
+	}
+	tempItem.Card = CardInfo{
+		CardHolderName: item.Card.CardHolderName,
+		Brand:          item.Card.Brand,
+		Number:         shortCardNumber(item.Card.Number),
+		ExpMonth:       item.Card.ExpMonth,
+		ExpYear:        item.Card.ExpYear,
+		Code:           codeValue,
 	}
+	tempItem.SecureNote = item.SecureNote
+	passwordValue := "✳︎✳︎✳︎✳︎✳︎"
+	if item.Login.Password == "" {
+		passwordValue = ""
+	}
+	totpValue := "✳︎✳︎✳︎✳︎✳︎"
+	if item.Login.Totp == "" {
+		totpValue = ""
+	}
+	tempItem.Login = Login{
+		Uris:                 item.Login.Uris,
+		Username:             item.Login.Username,
+		Password:             passwordValue,
+		Totp:                 totpValue,
+		PasswordRevisionDate: item.Login.PasswordRevisionDate,
+	}
+	tempItem.Identity = Identity{
+		Title:          item.Identity.Title,
+		FirstName:      item.Identity.FirstName,
+		MiddleName:     item.Identity.MiddleName,
+		LastName:       item.Identity.LastName,
+		Address1:       item.Identity.Address1,
+		Address2:       item.Identity.Address2,
+		Address3:       item.Identity.Address3,
+		City:           item.Identity.City,
+		State:          item.Identity.State,
+		PostalCode:     item.Identity.PostalCode,
+		Country:        item.Identity.Country,
+		Company:        item.Identity.Company,
+		Email:          item.Identity.Email,
+		Phone:          item.Identity.Email,
+		Ssn:            item.Identity.Ssn,
+		Username:       item.Identity.Username,
+		PassportNumber: item.Identity.PassportNumber,
+		LicenseNumber:  item.Identity.LicenseNumber,
+	}
+	var tempFields []Field
+	for _, field := range item.Fields {
+		if field.Type == 1 {
+			valueContent := "✳︎✳︎✳︎✳︎✳︎"
+			if field.Value == "" {
+				valueContent = ""
+			}
+			tempFields = append(tempFields, Field{
+				Name:  field.Name,
+				Value: valueContent,
+				Type:  field.Type,
+			})
+		} else {
+			tempFields = append(tempFields, Field{
+				Name:  field.Name,
+				Value: field.Value,
+				Type:  field.Type,
+			})
+		}
+	}
+	tempItem.Fields = tempFields
 
-	// calculate to duration
-	elapsed := time.Since(start)
-	debugLog(fmt.Sprintf("Function exec time took %s", elapsed))
+	// handling attachments slice here
+	var tempAttachments []Attachments
+	for _, att := range item.Attachments {
+		tempAttachments = append(tempAttachments, Attachments{
+			Id:       att.Id,
+			FileName: att.FileName,
+			Size:     att.Size,
+			SizeName: att.SizeName,
+			Url:      att.Url,
+		})
+	}
+	tempItem.Attachments = tempAttachments
+
+	return tempItem
 }
 
 func getIcon() {
@@ -202,12 +458,41 @@ func populateCacheFolders(folders []Folder) {
 		cacheFolders = append(cacheFolders, tempFolder)
 	}
 
-	err := wf.Cache.StoreJSON(FOLDER_CACHE_NAME, cacheFolders)
+	err := wf.Cache.StoreJSON(cacheName(FOLDER_CACHE_NAME), cacheFolders)
 	if err != nil {
 		log.Println(err)
 	}
 }
 
+// populateCacheCollections stores the names of the organizations and collections
+func populateCacheCollections(orgs []Organization, collections []Collection) {
+	if err := wf.Cache.StoreJSON(cacheName(ORGANIZATION_CACHE_NAME), orgs); err != nil {
+		log.Println(err)
+	}
+	if err := wf.Cache.StoreJSON(cacheName(COLLECTION_CACHE_NAME), collections); err != nil {
+		log.Println(err)
+	}
+}
+
+// loadCacheCollections returns the organizations and collections of the caches,
+// the caches don't exist if the vault wasn't synced since they were added
+func loadCacheCollections() ([]Organization, []Collection, error) {
+	var orgs []Organization
+	var collections []Collection
+	if !wf.Cache.Exists(cacheName(ORGANIZATION_CACHE_NAME)) {
+		return nil, nil, nil
+	}
+	if err := wf.Cache.LoadJSON(cacheName(ORGANIZATION_CACHE_NAME), &orgs); err != nil {
+		return nil, nil, err
+	}
+	if wf.Cache.Exists(cacheName(COLLECTION_CACHE_NAME)) {
+		if err := wf.Cache.LoadJSON(cacheName(COLLECTION_CACHE_NAME), &collections); err != nil {
+			return orgs, nil, err
+		}
+	}
+	return orgs, collections, nil
+}
+
 func DownloadIcon(urlMap map[string]string, outputFolder string) {
 	//get https://icons.duckduckgo.com/ip3/maersk-analytics.atlassian.net.ico
 	//fullUrlFile = fmt.Sprintf("https://www.google.com/s2/favicons?domain=%s", urlString)
@@ -272,7 +557,7 @@ func runGetIcons(url string, id string) {
 	if url == "" && id == "" {
 		// Load data
 		var items []Item
-		if wf.Cache.Exists(CACHE_NAME) {
+		if wf.Cache.Exists(cacheName(CACHE_NAME)) {
 			data, err := Decrypt()
 			if err != nil {
 				log.Printf("Error decrypting data: %s", err)
@@ -0,0 +1,219 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// CACHE_VERSION is the schema version of the items cache. Version 1 is the format without
+// envelope ("nonce:ciphertext" as hex), version 2 was encrypted with a random key from the secret
+// store, version 3 with a key derived from the session (see cacheKeyFromSession).
+// Caches of other versions aren't read but rebuilt with a full sync, increase it when the
+// cached items change.
+const CACHE_VERSION = 3
+
+// LEGACY_CACHE_KEY_NAME is the secret store entry of the key of cache version 1 and 2,
+// it is removed when such a cache is found
+const LEGACY_CACHE_KEY_NAME = "encryptPassword"
+
+var (
+	errCacheCorrupt  = errors.New("the items cache is corrupt")
+	errCacheVersion  = errors.New("the items cache was created by a newer version of the workflow")
+	errCacheOutdated = errors.New("the items cache was created by an old version of the workflow")
+	errCacheAccount  = errors.New("the items cache belongs to a different account")
+	errCacheLocked   = errors.New("the items cache can't be decrypted without an unlocked session")
+)
+
+// cacheHeader describes the content of the items cache
+type cacheHeader struct {
+	Version   int       `json:"version"`
+	AccountId string    `json:"accountId"`
+	Created   time.Time `json:"created"`
+	ItemCount int       `json:"itemCount"`
+	// Salt is used to derive the key from the session, since version 3
+	Salt string `json:"salt,omitempty"`
+}
+
+func (h cacheHeader) equal(other cacheHeader) bool {
+	return h.Version == other.Version && h.AccountId == other.AccountId &&
+		h.Created.Equal(other.Created) && h.ItemCount == other.ItemCount && h.Salt == other.Salt
+}
+
+// cacheKeyFunc returns the key the cache with the header is encrypted with
+type cacheKeyFunc func(header cacheHeader) (*[32]byte, error)
+
+// cacheEnvelope is stored as items cache. The header is readable without the key, it is
+// sealed together with the items as well so that changes to it are detected.
+type cacheEnvelope struct {
+	Header cacheHeader `json:"header"`
+	Nonce  string      `json:"nonce"`
+	Data   string      `json:"data"`
+}
+
+type cachePayload struct {
+	Header cacheHeader     `json:"header"`
+	Items  json.RawMessage `json:"items"`
+}
+
+// sealCache encrypts the items JSON into a cache envelope
+func sealCache(items []byte, accountId string, keyFor cacheKeyFunc) ([]byte, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(items, &list); err != nil {
+		return nil, fmt.Errorf("items are not a JSON list, %s", err)
+	}
+	var salt [16]byte
+	if _, err := io.ReadFull(rand.Reader, salt[:]); err != nil {
+		return nil, err
+	}
+	header := cacheHeader{
+		Version:   CACHE_VERSION,
+		AccountId: accountId,
+		Created:   time.Now().UTC(),
+		ItemCount: len(list),
+		Salt:      hex.EncodeToString(salt[:]),
+	}
+	key, err := keyFor(header)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(cachePayload{Header: header, Items: items})
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+	encrypted := secretbox.Seal(nil, payload, &nonce, key)
+	return json.Marshal(cacheEnvelope{
+		Header: header,
+		Nonce:  hex.EncodeToString(nonce[:]),
+		Data:   hex.EncodeToString(encrypted),
+	})
+}
+
+// openCache decrypts the items cache and returns the items JSON. Caches of older versions
+// return errCacheOutdated.
+func openCache(blob []byte, accountId string, keyFor cacheKeyFunc) ([]byte, error) {
+	blob = bytes.TrimSpace(blob)
+	if !bytes.HasPrefix(blob, []byte("{")) {
+		return nil, fmt.Errorf("%w: version 1", errCacheOutdated)
+	}
+
+	var envelope cacheEnvelope
+	if err := json.Unmarshal(blob, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %s", errCacheCorrupt, err)
+	}
+	version := envelope.Header.Version
+	if version > CACHE_VERSION {
+		return nil, fmt.Errorf("%w: version %d", errCacheVersion, version)
+	}
+	if version < CACHE_VERSION {
+		return nil, fmt.Errorf("%w: version %d", errCacheOutdated, version)
+	}
+	if accountId != "" && envelope.Header.AccountId != "" && envelope.Header.AccountId != accountId {
+		return nil, errCacheAccount
+	}
+
+	nonce, err := hex.DecodeString(envelope.Nonce)
+	if err != nil || len(nonce) != 24 {
+		return nil, fmt.Errorf("%w: invalid nonce", errCacheCorrupt)
+	}
+	encrypted, err := hex.DecodeString(envelope.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid data", errCacheCorrupt)
+	}
+	key, err := keyFor(envelope.Header)
+	if err != nil {
+		return nil, err
+	}
+	var n [24]byte
+	copy(n[:], nonce)
+	decrypted, ok := secretbox.Open(nil, encrypted, &n, key)
+	if !ok {
+		return nil, fmt.Errorf("%w: decryption failed", errCacheCorrupt)
+	}
+
+	var payload cachePayload
+	if err := json.Unmarshal(decrypted, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %s", errCacheCorrupt, err)
+	}
+	if !payload.Header.equal(envelope.Header) {
+		return nil, fmt.Errorf("%w: header was modified", errCacheCorrupt)
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(payload.Items, &list); err != nil || len(list) != payload.Header.ItemCount {
+		return nil, fmt.Errorf("%w: expected %d items", errCacheCorrupt, payload.Header.ItemCount)
+	}
+
+	return payload.Items, nil
+}
+
+// cacheKeyFromSession derives the key of the items cache from the session key and the salt
+// of the cache. Locking or logging out removes the session key, which makes the cache
+// unreadable, and every unlock creates a new session key and with it a new cache key.
+func cacheKeyFromSession(sessionKey string, salt string) (*[32]byte, error) {
+	if sessionKey == "" {
+		return nil, errCacheLocked
+	}
+	saltBytes, err := hex.DecodeString(salt)
+	if err != nil || len(saltBytes) == 0 {
+		return nil, fmt.Errorf("%w: invalid salt", errCacheCorrupt)
+	}
+	var key [32]byte
+	r := hkdf.New(sha256.New, []byte(sessionKey), saltBytes, []byte("bitwarden-alfred-workflow items cache"))
+	if _, err := io.ReadFull(r, key[:]); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// sessionCacheKey returns the cache key for the header with the session of the active account
+func sessionCacheKey(header cacheHeader) (*[32]byte, error) {
+	token, err := alfred.GetToken(secrets)
+	if err != nil {
+		return nil, errCacheLocked
+	}
+	return cacheKeyFromSession(token, header.Salt)
+}
+
+// isCacheError reports if the items cache can't be used and needs to be created again
+func isCacheError(err error) bool {
+	return errors.Is(err, errCacheCorrupt) || errors.Is(err, errCacheVersion) || errors.Is(err, errCacheOutdated) ||
+		errors.Is(err, errCacheAccount)
+}
+
+// addCacheErrorItem shows why the items cache can't be used and recreates it with a sync in the background
+func addCacheErrorItem(err error) {
+	log.Printf("The items cache can't be used: %s", err)
+	if !wf.IsRunning("sync") {
+		cmd := exec.Command(os.Args[0], "-sync", "-force")
+		cmd.Env = append(os.Environ(), "BACKGROUND_SYNC_DAEMON=true")
+		if err := wf.RunInBackground("sync", cmd); err != nil {
+			log.Println(err)
+		}
+	}
+	wf.Rerun(1)
+	wf.NewItem("Cache Invalid, Syncing…").
+		Subtitle(fmt.Sprintf("%s, the items show up after the sync", err)).
+		Valid(false).
+		Icon(ReloadIcon())
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// testCacheKey uses the session key like sessionCacheKey
+func testCacheKey(session string) cacheKeyFunc {
+	return func(header cacheHeader) (*[32]byte, error) {
+		return cacheKeyFromSession(session, header.Salt)
+	}
+}
+
+func Test_openCache(t *testing.T) {
+	key := testCacheKey("session-1")
+	otherKey := testCacheKey("session-2")
+	legacyKey := &[32]byte{1, 2, 3}
+	items := `[{"id":"item-1","login":{"uris":[{"match":null,"uri":"https://github.com"}]}},{"id":"item-2"}]`
+
+	sealed, err := sealCache([]byte(items), "user-1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modify := func(change func(e *cacheEnvelope)) []byte {
+		var envelope cacheEnvelope
+		if err := json.Unmarshal(sealed, &envelope); err != nil {
+			t.Fatal(err)
+		}
+		change(&envelope)
+		data, err := json.Marshal(envelope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	legacy := func(data string) []byte {
+		nonce := [24]byte{7}
+		return []byte(fmt.Sprintf("%x:%x", nonce[:], secretbox.Seal(nil, []byte(data), &nonce, legacyKey)))
+	}
+	version2 := func(data string) []byte {
+		nonce := [24]byte{8}
+		header := cacheHeader{Version: 2, AccountId: "user-1", Created: time.Now().UTC(), ItemCount: 1}
+		payload, err := json.Marshal(cachePayload{Header: header, Items: json.RawMessage(data)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		envelope, err := json.Marshal(cacheEnvelope{
+			Header: header,
+			Nonce:  hex.EncodeToString(nonce[:]),
+			Data:   hex.EncodeToString(secretbox.Seal(nil, payload, &nonce, legacyKey)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return envelope
+	}
+
+	tests := []struct {
+		name      string
+		blob      []byte
+		accountId string
+		key       cacheKeyFunc
+		want      string
+		wantErr   error
+	}{
+		{name: "current version", blob: sealed, accountId: "user-1", key: key, want: items},
+		{name: "other session", blob: sealed, accountId: "user-1", key: otherKey, wantErr: errCacheCorrupt},
+		{name: "locked", blob: sealed, accountId: "user-1", key: testCacheKey(""), wantErr: errCacheLocked},
+		{name: "other account", blob: sealed, accountId: "user-2", key: key, wantErr: errCacheAccount},
+		{name: "not json", blob: []byte("{garbage"), key: key, wantErr: errCacheCorrupt},
+		{name: "truncated data", blob: modify(func(e *cacheEnvelope) { e.Data = e.Data[:20] }), key: key, wantErr: errCacheCorrupt},
+		{name: "modified header", blob: modify(func(e *cacheEnvelope) { e.Header.ItemCount = 5 }), key: key, wantErr: errCacheCorrupt},
+		{name: "newer version", blob: modify(func(e *cacheEnvelope) { e.Header.Version = CACHE_VERSION + 1 }), key: key, wantErr: errCacheVersion},
+		{
+			name:    "legacy version is rebuilt",
+			blob:    legacy(`[{"id":"item-1","login":{"uris":[{"match":0,"uri":"https://github.com"}]}}]`),
+			key:     key,
+			wantErr: errCacheOutdated,
+		},
+		{
+			name:      "version 2 is rebuilt",
+			blob:      version2(`[{"id":"item-1"}]`),
+			accountId: "user-1",
+			key:       key,
+			wantErr:   errCacheOutdated,
+		},
+		{name: "legacy version without nonce", blob: []byte("abcdef"), key: key, wantErr: errCacheOutdated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := openCache(tt.blob, tt.accountId, tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("openCache() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if !isCacheError(err) && !errors.Is(err, errCacheLocked) {
+					t.Errorf("isCacheError(%v) = false", err)
+				}
+				return
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Errorf("openCache() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sealCache(t *testing.T) {
+	key := testCacheKey("session-1")
+	if _, err := sealCache([]byte(`{"id": "no list"}`), "user-1", key); err == nil {
+		t.Errorf("sealCache() of an object should fail")
+	}
+	sealed, err := sealCache([]byte(`[{"id":"item-1"},{"id":"item-2"}]`), "user-1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope cacheEnvelope
+	if err := json.Unmarshal(sealed, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Header.Version != CACHE_VERSION || envelope.Header.AccountId != "user-1" || envelope.Header.ItemCount != 2 || envelope.Header.Created.IsZero() || envelope.Header.Salt == "" {
+		t.Errorf("sealCache() header = %+v", envelope.Header)
+	}
+}
+
+func jsonEqual(t *testing.T, a []byte, b []byte) bool {
+	t.Helper()
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatal(err)
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return string(ja) == string(jb)
+}
+
+func Test_cacheKeyFromSession(t *testing.T) {
+	salt := hex.EncodeToString([]byte("0123456789abcdef"))
+	otherSalt := hex.EncodeToString([]byte("fedcba9876543210"))
+	key, err := cacheKeyFromSession("session-1", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		session  string
+		salt     string
+		wantSame bool
+		wantErr  error
+	}{
+		{name: "same session and salt", session: "session-1", salt: salt, wantSame: true},
+		{name: "new session after unlock", session: "session-2", salt: salt},
+		{name: "new salt", session: "session-1", salt: otherSalt},
+		{name: "locked", session: "", salt: salt, wantErr: errCacheLocked},
+		{name: "invalid salt", session: "session-1", salt: "xyz", wantErr: errCacheCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cacheKeyFromSession(tt.session, tt.salt)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("cacheKeyFromSession() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (*got == *key) != tt.wantSame {
+				t.Errorf("cacheKeyFromSession() same key = %v, want %v", *got == *key, tt.wantSame)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_getItemTypeByName(t *testing.T) {
@@ -108,3 +110,144 @@ func Test_isItemIdFound(t *testing.T) {
 		})
 	}
 }
+
+func Test_diffCacheItems(t *testing.T) {
+	day1 := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	cached := []Item{
+		{Id: "unchanged", Name: "cached name", RevisionDate: day1},
+		{Id: "updated", Name: "old name", RevisionDate: day1},
+		{Id: "deleted", Name: "deleted", RevisionDate: day1},
+	}
+	tests := []struct {
+		name        string
+		cached      []Item
+		items       []Item
+		wantNames   []string
+		wantChanges cacheChanges
+	}{
+		{
+			name:        "empty cache",
+			items:       []Item{{Id: "new", Name: "new", RevisionDate: day1}},
+			wantNames:   []string{"new"},
+			wantChanges: cacheChanges{Added: 1},
+		},
+		{
+			name:   "add, update and delete",
+			cached: cached,
+			items: []Item{
+				{Id: "new", Name: "new", RevisionDate: day2},
+				{Id: "unchanged", Name: "synced name", RevisionDate: day1},
+				{Id: "updated", Name: "new name", RevisionDate: day2},
+			},
+			wantNames:   []string{"new", "cached name", "new name"},
+			wantChanges: cacheChanges{Added: 1, Updated: 1, Deleted: 1},
+		},
+		{
+			name:        "items without revision date are always updated",
+			cached:      []Item{{Id: "item", Name: "old"}},
+			items:       []Item{{Id: "item", Name: "new"}},
+			wantNames:   []string{"new"},
+			wantChanges: cacheChanges{Updated: 1},
+		},
+		{
+			name:        "no changes",
+			cached:      cached[:1],
+			items:       []Item{{Id: "unchanged", Name: "synced name", RevisionDate: day1}},
+			wantNames:   []string{"cached name"},
+			wantChanges: cacheChanges{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changes := diffCacheItems(tt.cached, tt.items)
+			if changes != tt.wantChanges {
+				t.Errorf("diffCacheItems() changes = %+v, want %+v", changes, tt.wantChanges)
+			}
+			if len(got) != len(tt.wantNames) {
+				t.Fatalf("diffCacheItems() returned %d items, want %d", len(got), len(tt.wantNames))
+			}
+			for i, item := range got {
+				if item.Name != tt.wantNames[i] {
+					t.Errorf("diffCacheItems() item %d = %q, want %q", i, item.Name, tt.wantNames[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_cacheItem(t *testing.T) {
+	item := Item{Id: "item-1", Type: 1, Name: "GitHub", Login: Login{Username: "octocat", Password: "secret", Totp: "JBSWY3DPEHPK3PXP"}}
+	got := cacheItem(item)
+	if got.Login.Password == item.Login.Password || got.Login.Totp == item.Login.Totp {
+		t.Errorf("cacheItem() keeps the secrets: %+v", got.Login)
+	}
+	if got.Login.Username != "octocat" || got.Name != "GitHub" {
+		t.Errorf("cacheItem() = %+v, want the username and name to be kept", got)
+	}
+}
+
+func Test_shortCardNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		want   string
+	}{
+		{number: "", want: ""},
+		{number: "123", want: "✳︎✳︎✳︎✳︎✳︎"},
+		{number: "1234", want: "✳︎✳︎✳︎✳︎✳︎"},
+		{number: "4111111111111111", want: "*1111"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			if got := shortCardNumber(tt.number); got != tt.want {
+				t.Errorf("shortCardNumber() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_cardExpiration(t *testing.T) {
+	tests := []struct {
+		name string
+		card CardInfo
+		want string
+	}{
+		{name: "4 digit year", card: CardInfo{ExpMonth: "04", ExpYear: "2027"}, want: "0427"},
+		{name: "2 digit year", card: CardInfo{ExpMonth: "04", ExpYear: "27"}, want: "0427"},
+		{name: "no year", card: CardInfo{ExpMonth: "04"}, want: "04"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cardExpiration(tt.card); got != tt.want {
+				t.Errorf("cardExpiration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_upsertFolder(t *testing.T) {
+	folders := []Folder{{Id: "folder-1", Name: "Banking"}, {Id: "folder-2", Name: "Work"}, {Id: "", Name: "No Folder"}}
+	tests := []struct {
+		name   string
+		folder Folder
+		want   []string
+	}{
+		{name: "new folder in between", folder: Folder{Id: "folder-3", Name: "private"}, want: []string{"Banking", "private", "Work", "No Folder"}},
+		{name: "new folder last", folder: Folder{Id: "folder-3", Name: "Zoo"}, want: []string{"Banking", "Work", "Zoo", "No Folder"}},
+		{name: "renamed folder", folder: Folder{Id: "folder-2", Name: "Archive"}, want: []string{"Archive", "Banking", "No Folder"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, folder := range upsertFolder(folders, tt.folder) {
+				got = append(got, folder.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("upsertFolder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if folders[1].Name != "Work" {
+		t.Errorf("upsertFolder() changed the passed folders: %v", folders)
+	}
+}
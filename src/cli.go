@@ -5,6 +5,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -12,7 +13,6 @@ import (
 	"os/exec"
 	"strconv"
 	"time"
-	"sort"
 
 	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
 	aw "github.com/deanishe/awgo"
@@ -27,35 +27,80 @@ var (
 // CLI flags
 type options struct {
 	// Commands
-	Search       bool
-	Config       bool
-	SetConfigs   bool
-	Auth         bool
-	OnOffConfigs bool
-	AuthConfig   bool
-	Lock         bool
-	Icons        bool
-	Folder       bool
-	Favorites    bool
-	Unlock       bool
-	Login        bool
-	Logout       bool
-	Sync         bool
-	Open         bool
-	GetItem      bool
-	GetTotp      bool
+	Search        bool
+	Config        bool
+	SetConfigs    bool
+	Auth          bool
+	OnOffConfigs  bool
+	AuthConfig    bool
+	Lock          bool
+	Icons         bool
+	Folder        bool
+	Favorites     bool
+	Orgs          bool
+	Org           bool
+	Collection    bool
+	Unlock        bool
+	Login         bool
+	Logout        bool
+	Sync          bool
+	Open          bool
+	GetItem       bool
+	GetTotp       bool
+	TotpView      bool
+	Generate      bool
+	CreateLogin   bool
+	Create        bool
+	CreateItem    bool
+	Edit          bool
+	EditItem      bool
+	Health        bool
+	BreachCheck   bool
+	Trash         bool
+	Delete        bool
+	ConfirmDelete bool
+	Restore       bool
+	Attach        bool
+	AttachTo      bool
+	AttachFile    bool
+	DeleteAttach  bool
+	OpenAttach    bool
+	CleanAttach   bool
+	NewFolder     bool
+	CreateFolder  bool
+	RenameFolder  bool
+	SaveFolder    bool
+	DeleteFolder  bool
+	MoveFolder    bool
+	SetFolder     bool
+	Send          bool
+	SendField     bool
+	SendCreate    bool
+	SendRevoke    bool
+	SendDelete    bool
+	SendReceive   bool
+	Accounts      bool
+	SwitchAccount bool
+	AddAccount    bool
+	RemoveAccount bool
+	Recent        bool
+	ResetUsage    bool
+	RecordUsage   bool
 
 	// Options
-	Force      bool
-	Totp       bool
-	Last       bool
-	Background bool
+	Force       bool
+	Totp        bool
+	Last        bool
+	Background  bool
+	AllAccounts bool
+	Permanent   bool
 
 	// Arguments
 	Id         string
 	Query      string
 	Attachment string
 	Output     string
+	MatchUrl   string
 }
 
 func init() {
@@ -70,6 +115,9 @@ func init() {
 	cli.BoolVar(&opts.Icons, "icons", false, "Get favicons")
 	cli.BoolVar(&opts.Folder, "folder", false, "Filter Bitwarden Folders")
 	cli.BoolVar(&opts.Favorites, "favorites", false, "Search Bitwarden Favorite Items")
+	cli.BoolVar(&opts.Orgs, "orgs", false, "show/filter the organizations")
+	cli.BoolVar(&opts.Org, "org", false, "show/filter the collections of organization id")
+	cli.BoolVar(&opts.Collection, "collection", false, "show/filter the items of collection id")
 	cli.StringVar(&opts.Id, "id", "", "Get item by id")
 	cli.StringVar(&opts.Attachment, "attachment", "", "set attachment id")
 	cli.BoolVar(&opts.Login, "login", false, "login to Bitwarden")
@@ -80,7 +128,49 @@ func init() {
 	cli.BoolVar(&opts.Force, "force", false, "force full sync")
 	cli.BoolVar(&opts.Totp, "totp", false, "get totp for item id")
 	cli.BoolVar(&opts.GetTotp, "gettotp", false, "get totp the other way")
+	cli.BoolVar(&opts.TotpView, "totpview", false, "show the current and next totp of item id")
+	cli.BoolVar(&opts.Generate, "generate", false, "generate passwords and passphrases")
+	cli.BoolVar(&opts.CreateLogin, "createlogin", false, "create a login with the password")
+	cli.BoolVar(&opts.Create, "create", false, "create an item step by step")
+	cli.BoolVar(&opts.CreateItem, "createitem", false, "create the encoded item")
+	cli.BoolVar(&opts.Edit, "edit", false, "show the new value of a field of item id")
+	cli.BoolVar(&opts.EditItem, "edititem", false, "set the encoded value of a field of item id")
+	cli.BoolVar(&opts.Health, "health", false, "show the vault health report")
+	cli.BoolVar(&opts.BreachCheck, "breach-check", false, "show the logins with breached passwords")
+	cli.BoolVar(&opts.Trash, "trash", false, "show/filter the deleted items")
+	cli.BoolVar(&opts.Delete, "delete", false, "move item id to the trash")
+	cli.BoolVar(&opts.Permanent, "permanent", false, "delete item id permanently")
+	cli.BoolVar(&opts.ConfirmDelete, "confirmdelete", false, "confirm deleting item id permanently")
+	cli.BoolVar(&opts.Restore, "restore", false, "restore item id from the trash")
+	cli.BoolVar(&opts.Attach, "attach", false, "show the typed file which is attached to item id")
+	cli.BoolVar(&opts.AttachTo, "attachto", false, "show/filter the items the file of the file action can be attached to")
+	cli.BoolVar(&opts.AttachFile, "attachfile", false, "attach the file with the encoded path to item id")
+	cli.BoolVar(&opts.DeleteAttach, "deleteattachment", false, "delete the attachment of item id")
+	cli.BoolVar(&opts.OpenAttach, "openattachment", false, "open the attachment of item id from a private temporary folder")
+	cli.BoolVar(&opts.CleanAttach, "cleanattachments", false, "remove the opened attachments when they expire, all of them with -force")
+	cli.BoolVar(&opts.NewFolder, "newfolder", false, "show the folder with the typed name")
+	cli.BoolVar(&opts.CreateFolder, "createfolder", false, "create a folder with the encoded name")
+	cli.BoolVar(&opts.RenameFolder, "renamefolder", false, "show the typed name of folder id")
+	cli.BoolVar(&opts.SaveFolder, "savefolder", false, "rename folder id to the encoded name")
+	cli.BoolVar(&opts.DeleteFolder, "deletefolder", false, "delete folder id")
+	cli.BoolVar(&opts.MoveFolder, "movefolder", false, "show/filter the folders item id can be moved to")
+	cli.BoolVar(&opts.SetFolder, "setfolder", false, "move item id to the folder")
+	cli.BoolVar(&opts.Send, "send", false, "create, receive and list Sends")
+	cli.BoolVar(&opts.SendField, "sendfield", false, "show the values of item id which can be sent")
+	cli.BoolVar(&opts.SendCreate, "sendcreate", false, "create the encoded Send and print its link")
+	cli.BoolVar(&opts.SendRevoke, "sendrevoke", false, "revoke Send id")
+	cli.BoolVar(&opts.SendDelete, "senddelete", false, "delete Send id")
+	cli.BoolVar(&opts.SendReceive, "sendreceive", false, "receive the encoded Send, print its text or save its file")
 	cli.BoolVar(&opts.GetItem, "getitem", false, "get item and an object of it")
+	cli.BoolVar(&opts.Accounts, "accounts", false, "show/filter accounts")
+	cli.BoolVar(&opts.SwitchAccount, "switchaccount", false, "switch to the account")
+	cli.BoolVar(&opts.AddAccount, "addaccount", false, "add an account")
+	cli.BoolVar(&opts.RemoveAccount, "removeaccount", false, "remove an account")
+	cli.BoolVar(&opts.AllAccounts, "allaccounts", false, "search or lock all accounts")
+	cli.BoolVar(&opts.Recent, "recent", false, "show the recently used items")
+	cli.BoolVar(&opts.ResetUsage, "resetusage", false, "reset the usage statistics")
+	cli.BoolVar(&opts.RecordUsage, "recordusage", false, "record the use of an item action")
+	cli.StringVar(&opts.MatchUrl, "match-url", "", "show the logins matching the url")
 
 	cli.Usage = func() {
 		fmt.Fprint(os.Stderr, `usage: bitwarden-alfred-workflow [options] [arguments]
@@ -88,21 +178,64 @@ func init() {
 Alfred workflow to get secrets from Bitwarden.
 
 Usage:
-    bitwarden-alfred-workflow [<query>]
+    bitwarden-alfred-workflow [-allaccounts] [<query>]
+    bitwarden-alfred-workflow -accounts [<query>]
+    bitwarden-alfred-workflow -addaccount <name> <email> [<server url>]
+    bitwarden-alfred-workflow -attach -id <id> [<path>]
+    bitwarden-alfred-workflow -attachfile -id <id> <encoded path>
+    bitwarden-alfred-workflow -attachto [<query>] (the file is read from the attachment_file variable)
     bitwarden-alfred-workflow -auth [<query>]
+    bitwarden-alfred-workflow -breach-check [-force] [-background] [<query>]
+    bitwarden-alfred-workflow -cleanattachments [-force]
+    bitwarden-alfred-workflow -collection -id <collection id> [<query>]
     bitwarden-alfred-workflow -conf [<query>]
+    bitwarden-alfred-workflow -create [<template> › <value> › ...]
+    bitwarden-alfred-workflow -createitem <encoded item>
+    bitwarden-alfred-workflow -createfolder <encoded name>
+    bitwarden-alfred-workflow -createlogin <password>
+    bitwarden-alfred-workflow -confirmdelete -id <id> [-attachment <id>|-folder]
+    bitwarden-alfred-workflow -delete -id <id> [-permanent]
+    bitwarden-alfred-workflow -deleteattachment -id <id> -attachment <id>
+    bitwarden-alfred-workflow -deletefolder -id <folder id>
+    bitwarden-alfred-workflow -edit -id <id> <jsonpath> [<value>]
+    bitwarden-alfred-workflow -edititem -id <id> <jsonpath> [<encoded value>]
     bitwarden-alfred-workflow -folder [<query>]
 	bitwarden-alfred-workflow -favorites
+    bitwarden-alfred-workflow -generate [<length>] [<name>]
     bitwarden-alfred-workflow -getitem -id <id> [-totp] [-attachment <id>] [<query>] (query is used as jsonpath)
+    bitwarden-alfred-workflow -health [<query>]
     bitwarden-alfred-workflow -icons [-background]
-    bitwarden-alfred-workflow -lock
+    bitwarden-alfred-workflow -lock [-allaccounts]
     bitwarden-alfred-workflow -login
+    bitwarden-alfred-workflow -match-url <url>
+    bitwarden-alfred-workflow -movefolder -id <id> [<query>]
+    bitwarden-alfred-workflow -newfolder [<name>]
     bitwarden-alfred-workflow -logout
     bitwarden-alfred-workflow -open [<query>]
+    bitwarden-alfred-workflow -openattachment -id <id> -attachment <id>
+    bitwarden-alfred-workflow -org -id <organization id> [<query>]
+    bitwarden-alfred-workflow -orgs [<query>]
+    bitwarden-alfred-workflow -recent [<query>]
+    bitwarden-alfred-workflow -recordusage -id <id> <action>
+    bitwarden-alfred-workflow -resetusage
+    bitwarden-alfred-workflow -restore -id <id>
+    bitwarden-alfred-workflow -removeaccount <name>
+    bitwarden-alfred-workflow -renamefolder -id <folder id> [<name>]
     bitwarden-alfred-workflow -output <query>
+    bitwarden-alfred-workflow -savefolder -id <folder id> <encoded name>
     bitwarden-alfred-workflow -search <query>
+    bitwarden-alfred-workflow -send [<text>|<file>|<send url>] [expires:<30m|12h|7d>] [max:<count>] [password:<password>]
+    bitwarden-alfred-workflow -sendcreate [-id <id> <jsonpath>] <encoded send>
+    bitwarden-alfred-workflow -senddelete -id <send id>
+    bitwarden-alfred-workflow -sendfield -id <id> [<options>]
+    bitwarden-alfred-workflow -sendreceive <encoded send>
+    bitwarden-alfred-workflow -sendrevoke -id <send id>
+    bitwarden-alfred-workflow -setfolder -id <id> <folder id>
     bitwarden-alfred-workflow -setsfaconfig [<setting>]
     bitwarden-alfred-workflow -authconfig [<query>]
+    bitwarden-alfred-workflow -switchaccount <name>
+    bitwarden-alfred-workflow -trash [<query>]
+    bitwarden-alfred-workflow -totpview -id <id> [<query>] (query is the jsonpath of the totp key)
     bitwarden-alfred-workflow -sync [-force|-last] [-background]
     bitwarden-alfred-workflow -unlock
     bitwarden-alfred-workflow -h|-help
@@ -129,7 +262,7 @@ func BitwardenAuthChecks() (loginErr error, unlockErr error) {
 	if wf.Debug() {
 		noQuiet = ""
 	}
-	token, err := alfred.GetToken(wf)
+	token, err := alfred.GetToken(secrets)
 	if err != nil {
 		args = fmt.Sprintf("%s unlock %s --check", conf.BwExec, noQuiet)
 	} else {
@@ -194,6 +327,41 @@ func runConfig() {
 		Var("subtitle", fmt.Sprintf("Currently set to: %q", conf.WebUiURL)).
 		Arg(opts.Query)
 
+	wf.NewItem("Accounts").
+		Subtitle(fmt.Sprintf("Switch, add or remove accounts, active account: %q", activeAccount.Name)).
+		UID("accounts").
+		Valid(true).
+		Icon(iconUser).
+		Var("action", "-accounts")
+
+	wf.NewItem("Recently Used Items").
+		Subtitle("Show the items used last, the usage statistics can be reset there").
+		UID("recent").
+		Valid(true).
+		Icon(iconReload).
+		Var("action", "-recent")
+
+	wf.NewItem("Vault Health Report").
+		Subtitle("Show reused, weak and old passwords and logins with unencrypted URIs").
+		UID("health").
+		Valid(true).
+		Icon(iconWarning).
+		Var("action", "-health")
+
+	wf.NewItem("Check for Breached Passwords").
+		Subtitle("Look up the password hashes in the breach database, only the first 5 characters are sent").
+		UID("breach-check").
+		Valid(true).
+		Icon(iconWarning).
+		Var("action", "-breach-check")
+
+	wf.NewItem("Trash").
+		Subtitle("Restore deleted items or delete them permanently").
+		UID("trash").
+		Valid(true).
+		Icon(iconWarning).
+		Var("action", "-trash")
+
 	wf.NewItem("Enable or disable 2FA").
 		Subtitle("Configure Bitwarden to use or not use 2 Factor Authentication").
 		UID("sfa").
@@ -394,6 +562,11 @@ func runSetConfigs() {
 		value := cli.Arg(1)
 		switch mode {
 		case "email":
+			// a named account keeps its email in the accounts.json
+			if activeAccount.Name != "" {
+				err = updateActiveAccount(func(acc *Account) { acc.Email = value })
+				break
+			}
 			err = alfred.SetEmail(wf, value)
 		case "server":
 			if value == "" {
@@ -412,6 +585,10 @@ func runSetConfigs() {
 			if err != nil {
 				wf.FatalError(err)
 			}
+			if activeAccount.Name != "" {
+				err = updateActiveAccount(func(acc *Account) { acc.Server = value })
+				break
+			}
 			err = alfred.SetServer(wf, value)
 			if err != nil {
 				wf.FatalError(err)
@@ -447,6 +624,8 @@ func runSetConfigs() {
 			return
 		case "apikey":
 			err = alfred.SetApikey(wf, value)
+		case "allaccounts":
+			err = alfred.SetSearchAllAccounts(wf, value)
 		}
 		if err != nil {
 			wf.FatalError(err)
@@ -572,6 +751,11 @@ func runSearch(folderSearch bool, itemId string, favoritesSearch bool) {
 		return
 	}
 
+	if (opts.AllAccounts || conf.SearchAllAccounts) && len(accounts) > 1 && !folderSearch && itemId == "" && !favoritesSearch {
+		runSearchAllAccounts()
+		return
+	}
+
 	if conf.ReorderingDisabled {
 		wf.Configure(aw.SuppressUIDs(true))
 	} else {
@@ -585,21 +769,34 @@ func runSearch(folderSearch bool, itemId string, favoritesSearch bool) {
 	var folders []Folder
 
 	// check if the data cache exists
-	if wf.Cache.Exists(CACHE_NAME) && wf.Cache.Exists(FOLDER_CACHE_NAME) {
+	if wf.Cache.Exists(cacheName(CACHE_NAME)) && wf.Cache.Exists(cacheName(FOLDER_CACHE_NAME)) {
 		data, err := Decrypt()
-		if err != nil {
+		if errors.Is(err, errCacheLocked) {
+			addUnlockItem(email)
+			wf.SendFeedback()
+			return
+		} else if isCacheError(err) {
+			addCacheErrorItem(err)
+			wf.SendFeedback()
+			return
+		} else if err != nil {
 			log.Printf("Error decrypting data: %s", err)
 		}
 		if err := json.Unmarshal(data, &items); err != nil {
 			log.Printf("Couldn't load the items cache, error: %s", err)
 		}
-		if err := wf.Cache.LoadJSON(FOLDER_CACHE_NAME, &folders); err != nil {
+		if err := wf.Cache.LoadJSON(cacheName(FOLDER_CACHE_NAME), &folders); err != nil {
 			log.Printf("Couldn't load the folders cache, error: %s", err)
 		}
+		orgs, collections, err := loadCacheCollections()
+		if err != nil {
+			log.Printf("Couldn't load the collections cache, error: %s", err)
+		}
+		searchCollections = newCollectionNames(orgs, collections)
 	}
 
 	// Check if the sync cache exists
-	if !wf.Cache.Exists(SYNC_CACHE_NAME) && !wf.Cache.Exists(CACHE_NAME) {
+	if !wf.Cache.Exists(cacheName(SYNC_CACHE_NAME)) && !wf.Cache.Exists(cacheName(CACHE_NAME)) {
 		if !wf.IsRunning("sync") {
 			wf.NewItem("Cache Expired or not Existed").
 				Subtitle("Sync now").
@@ -642,19 +839,34 @@ func runSearch(folderSearch bool, itemId string, favoritesSearch bool) {
 		log.Println(err)
 	}
 
+	if opts.Recent {
+		runRecent(items)
+		return
+	}
+
+	if opts.MatchUrl != "" {
+		runMatchUrl(items, opts.MatchUrl)
+		return
+	}
+
 	if folderSearch && itemId == "" {
 		runSearchFolder(items, folders)
 	}
 
 	autoFetchCache := false
-	if wf.Cache.Expired(AUTO_FETCH_CACHE, conf.AutoFetchIconMaxCacheAge) || !wf.Cache.Exists(AUTO_FETCH_CACHE) {
+	if wf.Cache.Expired(cacheName(AUTO_FETCH_CACHE), conf.AutoFetchIconMaxCacheAge) || !wf.Cache.Exists(cacheName(AUTO_FETCH_CACHE)) {
 		autoFetchCache = true
-		err := wf.Cache.Store(AUTO_FETCH_CACHE, []byte(string("auto-fetch-cache")))
+		err := wf.Cache.Store(cacheName(AUTO_FETCH_CACHE), []byte(string("auto-fetch-cache")))
 		if err != nil {
 			log.Println(err)
 		}
 	}
 
+	if opts.Orgs || opts.Org || opts.Collection {
+		runSearchCollections(items, autoFetchCache)
+		return
+	}
+
 	if itemId != "" && !folderSearch {
 		// Add item to workflow for itemId
 		for _, item := range items {
@@ -678,13 +890,7 @@ func runSearch(folderSearch bool, itemId string, favoritesSearch bool) {
 				}
 			}
 		}
-		wf.NewItem("Go Back to Folder Search").
-			Valid(true).
-			UID("").
-			Icon(iconFolder).
-			Var("action", "-search").
-			Arg(conf.BwfKeyword).
-			Match(".")
+		addBackToFolderSearchItem()
 	}
 
 	if len(items) == 0 && len(folders) == 0 {
@@ -692,27 +898,20 @@ func runSearch(folderSearch bool, itemId string, favoritesSearch bool) {
 	}
 
 	if !folderSearch && itemId == "" && !favoritesSearch {
-		sort.Slice(items, func(i, j int) bool {
-			return items[i].Favorite && !items[j].Favorite
-		})
+		sortItems(items, loadUsageStats())
 		for _, item := range items {
 			addItemsToWorkflow(item, autoFetchCache)
 		}
 	}
 
 	if favoritesSearch {
+		sortItems(items, loadUsageStats())
 		for _, item := range items {
 			if item.Favorite {
 				addItemsToWorkflow(item, autoFetchCache)
 			}
 		}
-		wf.NewItem("Go Back to Folder Search").
-			Valid(true).
-			UID("").
-			Icon(iconFolder).
-			Var("action", "-search").
-			Arg(conf.BwfKeyword).
-			Match(".")
+		addBackToFolderSearchItem()
 	}
 
 	wf.SendFeedback()
@@ -727,28 +926,27 @@ func runSearchFolder(items []Item, folders []Folder) {
 		Icon(iconStar).
 		Var("action", "-favorites")
 
+	if orgs, _, err := loadCacheCollections(); err == nil && len(orgs) > 0 {
+		addOrganizationsItem(orgs)
+	}
+
 	for _, folder := range folders {
 		itemCount := getItemsInFolderCount(folder.Id, items)
 		id := "null"
 		if folder.Id != "" {
 			id = folder.Id
 		}
-		if opts.Query != "" {
-			wf.NewItem(folder.Name).
-				Subtitle(fmt.Sprintf("%d items", itemCount)).Valid(true).
-				UID(id).
-				Icon(iconFolderOpen).
-				Var("action", "-folder").
-				Var("action2", fmt.Sprintf("-id %s ", id))
-		} else {
-			wf.NewItem(folder.Name).
-				Subtitle(fmt.Sprintf("%d items", itemCount)).Valid(true).
-				UID(id).
-				Icon(iconFolderOpen).
-				Var("action", "-folder").
-				Var("action2", fmt.Sprintf("-id %s ", id))
+		it := wf.NewItem(folder.Name).
+			Subtitle(fmt.Sprintf("%d items", itemCount)).Valid(true).
+			UID(id).
+			Icon(iconFolderOpen).
+			Var("action", "-folder").
+			Var("action2", fmt.Sprintf("-id %s ", id))
+		if folder.Id != "" {
+			addFolderModifiers(it, folder, itemCount)
 		}
 	}
+	addNewFolderItem()
 
 	if len(items) == 0 && len(folders) == 0 {
 		wf.WarnEmpty("No Secrets Found", "Try a different query or sync manually")
@@ -0,0 +1,266 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+const (
+	ORGANIZATION_CACHE_NAME = "bw-items-organizations"
+	COLLECTION_CACHE_NAME   = "bw-items-collections"
+)
+
+// collectionNames resolves the organization and collection ids of the items
+type collectionNames struct {
+	orgs        map[string]string
+	collections map[string]string
+}
+
+// searchCollections is loaded with the caches for the search of the current account
+var searchCollections collectionNames
+
+func newCollectionNames(orgs []Organization, collections []Collection) collectionNames {
+	names := collectionNames{
+		orgs:        make(map[string]string, len(orgs)),
+		collections: make(map[string]string, len(collections)),
+	}
+	for _, org := range orgs {
+		names.orgs[org.Id] = org.Name
+	}
+	for _, collection := range collections {
+		names.collections[collection.Id] = collection.Name
+	}
+	return names
+}
+
+// itemCollections returns the collection names of the item, unknown collections are shown with their id
+func (n collectionNames) itemCollections(item Item) []string {
+	var names []string
+	for _, id := range item.CollectionIds {
+		if name, ok := n.collections[id]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, id)
+		}
+	}
+	return names
+}
+
+// itemLocation returns "Organization › Collection, …" for items of an organization, empty for personal items
+func (n collectionNames) itemLocation(item Item) string {
+	org, ok := n.orgs[item.OrganizationId]
+	if item.OrganizationId == "" || !ok {
+		return ""
+	}
+	if len(item.CollectionIds) == 0 {
+		return org
+	}
+	return fmt.Sprintf("%s › %s", org, strings.Join(n.itemCollections(item), ", "))
+}
+
+// sortByName sorts organizations and collections like the Bitwarden clients list them
+func sortByName(orgs []Organization, collections []Collection) {
+	sort.SliceStable(orgs, func(i, j int) bool {
+		return strings.ToLower(orgs[i].Name) < strings.ToLower(orgs[j].Name)
+	})
+	sort.SliceStable(collections, func(i, j int) bool {
+		return strings.ToLower(collections[i].Name) < strings.ToLower(collections[j].Name)
+	})
+}
+
+// decryptCollections returns the organizations of the profile and the collections decrypted with the organization keys
+func decryptCollections(sync syncResponse, keys vaultKeys) ([]Organization, []Collection, error) {
+	var orgs []Organization
+	for _, org := range sync.Profile.Organizations {
+		orgs = append(orgs, Organization{Object: "organization", Id: org.Id, Name: org.Name})
+	}
+	var collections []Collection
+	for _, c := range sync.Collections {
+		key, ok := keys.orgs[c.OrganizationId]
+		if !ok {
+			return nil, nil, fmt.Errorf("no key found for organization %s of collection %s", c.OrganizationId, c.Id)
+		}
+		name, err := DecryptString(c.Name, key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decrypting collection %s, %s", c.Id, err)
+		}
+		collections = append(collections, Collection{Object: "collection", Id: c.Id, OrganizationId: c.OrganizationId, Name: name})
+	}
+	sortByName(orgs, collections)
+	return orgs, collections, nil
+}
+
+// runGetCollections uses the Bitwarden CLI to get the organizations and collections,
+// errors are only logged as the items can be searched without them
+func runGetCollections(token string) ([]Organization, []Collection) {
+	var orgs []Organization
+	var collections []Collection
+	args := fmt.Sprintf("%s list organizations --session %s", conf.BwExec, token)
+	result, err := runCmd(args, "Failed to get Bitwarden organizations.")
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		return nil, nil
+	}
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &orgs); err != nil {
+		log.Printf("Failed to unmarshall body. Err: %s", err)
+		return nil, nil
+	}
+	if len(orgs) == 0 {
+		return nil, nil
+	}
+	args = fmt.Sprintf("%s list collections --session %s", conf.BwExec, token)
+	result, err = runCmd(args, "Failed to get Bitwarden collections.")
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		return orgs, nil
+	}
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &collections); err != nil {
+		log.Printf("Failed to unmarshall body. Err: %s", err)
+	}
+	sortByName(orgs, collections)
+	return orgs, collections
+}
+
+// getItemsInCollectionCount returns the number of items which are in collection id
+func getItemsInCollectionCount(id string, items []Item) int {
+	count := 0
+	for _, item := range items {
+		for _, collectionId := range item.CollectionIds {
+			if collectionId == id {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// getItemsInOrganizationCount returns the number of items which are owned by organization id
+func getItemsInOrganizationCount(id string, items []Item) int {
+	count := 0
+	for _, item := range items {
+		if item.OrganizationId == id {
+			count++
+		}
+	}
+	return count
+}
+
+// addOrganizationsItem opens the organizations browser from the folder search
+func addOrganizationsItem(orgs []Organization) {
+	subtitle := fmt.Sprintf("%d organizations", len(orgs))
+	if len(orgs) == 1 {
+		subtitle = orgs[0].Name
+	}
+	wf.NewItem("Organizations").
+		Subtitle(subtitle).
+		Valid(true).
+		UID("organizations").
+		Icon(iconOrg).
+		Var("action", "-orgs")
+}
+
+// addBackToFolderSearchItem goes back to the folder search
+func addBackToFolderSearchItem() {
+	wf.NewItem("Go Back to Folder Search").
+		Valid(true).
+		UID("").
+		Icon(iconFolder).
+		Var("action", "-search").
+		Arg(conf.BwfKeyword).
+		Match(".")
+}
+
+// addBackToOrganizationsItem goes back to the organizations browser
+func addBackToOrganizationsItem() {
+	wf.NewItem("Go Back to Organizations").
+		Valid(true).
+		UID("").
+		Icon(iconOrg).
+		Var("action", "-orgs").
+		Match(".")
+}
+
+// runSearchCollections browses the items by organization and collection,
+// -orgs lists the organizations, -org -id the collections of an organization
+// and -collection -id the items of a collection
+func runSearchCollections(items []Item, autoFetchCache bool) {
+	orgs, collections, err := loadCacheCollections()
+	if err != nil {
+		log.Printf("Couldn't load the collections cache, error: %s", err)
+	}
+
+	switch {
+	case opts.Collection:
+		var collection Collection
+		for _, c := range collections {
+			if c.Id == opts.Id {
+				collection = c
+			}
+		}
+		for _, item := range items {
+			for _, id := range item.CollectionIds {
+				if id == opts.Id {
+					addItemsToWorkflow(item, autoFetchCache)
+					break
+				}
+			}
+		}
+		if org, ok := searchCollections.orgs[collection.OrganizationId]; ok {
+			wf.NewItem(fmt.Sprintf("Go Back to %s", org)).
+				Valid(true).
+				UID("").
+				Icon(iconOrg).
+				Var("action", "-org").
+				Var("action2", fmt.Sprintf("-id %s", collection.OrganizationId)).
+				Match(".")
+		} else {
+			addBackToOrganizationsItem()
+		}
+	case opts.Org:
+		for _, collection := range collections {
+			if collection.OrganizationId != opts.Id {
+				continue
+			}
+			wf.NewItem(collection.Name).
+				Subtitle(fmt.Sprintf("%d items", getItemsInCollectionCount(collection.Id, items))).
+				Valid(true).
+				UID(collection.Id).
+				Icon(iconBoxes).
+				Var("action", "-collection").
+				Var("action2", fmt.Sprintf("-id %s", collection.Id))
+		}
+		addBackToOrganizationsItem()
+	default:
+		for _, org := range orgs {
+			collectionCount := 0
+			for _, collection := range collections {
+				if collection.OrganizationId == org.Id {
+					collectionCount++
+				}
+			}
+			wf.NewItem(org.Name).
+				Subtitle(fmt.Sprintf("%d items ∙ %d collections", getItemsInOrganizationCount(org.Id, items), collectionCount)).
+				Valid(true).
+				UID(org.Id).
+				Icon(iconOrg).
+				Var("action", "-org").
+				Var("action2", fmt.Sprintf("-id %s", org.Id))
+		}
+		if len(orgs) == 0 {
+			wf.NewItem("No Organizations Found").
+				Subtitle("Sync the vault if you joined an organization recently").
+				Icon(iconWarning).
+				Valid(false)
+		}
+		addBackToFolderSearchItem()
+	}
+	wf.WarnEmpty("No Secrets Found", "Try a different query")
+	wf.SendFeedback()
+}
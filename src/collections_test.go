@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func Test_decryptCollections(t *testing.T) {
+	orgKey := newTestKey(t)
+	sync := syncResponse{
+		Profile: syncProfile{Organizations: []syncOrganization{
+			{Id: "org-2", Name: "Zeta"},
+			{Id: "org-1", Name: "acme"},
+		}},
+		Collections: []syncCollection{
+			{Id: "coll-2", OrganizationId: "org-1", Name: encryptTestString(t, "Ops", orgKey)},
+			{Id: "coll-1", OrganizationId: "org-1", Name: encryptTestString(t, "Engineering", orgKey)},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		keys            vaultKeys
+		wantOrgs        []string
+		wantCollections []string
+		wantErr         bool
+	}{
+		{name: "sorted by name", keys: vaultKeys{orgs: map[string]CryptoKey{"org-1": orgKey}}, wantOrgs: []string{"acme", "Zeta"}, wantCollections: []string{"Engineering", "Ops"}},
+		{name: "missing organization key", keys: vaultKeys{}, wantErr: true},
+		{name: "wrong organization key", keys: vaultKeys{orgs: map[string]CryptoKey{"org-1": newTestKey(t)}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orgs, collections, err := decryptCollections(sync, tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decryptCollections() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var gotOrgs, gotCollections []string
+			for _, org := range orgs {
+				gotOrgs = append(gotOrgs, org.Name)
+			}
+			for _, collection := range collections {
+				gotCollections = append(gotCollections, collection.Name)
+				if collection.OrganizationId != "org-1" {
+					t.Errorf("collection %s organization = %q", collection.Id, collection.OrganizationId)
+				}
+			}
+			if !reflect.DeepEqual(gotOrgs, tt.wantOrgs) {
+				t.Errorf("decryptCollections() organizations = %v, want %v", gotOrgs, tt.wantOrgs)
+			}
+			if !reflect.DeepEqual(gotCollections, tt.wantCollections) {
+				t.Errorf("decryptCollections() collections = %v, want %v", gotCollections, tt.wantCollections)
+			}
+		})
+	}
+}
+
+func Test_readDataJsonVault_collections(t *testing.T) {
+	orgKey := newTestKey(t)
+	ciphers := map[string]interface{}{}
+	collections := map[string]interface{}{
+		"coll-1": map[string]interface{}{"id": "coll-1", "organizationId": "org-1", "name": encryptTestString(t, "Engineering", orgKey)},
+	}
+	orgs := map[string]interface{}{
+		"org-1": map[string]interface{}{"id": "org-1", "name": "Acme"},
+	}
+	oldLayout, _ := json.Marshal(map[string]interface{}{
+		"ciphers_user-1":       ciphers,
+		"collections_user-1":   collections,
+		"organizations_user-1": orgs,
+	})
+	accountLayout, _ := json.Marshal(map[string]interface{}{
+		"user-1": map[string]interface{}{"data": map[string]interface{}{
+			"ciphers":       map[string]interface{}{"encrypted": ciphers},
+			"collections":   map[string]interface{}{"encrypted": collections},
+			"organizations": orgs,
+		}},
+	})
+
+	tests := []struct {
+		name          string
+		data          []byte
+		accountLayout bool
+	}{
+		{name: "version 1.21.0 and earlier", data: oldLayout},
+		{name: "version 1.21.1 and above", data: accountLayout, accountLayout: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault, err := readDataJsonVault(tt.data, "user-1", tt.accountLayout)
+			if err != nil {
+				t.Fatalf("readDataJsonVault() error = %v", err)
+			}
+			orgs, collections, err := decryptCollections(vault, vaultKeys{orgs: map[string]CryptoKey{"org-1": orgKey}})
+			if err != nil {
+				t.Fatalf("decryptCollections() error = %v", err)
+			}
+			if got := fmt.Sprint(orgs, collections); got != "[{organization org-1 Acme}] [{collection coll-1 org-1 Engineering}]" {
+				t.Errorf("readDataJsonVault() organizations and collections = %s", got)
+			}
+		})
+	}
+}
+
+func Test_collectionNames_itemLocation(t *testing.T) {
+	names := newCollectionNames(
+		[]Organization{{Id: "org-1", Name: "Acme"}},
+		[]Collection{{Id: "coll-1", OrganizationId: "org-1", Name: "Engineering"}, {Id: "coll-2", OrganizationId: "org-1", Name: "Ops"}},
+	)
+	tests := []struct {
+		name string
+		item Item
+		want string
+	}{
+		{name: "personal item", item: Item{Id: "item-1"}, want: ""},
+		{name: "one collection", item: Item{OrganizationId: "org-1", CollectionIds: []string{"coll-1"}}, want: "Acme › Engineering"},
+		{name: "two collections", item: Item{OrganizationId: "org-1", CollectionIds: []string{"coll-2", "coll-1"}}, want: "Acme › Ops, Engineering"},
+		{name: "no collection", item: Item{OrganizationId: "org-1"}, want: "Acme"},
+		{name: "unknown collection", item: Item{OrganizationId: "org-1", CollectionIds: []string{"coll-9"}}, want: "Acme › coll-9"},
+		{name: "unknown organization", item: Item{OrganizationId: "org-9", CollectionIds: []string{"coll-1"}}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names.itemLocation(tt.item); got != tt.want {
+				t.Errorf("itemLocation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
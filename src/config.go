@@ -34,6 +34,7 @@ var (
 	mod5      []string
 	mod5Emoji string
 	bwData    BwData
+	secrets   alfred.SecretStore
 )
 
 func loadBitwardenJSON() error {
@@ -49,6 +50,7 @@ func loadBitwardenJSON() error {
 	if err := loadDataFile(bwDataPath); err != nil {
 		return err
 	}
+	loadProtectedKey()
 	return nil
 }
 
@@ -145,6 +147,9 @@ func decodeBitwardenDataJson(byteData []byte) (BwData, error) {
 					if val, ok := tokensVal.(map[string]interface{})["accessToken"]; ok {
 						newBwData.Tokens.AccessToken = fmt.Sprintf("%s", val)
 					}
+					if val, ok := tokensVal.(map[string]interface{})["refreshToken"]; ok {
+						newBwData.Tokens.RefreshToken = fmt.Sprintf("%s", val)
+					}
 				}
 				if profileVal, ok := userTable["profile"]; ok {
 					if val, ok := profileVal.(map[string]interface{})["everBeenUnlocked"]; ok {
@@ -170,6 +175,16 @@ func decodeBitwardenDataJson(byteData []byte) (BwData, error) {
 						newBwData.Kdf = int64(kdfFloat64)
 						newBwData.Profile.KdfType = newBwData.Kdf
 					}
+					if val, ok := profileVal.(map[string]interface{})["kdfMemory"]; ok && val != nil {
+						kdfMemoryFloat64, _ := strconv.ParseFloat(fmt.Sprintf("%f", val), 64)
+						newBwData.KdfMemory = int64(kdfMemoryFloat64)
+						newBwData.Profile.KdfMemory = newBwData.KdfMemory
+					}
+					if val, ok := profileVal.(map[string]interface{})["kdfParallelism"]; ok && val != nil {
+						kdfParallelismFloat64, _ := strconv.ParseFloat(fmt.Sprintf("%f", val), 64)
+						newBwData.KdfParallelism = int64(kdfParallelismFloat64)
+						newBwData.Profile.KdfParallelism = newBwData.KdfParallelism
+					}
 				}
 			}
 
@@ -179,6 +194,15 @@ func decodeBitwardenDataJson(byteData []byte) (BwData, error) {
 			newBwData.UserEmail = fmt.Sprintf("%s", table["userEmail"])
 			newBwData.ProtectedKey = fmt.Sprintf("%s", table["__PROTECTED__key"])
 			newBwData.EncKey = fmt.Sprintf("%s", table["encKey"])
+			if val, ok := table["encPrivateKey"]; ok && val != nil {
+				newBwData.Keys.PrivateKey.Encrypted = fmt.Sprintf("%s", val)
+			}
+			if val, ok := table["accessToken"]; ok && val != nil {
+				newBwData.Tokens.AccessToken = fmt.Sprintf("%s", val)
+			}
+			if val, ok := table["refreshToken"]; ok && val != nil {
+				newBwData.Tokens.RefreshToken = fmt.Sprintf("%s", val)
+			}
 
 			// kdfIterations is the only int/float value
 			kdfIteractionsFloat64, _ := strconv.ParseFloat(fmt.Sprintf("%f", table["kdfIterations"]), 64)
@@ -201,6 +225,18 @@ func loadConfig() {
 		log.Fatal(err.Error())
 	}
 
+	// the store for the session token and the cache key
+	rootSecrets, err = alfred.NewSecretStore(wf, conf.SecretStore, conf.SecretStoreKey)
+	if err != nil {
+		log.Printf("Error creating the secret store, falling back to the keychain: %s", err)
+		rootSecrets = wf.Keychain
+	}
+	secrets = rootSecrets
+
+	// the named accounts overwrite the email, server and data.json path
+	loadAccounts()
+	selectAccount()
+
 	// load the bitwarden data.json
 	err = loadBitwardenJSON()
 	if err != nil {
@@ -219,6 +255,9 @@ func loadConfig() {
 	autoFetchIconCacheAgeDuration := time.Duration(conf.AutoFetchIconCacheAge)
 	conf.AutoFetchIconMaxCacheAge = autoFetchIconCacheAgeDuration * time.Minute
 
+	attachmentViewAgeDuration := time.Duration(conf.AttachmentViewAge)
+	conf.AttachmentViewMaxAge = attachmentViewAgeDuration * time.Minute
+
 	conf.BwauthKeyword = os.Getenv("bwauth_keyword")
 	conf.BwconfKeyword = os.Getenv("bwconf_keyword")
 	conf.BwKeyword = os.Getenv("bw_keyword")
@@ -366,11 +405,12 @@ func setModAction(itemConfig itemsModifierActionRelationMap, item Item, itemType
 					Subtitle:     subtitle,
 					Sound:        true,
 					Action:       "output",
-					Action2:      " ",
+					Action2:      fmt.Sprintf("-id %s", item.Id),
 					Action3:      " ",
 					Arg:          item.Login.Username,
 					Icon:         assignedIcon,
 					ActionName:   action,
+					Usage:        "username",
 				}
 				setItemMod(itemConfig, modItem, itemType, modMode)
 			}
@@ -497,7 +537,7 @@ func setModAction(itemConfig itemsModifierActionRelationMap, item Item, itemType
 					Action:       "output",
 					Action2:      " ",
 					Action3:      " ",
-					Arg:          fmt.Sprintf("%s%s", item.Card.ExpMonth, item.Card.ExpYear[2:]),
+					Arg:          cardExpiration(item.Card),
 					Icon:         iconCalDay,
 					ActionName:   "",
 				}
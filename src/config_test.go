@@ -34,15 +34,20 @@ func Test_decodeBitwardenDataJson1(t *testing.T) {
 				KdfIterations:    50000,
 				Global:           BwGlobalData{},
 				Profile:          BwProfileData{},
-				Keys:             BwKeyData{},
-				Tokens:           BwTokens{},
-				Unused:           nil,
+				Keys: BwKeyData{
+					PrivateKey: BwPrivateKey{Encrypted: "ThisIsEncPrivateKey"},
+				},
+				Tokens: BwTokens{
+					AccessToken:  "ThisIsTheaccessToken",
+					RefreshToken: "ThisIsRefreshToken",
+				},
+				Unused: nil,
 			},
 		},
 		{
 			name: "since-1.21.1",
 			args: args{
-				byteData: []byte(`{"global":{"installedVersion":"1.21.1"},"userIdBlaBlubb":{"keys":{"masterKeyEncryptedUserKey":"ThisIsCryptoSymmetricKeyEncrypted","privateKey":{"encrypted":"ThisIsPrivateKeyEncrypted"},"apiKeyClientSecret":"ThisIsApiKeyClientSecret","legacyEtmKey":null},"profile":{"userId":"userIdBlaBlubb","email":"bitwarden@test.com","kdfIterations":50000,"kdfType":0,"lastSync":"2022-02-28T16:58:54.900Z","everBeenUnlocked":true},"tokens":{"accessToken":"ThisIsAccessToken"}},"activeUserId":"userIdBlaBlubb","__PROTECTED__userIdBlaBlubb_user_auto":"ThisIs__Protected__masterkey"}`),
+				byteData: []byte(`{"global":{"installedVersion":"1.21.1"},"userIdBlaBlubb":{"keys":{"masterKeyEncryptedUserKey":"ThisIsCryptoSymmetricKeyEncrypted","privateKey":{"encrypted":"ThisIsPrivateKeyEncrypted"},"apiKeyClientSecret":"ThisIsApiKeyClientSecret","legacyEtmKey":null},"profile":{"userId":"userIdBlaBlubb","email":"bitwarden@test.com","kdfIterations":50000,"kdfType":0,"lastSync":"2022-02-28T16:58:54.900Z","everBeenUnlocked":true},"tokens":{"accessToken":"ThisIsAccessToken","refreshToken":"ThisIsRefreshToken"}},"activeUserId":"userIdBlaBlubb","__PROTECTED__userIdBlaBlubb_user_auto":"ThisIs__Protected__masterkey"}`),
 			},
 			wantErr: false,
 			want: BwData{
@@ -76,7 +81,42 @@ func Test_decodeBitwardenDataJson1(t *testing.T) {
 					},
 				},
 				Tokens: BwTokens{
-					AccessToken: "ThisIsAccessToken",
+					AccessToken:  "ThisIsAccessToken",
+					RefreshToken: "ThisIsRefreshToken",
+				},
+			},
+		},
+		{
+			name: "argon2id",
+			args: args{
+				byteData: []byte(`{"global":{"installedVersion":"2023.2.0"},"userIdArgon":{"keys":{"cryptoSymmetricKey":{"encrypted":"ThisIsCryptoSymmetricKeyEncrypted"}},"profile":{"userId":"userIdArgon","email":"bitwarden@test.com","kdfIterations":3,"kdfMemory":64,"kdfParallelism":4,"kdfType":1}},"activeUserId":"userIdArgon"}`),
+			},
+			wantErr: false,
+			want: BwData{
+				InstalledVersion: "2023.2.0",
+				UserEmail:        "bitwarden@test.com",
+				UserId:           "userIdArgon",
+				ActiveUserId:     "userIdArgon",
+				EncKey:           "ThisIsCryptoSymmetricKeyEncrypted",
+				Kdf:              1,
+				KdfIterations:    3,
+				KdfMemory:        64,
+				KdfParallelism:   4,
+				Global: BwGlobalData{
+					InstalledVersion: "2023.2.0",
+				},
+				Profile: BwProfileData{
+					KdfIterations:  3,
+					KdfType:        1,
+					KdfMemory:      64,
+					KdfParallelism: 4,
+					Email:          "bitwarden@test.com",
+					UserId:         "userIdArgon",
+				},
+				Keys: BwKeyData{
+					CryptoSymmetricKey: BwCryptoSymmetricKey{
+						Encrypted: "ThisIsCryptoSymmetricKeyEncrypted",
+					},
 				},
 			},
 		},
@@ -21,6 +21,8 @@ type modifierActionContent struct {
 	Icon         *aw.Icon
 	ActionName   string
 	Sound        bool
+	// Usage is recorded as used action of the item when the output copies the Arg
+	Usage        string
 }
 
 type modifierActionRelation struct {
@@ -32,8 +34,13 @@ type itemsModifierActionRelationMap = map[string]map[string]modifierActionRelati
 
 type config struct {
 	// From workflow environment variables
+	Account                  string `envconfig:"BW_ACCOUNT" default:""`
+	AttachmentViewAge        int `default:"5" split_words:"true"`
+	AttachmentViewMaxAge     time.Duration
 	AutoFetchIconCacheAge    int `default:"1440" split_words:"true"`
 	AutoFetchIconMaxCacheAge time.Duration
+	BreachApiUrl             string `envconfig:"BREACH_API_URL" default:"https://api.pwnedpasswords.com"`
+	BreachCacheAge           int    `envconfig:"BREACH_CACHE_AGE" default:"1440"`
 	BwconfKeyword            string
 	BwauthKeyword            string
 	BwKeyword                string
@@ -42,12 +49,20 @@ type config struct {
 	// BwDataPath default is set in loadBitwardenJSON()
 	BwDataPath         string `envconfig:"BW_DATA_PATH"`
 	Debug              bool   `envconfig:"DEBUG" default:"false"`
+	DefaultUriMatch    string `envconfig:"DEFAULT_URI_MATCH" default:"domain"`
 	Email              string
 	EmailMaxWait       int  `envconfig:"EMAIL_MAX_WAIT" default:"15"`
 	EmptyDetailResults bool `default:"false" split_words:"true"`
+	FrecencyHalfLife   int  `envconfig:"FRECENCY_HALF_LIFE" default:"14"`
+	GeneratorAvoidAmbiguous bool   `envconfig:"GENERATOR_AVOID_AMBIGUOUS" default:"true"`
+	GeneratorCharacters     string `envconfig:"GENERATOR_CHARACTERS" default:"lower,upper,numbers,special"`
+	GeneratorLength         int    `envconfig:"GENERATOR_LENGTH" default:"20"`
+	HealthMaxPasswordAge    int    `envconfig:"HEALTH_MAX_PASSWORD_AGE" default:"365"`
+	HealthMinBits           int    `envconfig:"HEALTH_MIN_BITS" default:"50"`
 	IconCacheAge       int  `default:"43200" split_words:"true"`
 	IconCacheEnabled   bool `default:"true" split_words:"true"`
 	IconMaxCacheAge    time.Duration
+	ItemTemplates      string `envconfig:"ITEM_TEMPLATES" default:""`
 	MaxResults         int    `default:"1000" split_words:"true"`
 	Mod1               string `envconfig:"MODIFIER_1" default:"alt"`
 	Mod1Action         string `envconfig:"MODIFIER_1_ACTION" default:"username,code"`
@@ -59,21 +74,42 @@ type config struct {
 	Mod4Action         string `envconfig:"MODIFIER_4_ACTION" default:"more"`
 	Mod5               string `envconfig:"MODIFIER_5" default:"cmd,shift"`
 	Mod5Action         string `envconfig:"MODIFIER_5_ACTION" default:"webui"`
+	NativeUnlock       bool   `envconfig:"NATIVE_UNLOCK" default:"false"`
 	NoModAction        string `envconfig:"NO_MODIFIER_ACTION" default:"password,card"`
 	OpenLoginUrl       bool   `envconfig:"OPEN_LOGIN_URL" default:"true"`
 	OutputFolder       string `default:"" split_words:"true"`
+	PassphraseCapitalize bool   `envconfig:"PASSPHRASE_CAPITALIZE" default:"false"`
+	PassphraseNumber     bool   `envconfig:"PASSPHRASE_NUMBER" default:"false"`
+	PassphraseSeparator  string `envconfig:"PASSPHRASE_SEPARATOR" default:"-"`
+	PassphraseWordlist   string `envconfig:"PASSPHRASE_WORDLIST" default:""`
+	PassphraseWords      int    `envconfig:"PASSPHRASE_WORDS" default:"5"`
 	Path               string
 	ReorderingDisabled bool   `default:"true" split_words:"true"`
+	SearchAllAccounts  bool   `envconfig:"SEARCH_ALL_ACCOUNTS" default:"false"`
+	SecretStore        string `envconfig:"SECRET_STORE" default:"keychain"`
+	SecretStoreKey     string `envconfig:"SECRET_STORE_KEY" default:""`
+	SendDeletionDays   int    `envconfig:"SEND_DELETION_DAYS" default:"7"`
 	Server             string `envconfig:"SERVER_URL" default:"https://bitwarden.com"`
 	Sfa                bool   `envconfig:"2FA_ENABLED" default:"true"`
 	SfaMode            int    `envconfig:"2FA_MODE" default:"0"`
 	SkipTypes          string `envconfig:"SKIP_TYPES" default:""`
+	SyncMode           string `envconfig:"SYNC_MODE" default:"cli"`
 	TitleWithUser      bool   `envconfig:"TITLE_WITH_USER" default:"true"`
+	TotpClockOffset    int    `envconfig:"TOTP_CLOCK_OFFSET" default:"0"`
+	TotpWaitSeconds    int    `envconfig:"TOTP_WAIT_SECONDS" default:"0"`
 	TitleWithUrls      bool   `envconfig:"TITLE_WITH_URLS" default:"true"`
 	UseApikey          bool   `envconfig:"USE_APIKEY" default:"false"`
 	WebUiURL           string `envconfig:"WEBUI_URL" default:"https://vault.bitwarden.com"`
 }
 
+// Account is a named Bitwarden account with its own Bitwarden CLI data directory
+type Account struct {
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	Server     string `json:"server"`
+	AppDataDir string `json:"appDataDir,omitempty"`
+}
+
 type BwData struct {
 	path string
 	// InstalledVersion is not any longer in this location in the structure of >= 1.21
@@ -92,6 +128,9 @@ type BwData struct {
 	Kdf int64 `json:"kdf"`
 	// KdfIterations is not any longer in this location in the structure of >= 1.21
 	KdfIterations int64 `json:"kdfIterations"`
+	// KdfMemory in MiB and KdfParallelism are only used by Argon2id
+	KdfMemory      int64 `json:"kdfMemory"`
+	KdfParallelism int64 `json:"kdfParallelism"`
 	// used in >= 1.21
 	Global  BwGlobalData           `json:"global"`
 	Profile BwProfileData          `json:"profile"`
@@ -107,11 +146,14 @@ type BwProfileData struct {
 	LastSync         string `json:"lastSync"`
 	KdfIterations    int64  `json:"kdfIterations"`
 	KdfType          int64  `json:"kdfType"`
+	KdfMemory        int64  `json:"kdfMemory"`
+	KdfParallelism   int64  `json:"kdfParallelism"`
 	Email            string `json:"email"`
 	UserId           string `json:"userId"`
 }
 type BwTokens struct {
-	AccessToken string `json:"accessToken"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
 }
 type BwKeyData struct {
 	ApiKeyClientSecret string               `json:"apiKeyClientSecret"`
@@ -0,0 +1,363 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/generator"
+	aw "github.com/deanishe/awgo"
+)
+
+const (
+	// GENERATED_LOGIN_NAME is the name of a login created with a generated password if no name is given
+	GENERATED_LOGIN_NAME = "Generated Password"
+	// CREATE_SEPARATOR separates the template and the values of the steps in the query of the create flow
+	CREATE_SEPARATOR = " › "
+	// ITEM_TEMPLATES_FILE is the file name of the user-defined templates in the workflow data folder
+	ITEM_TEMPLATES_FILE = "templates.json"
+)
+
+// itemTemplate is a kind of item which can be created. Notes and the values of the fields are
+// the defaults, every field of a template is asked for after the values of the item type.
+type itemTemplate struct {
+	Name   string  `json:"name"`
+	Type   int     `json:"type"`
+	Notes  string  `json:"notes"`
+	Fields []Field `json:"fields"`
+}
+
+// createStep is a value which is asked for when an item is created
+type createStep struct {
+	Title   string
+	Key     string
+	Default string
+	Secret  bool
+}
+
+// builtinTemplates are the item types without preset fields
+var builtinTemplates = []itemTemplate{
+	{Name: "Login", Type: 1},
+	{Name: "Secure Note", Type: 2},
+	{Name: "Card", Type: 3},
+	{Name: "Identity", Type: 4},
+}
+
+// itemTypeSteps are the values which are asked for each item type, the keys are the json names
+var itemTypeSteps = map[int][]createStep{
+	1: {{Title: "Username", Key: "username"}, {Title: "Password", Key: "password", Secret: true}, {Title: "URI", Key: "uri"}},
+	2: {{Title: "Note", Key: "notes"}},
+	3: {{Title: "Cardholder name", Key: "cardholderName"}, {Title: "Number", Key: "number", Secret: true},
+		{Title: "Expiration month", Key: "expMonth"}, {Title: "Expiration year", Key: "expYear"}, {Title: "Security code", Key: "code", Secret: true}},
+	4: {{Title: "First name", Key: "firstName"}, {Title: "Last name", Key: "lastName"}, {Title: "Email", Key: "email"},
+		{Title: "Phone", Key: "phone"}, {Title: "Company", Key: "company"}},
+}
+
+var itemTypeIcons = map[int]*aw.Icon{1: iconPassword, 2: iconNote, 3: iconCreditCard, 4: iconIdCard}
+
+// newLogin is the login of a new item
+type newLogin struct {
+	Uris     []Uri   `json:"uris"`
+	Username string  `json:"username"`
+	Password string  `json:"password"`
+	Totp     *string `json:"totp"`
+}
+
+// newItem is the item which is passed to "bw create item", unset ids have to be null
+type newItem struct {
+	OrganizationId *string         `json:"organizationId"`
+	FolderId       *string         `json:"folderId"`
+	Type           int             `json:"type"`
+	Name           string          `json:"name"`
+	Notes          string          `json:"notes"`
+	Favorite       bool            `json:"favorite"`
+	Fields         []Field         `json:"fields"`
+	Login          *newLogin       `json:"login,omitempty"`
+	SecureNote     *SecureNoteType `json:"secureNote,omitempty"`
+	Card           *CardInfo       `json:"card,omitempty"`
+	Identity       *Identity       `json:"identity,omitempty"`
+	Reprompt       int             `json:"reprompt"`
+}
+
+// encodeItem encodes the item like "bw encode" does
+func encodeItem(item interface{}) (string, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// createItem creates the item with the Bitwarden CLI and returns it as it was stored by Bitwarden,
+// the encoded item is passed via stdin so the secrets don't show up in the process list
+func createItem(item newItem, token string) (Item, error) {
+	encoded, err := encodeItem(item)
+	if err != nil {
+		return Item{}, err
+	}
+	args := fmt.Sprintf("%s create item --session %s", conf.BwExec, token)
+	result, err := runCmdWithStdin(args, encoded, "Failed to create the Bitwarden item.")
+	if err != nil {
+		return Item{}, err
+	}
+	var created Item
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &created); err != nil {
+		return Item{}, fmt.Errorf("invalid response of bw create item, %s", err)
+	}
+	return created, nil
+}
+
+// runCreateLogin creates a login with the password passed as query, the name is taken
+// from the variable "name" which is set by the item which triggers the action
+func runCreateLogin() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	if opts.Query == "" {
+		wf.Fatal("No password sent.")
+		return
+	}
+
+	name := strings.TrimSpace(os.Getenv("name"))
+	if name == "" {
+		name = GENERATED_LOGIN_NAME
+	}
+	item := newItem{
+		Type:   1,
+		Name:   name,
+		Fields: []Field{},
+		Login:  &newLogin{Uris: []Uri{}, Password: opts.Query},
+	}
+	created, err := createItem(item, token)
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	debugLog(fmt.Sprintf("Created item %s", created.Id))
+	if err := storeCacheItem(created); err != nil {
+		log.Printf("Error adding the item to the cache: %s", err)
+		fmt.Printf("Created login %s. It shows up after the next sync.", created.Name)
+		return
+	}
+	fmt.Printf("Created login %s.", created.Name)
+}
+
+// loadTemplates returns the built-in templates and the user-defined templates of ITEM_TEMPLATES
+// or the templates.json of the workflow data folder
+func loadTemplates() ([]itemTemplate, error) {
+	templates := append([]itemTemplate{}, builtinTemplates...)
+	path := conf.ItemTemplates
+	if path == "" {
+		path = filepath.Join(wf.DataDir(), ITEM_TEMPLATES_FILE)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return templates, nil
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return templates, err
+	}
+	var userTemplates []itemTemplate
+	if err := json.Unmarshal(data, &userTemplates); err != nil {
+		return templates, fmt.Errorf("invalid templates in %s, %s", path, err)
+	}
+	for _, template := range userTemplates {
+		if _, ok := itemTypeSteps[template.Type]; !ok || template.Name == "" {
+			return templates, fmt.Errorf("template %q in %s needs a name and a type from 1 to 4", template.Name, path)
+		}
+	}
+	return append(templates, userTemplates...), nil
+}
+
+// templateSteps returns the steps of the template, the name is always asked first
+func templateSteps(template itemTemplate) []createStep {
+	steps := []createStep{{Title: "Name", Key: "name"}}
+	for _, step := range itemTypeSteps[template.Type] {
+		if step.Key == "notes" {
+			step.Default = template.Notes
+		}
+		steps = append(steps, step)
+	}
+	for i, field := range template.Fields {
+		steps = append(steps, createStep{Title: field.Name, Key: fmt.Sprintf("field:%d", i), Default: field.Value, Secret: field.Type == 1})
+	}
+	return steps
+}
+
+// buildNewItem returns the item of the template with the values of the steps,
+// empty values are replaced by the defaults of the steps
+func buildNewItem(template itemTemplate, values []string) newItem {
+	v := map[string]string{}
+	for i, step := range templateSteps(template) {
+		v[step.Key] = step.Default
+		if i < len(values) && values[i] != "" {
+			v[step.Key] = values[i]
+		}
+	}
+
+	item := newItem{Type: template.Type, Name: v["name"], Notes: v["notes"], Fields: []Field{}}
+	switch template.Type {
+	case 1:
+		item.Login = &newLogin{Uris: []Uri{}, Username: v["username"], Password: v["password"]}
+		if v["uri"] != "" {
+			item.Login.Uris = append(item.Login.Uris, Uri{Uri: v["uri"]})
+		}
+	case 2:
+		item.SecureNote = &SecureNoteType{Type: 0}
+	case 3:
+		item.Card = &CardInfo{CardHolderName: v["cardholderName"], Number: v["number"], ExpMonth: v["expMonth"], ExpYear: v["expYear"], Code: v["code"]}
+	case 4:
+		item.Identity = &Identity{FirstName: v["firstName"], LastName: v["lastName"], Email: v["email"], Phone: v["phone"], Company: v["company"]}
+	}
+	for i, field := range template.Fields {
+		item.Fields = append(item.Fields, Field{Name: field.Name, Value: v[fmt.Sprintf("field:%d", i)], Type: field.Type})
+	}
+	return item
+}
+
+// runCreate collects the values of a new item step by step. The query is the template and the
+// values entered so far separated by CREATE_SEPARATOR, ⏎ moves on to the next step.
+func runCreate() {
+	wf.Configure(aw.SuppressUIDs(true))
+	templates, err := loadTemplates()
+	if err != nil {
+		log.Printf("Error loading the templates: %s", err)
+		wf.NewItem("Can't load the item templates").
+			Subtitle(err.Error()).
+			Icon(iconWarning).
+			Valid(false)
+	}
+
+	parts := strings.Split(opts.Query, CREATE_SEPARATOR)
+	var template itemTemplate
+	found := false
+	for _, t := range templates {
+		if len(parts) > 1 && strings.EqualFold(t.Name, parts[0]) {
+			template, found = t, true
+		}
+	}
+	if !found {
+		for _, t := range templates {
+			wf.NewItem(t.Name).
+				Subtitle(fmt.Sprintf("Create a new item with the template %s", t.Name)).
+				Autocomplete(t.Name + CREATE_SEPARATOR).
+				Icon(itemTypeIcons[t.Type]).
+				Valid(false)
+		}
+		if opts.Query != "" {
+			wf.Filter(opts.Query)
+		}
+		wf.SendFeedback()
+		return
+	}
+
+	steps := templateSteps(template)
+	values := parts[1:]
+	// a value which contains the separator belongs to the last step
+	if len(values) > len(steps) {
+		values = append(values[:len(steps)-1], strings.Join(values[len(steps)-1:], CREATE_SEPARATOR))
+	}
+	current := len(values) - 1
+	step := steps[current]
+
+	title := fmt.Sprintf("%s: %s", step.Title, values[current])
+	if values[current] == "" && step.Default != "" {
+		title = fmt.Sprintf("%s: %s (default)", step.Title, step.Default)
+	}
+	hint := ""
+	if step.Key == "password" && template.Type == 1 {
+		hint = " ∙ empty generates a password"
+	}
+	if current < len(steps)-1 {
+		wf.NewItem(title).
+			Subtitle(fmt.Sprintf("Step %d of %d%s ∙ ⏎ next", current+1, len(steps), hint)).
+			Autocomplete(opts.Query + CREATE_SEPARATOR).
+			Icon(itemTypeIcons[template.Type]).
+			Valid(false)
+	} else {
+		item := buildNewItem(template, values)
+		encoded, err := encodeItem(item)
+		if err != nil {
+			wf.FatalError(err)
+			return
+		}
+		it := wf.NewItem(title).
+			Icon(itemTypeIcons[template.Type]).
+			Arg(encoded).
+			Var("action", "-createitem").
+			Var("action2", " ").
+			Var("action3", " ").
+			Var("notification", fmt.Sprintf("Created %s", item.Name)).
+			Valid(item.Name != "")
+		if item.Name == "" {
+			it.Subtitle(fmt.Sprintf("Step %d of %d ∙ the name is required", current+1, len(steps)))
+		} else {
+			it.Subtitle(fmt.Sprintf("Step %d of %d ∙ ⏎ create %s %q", current+1, len(steps), template.Name, item.Name))
+		}
+	}
+
+	// the values entered so far, secrets are masked like in the items cache
+	for i, value := range values[:current] {
+		if steps[i].Secret && value != "" {
+			value = "✳︎✳︎✳︎✳︎✳︎"
+		}
+		wf.NewItem(fmt.Sprintf("%s: %s", steps[i].Title, value)).
+			Subtitle(fmt.Sprintf("Step %d of %d", i+1, len(steps))).
+			Icon(iconList).
+			Valid(false)
+	}
+	wf.SendFeedback()
+}
+
+// runCreateItem creates the item passed encoded as query and adds it to the items cache,
+// a login without a password gets a generated one
+func runCreateItem() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(opts.Query)
+	if err != nil {
+		wf.Fatal("No item sent.")
+		return
+	}
+	var item newItem
+	if err := json.Unmarshal(data, &item); err != nil || item.Name == "" {
+		wf.Fatal("Invalid item sent.")
+		return
+	}
+	if item.Type == 1 && item.Login != nil && item.Login.Password == "" {
+		passwordOpts, _, _, err := generatorOptions("")
+		if err == nil {
+			item.Login.Password, err = generator.New(nil).Password(passwordOpts)
+		}
+		if err != nil {
+			wf.FatalError(err)
+			return
+		}
+	}
+
+	created, err := createItem(item, token)
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	debugLog(fmt.Sprintf("Created item %s", created.Id))
+	if err := storeCacheItem(created); err != nil {
+		log.Printf("Error adding the item to the cache: %s", err)
+		fmt.Printf("Created %s. It shows up after the next sync.", created.Name)
+		return
+	}
+	fmt.Printf("Created %s.", created.Name)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_buildNewItem(t *testing.T) {
+	server := itemTemplate{
+		Name:  "Server",
+		Type:  2,
+		Notes: "Managed by ansible",
+		Fields: []Field{
+			{Name: "host", Type: 0},
+			{Name: "port", Value: "22", Type: 0},
+			{Name: "root password", Type: 1},
+		},
+	}
+	tests := []struct {
+		name     string
+		template itemTemplate
+		values   []string
+		want     string
+	}{
+		{
+			name:     "login",
+			template: builtinTemplates[0],
+			values:   []string{"GitHub", "octocat", "secret", "https://github.com"},
+			want:     `{"organizationId":null,"folderId":null,"type":1,"name":"GitHub","notes":"","favorite":false,"fields":[],"login":{"uris":[{"match":null,"uri":"https://github.com"}],"username":"octocat","password":"secret","totp":null},"reprompt":0}`,
+		},
+		{
+			name:     "login without uri and password",
+			template: builtinTemplates[0],
+			values:   []string{"GitHub", "octocat"},
+			want:     `{"organizationId":null,"folderId":null,"type":1,"name":"GitHub","notes":"","favorite":false,"fields":[],"login":{"uris":[],"username":"octocat","password":"","totp":null},"reprompt":0}`,
+		},
+		{
+			name:     "secure note",
+			template: builtinTemplates[1],
+			values:   []string{"Wifi", "the password is on the router"},
+			want:     `{"organizationId":null,"folderId":null,"type":2,"name":"Wifi","notes":"the password is on the router","favorite":false,"fields":[],"secureNote":{"type":0},"reprompt":0}`,
+		},
+		{
+			name:     "card",
+			template: builtinTemplates[2],
+			values:   []string{"Visa", "Jane Doe", "4111111111111111", "12", "2030", "123"},
+			want:     `{"organizationId":null,"folderId":null,"type":3,"name":"Visa","notes":"","favorite":false,"fields":[],"card":{"cardholderName":"Jane Doe","brand":"","number":"4111111111111111","expMonth":"12","expYear":"2030","code":"123"},"reprompt":0}`,
+		},
+		{
+			name:     "identity",
+			template: builtinTemplates[3],
+			values:   []string{"Me", "Jane", "Doe", "jane@example.com"},
+			want:     `{"organizationId":null,"folderId":null,"type":4,"name":"Me","notes":"","favorite":false,"fields":[],"identity":{"title":"","firstName":"Jane","middleName":"","lastName":"Doe","address1":"","address2":"","address3":"","city":"","state":"","postalCode":"","country":"","company":"","email":"jane@example.com","phone":"","ssn":"","username":"","passportNumber":"","licenseNumber":""},"reprompt":0}`,
+		},
+		{
+			name:     "template with defaults",
+			template: server,
+			values:   []string{"web-1", "", "web-1.example.com", "", "toor"},
+			want:     `{"organizationId":null,"folderId":null,"type":2,"name":"web-1","notes":"Managed by ansible","favorite":false,"fields":[{"name":"host","value":"web-1.example.com","type":0},{"name":"port","value":"22","type":0},{"name":"root password","value":"toor","type":1}],"secureNote":{"type":0},"reprompt":0}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(buildNewItem(tt.template, tt.values))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("buildNewItem() = %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_templateSteps(t *testing.T) {
+	template := itemTemplate{Name: "Server", Type: 1, Fields: []Field{{Name: "host"}, {Name: "api key", Type: 1}}}
+	steps := templateSteps(template)
+	var keys []string
+	for _, step := range steps {
+		keys = append(keys, step.Key)
+	}
+	want := []string{"name", "username", "password", "uri", "field:0", "field:1"}
+	if len(keys) != len(want) {
+		t.Fatalf("templateSteps() = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("templateSteps() = %v, want %v", keys, want)
+		}
+	}
+	if !steps[2].Secret || !steps[5].Secret || steps[4].Secret {
+		t.Errorf("templateSteps() secrets = %+v", steps)
+	}
+}
@@ -5,93 +5,47 @@ package main
 
 import (
 	"crypto/hmac"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/hex"
 	"errors"
 	"fmt"
-	"golang.org/x/crypto/nacl/secretbox"
-	"io"
 	"log"
-	"strings"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
 )
 
+// Encrypt stores the items JSON encrypted as items cache, see sealCache.
+// The key is derived from the session, so the cache can only be read while the vault is unlocked.
 func Encrypt(message []byte) (string, bool) {
-	var nonce [24]byte
-	_, err := io.ReadAtLeast(rand.Reader, nonce[:], 24)
-	if err != nil {
-		log.Println(err)
-	}
-	var password [32]byte
-	_, err = io.ReadAtLeast(rand.Reader, password[:], 32)
-	if err != nil {
-		log.Println(err)
-	}
-	encrypted := secretbox.Seal(nil, message, &nonce, &password)
-	base64Enc := base64.StdEncoding.EncodeToString(password[:])
-	err = wf.Keychain.Set("encryptPassword", base64Enc)
+	sealed, err := sealCache(message, bwData.UserId, sessionCacheKey)
 	if err != nil {
 		log.Println(err)
+		return "", false
 	}
 
-	// if wf.Debug() {
-		// log.Printf("%T \n", encrypted)
-	// }
-	enHex := fmt.Sprintf("%x:%x", nonce[:], encrypted)
-	// if wf.Debug() {
-		// log.Println("ENCRYPTED:", enHex[0:5])
-	// }
-	err = wf.Cache.Store(CACHE_NAME, []byte(enHex))
+	err = wf.Cache.Store(cacheName(CACHE_NAME), sealed)
 	if err != nil {
 		log.Println(err)
 	}
-	return enHex, true
+	return string(sealed), true
 }
 
+// Decrypt returns the items JSON of the items cache. Corrupt caches and the ones of older
+// versions return an error for which isCacheError is true, they are rebuilt with a full sync.
 func Decrypt() ([]byte, error) {
-	// log.Println("Decrypting data.")
-	encryptedHex, err := wf.Cache.Load(CACHE_NAME)
+	blob, err := wf.Cache.Load(cacheName(CACHE_NAME))
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
-	var nonce2 [24]byte
-	parts := strings.SplitN(string(encryptedHex), ":", 2)
-	if len(parts) < 2 {
-		log.Println("expected nonce")
-		return nil, errors.New("expected nonce")
-	}
-	//get nonce
-	bs, err := hex.DecodeString(parts[0])
-	if err != nil || len(bs) != 24 {
-		log.Println("invalid nonce")
-		return nil, errors.New("invalid nonce")
-	}
-	copy(nonce2[:], bs)
-	// get message
-	bs, err = hex.DecodeString(parts[1])
-	if err != nil {
-		log.Println("invalid message")
-		return nil, errors.New("invalid message")
-	}
-	passwordBase64, err := wf.Keychain.Get("encryptPassword")
-	if err != nil {
-		log.Println(err)
-	}
-	decoded64, err := base64.StdEncoding.DecodeString(passwordBase64)
-	if err != nil {
-		log.Println(err)
-	}
-	var password [32]byte
-	copy(password[:], decoded64)
 
-	// you need the password to open the sealed secret box
-	msg, ok := secretbox.Open(nil, bs, &nonce2, &password)
-	if !ok {
-		log.Print("invalid message")
+	msg, err := openCache(blob, bwData.UserId, sessionCacheKey)
+	if errors.Is(err, errCacheOutdated) {
+		if err := secrets.Delete(LEGACY_CACHE_KEY_NAME); err != nil && !errors.Is(err, alfred.ErrSecretNotFound) {
+			log.Println(err)
+		}
 	}
-	return msg, nil
+	return msg, err
 }
 
 // These notes helped a lot https://github.com/attie/bitwarden-decrypt
@@ -100,11 +54,11 @@ func Decrypt() ([]byte, error) {
 const (
 	AesCbc256_B64 = 0
 	//AesCbc128_HmacSha256_B64          = 1
-	AesCbc256_HmacSha256_B64 = 2
-	//Rsa2048_OaepSha256_B64            = 3
-	//Rsa2048_OaepSha1_B64              = 4
-	//Rsa2048_OaepSha256_HmacSha256_B64 = 5
-	//Rsa2048_OaepSha1_HmacSha256_B64   = 6
+	AesCbc256_HmacSha256_B64          = 2
+	Rsa2048_OaepSha256_B64            = 3
+	Rsa2048_OaepSha1_B64              = 4
+	Rsa2048_OaepSha256_HmacSha256_B64 = 5
+	Rsa2048_OaepSha1_HmacSha256_B64   = 6
 )
 
 type CipherString struct {
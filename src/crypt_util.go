@@ -4,18 +4,19 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"github.com/pquerna/otp/totp"
 	"golang.org/x/crypto/hkdf"
+	"hash"
 	"io"
 	// "log"
-	"regexp"
 	"strconv"
 	"strings"
-	"time"
 )
 
 func DecryptString(s string, mk CryptoKey) (string, error) {
@@ -120,13 +121,86 @@ func NewCipherString(encryptedString string) (*CipherString, error) {
 		cs.initializationVector = encPieces[0]
 		cs.cipherText = encPieces[1]
 		cs.mac = encPieces[2]
+	case Rsa2048_OaepSha256_B64, Rsa2048_OaepSha1_B64:
+		if len(encPieces) != 1 {
+			return nil, fmt.Errorf("invalid key body len %d", len(encPieces))
+		}
+		cs.cipherText = encPieces[0]
+	case Rsa2048_OaepSha256_HmacSha256_B64, Rsa2048_OaepSha1_HmacSha256_B64:
+		if len(encPieces) != 2 {
+			return nil, fmt.Errorf("invalid key body len %d", len(encPieces))
+		}
+		cs.cipherText = encPieces[0]
+		cs.mac = encPieces[1]
 	default:
 		return nil, errors.New("unknown algorithm")
 	}
 	return &cs, nil
 }
 
+// isRsa reports if the CipherString is encrypted with a public key
+func (cs *CipherString) isRsa() bool {
+	switch cs.encryptionType {
+	case Rsa2048_OaepSha256_B64, Rsa2048_OaepSha1_B64, Rsa2048_OaepSha256_HmacSha256_B64, Rsa2048_OaepSha1_HmacSha256_B64:
+		return true
+	}
+	return false
+}
+
+// DecryptRsa decrypts a CipherString which was encrypted with the public key of the user.
+// The MAC of the HmacSha256 types is deprecated and not checked by the Bitwarden clients either.
+func (cs *CipherString) DecryptRsa(privateKey *rsa.PrivateKey) ([]byte, error) {
+	if !cs.isRsa() {
+		return nil, fmt.Errorf("encryption type %d is not RSA", cs.encryptionType)
+	}
+	ct, err := base64.StdEncoding.DecodeString(cs.cipherText)
+	if err != nil {
+		return nil, err
+	}
+	var h hash.Hash
+	switch cs.encryptionType {
+	case Rsa2048_OaepSha256_B64, Rsa2048_OaepSha256_HmacSha256_B64:
+		h = sha256.New()
+	default:
+		h = sha1.New()
+	}
+	return rsa.DecryptOAEP(h, nil, privateKey, ct, nil)
+}
+
+// DecryptPrivateKey decrypts the PKCS#8 encoded private key of the user with the user key
+func DecryptPrivateKey(encryptedKey string, userKey CryptoKey) (*rsa.PrivateKey, error) {
+	der, err := DecryptValue(encryptedKey, userKey)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key, %s", err)
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return privateKey, nil
+}
+
+// DecryptOrgKey unwraps the key of an organization with the private key of the user
+func DecryptOrgKey(encryptedKey string, privateKey *rsa.PrivateKey) (CryptoKey, error) {
+	cs, err := NewCipherString(encryptedKey)
+	if err != nil {
+		return CryptoKey{}, err
+	}
+	key, err := cs.DecryptRsa(privateKey)
+	if err != nil {
+		return CryptoKey{}, err
+	}
+	return NewCryptoKey(key, AesCbc256_HmacSha256_B64)
+}
+
 func (cs *CipherString) Decrypt(key CryptoKey) ([]byte, error) {
+	if cs.isRsa() {
+		return nil, fmt.Errorf("encryption type %d needs the private key", cs.encryptionType)
+	}
 	iv, err := base64.StdEncoding.DecodeString(cs.initializationVector)
 	if err != nil {
 		return nil, err
@@ -166,38 +240,18 @@ func (cs *CipherString) Decrypt(key CryptoKey) ([]byte, error) {
 }
 
 func unpad(src []byte) []byte {
-	n := src[len(src)-1]
-	return src[:len(src)-int(n)]
-}
-
-// TOTP related functions
-func otpKey(key string) (string, error) {
-	removedWhitespace := strings.ReplaceAll(key, " ", "")
-	fetchSecret := getTotpSecretFromString(removedWhitespace)
-	code, err := totp.GenerateCode(fetchSecret, time.Now().Add(5 * time.Second))
-	if err != nil {
-		return "", fmt.Errorf("error generating totp code, %s", err)
+	if len(src) == 0 {
+		return src
 	}
-	return code, nil
-}
-
-func getTotpSecretFromString(key string) string {
-	// need to get the secret
-	//?secret=JBSWY3DPE&is
-	re := regexp.MustCompile("secret=(.*?)&")
-	matches := re.MatchString(key)
-	if matches {
-		res := re.FindAllStringSubmatch(key, 1)
-		// log.Print(res[0][1])
-		return res[0][1]
-	}
-	re = regexp.MustCompile("secret=(.*)")
-	matches = re.MatchString(key)
-	if matches {
-		res := re.FindAllStringSubmatch(key, 1)
-		// log.Print(res[0][1])
-		return res[0][1]
-	}
-	// no matches, return original key
-	return key
+	n := int(src[len(src)-1])
+	// decrypting with a wrong key without MAC results in an invalid padding
+	if n == 0 || n > aes.BlockSize || n > len(src) {
+		return src
+	}
+	for _, b := range src[len(src)-n:] {
+		if int(b) != n {
+			return src
+		}
+	}
+	return src[:len(src)-n]
 }
@@ -0,0 +1,2277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
+	"github.com/blacs30/bitwarden-alfred-workflow/generator"
+)
+
+// The end-to-end tests run the workflow binary headless against a fake "bw" (see testdata/fakebw)
+// and a fake "zenity" which answers the password and code prompts.
+
+const (
+	e2eEmail     = "bitwarden@test.com"
+	e2ePassword  = "master-password"
+	e2eToken     = "session-token"
+	e2eBinary    = "bitwarden-alfred-workflow-e2e"
+	e2eDataJson  = `{"userEmail": "bitwarden@test.com", "userId": "user-1", "__PROTECTED__key": "invalid", "kdf": 0, "kdfIterations": 100000}`
+	e2eItemsJson = `[
+		{"object": "item", "id": "item-1", "folderId": "folder-1", "type": 1, "name": "GitHub",
+		 "login": {"username": "octocat", "password": "secret-password", "uris": [{"match": null, "uri": "https://github.com"}]}},
+		{"object": "item", "id": "item-2", "folderId": null, "type": 2, "name": "Server notes", "notes": "ssh root@example.com", "secureNote": {"type": 0}}
+	]`
+	e2eFoldersJson = `[{"object": "folder", "id": "folder-1", "name": "Work"}, {"object": "folder", "id": null, "name": "No Folder"}]`
+	fakeZenity     = `#!/bin/sh
+case "$1" in
+  --password) printf '%s\n' "$FAKE_PASSWORD" ;;
+  *) printf '%s\n' "$FAKE_ENTRY" ;;
+esac
+`
+)
+
+var (
+	e2eBuild    sync.Once
+	e2eBinDir   string
+	e2eBuildErr error
+)
+
+// testWorkflowDir holds the data and cache of the workflow in the unit tests, nothing is written
+// into the tree. It's set up as package variable which is initialized before the init of main.go.
+var testWorkflowDir = func() string {
+	dir, err := os.MkdirTemp("", "bitwarden-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("alfred_workflow_data", filepath.Join(dir, "data"))
+	os.Setenv("alfred_workflow_cache", filepath.Join(dir, "cache"))
+	return dir
+}()
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if e2eBinDir != "" {
+		os.RemoveAll(e2eBinDir)
+	}
+	os.RemoveAll(testWorkflowDir)
+	os.Exit(code)
+}
+
+// buildE2EBinaries builds the workflow, the fake bw and the fake zenity once for all tests
+func buildE2EBinaries(t *testing.T) string {
+	t.Helper()
+	e2eBuild.Do(func() {
+		e2eBinDir, e2eBuildErr = os.MkdirTemp("", "bitwarden-e2e")
+		if e2eBuildErr != nil {
+			return
+		}
+		for _, build := range [][]string{
+			{"-o", filepath.Join(e2eBinDir, e2eBinary), "."},
+			{"-o", filepath.Join(e2eBinDir, "bw"), "./testdata/fakebw"},
+		} {
+			out, err := exec.Command("go", append([]string{"build"}, build...)...).CombinedOutput()
+			if err != nil {
+				e2eBuildErr = fmt.Errorf("go build %s: %s\n%s", strings.Join(build, " "), err, out)
+				return
+			}
+		}
+		e2eBuildErr = os.WriteFile(filepath.Join(e2eBinDir, "zenity"), []byte(fakeZenity), 0755)
+	})
+	if e2eBuildErr != nil {
+		t.Fatal(e2eBuildErr)
+	}
+	return e2eBinDir
+}
+
+// bwResponse is a scripted response of the fake bw
+type bwResponse struct {
+	Args   string            `json:"args"`
+	Env    map[string]string `json:"env,omitempty"`
+	Stdout string            `json:"stdout,omitempty"`
+	Stderr string            `json:"stderr,omitempty"`
+	Files  map[string]string `json:"files,omitempty"`
+	Exit   int               `json:"exit"`
+}
+
+// alfredFeedback is the script filter JSON the workflow emits
+type alfredFeedback struct {
+	Rerun     float64           `json:"rerun"`
+	Variables map[string]string `json:"variables"`
+	Items     []struct {
+		Title     string            `json:"title"`
+		Subtitle  string            `json:"subtitle"`
+		Arg       string            `json:"arg"`
+		Uid       string            `json:"uid"`
+		Valid     bool              `json:"valid"`
+		Variables map[string]string `json:"variables"`
+		Mods      map[string]struct {
+			Subtitle  string            `json:"subtitle"`
+			Arg       string            `json:"arg"`
+			Variables map[string]string `json:"variables"`
+		} `json:"mods"`
+	} `json:"items"`
+}
+
+func (f alfredFeedback) titles() []string {
+	var titles []string
+	for _, item := range f.Items {
+		titles = append(titles, item.Title)
+	}
+	return titles
+}
+
+type e2eHarness struct {
+	t       *testing.T
+	binDir  string
+	dir     string
+	env     map[string]string
+	scripts []bwResponse
+}
+
+func newE2EHarness(t *testing.T) *e2eHarness {
+	t.Helper()
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("the fake zenity only works with the zenity implementation for unix")
+	}
+	if testing.Short() {
+		t.Skip("skipping end-to-end test in short mode")
+	}
+	h := &e2eHarness{t: t, binDir: buildE2EBinaries(t), dir: t.TempDir()}
+	h.env = map[string]string{
+		"PATH":                     fmt.Sprintf("%s%c%s", h.binDir, os.PathListSeparator, os.Getenv("PATH")),
+		"HOME":                     h.dir,
+		"alfred_workflow_bundleid": "com.lisowski-development.alfred.bitwarden",
+		"alfred_workflow_data":     filepath.Join(h.dir, "data"),
+		"alfred_workflow_cache":    filepath.Join(h.dir, "cache"),
+		"BW_EXEC":                  filepath.Join(h.binDir, "bw"),
+		"BW_DATA_PATH":             filepath.Join(h.dir, "data.json"),
+		"EMAIL":                    e2eEmail,
+		"2FA_ENABLED":              "false",
+		"ICON_CACHE_ENABLED":       "false",
+		"SECRET_STORE":             alfred.SecretStoreFile,
+		"FAKE_PASSWORD":            e2ePassword,
+		"FAKEBW_SCRIPT":            filepath.Join(h.dir, "fakebw.json"),
+		"FAKEBW_LOG":               filepath.Join(h.dir, "fakebw.log"),
+	}
+	h.writeFile("data.json", e2eDataJson)
+	// runs before the temporary folder is removed
+	t.Cleanup(h.stopJobs)
+	return h
+}
+
+// newUnlockedHarness returns a harness with the data.json of the test ciphers whose vault is unlocked
+func newUnlockedHarness(t *testing.T) (*e2eHarness, testSession) {
+	t.Helper()
+	h := newE2EHarness(t)
+	s := newTestSession(t)
+	ciphers, folders := testCiphers(t, s.userKey)
+	h.writeFile("data.json", s.dataJson(t, "user-1", false, ciphers, folders))
+	if err := alfred.SetToken(h.secretStore(), s.session); err != nil {
+		t.Fatal(err)
+	}
+	return h, s
+}
+
+// stopJobs kills the background jobs the workflow started, like the sync after an invalid cache
+func (h *e2eHarness) stopJobs() {
+	pidFiles, _ := filepath.Glob(filepath.Join(h.env["alfred_workflow_cache"], "_aw", "jobs", "*.pid"))
+	for _, pidFile := range pidFiles {
+		data, err := os.ReadFile(pidFile)
+		if err != nil {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			continue
+		}
+		p, err := os.FindProcess(pid)
+		if err != nil || p.Kill() != nil {
+			continue
+		}
+		// it isn't a child of the test, wait until it is gone
+		for i := 0; i < 100 && p.Signal(syscall.Signal(0)) == nil; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func (h *e2eHarness) writeFile(name string, content string) {
+	h.t.Helper()
+	if err := os.WriteFile(filepath.Join(h.dir, name), []byte(content), 0600); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// bw adds a scripted response, the first response matching the arguments is used
+func (h *e2eHarness) bw(args string, stdout string) *e2eHarness {
+	return h.bwResponse(bwResponse{Args: fmt.Sprintf("^%s$", regexp.QuoteMeta(args)), Stdout: stdout})
+}
+
+func (h *e2eHarness) bwResponse(res bwResponse) *e2eHarness {
+	h.t.Helper()
+	h.scripts = append(h.scripts, res)
+	data, err := json.Marshal(h.scripts)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.writeFile("fakebw.json", string(data))
+	return h
+}
+
+// bwCalls returns the arguments of every call to the fake bw
+func (h *e2eHarness) bwCalls() []string {
+	data, err := os.ReadFile(h.env["FAKEBW_LOG"])
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		h.t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func (h *e2eHarness) secretStore() alfred.SecretStore {
+	h.t.Helper()
+	store, err := alfred.NewFileStore(filepath.Join(h.env["alfred_workflow_data"], "secrets"), "")
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return store
+}
+
+// run executes the workflow binary and returns its stdout
+func (h *e2eHarness) run(args ...string) (string, error) {
+	h.t.Helper()
+	cmd := exec.Command(filepath.Join(h.binDir, e2eBinary), args...)
+	cmd.Dir = h.dir
+	for key, value := range h.env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	h.t.Logf("%s %s\nstdout: %s\nstderr: %s", e2eBinary, strings.Join(args, " "), stdout.String(), stderr.String())
+	return stdout.String(), err
+}
+
+// runFeedback executes a script filter and decodes the Alfred JSON
+func (h *e2eHarness) runFeedback(args ...string) alfredFeedback {
+	h.t.Helper()
+	out, err := h.run(args...)
+	if err != nil {
+		h.t.Fatalf("running %v failed: %s", args, err)
+	}
+	var feedback alfredFeedback
+	if err := json.Unmarshal([]byte(out), &feedback); err != nil {
+		h.t.Fatalf("invalid Alfred JSON %q: %s", out, err)
+	}
+	return feedback
+}
+
+// rerunFeedback executes a script filter again while it asks for a rerun like Alfred does,
+// the variables of the feedback are passed to the next run
+func (h *e2eHarness) rerunFeedback(args ...string) alfredFeedback {
+	h.t.Helper()
+	env := h.env
+	h.env = map[string]string{}
+	for key, value := range env {
+		h.env[key] = value
+	}
+	defer func() { h.env = env }()
+	for i := 0; i < 100; i++ {
+		feedback := h.runFeedback(args...)
+		if feedback.Rerun == 0 {
+			return feedback
+		}
+		for key, value := range feedback.Variables {
+			h.env[key] = value
+		}
+		time.Sleep(time.Duration(feedback.Rerun * float64(time.Second)))
+	}
+	h.t.Fatalf("running %v still asks for a rerun", args)
+	return alfredFeedback{}
+}
+
+func assertContains(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			if g == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("%q not found in %q", w, got)
+		}
+	}
+}
+
+func TestE2E_login(t *testing.T) {
+	h := newE2EHarness(t)
+	h.writeFile("data.json", `{"userEmail": null, "userId": null}`)
+	h.bwResponse(bwResponse{Args: "^login bitwarden@test.com --passwordenv PASS$", Env: map[string]string{"PASS": e2ePassword}, Stdout: e2eToken}).
+		bw("list items --pretty --session "+e2eToken, e2eItemsJson).
+		bw("list folders --pretty --session "+e2eToken, e2eFoldersJson)
+
+	out, err := h.run("-login")
+	if err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	if !strings.Contains(out, "Logged In.") {
+		t.Errorf("login output = %q", out)
+	}
+	token, err := alfred.GetToken(h.secretStore())
+	if err != nil || token != e2eToken {
+		t.Errorf("stored token = %q, %v, want %q", token, err, e2eToken)
+	}
+	assertContains(t, h.bwCalls(), "login bitwarden@test.com --passwordenv PASS", "list items --pretty --session "+e2eToken)
+}
+
+func TestE2E_loginTwoFactor(t *testing.T) {
+	h := newE2EHarness(t)
+	h.env["2FA_ENABLED"] = "true"
+	h.env["FAKE_ENTRY"] = "123456"
+	h.bwResponse(bwResponse{Args: "^login bitwarden@test.com --passwordenv PASS --raw --method 0 --code 123456$", Env: map[string]string{"PASS": e2ePassword}, Stdout: e2eToken}).
+		bw("list items --pretty --session "+e2eToken, e2eItemsJson).
+		bw("list folders --pretty --session "+e2eToken, e2eFoldersJson)
+
+	out, err := h.run("-login")
+	if err != nil || !strings.Contains(out, "Logged In.") {
+		t.Fatalf("login output = %q, %v", out, err)
+	}
+}
+
+func TestE2E_unlock(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		wantOut   string
+		wantErr   bool
+		wantToken bool
+	}{
+		{name: "correct password", password: e2ePassword, wantOut: "Unlocked", wantToken: true},
+		{name: "wrong password", password: "wrong", wantOut: "Unlocking Bitwarden failed.", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newE2EHarness(t)
+			h.env["FAKE_PASSWORD"] = tt.password
+			h.bwResponse(bwResponse{Args: "^unlock --raw --passwordenv PASS$", Env: map[string]string{"PASS": e2ePassword}, Stdout: e2eToken}).
+				bwResponse(bwResponse{Args: "^unlock ", Stderr: "Invalid master password.", Exit: 1})
+
+			out, err := h.run("-unlock")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unlock error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.Contains(out, tt.wantOut) {
+				t.Errorf("unlock output = %q, want %q", out, tt.wantOut)
+			}
+			_, err = alfred.GetToken(h.secretStore())
+			if (err == nil) != tt.wantToken {
+				t.Errorf("token stored = %v, want %v", err == nil, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestE2E_syncAndSearch(t *testing.T) {
+	h := newE2EHarness(t)
+	if err := alfred.SetToken(h.secretStore(), e2eToken); err != nil {
+		t.Fatal(err)
+	}
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+e2eToken, e2eFoldersJson).
+		bw("sync --force --session "+e2eToken, "Syncing complete.").
+		bw("list items --pretty --session "+e2eToken, e2eItemsJson).
+		bw("list folders --pretty --session "+e2eToken, e2eFoldersJson)
+
+	feedback := h.runFeedback()
+	assertContains(t, feedback.titles(), "Cache Expired or not Existed")
+
+	out, err := h.run("-sync", "-force")
+	if err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+	assertContains(t, h.bwCalls(), "sync --force --session "+e2eToken)
+
+	feedback = h.runFeedback()
+	if len(feedback.Items) != 2 {
+		t.Errorf("search returned %q, want 2 items", feedback.titles())
+	}
+	feedback = h.runFeedback("git")
+	if len(feedback.Items) == 0 || !strings.HasPrefix(feedback.Items[0].Title, "GitHub") {
+		t.Errorf("search for git returned %q", feedback.titles())
+	}
+	// the secrets must not end up in the Alfred results
+	for _, item := range feedback.Items {
+		if strings.Contains(item.Arg, "secret-password") || strings.Contains(item.Subtitle, "secret-password") {
+			t.Errorf("search result leaks the password: %+v", item)
+		}
+	}
+}
+
+func TestE2E_syncNotLoggedIn(t *testing.T) {
+	h := newE2EHarness(t)
+	h.bwResponse(bwResponse{Args: "^login --quiet --check$", Stderr: "You are not logged in.", Exit: 1}).
+		bwResponse(bwResponse{Args: "^unlock --quiet --check$", Stderr: "Vault is locked.", Exit: 1})
+
+	out, err := h.run("-sync", "-force")
+	if err != nil || !strings.Contains(out, NOT_LOGGED_IN_MSG) {
+		t.Errorf("sync output = %q, %v, want %q", out, err, NOT_LOGGED_IN_MSG)
+	}
+	for _, call := range h.bwCalls() {
+		if strings.HasPrefix(call, "sync") {
+			t.Errorf("bw sync should not run when logged out")
+		}
+	}
+}
+
+func TestE2E_getItem(t *testing.T) {
+	item := `{"object": "item", "id": "item-1", "type": 1, "name": "GitHub", "login": {"username": "octocat", "password": "secret-password", "totp": null}}`
+	tests := []struct {
+		name     string
+		args     []string
+		response []bwResponse
+		wantOut  string
+		wantErr  bool
+	}{
+		{
+			name:     "password",
+			args:     []string{"-getitem", "-id", "item-1", "login.password"},
+			response: []bwResponse{{Args: "^get item item-1 --pretty --session session-token$", Stdout: item}},
+			wantOut:  "secret-password",
+		},
+		{
+			name:     "username",
+			args:     []string{"-getitem", "-id", "item-1", "login.username"},
+			response: []bwResponse{{Args: "^get item item-1 --pretty --session session-token$", Stdout: item}},
+			wantOut:  "octocat",
+		},
+		{
+			name: "totp via bw",
+			args: []string{"-gettotp", "-id", "item-1"},
+			response: []bwResponse{
+				{Args: "^get item item-1 --pretty --session session-token$", Stdout: item},
+				{Args: "^get totp item-1 --session session-token$", Stdout: "123456"},
+			},
+			wantOut: "123456",
+		},
+		{
+			name:     "item not found",
+			args:     []string{"-getitem", "-id", "item-1", "login.password"},
+			response: []bwResponse{{Args: "^get item", Stderr: "Not found.", Exit: 1}},
+			wantOut:  "Failed to get Bitwarden item.",
+			wantErr:  true,
+		},
+		{
+			name:     "session expired",
+			args:     []string{"-getitem", "-id", "item-1", "login.password"},
+			response: []bwResponse{{Args: "^get item", Stderr: "Vault is locked.", Exit: 2}},
+			wantOut:  "Has the session key changed?",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newE2EHarness(t)
+			if err := alfred.SetToken(h.secretStore(), e2eToken); err != nil {
+				t.Fatal(err)
+			}
+			for _, res := range tt.response {
+				h.bwResponse(res)
+			}
+
+			out, err := h.run(tt.args...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(out, tt.wantOut) || !tt.wantErr && strings.TrimSpace(out) != tt.wantOut {
+				t.Errorf("output = %q, want %q", out, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestE2E_accounts(t *testing.T) {
+	h := newE2EHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	dataDir := h.env["alfred_workflow_data"]
+	h.bwResponse(bwResponse{
+		Args: "^config server https://bitwarden.com$",
+		Env:  map[string]string{"BITWARDENCLI_APPDATA_DIR": filepath.Join(dataDir, "accounts", "personal")},
+	}).bwResponse(bwResponse{
+		Args: "^config server https://bw.example.com$",
+		Env:  map[string]string{"BITWARDENCLI_APPDATA_DIR": filepath.Join(dataDir, "accounts", "work")},
+	})
+
+	for _, args := range [][]string{
+		{"-addaccount", "personal", "me@test.com"},
+		{"-addaccount", "work", "me@example.com", "https://bw.example.com"},
+	} {
+		if out, err := h.run(args...); err != nil || !strings.HasPrefix(out, "Added account") {
+			t.Fatalf("%v output = %q, %v", args, out, err)
+		}
+	}
+	if out, err := h.run("-addaccount", "work", "other@example.com"); err == nil {
+		t.Errorf("adding an account twice should fail, output = %q", out)
+	}
+	feedback := h.runFeedback("-accounts")
+	assertContains(t, feedback.titles(), "personal", "work", "Search All Accounts")
+	if feedback.Items[0].Subtitle != "Active, me@test.com on https://bitwarden.com" {
+		t.Errorf("first account should be active, got %q", feedback.Items[0].Subtitle)
+	}
+
+	// log in both accounts, the tokens are kept apart
+	for _, acc := range []string{"personal", "work"} {
+		appDataDir := filepath.Join(dataDir, "accounts", acc)
+		token := fmt.Sprintf("%s-token", acc)
+		data := strings.Replace(e2eDataJson, "bitwarden@test.com", acc, 1)
+		if err := os.WriteFile(filepath.Join(appDataDir, "data.json"), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := alfred.SetToken(alfred.NewNamespacedStore(h.secretStore(), acc), token); err != nil {
+			t.Fatal(err)
+		}
+		items := strings.Replace(e2eItemsJson, "GitHub", fmt.Sprintf("GitHub %s", acc), 1)
+		h.bwResponse(bwResponse{Args: "^login --quiet --check$", Env: map[string]string{"BITWARDENCLI_APPDATA_DIR": appDataDir}}).
+			bw("list folders --nointeraction --session "+token, e2eFoldersJson).
+			bw("sync --force --session "+token, "Syncing complete.").
+			bw("list items --pretty --session "+token, items).
+			bw("list folders --pretty --session "+token, e2eFoldersJson)
+	}
+	h.env["BW_ACCOUNT"] = "work"
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync of work account output = %q, %v", out, err)
+	}
+	delete(h.env, "BW_ACCOUNT")
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync of personal account output = %q, %v", out, err)
+	}
+
+	// the active account only sees its own items
+	feedback = h.runFeedback()
+	assertContains(t, feedback.titles(), "GitHub personal")
+	for _, title := range feedback.titles() {
+		if strings.Contains(title, "work") {
+			t.Errorf("search of the active account shows %q", title)
+		}
+	}
+
+	feedback = h.runFeedback("-allaccounts")
+	if len(feedback.Items) != 4 {
+		t.Errorf("search of all accounts returned %q, want 4 items", feedback.titles())
+	}
+	for _, item := range feedback.Items {
+		if !strings.HasSuffix(item.Title, fmt.Sprintf("[%s]", item.Variables["BW_ACCOUNT"])) {
+			t.Errorf("item %q has the account variable %q", item.Title, item.Variables["BW_ACCOUNT"])
+		}
+	}
+
+	if out, err := h.run("-switchaccount", "work"); err != nil || out != "Switched to account work" {
+		t.Fatalf("switch output = %q, %v", out, err)
+	}
+	feedback = h.runFeedback()
+	assertContains(t, feedback.titles(), "GitHub work")
+
+	if out, err := h.run("-removeaccount", "work"); err != nil || out != "Removed account work" {
+		t.Fatalf("remove output = %q, %v", out, err)
+	}
+	if _, err := alfred.GetToken(alfred.NewNamespacedStore(h.secretStore(), "work")); err == nil {
+		t.Errorf("the token of a removed account should be deleted")
+	}
+	if _, err := alfred.GetToken(alfred.NewNamespacedStore(h.secretStore(), "personal")); err != nil {
+		t.Errorf("removing an account deleted the token of another account")
+	}
+	assertContains(t, h.runFeedback("-accounts").titles(), "personal")
+}
+
+func TestE2E_usageRanking(t *testing.T) {
+	h := newE2EHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	if err := alfred.SetToken(h.secretStore(), e2eToken); err != nil {
+		t.Fatal(err)
+	}
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+e2eToken, e2eFoldersJson).
+		bw("sync --force --session "+e2eToken, "Syncing complete.").
+		bw("list items --pretty --session "+e2eToken, e2eItemsJson).
+		bw("list folders --pretty --session "+e2eToken, e2eFoldersJson).
+		bwResponse(bwResponse{Args: "^get item item-2 --pretty --session session-token$", Stdout: `{"id": "item-2", "notes": "ssh root@example.com"}`})
+
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+	if titles := h.runFeedback().titles(); len(titles) == 0 || titles[0] != "GitHub" {
+		t.Fatalf("search before any use returned %q", titles)
+	}
+	assertContains(t, h.runFeedback("-recent").titles(), "No Recently Used Items")
+
+	if out, err := h.run("-getitem", "-id", "item-2", "notes"); err != nil || out != "ssh root@example.com" {
+		t.Fatalf("getitem output = %q, %v", out, err)
+	}
+	if titles := h.runFeedback().titles(); len(titles) == 0 || titles[0] != "Server notes" {
+		t.Errorf("the used item should be ranked first, got %q", titles)
+	}
+	recent := h.runFeedback("-recent").titles()
+	if len(recent) != 2 || recent[0] != "Server notes" || recent[1] != "Reset Usage Statistics" {
+		t.Errorf("recently used returned %q", recent)
+	}
+
+	// the username is copied from the cache at once, the output records its usage with -recordusage
+	for _, item := range h.runFeedback().Items {
+		if mod := item.Mods["alt"]; item.Title == "GitHub" && (mod.Arg != "octocat" || mod.Variables["action"] != "output" ||
+			mod.Variables["action2"] != "-id item-1" || mod.Variables["usage"] != "username") {
+			t.Errorf("username modifier = %+v", mod)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if out, err := h.run("-recordusage", "-id", "item-1", "username"); err != nil || out != "" {
+			t.Fatalf("recordusage output = %q, %v", out, err)
+		}
+	}
+	if titles := h.runFeedback().titles(); len(titles) == 0 || titles[0] != "GitHub" {
+		t.Errorf("the item whose username was copied more often should be ranked first, got %q", titles)
+	}
+	if _, err := os.Stat(filepath.Join(h.env["alfred_workflow_data"], "usage-stats.json")); err != nil {
+		t.Errorf("usage statistics of the default account not saved, %v", err)
+	}
+
+	if out, err := h.run("-resetusage"); err != nil || out != "Usage statistics of the default account reset" {
+		t.Fatalf("reset output = %q, %v", out, err)
+	}
+	if titles := h.runFeedback().titles(); len(titles) == 0 || titles[0] != "GitHub" {
+		t.Errorf("search after the reset returned %q", titles)
+	}
+}
+
+func TestE2E_matchUrl(t *testing.T) {
+	h := newE2EHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	h.writeFile("data.json", strings.Replace(e2eDataJson, `"kdf": 0`, `"kdf": 0, "settings_user-1": {"equivalentDomains": [["github.com", "octocat.dev"]]}`, 1))
+	if err := alfred.SetToken(h.secretStore(), e2eToken); err != nil {
+		t.Fatal(err)
+	}
+	items := `[
+		{"object": "item", "id": "item-1", "type": 1, "name": "GitHub", "login": {"username": "octocat", "uris": [{"match": null, "uri": "https://github.com"}]}},
+		{"object": "item", "id": "item-3", "type": 1, "name": "GitHub Enterprise", "login": {"username": "octocat", "uris": [{"match": 3, "uri": "https://github.com/enterprise/login"}]}},
+		{"object": "item", "id": "item-4", "type": 1, "name": "GitLab", "login": {"username": "octocat", "uris": [{"match": 0, "uri": "https://gitlab.com"}]}}
+	]`
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+e2eToken, e2eFoldersJson).
+		bw("sync --force --session "+e2eToken, "Syncing complete.").
+		bw("list items --pretty --session "+e2eToken, items).
+		bw("list folders --pretty --session "+e2eToken, e2eFoldersJson)
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{url: "https://github.com/enterprise/login", want: []string{"GitHub Enterprise", "GitHub"}},
+		{url: "https://www.octocat.dev/", want: []string{"GitHub"}},
+		{url: "https://example.com", want: []string{"No Login found for example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got := h.runFeedback("-match-url", tt.url).titles()
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("-match-url %s returned %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestE2E_incrementalSync(t *testing.T) {
+	h := newE2EHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	if err := alfred.SetToken(h.secretStore(), e2eToken); err != nil {
+		t.Fatal(err)
+	}
+	syncWith := func(items string) *e2eHarness {
+		h.scripts = nil
+		return h.bw("login --quiet --check", "").
+			bw("list folders --nointeraction --session "+e2eToken, e2eFoldersJson).
+			bw("sync --force --session "+e2eToken, "Syncing complete.").
+			bw("list items --pretty --session "+e2eToken, items).
+			bw("list folders --pretty --session "+e2eToken, e2eFoldersJson)
+	}
+	items := `[
+		{"object": "item", "id": "item-1", "type": 1, "name": "GitHub", "revisionDate": "2022-03-01T12:00:00.000Z", "login": {"username": "octocat"}},
+		{"object": "item", "id": "item-2", "type": 2, "name": "Server notes", "revisionDate": "2022-03-01T12:00:00.000Z", "secureNote": {"type": 0}},
+		{"object": "item", "id": "item-3", "type": 1, "name": "GitLab", "revisionDate": "2022-03-01T12:00:00.000Z", "login": {"username": "tanuki"}}
+	]`
+	syncWith(items)
+	if out, err := h.run("-sync", "-force"); err != nil || strings.TrimSpace(out) != "Synced. 3 added, 0 updated, 0 deleted" {
+		t.Fatalf("first sync output = %q, %v", out, err)
+	}
+
+	changed := `[
+		{"object": "item", "id": "item-1", "type": 1, "name": "GitHub", "revisionDate": "2022-03-01T12:00:00.000Z", "login": {"username": "octocat"}},
+		{"object": "item", "id": "item-3", "type": 1, "name": "GitLab Work", "revisionDate": "2022-03-02T12:00:00.000Z", "login": {"username": "tanuki"}},
+		{"object": "item", "id": "item-4", "type": 3, "name": "Visa", "revisionDate": "2022-03-02T12:00:00.000Z", "card": {"brand": "Visa"}}
+	]`
+	syncWith(changed)
+	if out, err := h.run("-sync", "-force"); err != nil || strings.TrimSpace(out) != "Synced. 1 added, 1 updated, 1 deleted" {
+		t.Fatalf("second sync output = %q, %v", out, err)
+	}
+	titles := h.runFeedback().titles()
+	if strings.Join(titles, ",") != "GitHub,GitLab Work,Visa" {
+		t.Errorf("search after the second sync returned %q", titles)
+	}
+
+	syncWith(changed)
+	if out, err := h.run("-sync", "-force"); err != nil || strings.TrimSpace(out) != "Synced. no changes" {
+		t.Fatalf("sync without changes output = %q, %v", out, err)
+	}
+
+	// skipped types are removed from the cache, the following items are still cached
+	h.env["SKIP_TYPES"] = "login"
+	syncWith(changed)
+	if out, err := h.run("-sync", "-force"); err != nil || strings.TrimSpace(out) != "Synced. 0 added, 0 updated, 2 deleted" {
+		t.Fatalf("sync skipping logins output = %q, %v", out, err)
+	}
+	delete(h.env, "SKIP_TYPES")
+
+	// a failing sync keeps the cache searchable
+	h.scripts = nil
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+e2eToken, e2eFoldersJson).
+		bw("sync --force --session "+e2eToken, "Syncing complete.").
+		bwResponse(bwResponse{Args: "^list items", Stderr: "Request timed out.", Exit: 1})
+	if out, err := h.run("-sync", "-force"); err == nil {
+		t.Errorf("sync with a failing bw list items should fail, output = %q", out)
+	}
+	assertContains(t, h.runFeedback().titles(), "Visa")
+}
+
+func TestE2E_corruptCache(t *testing.T) {
+	h := newE2EHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	if err := alfred.SetToken(h.secretStore(), e2eToken); err != nil {
+		t.Fatal(err)
+	}
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+e2eToken, e2eFoldersJson).
+		bw("sync --force --session "+e2eToken, "Syncing complete.").
+		bw("list items --pretty --session "+e2eToken, e2eItemsJson).
+		bw("list folders --pretty --session "+e2eToken, e2eFoldersJson)
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+
+	// a cache of version 2 isn't migrated, its key is removed
+	cacheFile := filepath.Join(h.env["alfred_workflow_cache"], CACHE_NAME)
+	if err := os.WriteFile(cacheFile, []byte(`{"header": {"version": 2}, "nonce": "00", "data": "00"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.secretStore().Set(LEGACY_CACHE_KEY_NAME, "legacy-key"); err != nil {
+		t.Fatal(err)
+	}
+	feedback := h.runFeedback()
+	assertContains(t, feedback.titles(), "Cache Invalid, Syncing…")
+	if _, err := h.secretStore().Get(LEGACY_CACHE_KEY_NAME); err == nil {
+		t.Errorf("the key of the old cache is still stored")
+	}
+
+	// the sync in the background recreates the cache
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		titles := h.runFeedback().titles()
+		if len(titles) == 2 && titles[0] == "GitHub" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the cache wasn't recreated, search returned %q", titles)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func TestE2E_cacheKeyBoundToSession(t *testing.T) {
+	h := newE2EHarness(t)
+	if err := alfred.SetToken(h.secretStore(), e2eToken); err != nil {
+		t.Fatal(err)
+	}
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+e2eToken, e2eFoldersJson).
+		bw("sync --force --session "+e2eToken, "Syncing complete.").
+		bw("list items --pretty --session "+e2eToken, e2eItemsJson).
+		bw("list folders --pretty --session "+e2eToken, e2eFoldersJson)
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+	if _, err := h.secretStore().Get(LEGACY_CACHE_KEY_NAME); err == nil {
+		t.Errorf("the cache key must not be stored in the secret store")
+	}
+
+	// without the session the cache can't be read
+	if err := alfred.RemoveToken(h.secretStore()); err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, h.runFeedback().titles(), "Unlock")
+
+	// a new session after unlocking can't read the cache of the old session
+	if err := alfred.SetToken(h.secretStore(), "new-session-token"); err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, h.runFeedback().titles(), "Cache Invalid, Syncing…")
+}
+
+func TestE2E_apiSync(t *testing.T) {
+	h, s := newUnlockedHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	h.env["SYNC_MODE"] = SYNC_MODE_API
+	ciphers, folders := testCiphers(t, s.userKey)
+	dataJson := func(accessToken string) string {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(s.dataJson(t, "user-1", false, ciphers, folders)), &data); err != nil {
+			t.Fatal(err)
+		}
+		data["accessToken"] = accessToken
+		data["refreshToken"] = "refresh-token"
+		out, err := json.Marshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+	h.writeFile("data.json", dataJson("access-token"))
+
+	response := map[string]interface{}{"profile": map[string]interface{}{}, "ciphers": []interface{}{}, "folders": []interface{}{}}
+	for _, cipher := range ciphers {
+		response["ciphers"] = append(response["ciphers"].([]interface{}), cipher)
+	}
+	for _, folder := range folders {
+		response["folders"] = append(response["folders"].([]interface{}), folder)
+	}
+	// the server rotates the refresh token with every refresh
+	var mu sync.Mutex
+	accessToken, refreshToken, refreshes := "access-token", "refresh-token", 0
+	expire := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		accessToken = ""
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identity/connect/token", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.FormValue("refresh_token") != refreshToken {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		refreshes++
+		accessToken = fmt.Sprintf("access-token-%d", refreshes)
+		refreshToken = fmt.Sprintf("refresh-token-%d", refreshes)
+		_ = json.NewEncoder(w).Encode(tokenResponse{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: 3600, TokenType: "Bearer"})
+	})
+	mux.HandleFunc("/api/sync", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if accessToken == "" || r.Header.Get("Authorization") != "Bearer "+accessToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	h.env["SERVER_URL"] = server.URL
+
+	// the items are synced without the Bitwarden CLI
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+s.session, e2eFoldersJson)
+	if out, err := h.run("-sync", "-force"); err != nil || strings.TrimSpace(out) != "Synced. 2 added, 0 updated, 0 deleted" {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+	for _, call := range h.bwCalls() {
+		if strings.HasPrefix(call, "list items") || strings.HasPrefix(call, "sync") {
+			t.Errorf("the API sync called the Bitwarden CLI: %s", call)
+		}
+	}
+	if titles := h.runFeedback().titles(); strings.Join(titles, ",") != "GitHub,Server notes" {
+		t.Errorf("search returned %q", titles)
+	}
+	mu.Lock()
+	if refreshes != 0 {
+		t.Errorf("the access token was refreshed %d times, it is still valid", refreshes)
+	}
+	mu.Unlock()
+
+	// the refreshed tokens are kept in the secret store, the rotated refresh token is used next
+	for i, step := range []struct {
+		expire    bool
+		refreshes int
+	}{
+		{expire: true, refreshes: 1},
+		{expire: false, refreshes: 1},
+		{expire: true, refreshes: 2},
+	} {
+		if step.expire {
+			expire()
+		}
+		if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+			t.Fatalf("sync %d output = %q, %v", i, out, err)
+		}
+		mu.Lock()
+		got, wantAccess, wantRefresh := refreshes, accessToken, refreshToken
+		mu.Unlock()
+		if got != step.refreshes {
+			t.Errorf("sync %d refreshed the access token %d times, want %d", i, got, step.refreshes)
+		}
+		store := h.secretStore()
+		if token, _ := store.Get(API_ACCESS_TOKEN_NAME); token != wantAccess {
+			t.Errorf("sync %d stored access token %q, want %q", i, token, wantAccess)
+		}
+		if token, _ := store.Get(API_REFRESH_TOKEN_NAME); token != wantRefresh {
+			t.Errorf("sync %d stored refresh token %q, want %q", i, token, wantRefresh)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(h.dir, "data.json")); err != nil || !strings.Contains(string(data), `"refreshToken":"refresh-token"`) {
+		t.Errorf("the data.json of the Bitwarden CLI was changed: %s, %v", data, err)
+	}
+}
+
+func TestE2E_localSync(t *testing.T) {
+	h, s := newUnlockedHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	h.env["SYNC_MODE"] = SYNC_MODE_LOCAL
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+s.session, e2eFoldersJson).
+		bw("sync --force --session "+s.session, "Syncing complete.")
+
+	if out, err := h.run("-sync", "-force"); err != nil || strings.TrimSpace(out) != "Synced. 2 added, 0 updated, 0 deleted" {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+	for _, call := range h.bwCalls() {
+		if strings.HasPrefix(call, "list items") {
+			t.Errorf("the local sync called the Bitwarden CLI: %s", call)
+		}
+	}
+	if titles := h.runFeedback().titles(); strings.Join(titles, ",") != "GitHub,Server notes" {
+		t.Errorf("search returned %q", titles)
+	}
+
+	// without items in the data.json the Bitwarden CLI is used
+	h.writeFile("data.json", fmt.Sprintf(`{"userId": "user-1", "userEmail": "bitwarden@test.com", "__PROTECTED__key": %q, "encKey": %q}`, s.protectedKey, s.encKey))
+	h.bw("list items --pretty --session "+s.session, e2eItemsJson).
+		bw("list folders --pretty --session "+s.session, e2eFoldersJson)
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync with the CLI fallback output = %q, %v", out, err)
+	}
+	assertContains(t, h.bwCalls(), "list items --pretty --session "+s.session)
+}
+
+func TestE2E_organizationItem(t *testing.T) {
+	h, s := newUnlockedHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	h.env["SYNC_MODE"] = SYNC_MODE_LOCAL
+	orgKey := newTestKey(t)
+	privateKey, encPrivateKey := newTestPrivateKey(t, s.userKey)
+	s.encPrivateKey = encPrivateKey
+	s.encOrgKeys = map[string]string{"org-1": wrapTestOrgKey(t, orgKey, &privateKey.PublicKey, Rsa2048_OaepSha1_B64)}
+	ciphers, folders := testCiphers(t, s.userKey)
+	ciphers["org-item"] = map[string]interface{}{
+		"id": "org-item", "organizationId": "org-1", "type": 1, "name": encryptTestString(t, "Shared Server", orgKey),
+		"revisionDate": "2022-03-01T12:00:00.000Z",
+		"login":        map[string]interface{}{"username": encryptTestString(t, "admin", orgKey), "password": encryptTestString(t, "shared-password", orgKey)},
+	}
+	h.writeFile("data.json", s.dataJson(t, "user-1", false, ciphers, folders))
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+s.session, e2eFoldersJson).
+		bw("sync --force --session "+s.session, "Syncing complete.")
+
+	if out, err := h.run("-sync", "-force"); err != nil || strings.TrimSpace(out) != "Synced. 3 added, 0 updated, 0 deleted" {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+	assertContains(t, h.runFeedback("shared").titles(), "Shared Server")
+
+	// the password is decrypted with the organization key without the Bitwarden CLI
+	if out, err := h.run("-getitem", "-id", "org-item", "login.password"); err != nil || strings.TrimSpace(out) != "shared-password" {
+		t.Errorf("getitem output = %q, %v", out, err)
+	}
+	for _, call := range h.bwCalls() {
+		if strings.HasPrefix(call, "get item") || strings.HasPrefix(call, "list items") {
+			t.Errorf("the organization item was read with the Bitwarden CLI: %s", call)
+		}
+	}
+}
+
+func TestE2E_nativeUnlock(t *testing.T) {
+	masterKey, err := makeMasterKey(e2ePassword, "bitwarden@test.com", kdfParams{Type: KDF_PBKDF2_SHA256, Iterations: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userKey := newTestKey(t)
+	dataJson := fmt.Sprintf(`{"userId": "user-1", "userEmail": "bitwarden@test.com", "encKey": %q, "kdf": 0, "kdfIterations": 5000, "installedVersion": "1.20.0"}`,
+		encryptTestUserKey(t, userKey, masterKey))
+
+	tests := []struct {
+		name      string
+		password  string
+		dataJson  string
+		wantOut   string
+		wantErr   bool
+		wantToken bool
+		wantBw    bool
+	}{
+		{name: "correct password", password: e2ePassword, dataJson: dataJson, wantOut: "Unlocked", wantToken: true},
+		{name: "wrong password", password: "wrong", dataJson: dataJson, wantOut: "Invalid master password", wantErr: true},
+		{name: "unsupported kdf falls back to the CLI", password: e2ePassword, dataJson: strings.Replace(dataJson, `"kdf": 0`, `"kdf": 7`, 1), wantOut: "Unlocked", wantToken: true, wantBw: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newE2EHarness(t)
+			h.env["NATIVE_UNLOCK"] = "true"
+			h.env["FAKE_PASSWORD"] = tt.password
+			h.writeFile("data.json", tt.dataJson)
+			h.bwResponse(bwResponse{Args: "^unlock --raw --passwordenv PASS$", Env: map[string]string{"PASS": e2ePassword}, Stdout: e2eToken})
+
+			out, err := h.run("-unlock")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unlock error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.Contains(out, tt.wantOut) {
+				t.Errorf("unlock output = %q, want %q", out, tt.wantOut)
+			}
+			token, err := alfred.GetToken(h.secretStore())
+			if (err == nil) != tt.wantToken {
+				t.Fatalf("token stored = %v, want %v", err == nil, tt.wantToken)
+			}
+			if (len(h.bwCalls()) > 0) != tt.wantBw {
+				t.Errorf("Bitwarden CLI calls = %q, want calls %v", h.bwCalls(), tt.wantBw)
+			}
+			if !tt.wantToken || tt.wantBw {
+				return
+			}
+
+			// the session decrypts the vault like one of "bw unlock"
+			data, err := os.ReadFile(filepath.Join(h.dir, "data.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldBwData := bwData
+			defer func() { bwData = oldBwData }()
+			bwData, err = decodeBitwardenDataJson(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, err := MakeDecryptKeyFromSession(bwData.ProtectedKey, token)
+			if err != nil || !bytes.Equal(key.EncKey, userKey.EncKey) {
+				t.Errorf("the session doesn't decrypt the user key, %v", err)
+			}
+			if stored, err := h.secretStore().Get(PROTECTED_KEY_NAME); err != nil || stored != bwData.ProtectedKey {
+				t.Errorf("secret store protected key = %q, %v, want the one of the data.json", stored, err)
+			}
+
+			// locking removes the protected key of the workflow as well
+			h.bw("lock", "Your vault is locked.")
+			if _, err := h.run("-lock"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := h.secretStore().Get(PROTECTED_KEY_NAME); err == nil {
+				t.Errorf("the protected key is still stored after locking")
+			}
+		})
+	}
+}
+
+func TestE2E_totpField(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		offset string
+	}{
+		{name: "steam guard", secret: "steam://JBSWY3DPEHPK3PXP"},
+		{name: "8 digits sha256", secret: "otpauth://totp/Example:alice?secret=JBSWY3DPEHPK3PXP&digits=8&algorithm=SHA256&period=60"},
+		{name: "clock offset", secret: "JBSWY3DPEHPK3PXP", offset: "30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newE2EHarness(t)
+			if err := alfred.SetToken(h.secretStore(), e2eToken); err != nil {
+				t.Fatal(err)
+			}
+			if tt.offset != "" {
+				h.env["TOTP_CLOCK_OFFSET"] = tt.offset
+			}
+			item := fmt.Sprintf(`{"object": "item", "id": "item-1", "type": 1, "name": "Steam", "fields": [{"name": "TOTP", "value": %q, "type": 1}]}`, tt.secret)
+			h.bw("get item item-1 --pretty --session "+e2eToken, item)
+
+			config, err := parseOtp(tt.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			offset, _ := strconv.Atoi(tt.offset)
+			// the code may change while the workflow runs
+			var want []string
+			for _, d := range []time.Duration{0, 5 * time.Second} {
+				code, err := config.code(time.Now().Add(time.Duration(offset)*time.Second + d))
+				if err != nil {
+					t.Fatal(err)
+				}
+				want = append(want, code)
+			}
+
+			out, err := h.run("-gettotp", "-id", "item-1")
+			if err != nil || (out != want[0] && out != want[1]) {
+				t.Errorf("gettotp output = %q, %v, want one of %q", out, err, want)
+			}
+		})
+	}
+}
+
+func TestE2E_totpView(t *testing.T) {
+	login := `{"object": "item", "id": "item-1", "type": 1, "name": "GitHub", "login": {"totp": %q}}`
+	field := `{"object": "item", "id": "item-1", "type": 1, "name": "GitHub", "fields": [{"name": "TOTP", "value": %q, "type": 1}]}`
+	tests := []struct {
+		name        string
+		item        string
+		key         string
+		jsonPath    string
+		waitSeconds string
+		wantWaiting bool
+		wantRerun   bool
+	}{
+		{name: "login totp", item: login, key: "JBSWY3DPEHPK3PXP", jsonPath: "login.totp", wantRerun: true},
+		{name: "totp field", item: field, key: "JBSWY3DPEHPK3PXP", jsonPath: "fields[0].value", wantRerun: true},
+		{name: "wait for the next code", item: login, key: "JBSWY3DPEHPK3PXP", jsonPath: "login.totp", waitSeconds: "30", wantWaiting: true, wantRerun: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newE2EHarness(t)
+			if err := alfred.SetToken(h.secretStore(), e2eToken); err != nil {
+				t.Fatal(err)
+			}
+			if tt.waitSeconds != "" {
+				h.env["TOTP_WAIT_SECONDS"] = tt.waitSeconds
+			}
+			h.bw("get item item-1 --pretty --session "+e2eToken, fmt.Sprintf(tt.item, tt.key))
+
+			start := time.Now()
+			feedback := h.runFeedback("-totpview", "-id", "item-1", tt.jsonPath)
+			if (feedback.Rerun > 0) != tt.wantRerun {
+				t.Errorf("rerun = %v, want rerun %v", feedback.Rerun, tt.wantRerun)
+			}
+			if len(feedback.Items) < 2 {
+				t.Fatalf("totpview items = %q", feedback.titles())
+			}
+
+			config, err := parseOtp(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the period may change while the workflow runs
+			var want []otpWindow
+			for _, now := range []time.Time{start, time.Now()} {
+				w, err := config.window(now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want = append(want, w)
+			}
+
+			current, next := feedback.Items[0], feedback.Items[1]
+			if next.Title != want[0].Next && next.Title != want[1].Next {
+				t.Errorf("next code = %q, want one of %q, %q", next.Title, want[0].Next, want[1].Next)
+			}
+			if next.Arg != next.Title || next.Variables["action"] != "output" {
+				t.Errorf("next code copies %q with action %q", next.Arg, next.Variables["action"])
+			}
+			if next.Variables["usage"] != "totp" || next.Variables["action2"] != "-id item-1" {
+				t.Errorf("next code records usage %q of %q", next.Variables["usage"], next.Variables["action2"])
+			}
+
+			// the reruns compute the codes from the cached key, the item isn't decrypted again
+			// and the key isn't passed to them
+			if feedback.Variables[TOTP_ITEM_VAR] != "item-1 "+tt.jsonPath {
+				t.Errorf("variables = %v, want %s", feedback.Variables, TOTP_ITEM_VAR)
+			}
+			for name, value := range feedback.Variables {
+				if strings.Contains(value, tt.key) {
+					t.Errorf("variable %s passes the key to the reruns", name)
+				}
+			}
+			cache, err := os.ReadFile(filepath.Join(h.env["alfred_workflow_cache"], TOTP_VIEW_CACHE_NAME))
+			if err != nil || strings.Contains(string(cache), tt.key) {
+				t.Errorf("TOTP view cache = %s, %v, want the key encrypted", cache, err)
+			}
+			calls := len(h.bwCalls())
+			for key, value := range feedback.Variables {
+				h.env[key] = value
+			}
+			rerun := h.runFeedback("-totpview", "-id", "item-1", tt.jsonPath)
+			if len(h.bwCalls()) != calls {
+				t.Errorf("the rerun called the Bitwarden CLI: %q", h.bwCalls()[calls:])
+			}
+			after, err := config.window(time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rerun.Items) < 2 || rerun.Rerun == 0 || (rerun.Items[1].Title != want[1].Next && rerun.Items[1].Title != after.Next) {
+				t.Errorf("rerun items = %q, rerun %v", rerun.titles(), rerun.Rerun)
+			}
+			if tt.wantWaiting {
+				if !strings.HasPrefix(current.Title, "Waiting") || current.Valid {
+					t.Errorf("current item = %q, valid %v, want the waiting item", current.Title, current.Valid)
+				}
+				return
+			}
+			if current.Title != want[0].Code && current.Title != want[1].Code {
+				t.Errorf("current code = %q, want one of %q, %q", current.Title, want[0].Code, want[1].Code)
+			}
+			if current.Arg != current.Title || current.Variables["action"] != "output" {
+				t.Errorf("current code copies %q with action %q", current.Arg, current.Variables["action"])
+			}
+		})
+	}
+}
+
+func TestE2E_hotp(t *testing.T) {
+	item := `{"object": "item", "id": "item-1", "type": 1, "name": "GitHub", "login": {"totp": "otpauth://hotp/GitHub?secret=JBSWY3DPEHPK3PXP&counter=3"}}`
+	config, err := parseOtp("otpauth://hotp/GitHub?secret=JBSWY3DPEHPK3PXP&counter=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := config.code(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := newE2EHarness(t)
+	if err := alfred.SetToken(h.secretStore(), e2eToken); err != nil {
+		t.Fatal(err)
+	}
+	h.bw("get item item-1 --pretty --session "+e2eToken, item).
+		bw("get item item-1 --session "+e2eToken, item).
+		bw("edit item item-1 --session "+e2eToken, strings.Replace(item, "counter=3", "counter=4", 1))
+
+	// the view copies the code with -gettotp, there is no countdown
+	feedback := h.runFeedback("-totpview", "-id", "item-1", "login.totp")
+	if current := feedback.Items[0]; current.Title != code || current.Arg != "login.totp" || current.Variables["action"] != "-gettotp" ||
+		current.Variables["action2"] != "-id item-1" || feedback.Rerun != 0 {
+		t.Errorf("hotp view = %+v, rerun %v", feedback.Items, feedback.Rerun)
+	}
+
+	// the counter is advanced in the vault before the code is returned
+	out, err := h.run("-gettotp", "-id", "item-1", "login.totp")
+	if err != nil || out != code {
+		t.Fatalf("gettotp output = %q, %v, want %q", out, err, code)
+	}
+	var encoded string
+	for _, call := range h.bwCalls() {
+		if strings.HasPrefix(call, "< ") {
+			encoded = strings.TrimPrefix(call, "< ")
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("invalid encoded item %q: %s", encoded, err)
+	}
+	var edited Item
+	if err := json.Unmarshal(data, &edited); err != nil {
+		t.Fatal(err)
+	}
+	if next, err := parseOtp(edited.Login.Totp); err != nil || next.Counter != 4 {
+		t.Errorf("edited authenticator key = %q, %v", edited.Login.Totp, err)
+	}
+
+	// without the saved counter no code is returned
+	h = newE2EHarness(t)
+	if err := alfred.SetToken(h.secretStore(), e2eToken); err != nil {
+		t.Fatal(err)
+	}
+	h.bw("get item item-1 --pretty --session "+e2eToken, item).
+		bw("get item item-1 --session "+e2eToken, item).
+		bwResponse(bwResponse{Args: "^edit item item-1 ", Stderr: "Not found.", Exit: 1})
+	if out, err := h.run("-gettotp", "-id", "item-1", "login.totp"); err == nil || strings.Contains(out, code) {
+		t.Errorf("gettotp without the saved counter = %q, %v", out, err)
+	}
+}
+
+func TestE2E_generate(t *testing.T) {
+	var wordlist strings.Builder
+	for i := 0; i < generator.MinWordlistSize; i++ {
+		fmt.Fprintf(&wordlist, "%05d\tword%d\n", i, i)
+	}
+	tests := []struct {
+		name       string
+		query      string
+		wordlist   bool
+		wantLength int
+		wantName   string
+		wantErr    bool
+	}{
+		{name: "defaults", wordlist: true, wantLength: 20, wantName: "Generated Password"},
+		{name: "length and name", query: "24 GitHub Login", wordlist: true, wantLength: 24, wantName: "GitHub Login"},
+		{name: "no word list", query: "12", wantLength: 12, wantName: "Generated Password"},
+		{name: "longest length", query: "128", wordlist: true, wantLength: 128, wantName: "Generated Password"},
+		{name: "too short", query: "4", wordlist: true, wantName: "Generated Password", wantErr: true},
+		{name: "too long", query: "129", wordlist: true, wantName: "Generated Password", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newE2EHarness(t)
+			h.env["PASSPHRASE_WORDLIST"] = filepath.Join(h.dir, "wordlist.txt")
+			h.env["PASSPHRASE_WORDS"] = "4"
+			if tt.wordlist {
+				h.writeFile("wordlist.txt", wordlist.String())
+			}
+
+			feedback := h.runFeedback("-generate", tt.query)
+			if tt.wantErr {
+				// only an error item instead of the passwords, the passphrases are shown
+				if len(feedback.Items) != GENERATOR_CANDIDATES+1 || feedback.Items[0].Valid || !strings.Contains(feedback.Items[0].Subtitle, "between 5 and 128") {
+					t.Fatalf("generate items = %q", feedback.titles())
+				}
+				for _, item := range feedback.Items[1:] {
+					if len(strings.Split(item.Title, "-")) != 4 {
+						t.Errorf("passphrase %q, want 4 words", item.Title)
+					}
+				}
+				return
+			}
+			if len(feedback.Items) != 2*GENERATOR_CANDIDATES && !(len(feedback.Items) == GENERATOR_CANDIDATES+1 && !tt.wordlist) {
+				t.Fatalf("generate items = %q", feedback.titles())
+			}
+			for i, item := range feedback.Items {
+				if i == GENERATOR_CANDIDATES && !tt.wordlist {
+					if item.Valid || !strings.HasPrefix(item.Title, "No passphrases") {
+						t.Errorf("word list item = %q, valid %v", item.Title, item.Valid)
+					}
+					break
+				}
+				if i < GENERATOR_CANDIDATES && len(item.Title) != tt.wantLength {
+					t.Errorf("password %q, want length %d", item.Title, tt.wantLength)
+				}
+				if i >= GENERATOR_CANDIDATES && len(strings.Split(item.Title, "-")) != 4 {
+					t.Errorf("passphrase %q, want 4 words", item.Title)
+				}
+				if item.Arg != item.Title || item.Variables["action"] != "output" {
+					t.Errorf("item %q copies %q with action %q", item.Title, item.Arg, item.Variables["action"])
+				}
+				create := item.Mods["cmd"]
+				if create.Arg != item.Title || create.Variables["action"] != "-createlogin" || create.Variables["name"] != tt.wantName {
+					t.Errorf("create login of %q = %+v", item.Title, create)
+				}
+			}
+		})
+	}
+}
+
+func TestE2E_createLogin(t *testing.T) {
+	h := newE2EHarness(t)
+	if err := alfred.SetToken(h.secretStore(), e2eToken); err != nil {
+		t.Fatal(err)
+	}
+	h.env["name"] = "GitHub Login"
+	h.bw("create item --session "+e2eToken, `{"object": "item", "id": "item-new", "type": 1, "name": "GitHub Login", "login": {"password": "generated-password"}}`)
+
+	out, err := h.run("-createlogin", "generated-password")
+	if err != nil || !strings.Contains(out, "Created login GitHub Login") {
+		t.Fatalf("createlogin output = %q, %v", out, err)
+	}
+
+	// the item is passed encoded via stdin, not as argument
+	calls := h.bwCalls()
+	assertContains(t, calls, "create item --session "+e2eToken)
+	var encoded string
+	for _, call := range calls {
+		if strings.HasPrefix(call, "< ") {
+			encoded = strings.TrimPrefix(call, "< ")
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("invalid encoded item %q: %s", encoded, err)
+	}
+	var item map[string]interface{}
+	if err := json.Unmarshal(data, &item); err != nil {
+		t.Fatal(err)
+	}
+	login, _ := item["login"].(map[string]interface{})
+	if item["name"] != "GitHub Login" || item["type"] != 1.0 || item["folderId"] != nil || login["password"] != "generated-password" {
+		t.Errorf("created item = %s", data)
+	}
+}
+
+func TestE2E_health(t *testing.T) {
+	h, s := newUnlockedHarness(t)
+	ciphers, folders := testCiphers(t, s.userKey)
+	enc := func(value string) string { return encryptTestString(t, value, s.userKey) }
+	ciphers["item-4"] = map[string]interface{}{
+		"id": "item-4", "type": 1, "name": enc("GitLab"), "revisionDate": time.Now().Format(time.RFC3339),
+		"login": map[string]interface{}{"username": enc("octocat"), "password": enc("secret-password")},
+	}
+	ciphers["item-5"] = map[string]interface{}{
+		"id": "item-5", "type": 1, "name": enc("Forum"), "revisionDate": time.Now().Format(time.RFC3339),
+		"login": map[string]interface{}{
+			"username": enc("forum-user"), "password": enc("x7#Kq9!vR2@mZ4$w"),
+			"uris": []interface{}{map[string]interface{}{"uri": enc("http://forum.example.com"), "match": nil}},
+		},
+	}
+	// encrypted with another key, it is skipped
+	other := newTestKey(t)
+	ciphers["item-6"] = map[string]interface{}{
+		"id": "item-6", "type": 1, "name": encryptTestString(t, "Broken", other), "revisionDate": time.Now().Format(time.RFC3339),
+		"login": map[string]interface{}{"username": encryptTestString(t, "broken", other), "password": encryptTestString(t, "secret-password", other)},
+	}
+	h.writeFile("data.json", s.dataJson(t, "user-1", false, ciphers, folders))
+
+	feedback := h.runFeedback("-health")
+	titles := feedback.titles()
+	want := []string{"Reused password: GitHub", "Reused password: GitLab", "Weak password: GitHub", "Weak password: GitLab", "Old password: GitHub", "Unencrypted URI: Forum", "1 login couldn't be decrypted"}
+	if strings.Join(titles, ",") != strings.Join(want, ",") {
+		t.Fatalf("health report = %q, want %q", titles, want)
+	}
+	if got := feedback.Items[0].Variables["action"]; got != "-id item-1" {
+		t.Errorf("action = %q, want -id item-1", got)
+	}
+	for _, item := range feedback.Items {
+		if strings.Contains(item.Subtitle, "secret-password") || strings.Contains(item.Title, "secret-password") {
+			t.Errorf("the health report shows a password: %+v", item)
+		}
+	}
+	for _, call := range h.bwCalls() {
+		t.Errorf("the health report called the Bitwarden CLI: %s", call)
+	}
+}
+
+func TestE2E_breachCheck(t *testing.T) {
+	server, requests := newTestRangeServer(t, map[string]int{"secret-password": 1234})
+	h, _ := newUnlockedHarness(t)
+	h.env["BREACH_API_URL"] = server.URL
+
+	// the passwords are checked by a job in the background, the script filter reruns until it is done
+	feedback := h.runFeedback("-breach-check")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Checking the passwords for breaches…" || feedback.Rerun == 0 {
+		t.Fatalf("breach check while the job runs = %q, rerun %v", titles, feedback.Rerun)
+	}
+	feedback = h.rerunFeedback("-breach-check")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Breached password: GitHub" {
+		t.Fatalf("breach check = %q", titles)
+	}
+	assertContains(t, []string{feedback.Items[0].Subtitle}, "Found 1234 times in data breaches ∙ ⏎ show details")
+	if got := feedback.Items[0].Variables["action"]; got != "-id item-1" {
+		t.Errorf("action = %q, want -id item-1", got)
+	}
+	if want := []string{passwordHash("secret-password")[:5]}; strings.Join(requests.list(), ",") != strings.Join(want, ",") {
+		t.Errorf("requests = %v, want %v", requests.list(), want)
+	}
+
+	// the results are cached encrypted, without a password or its hash in plain text
+	cache, err := os.ReadFile(filepath.Join(h.env["alfred_workflow_cache"], BREACH_CACHE_NAME))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-password", passwordHash("secret-password"), "GitHub"} {
+		if strings.Contains(string(cache), secret) {
+			t.Errorf("the breach cache contains %q in plain text", secret)
+		}
+	}
+	if titles := h.runFeedback("-breach-check").titles(); strings.Join(titles, ",") != "Breached password: GitHub" || len(requests.list()) != 1 {
+		t.Errorf("cached breach check = %q with requests %v", titles, requests.list())
+	}
+	if titles := h.rerunFeedback("-breach-check", "-force").titles(); strings.Join(titles, ",") != "Breached password: GitHub" || len(requests.list()) != 2 {
+		t.Errorf("forced breach check = %q with requests %v, want one new request", titles, requests.list())
+	}
+
+	// the error of the job is shown once it stopped
+	server.Close()
+	feedback = h.rerunFeedback("-breach-check", "-force")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Can't check the passwords for breaches" {
+		t.Errorf("breach check without a server = %q", titles)
+	}
+}
+
+func TestE2E_create(t *testing.T) {
+	h, s := newUnlockedHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	h.env["SYNC_MODE"] = SYNC_MODE_LOCAL
+	h.env["ITEM_TEMPLATES"] = filepath.Join(h.dir, "templates.json")
+	h.writeFile("templates.json", `[{"name": "Server", "type": 2, "notes": "Managed by ansible", "fields": [{"name": "host", "type": 0}]}]`)
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+s.session, e2eFoldersJson).
+		bw("sync --force --session "+s.session, "Syncing complete.")
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+
+	if titles := h.runFeedback("-create", "").titles(); strings.Join(titles, ",") != "Login,Secure Note,Card,Identity,Server" {
+		t.Errorf("templates = %q", titles)
+	}
+	step := h.runFeedback("-create", "Server"+CREATE_SEPARATOR+"web-1"+CREATE_SEPARATOR).Items[0]
+	if step.Title != "Note: Managed by ansible (default)" || step.Subtitle != "Step 2 of 3 ∙ ⏎ next" || step.Valid {
+		t.Errorf("template step = %+v", step)
+	}
+
+	query := strings.Join([]string{"Login", "GitLab", "tanuki", "", "https://gitlab.com"}, CREATE_SEPARATOR)
+	feedback := h.runFeedback("-create", query)
+	last := feedback.Items[0]
+	if !last.Valid || last.Variables["action"] != "-createitem" || last.Subtitle != `Step 4 of 4 ∙ ⏎ create Login "GitLab"` {
+		t.Fatalf("last step = %+v", last)
+	}
+	if titles := feedback.titles(); strings.Join(titles[1:], ",") != "Name: GitLab,Username: tanuki,Password: " {
+		t.Errorf("entered values = %q", titles)
+	}
+
+	h.bw("create item --session "+s.session, `{"object": "item", "id": "item-new", "type": 1, "name": "GitLab",
+		"revisionDate": "2022-03-03T12:00:00.000Z", "login": {"username": "tanuki", "password": "generated"}}`)
+	out, err := h.run("-createitem", last.Arg)
+	if err != nil || strings.TrimSpace(out) != "Created GitLab." {
+		t.Fatalf("createitem output = %q, %v", out, err)
+	}
+	var encoded string
+	for _, call := range h.bwCalls() {
+		if strings.HasPrefix(call, "< ") {
+			encoded = strings.TrimPrefix(call, "< ")
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("invalid encoded item %q: %s", encoded, err)
+	}
+	var item newItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Login == nil || item.Login.Username != "tanuki" || len(item.Login.Password) != 20 || item.Login.Uris[0].Uri != "https://gitlab.com" {
+		t.Errorf("created item = %s", data)
+	}
+
+	// the new item is searchable without a sync
+	calls := len(h.bwCalls())
+	if titles := h.runFeedback().titles(); strings.Join(titles, ",") != "GitHub,Server notes,GitLab" {
+		t.Errorf("search after create = %q", titles)
+	}
+	for _, call := range h.bwCalls()[calls:] {
+		if strings.HasPrefix(call, "sync") || strings.HasPrefix(call, "list") {
+			t.Errorf("the search synced after create: %s", call)
+		}
+	}
+}
+
+func TestE2E_edit(t *testing.T) {
+	h, s := newUnlockedHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	h.env["SYNC_MODE"] = SYNC_MODE_LOCAL
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+s.session, e2eFoldersJson).
+		bw("sync --force --session "+s.session, "Syncing complete.")
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+
+	// the detail rows can be edited with cmd
+	edits := map[string]string{}
+	for _, item := range h.runFeedback("-id", "item-1").Items {
+		if mod, ok := item.Mods["cmd"]; ok && mod.Variables["action"] == "-edit" {
+			edits[item.Title] = mod.Variables["action3"]
+		}
+	}
+	for title, jsonPath := range map[string]string{"Username: octocat": "login.username", "Password: ✳︎✳︎✳︎✳︎✳︎": "login.password", "URL: https://github.com": "login.uris[0].uri"} {
+		if edits[title] != jsonPath {
+			t.Errorf("edit of %q = %q, want %q (edits %v)", title, edits[title], jsonPath, edits)
+		}
+	}
+
+	// the password can't be cleared with an empty query, only the generated one can be saved
+	feedback := h.runFeedback("-edit", "-id", "item-1", "login.password")
+	if len(feedback.Items) != 2 || feedback.Items[0].Valid || feedback.Items[0].Title != "Type the new password" || !feedback.Items[1].Valid {
+		t.Errorf("edit with an empty value = %+v", feedback.Items)
+	}
+
+	feedback = h.runFeedback("-edit", "-id", "item-1", "login.password", "new", "password")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Set Password to new password,Set a generated password" {
+		t.Fatalf("edit = %q", titles)
+	}
+	set := feedback.Items[0]
+	if set.Variables["action"] != "-edititem" || set.Variables["action3"] != "login.password" || set.Arg != base64.StdEncoding.EncodeToString([]byte("new password")) {
+		t.Errorf("edit item = %+v", set)
+	}
+
+	h.bw("get item item-1 --session "+s.session, `{"object": "item", "id": "item-1", "type": 1, "name": "GitHub", "reprompt": 0,
+		"login": {"username": "octocat", "password": "secret-password", "uris": [{"match": null, "uri": "https://github.com"}]},
+		"passwordHistory": [{"lastUsedDate": "2022-01-01T00:00:00.000Z", "password": "older-password"}]}`).
+		bw("edit item item-1 --session "+s.session, `{"object": "item", "id": "item-1", "type": 1, "name": "GitHub Enterprise",
+		"revisionDate": "2022-03-05T12:00:00.000Z", "login": {"username": "octocat", "password": "new password"}}`)
+	out, err := h.run("-edititem", "-id", "item-1", "login.password", set.Arg)
+	if err != nil || strings.TrimSpace(out) != "Changed Password of GitHub Enterprise." {
+		t.Fatalf("edititem output = %q, %v", out, err)
+	}
+	var encoded string
+	for _, call := range h.bwCalls() {
+		if strings.HasPrefix(call, "< ") {
+			encoded = strings.TrimPrefix(call, "< ")
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("invalid encoded item %q: %s", encoded, err)
+	}
+	var edited struct {
+		Reprompt        *int `json:"reprompt"`
+		Login           Login
+		PasswordHistory []struct{ Password string }
+	}
+	if err := json.Unmarshal(data, &edited); err != nil {
+		t.Fatal(err)
+	}
+	// bw edit item adds the old password to the history itself
+	if edited.Login.Password != "new password" || len(edited.PasswordHistory) != 1 || edited.PasswordHistory[0].Password != "older-password" || edited.Reprompt == nil {
+		t.Errorf("edited item = %s", data)
+	}
+
+	// only the edited item is refreshed in the cache
+	if titles := h.runFeedback().titles(); strings.Join(titles, ",") != "GitHub Enterprise,Server notes" {
+		t.Errorf("search after edit = %q", titles)
+	}
+}
+
+func TestE2E_trash(t *testing.T) {
+	h, s := newUnlockedHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	h.env["SYNC_MODE"] = SYNC_MODE_LOCAL
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+s.session, e2eFoldersJson).
+		bw("sync --force --session "+s.session, "Syncing complete.")
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+
+	// the item details offer to move the item to the trash
+	found := false
+	feedback := h.runFeedback("-id", "item-1")
+	for _, item := range feedback.Items {
+		if item.Title == "Move to Trash" {
+			found = true
+			if item.Variables["action"] != "-delete" || item.Variables["action2"] != "-id item-1" || item.Variables["name"] != "GitHub" {
+				t.Errorf("move to trash item = %+v", item)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("details = %q, want a move to trash item", feedback.titles())
+	}
+
+	// the deleted item disappears from the search without a sync
+	h.env["name"] = "GitHub"
+	h.bw("delete item item-1 --session "+s.session, "")
+	out, err := h.run("-delete", "-id", "item-1")
+	if err != nil || strings.TrimSpace(out) != "Moved GitHub to the trash." {
+		t.Fatalf("delete output = %q, %v", out, err)
+	}
+	if titles := h.runFeedback().titles(); strings.Join(titles, ",") != "Server notes" {
+		t.Errorf("search after delete = %q", titles)
+	}
+
+	h.bw("list items --trash --session "+s.session, `[
+		{"object": "item", "id": "item-3", "type": 2, "name": "Old notes", "deletedDate": "2022-02-01T10:00:00.000Z"},
+		{"object": "item", "id": "item-1", "type": 1, "name": "GitHub", "deletedDate": "2022-03-01T10:00:00.000Z", "login": {"username": "octocat"}}]`)
+	feedback = h.runFeedback("-trash")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "GitHub,Old notes" {
+		t.Fatalf("trash = %q", titles)
+	}
+	restore := feedback.Items[0]
+	if restore.Subtitle != "Deleted on 2022-03-01 ∙ ⏎ restore ∙ ⌘ delete permanently" || restore.Variables["action"] != "-restore" || restore.Variables["action2"] != "-id item-1" {
+		t.Errorf("trash item = %+v", restore)
+	}
+	if mod := restore.Mods["cmd"]; mod.Variables["action"] != "-confirmdelete" || mod.Variables["action2"] != "-id item-1" {
+		t.Errorf("trash item cmd = %+v", mod)
+	}
+
+	// deleting permanently needs a confirmation
+	h.env["name"] = "Old notes"
+	feedback = h.runFeedback("-confirmdelete", "-id", "item-3")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Yes, delete Old notes permanently,No, keep it in the trash" {
+		t.Fatalf("confirm delete = %q", titles)
+	}
+	if confirm := feedback.Items[0]; confirm.Variables["action"] != "-delete" || confirm.Variables["action3"] != "-permanent" || !confirm.Valid || feedback.Items[1].Valid {
+		t.Errorf("confirm delete items = %+v", feedback.Items)
+	}
+	h.bw("delete item item-3 --permanent --session "+s.session, "")
+	if out, err := h.run("-delete", "-id", "item-3", "-permanent"); err != nil || strings.TrimSpace(out) != "Deleted Old notes permanently." {
+		t.Fatalf("permanent delete output = %q, %v", out, err)
+	}
+
+	// a restored item is back in the search without a sync
+	h.bw("restore item item-1 --session "+s.session, "").
+		bw("get item item-1 --session "+s.session, `{"object": "item", "id": "item-1", "type": 1, "name": "GitHub",
+		"revisionDate": "2022-03-05T12:00:00.000Z", "login": {"username": "octocat", "password": "secret-password"}}`)
+	if out, err := h.run("-restore", "-id", "item-1"); err != nil || strings.TrimSpace(out) != "Restored GitHub." {
+		t.Fatalf("restore output = %q, %v", out, err)
+	}
+	if titles := h.runFeedback().titles(); strings.Join(titles, ",") != "Server notes,GitHub" {
+		t.Errorf("search after restore = %q", titles)
+	}
+	for _, call := range h.bwCalls() {
+		if strings.HasPrefix(call, "delete") && !strings.HasPrefix(call, "delete item item-1 --session") && !strings.HasPrefix(call, "delete item item-3 --permanent") {
+			t.Errorf("unexpected delete call %q", call)
+		}
+	}
+}
+
+func TestE2E_folders(t *testing.T) {
+	h, s := newUnlockedHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	h.env["SYNC_MODE"] = SYNC_MODE_LOCAL
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+s.session, e2eFoldersJson).
+		bw("sync --force --session "+s.session, "Syncing complete.")
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+	folderTitles := func() string {
+		return strings.Join(h.runFeedback("-folder").titles(), ",")
+	}
+
+	// folders are renamed with cmd and deleted with alt
+	feedback := h.runFeedback("-folder")
+	if titles := strings.Join(feedback.titles(), ","); titles != "Favorites,Work,No Folder,New Folder…,Go Back to Item Search" {
+		t.Fatalf("folders = %q", titles)
+	}
+	work := feedback.Items[1]
+	if mod := work.Mods["cmd"]; mod.Variables["action"] != "-renamefolder" || mod.Variables["action2"] != "-id folder-1" {
+		t.Errorf("rename modifier = %+v", mod)
+	}
+	if mod := work.Mods["alt"]; mod.Variables["action"] != "-confirmdelete" || mod.Variables["action2"] != "-id folder-1" || mod.Variables["action3"] != "-folder" {
+		t.Errorf("delete modifier = %+v", mod)
+	}
+	if len(feedback.Items[2].Mods) != 0 {
+		t.Errorf("No Folder has modifiers %+v", feedback.Items[2].Mods)
+	}
+
+	// create a folder, the name is passed via stdin
+	feedback = h.runFeedback("-newfolder", "Private", "stuff")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Create folder Private stuff" {
+		t.Fatalf("new folder = %q", titles)
+	}
+	h.bw("create folder --session "+s.session, `{"object": "folder", "id": "folder-2", "name": "Private stuff"}`)
+	out, err := h.run("-createfolder", feedback.Items[0].Arg)
+	if err != nil || strings.TrimSpace(out) != "Created folder Private stuff." {
+		t.Fatalf("createfolder output = %q, %v", out, err)
+	}
+	calls := h.bwCalls()
+	if stdin := calls[len(calls)-1]; stdin != "< "+base64.StdEncoding.EncodeToString([]byte(`{"name":"Private stuff"}`)) {
+		t.Errorf("create folder stdin = %q", stdin)
+	}
+	if titles := folderTitles(); titles != "Favorites,Private stuff,Work,No Folder,New Folder…,Go Back to Item Search" {
+		t.Errorf("folders after create = %q", titles)
+	}
+
+	// rename it
+	feedback = h.runFeedback("-renamefolder", "-id", "folder-2", "Archive")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Rename Private stuff to Archive" {
+		t.Fatalf("rename folder = %q", titles)
+	}
+	h.bw("edit folder folder-2 --session "+s.session, `{"object": "folder", "id": "folder-2", "name": "Archive"}`)
+	if out, err := h.run("-savefolder", "-id", "folder-2", feedback.Items[0].Arg); err != nil || strings.TrimSpace(out) != "Renamed folder to Archive." {
+		t.Fatalf("savefolder output = %q, %v", out, err)
+	}
+	if titles := folderTitles(); titles != "Favorites,Archive,Work,No Folder,New Folder…,Go Back to Item Search" {
+		t.Errorf("folders after rename = %q", titles)
+	}
+
+	// move GitHub from Work to Archive
+	found := false
+	for _, item := range h.runFeedback("-id", "item-1").Items {
+		if item.Title == "Move to Folder…" {
+			found = item.Subtitle == "Currently in Work ∙ ⏎ pick another folder" && item.Variables["action"] == "-movefolder"
+		}
+	}
+	if !found {
+		t.Error("details have no move to folder item")
+	}
+	feedback = h.runFeedback("-movefolder", "-id", "item-1")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Archive,Work,No Folder" {
+		t.Fatalf("move folder = %q", titles)
+	}
+	if feedback.Items[1].Valid || !feedback.Items[0].Valid || feedback.Items[2].Arg != "null" {
+		t.Errorf("move folder items = %+v", feedback.Items)
+	}
+	h.bw("get item item-1 --session "+s.session, `{"object": "item", "id": "item-1", "folderId": "folder-1", "type": 1, "name": "GitHub",
+		"login": {"username": "octocat", "password": "secret-password"}}`).
+		bw("edit item item-1 --session "+s.session, `{"object": "item", "id": "item-1", "folderId": "folder-2", "type": 1, "name": "GitHub",
+		"revisionDate": "2022-03-05T12:00:00.000Z", "login": {"username": "octocat"}}`)
+	if out, err := h.run("-setfolder", "-id", "item-1", feedback.Items[0].Arg); err != nil || strings.TrimSpace(out) != "Moved GitHub to Archive." {
+		t.Fatalf("setfolder output = %q, %v", out, err)
+	}
+	if titles := h.runFeedback("-folder", "-id", "folder-2").titles(); strings.Join(titles, ",") != "GitHub,Go Back to Folder Search" {
+		t.Errorf("archive folder = %q", titles)
+	}
+
+	// deleting the folder asks first and moves its items to No Folder
+	h.env["name"] = "Archive"
+	feedback = h.runFeedback("-confirmdelete", "-id", "folder-2", "-folder")
+	if titles := strings.Join(feedback.titles(), ","); titles != "Yes, delete folder Archive,No, keep the folder" {
+		t.Fatalf("confirm delete = %q", titles)
+	}
+	if confirm := feedback.Items[0]; confirm.Variables["action"] != "-deletefolder" || confirm.Variables["action2"] != "-id folder-2" || feedback.Items[1].Valid {
+		t.Errorf("confirm delete items = %+v", feedback.Items)
+	}
+	h.bw("delete folder folder-2 --session "+s.session, "")
+	if out, err := h.run("-deletefolder", "-id", "folder-2"); err != nil || strings.TrimSpace(out) != "Deleted folder Archive." {
+		t.Fatalf("deletefolder output = %q, %v", out, err)
+	}
+	if titles := folderTitles(); titles != "Favorites,Work,No Folder,New Folder…,Go Back to Item Search" {
+		t.Errorf("folders after delete = %q", titles)
+	}
+	if titles := h.runFeedback("-folder", "-id", "null").titles(); strings.Join(titles, ",") != "GitHub,Server notes,Go Back to Folder Search" {
+		t.Errorf("no folder after delete = %q", titles)
+	}
+}
+
+func TestE2E_collections(t *testing.T) {
+	h, s := newUnlockedHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	h.env["SYNC_MODE"] = SYNC_MODE_LOCAL
+	orgKey := newTestKey(t)
+	privateKey, encPrivateKey := newTestPrivateKey(t, s.userKey)
+	s.encPrivateKey = encPrivateKey
+	s.encOrgKeys = map[string]string{"org-1": wrapTestOrgKey(t, orgKey, &privateKey.PublicKey, Rsa2048_OaepSha1_B64)}
+	ciphers, folders := testCiphers(t, s.userKey)
+	ciphers["item-3"] = map[string]interface{}{
+		"id": "item-3", "organizationId": "org-1", "collectionIds": []string{"coll-1"}, "type": 2,
+		"name": encryptTestString(t, "Shared notes", orgKey), "revisionDate": "2022-03-01T12:00:00.000Z",
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(s.dataJson(t, "user-1", false, ciphers, folders)), &data); err != nil {
+		t.Fatal(err)
+	}
+	data["organizations_user-1"] = map[string]interface{}{"org-1": map[string]interface{}{"id": "org-1", "name": "Acme"}}
+	data["collections_user-1"] = map[string]interface{}{
+		"coll-1": map[string]interface{}{"id": "coll-1", "organizationId": "org-1", "name": encryptTestString(t, "Engineering", orgKey)},
+		"coll-2": map[string]interface{}{"id": "coll-2", "organizationId": "org-1", "name": encryptTestString(t, "Ops", orgKey)},
+	}
+	dataJson, _ := json.Marshal(data)
+	h.writeFile("data.json", string(dataJson))
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+s.session, e2eFoldersJson).
+		bw("sync --force --session "+s.session, "Syncing complete.")
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+
+	// the folder search links to the organizations
+	feedback := h.runFeedback("-folder")
+	if titles := strings.Join(feedback.titles(), ","); titles != "Favorites,Organizations,Work,No Folder,New Folder…,Go Back to Item Search" {
+		t.Fatalf("folders = %q", titles)
+	}
+	if orgs := feedback.Items[1]; orgs.Subtitle != "Acme" || orgs.Variables["action"] != "-orgs" {
+		t.Errorf("organizations item = %+v", orgs)
+	}
+
+	// organization → collection → items
+	feedback = h.runFeedback("-orgs")
+	if titles := strings.Join(feedback.titles(), ","); titles != "Acme,Go Back to Folder Search" {
+		t.Fatalf("organizations = %q", titles)
+	}
+	if acme := feedback.Items[0]; acme.Subtitle != "1 items ∙ 2 collections" || acme.Variables["action2"] != "-id org-1" {
+		t.Errorf("organization item = %+v", acme)
+	}
+	feedback = h.runFeedback("-org", "-id", "org-1")
+	if titles := strings.Join(feedback.titles(), ","); titles != "Engineering,Ops,Go Back to Organizations" {
+		t.Fatalf("collections = %q", titles)
+	}
+	if feedback.Items[0].Subtitle != "1 items" || feedback.Items[1].Subtitle != "0 items" || feedback.Items[0].Variables["action"] != "-collection" {
+		t.Errorf("collection items = %+v", feedback.Items)
+	}
+	if titles := strings.Join(h.runFeedback("-collection", "-id", "coll-1").titles(), ","); titles != "Shared notes,Go Back to Acme" {
+		t.Errorf("collection = %q", titles)
+	}
+
+	// the search shows where shared items are and the details name the collections
+	found := false
+	for _, item := range h.runFeedback().Items {
+		if item.Title == "Shared notes" {
+			found = strings.HasSuffix(item.Subtitle, " ∙ Acme › Engineering")
+		} else if strings.Contains(item.Subtitle, "Acme") {
+			t.Errorf("personal item subtitle = %q", item.Subtitle)
+		}
+	}
+	if !found {
+		t.Error("search has no organization in the subtitle of the shared item")
+	}
+	found = false
+	for _, item := range h.runFeedback("-id", "item-3").Items {
+		found = found || (item.Title == "Collections: Acme › Engineering" && item.Arg == "Engineering")
+	}
+	if !found {
+		t.Error("details have no collection names")
+	}
+}
+
+func TestE2E_attachments(t *testing.T) {
+	h, s := newUnlockedHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	h.env["SYNC_MODE"] = SYNC_MODE_LOCAL
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+s.session, e2eFoldersJson).
+		bw("sync --force --session "+s.session, "Syncing complete.")
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+	file := filepath.Join(h.dir, "my contract.pdf")
+	h.writeFile("my contract.pdf", "contract text")
+	details := func() map[string]string {
+		rows := map[string]string{}
+		for _, item := range h.runFeedback("-id", "item-1").Items {
+			rows[item.Title] = item.Variables["action"]
+			if mod, ok := item.Mods["alt"]; ok {
+				rows[item.Title+" ⌥"] = mod.Variables["action"] + " " + mod.Variables["action3"]
+			}
+		}
+		return rows
+	}
+	if action := details()["Attach a File…"]; action != "-attach" {
+		t.Fatalf("details attach action = %q", action)
+	}
+
+	// the typed path is checked before it is uploaded
+	h.writeFile("big.bin", "")
+	if err := os.Truncate(filepath.Join(h.dir, "big.bin"), ATTACHMENT_MAX_SIZE+1); err != nil {
+		t.Fatal(err)
+	}
+	feedback := h.runFeedback("-attach", "-id", "item-1", filepath.Join(h.dir, "big.bin"))
+	if len(feedback.Items) != 1 || feedback.Items[0].Valid || !strings.Contains(feedback.Items[0].Subtitle, "attachments can have up to 500 MB") {
+		t.Errorf("too large file = %+v", feedback.Items)
+	}
+	feedback = h.runFeedback("-attach", "-id", "item-1", file)
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Attach my contract.pdf to GitHub" {
+		t.Fatalf("attach = %q", titles)
+	}
+	upload := feedback.Items[0]
+	if upload.Subtitle != "13 Bytes ∙ ⏎ upload the file" || upload.Variables["action"] != "-attachfile" {
+		t.Errorf("attach item = %+v", upload)
+	}
+
+	// errors of the Bitwarden CLI are reported
+	h.bwResponse(bwResponse{Args: "^create attachment --file .* --itemid item-1 --session .*$", Stderr: "Premium status is required to use this feature.", Exit: 1})
+	if out, err := h.run("-attachfile", "-id", "item-1", upload.Arg); err == nil || !strings.Contains(out, "Premium status is required") {
+		t.Errorf("attachfile without premium = %q, %v", out, err)
+	}
+	h.scripts = h.scripts[:len(h.scripts)-1]
+	h.bw("create attachment --file "+file+" --itemid item-1 --session "+s.session, `{"object": "item", "id": "item-1", "folderId": "folder-1", "type": 1, "name": "GitHub",
+		"revisionDate": "2022-03-05T12:00:00.000Z", "login": {"username": "octocat", "password": "secret-password"},
+		"attachments": [{"id": "att-1", "fileName": "my contract.pdf", "size": "13", "sizeName": "13 Bytes"}]}`)
+	if out, err := h.run("-attachfile", "-id", "item-1", upload.Arg); err != nil || strings.TrimSpace(out) != "Attached my contract.pdf to GitHub." {
+		t.Fatalf("attachfile output = %q, %v", out, err)
+	}
+	if action := details()["Attachment: my contract.pdf (13 Bytes) ⌥"]; action != "-confirmdelete -attachment att-1" {
+		t.Errorf("attachment delete modifier = %q", action)
+	}
+
+	// the file action picks the item the file is attached to
+	h.env[ATTACHMENT_FILE_ENV] = file
+	feedback = h.runFeedback("-attachto")
+	if titles := strings.Join(feedback.titles(), ","); titles != "Attach my contract.pdf to GitHub,Attach my contract.pdf to Server notes" {
+		t.Errorf("attachto = %q", titles)
+	}
+	delete(h.env, ATTACHMENT_FILE_ENV)
+
+	// deleting asks first
+	h.env["name"] = "my contract.pdf"
+	feedback = h.runFeedback("-confirmdelete", "-id", "item-1", "-attachment", "att-1")
+	if titles := strings.Join(feedback.titles(), ","); titles != "Yes, delete attachment my contract.pdf,No, keep the attachment" {
+		t.Fatalf("confirm delete = %q", titles)
+	}
+	if yes := feedback.Items[0]; yes.Variables["action"] != "-deleteattachment" || yes.Variables["action3"] != "-attachment att-1" {
+		t.Errorf("confirm delete item = %+v", yes)
+	}
+	h.bw("delete attachment att-1 --itemid item-1 --session "+s.session, "")
+	if out, err := h.run("-deleteattachment", "-id", "item-1", "-attachment", "att-1"); err != nil || strings.TrimSpace(out) != "Deleted attachment my contract.pdf." {
+		t.Fatalf("deleteattachment output = %q, %v", out, err)
+	}
+	for title := range details() {
+		if strings.HasPrefix(title, "Attachment:") {
+			t.Errorf("deleted attachment still shown: %q", title)
+		}
+	}
+}
+
+func TestE2E_openAttachment(t *testing.T) {
+	h, s := newUnlockedHarness(t)
+	h.env["TMPDIR"] = h.dir
+	h.env["ATTACHMENT_VIEW_AGE"] = "5"
+	// the fake open logs the opened files
+	openDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(openDir, "open"), []byte("#!/bin/sh\nprintf '%s\\n' \"$1\" >> \"$FAKE_OPEN_LOG\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	h.env["PATH"] = fmt.Sprintf("%s%c%s", openDir, os.PathListSeparator, h.env["PATH"])
+	h.env["FAKE_OPEN_LOG"] = filepath.Join(h.dir, "open.log")
+	base := filepath.Join(h.dir, WORKFLOW_NAME+"-attachments")
+	manifest := filepath.Join(h.env["alfred_workflow_data"], ATTACHMENT_VIEWS_NAME)
+	open := func() string {
+		t.Helper()
+		out, err := h.run("-openattachment", "-id", "item-1", "-attachment", "att-1")
+		if err != nil || strings.TrimSpace(out) != "Opened passport scan.pdf, it's removed after 5 minutes." {
+			t.Fatalf("openattachment output = %q, %v", out, err)
+		}
+		data, err := os.ReadFile(h.env["FAKE_OPEN_LOG"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		return lines[len(lines)-1]
+	}
+
+	h.bwResponse(bwResponse{
+		Args:  fmt.Sprintf("^get attachment att-1 --itemid item-1 --output %s/view-[^ ]+/ --session %s --raw$", regexp.QuoteMeta(base), regexp.QuoteMeta(s.session)),
+		Files: map[string]string{"passport scan.pdf": "passport"},
+	})
+	path := open()
+	if filepath.Base(path) != "passport scan.pdf" || filepath.Dir(filepath.Dir(path)) != base {
+		t.Fatalf("opened %q", path)
+	}
+	for file, want := range map[string]os.FileMode{base: 0700, filepath.Dir(path): 0700, path: 0600} {
+		if info, err := os.Stat(file); err != nil || info.Mode().Perm() != want {
+			t.Errorf("%s mode = %v, %v, want %v", file, info.Mode().Perm(), err, want)
+		}
+	}
+
+	// locking removes the opened attachments
+	h.bw("lock", "Your vault is locked.")
+	if out, err := h.run("-lock"); err != nil {
+		t.Fatalf("lock output = %q, %v", out, err)
+	}
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Errorf("attachment folder after lock = %v", err)
+	}
+	if _, err := os.Stat(manifest); !os.IsNotExist(err) {
+		t.Errorf("manifest after lock = %v", err)
+	}
+
+	// expired attachments are removed by the cleanup
+	if err := alfred.SetToken(h.secretStore(), s.session); err != nil {
+		t.Fatal(err)
+	}
+	path = open()
+	views := []attachmentView{}
+	data, err := os.ReadFile(manifest)
+	if err != nil || json.Unmarshal(data, &views) != nil || len(views) != 1 {
+		t.Fatalf("manifest = %s, %v", data, err)
+	}
+	if until := time.Until(views[0].Expires); until < 4*time.Minute || until > 5*time.Minute {
+		t.Errorf("attachment expires in %s", until)
+	}
+	views[0].Expires = time.Now().Add(-time.Minute)
+	data, _ = json.Marshal(views)
+	if err := os.WriteFile(manifest, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := h.run("-cleanattachments"); err != nil {
+		t.Fatalf("cleanattachments output = %q, %v", out, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expired attachment = %v", err)
+	}
+}
+
+func TestE2E_send(t *testing.T) {
+	h, s := newUnlockedHarness(t)
+	h.env["TITLE_WITH_USER"] = "false"
+	h.env["TITLE_WITH_URLS"] = "false"
+	h.env["SYNC_MODE"] = SYNC_MODE_LOCAL
+	h.bw("login --quiet --check", "").
+		bw("list folders --nointeraction --session "+s.session, e2eFoldersJson).
+		bw("sync --force --session "+s.session, "Syncing complete.")
+	if out, err := h.run("-sync", "-force"); err != nil || !strings.Contains(out, "Synced.") {
+		t.Fatalf("sync output = %q, %v", out, err)
+	}
+	lastStdin := func() map[string]interface{} {
+		var encoded string
+		for _, call := range h.bwCalls() {
+			if strings.HasPrefix(call, "< ") {
+				encoded = strings.TrimPrefix(call, "< ")
+			}
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			t.Fatalf("invalid encoded send %q: %s", encoded, err)
+		}
+		var send map[string]interface{}
+		if err := json.Unmarshal(data, &send); err != nil {
+			t.Fatal(err)
+		}
+		return send
+	}
+
+	// the Sends are listed with the clipboard Send
+	h.bw("send list --session "+s.session, `[
+		{"object": "send", "id": "send-1", "accessUrl": "https://send.bitwarden.com/#abc/key", "name": "wifi", "type": 0,
+		 "text": {"text": "hunter2", "hidden": false}, "maxAccessCount": 3, "accessCount": 1, "deletionDate": "2030-01-01T00:00:00.000Z",
+		 "expirationDate": "2030-01-01T00:00:00.000Z", "passwordSet": false, "disabled": false},
+		{"object": "send", "id": "send-2", "accessUrl": "https://send.bitwarden.com/#def/key", "name": "report.pdf", "type": 1,
+		 "file": {"fileName": "report.pdf"}, "accessCount": 0, "deletionDate": "2030-01-01T00:00:00.000Z", "disabled": true}]`)
+	feedback := h.runFeedback("-send")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Send the clipboard,wifi,report.pdf" {
+		t.Fatalf("sends = %q", titles)
+	}
+	wifi := feedback.Items[1]
+	if wifi.Arg != "https://send.bitwarden.com/#abc/key" || wifi.Variables["action"] != "output" || !strings.HasPrefix(wifi.Subtitle, "Text ∙ 1 of 3 accesses ∙ expires ") {
+		t.Errorf("send item = %+v", wifi)
+	}
+	if mod := wifi.Mods["cmd"]; mod.Variables["action"] != "-sendrevoke" || mod.Variables["action2"] != "-id send-1" {
+		t.Errorf("revoke modifier = %+v", mod)
+	}
+	if _, ok := feedback.Items[2].Mods["cmd"]; ok {
+		t.Error("a revoked Send can be revoked")
+	}
+	if mod := feedback.Items[2].Mods["alt"]; mod.Variables["action"] != "-senddelete" || mod.Variables["action2"] != "-id send-2" {
+		t.Errorf("delete modifier = %+v", mod)
+	}
+
+	// a text Send with options, the link is printed to be copied
+	feedback = h.runFeedback("-send", "hunter2 expires:1d max:2")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Send text hunter2" {
+		t.Fatalf("text send = %q", titles)
+	}
+	if item := feedback.Items[0]; item.Subtitle != "expires in 1d ∙ max 2 accesses ∙ ⏎ create and copy the link" || item.Variables["action"] != "-sendcreate" {
+		t.Errorf("text send item = %+v", item)
+	}
+	h.bw("send create --session "+s.session, `{"object": "send", "id": "send-3", "accessUrl": "https://send.bitwarden.com/#ghi/key", "name": "hunter2"}`)
+	out, err := h.run("-sendcreate", feedback.Items[0].Arg)
+	if err != nil || out != "https://send.bitwarden.com/#ghi/key" {
+		t.Fatalf("sendcreate output = %q, %v", out, err)
+	}
+	if send := lastStdin(); send["name"] != "hunter2" || send["maxAccessCount"] != 2.0 || send["expirationDate"] == nil || send["text"].(map[string]interface{})["text"] != "hunter2" {
+		t.Errorf("created send = %v", send)
+	}
+
+	// a file Send
+	h.writeFile("report.pdf", "%PDF")
+	feedback = h.runFeedback("-send", filepath.Join(h.dir, "report.pdf"))
+	if titles := feedback.titles(); len(titles) != 2 || titles[0] != "Send file report.pdf" {
+		t.Fatalf("file send = %q", titles)
+	}
+	if _, err := h.run("-sendcreate", feedback.Items[0].Arg); err != nil {
+		t.Fatal(err)
+	}
+	if send := lastStdin(); send["type"] != 1.0 || send["file"].(map[string]interface{})["fileName"] != filepath.Join(h.dir, "report.pdf") {
+		t.Errorf("created file send = %v", send)
+	}
+
+	// the password of an item is sent hidden
+	found := false
+	for _, item := range h.runFeedback("-id", "item-1").Items {
+		found = found || (item.Title == "Share in a Send…" && item.Variables["action"] == "-sendfield")
+	}
+	if !found {
+		t.Error("details have no share in a Send item")
+	}
+	feedback = h.runFeedback("-sendfield", "-id", "item-1", "max:1")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Send Username,Send Password" {
+		t.Fatalf("send field = %q", titles)
+	}
+	password := feedback.Items[1]
+	h.bw("get item item-1 --session "+s.session, `{"object": "item", "id": "item-1", "type": 1, "name": "GitHub", "login": {"username": "octocat", "password": "secret-password"}}`)
+	out, err = h.run("-sendcreate", "-id", "item-1", password.Variables["action3"], password.Arg)
+	if err != nil || out != "https://send.bitwarden.com/#ghi/key" {
+		t.Fatalf("sendcreate field output = %q, %v", out, err)
+	}
+	if send := lastStdin(); send["name"] != "GitHub Password" || send["maxAccessCount"] != 1.0 || send["text"].(map[string]interface{})["text"] != "secret-password" || send["text"].(map[string]interface{})["hidden"] != true {
+		t.Errorf("created field send = %v", send)
+	}
+
+	// revoke and delete
+	h.bw("send get send-1 --session "+s.session, `{"object": "send", "id": "send-1", "name": "wifi", "disabled": false}`).
+		bw("send edit --session "+s.session, `{"object": "send", "id": "send-1", "name": "wifi", "disabled": true}`)
+	if out, err := h.run("-sendrevoke", "-id", "send-1"); err != nil || out != "Revoked Send wifi." {
+		t.Fatalf("sendrevoke output = %q, %v", out, err)
+	}
+	if send := lastStdin(); send["disabled"] != true {
+		t.Errorf("revoked send = %v", send)
+	}
+	h.env["name"] = "report.pdf"
+	h.bw("send delete send-2 --session "+s.session, "")
+	if out, err := h.run("-senddelete", "-id", "send-2"); err != nil || out != "Deleted Send report.pdf." {
+		t.Fatalf("senddelete output = %q, %v", out, err)
+	}
+
+	// a pasted link is only received by the action, receiving a text Send counts as access
+	receives := func() int {
+		count := 0
+		for _, call := range h.bwCalls() {
+			if strings.HasPrefix(call, "send receive") {
+				count++
+			}
+		}
+		return count
+	}
+	feedback = h.runFeedback("-send", "https://send.bitwarden.com/#abc/key password:s3cret")
+	if titles := feedback.titles(); strings.Join(titles, ",") != "Receive Send https://send.bitwarden.com/#abc/key" || feedback.Items[0].Variables["action"] != "-sendreceive" {
+		t.Fatalf("send link = %+v", feedback.Items)
+	}
+	if count := receives(); count != 0 {
+		t.Errorf("the Send was received %d times while typing", count)
+	}
+
+	// received text Sends are printed to be copied, the password is passed via the environment
+	h.bwResponse(bwResponse{
+		Args:   "^send receive https://send.bitwarden.com/#abc/key --obj --passwordenv " + SEND_PASSWORD_ENV + "$",
+		Env:    map[string]string{SEND_PASSWORD_ENV: "s3cret"},
+		Stdout: `{"object": "send-access", "id": "abc", "name": "wifi", "type": 0, "text": {"text": "hunter2", "hidden": false}}`,
+	})
+	if out, err := h.run("-sendreceive", feedback.Items[0].Arg); err != nil || out != "hunter2" {
+		t.Fatalf("sendreceive output = %q, %v", out, err)
+	}
+	if count := receives(); count != 1 {
+		t.Errorf("the Send was received %d times", count)
+	}
+
+	// files are saved to the output folder, its path can contain spaces
+	output := filepath.Join(h.dir, "My Downloads")
+	if err := os.Mkdir(output, 0700); err != nil {
+		t.Fatal(err)
+	}
+	h.env["OUTPUT_FOLDER"] = output
+	h.bw("send receive https://send.bitwarden.com/#def/key --obj",
+		`{"object": "send-access", "id": "def", "name": "report.pdf", "type": 1, "file": {"fileName": "report.pdf", "sizeName": "1 KB"}}`).
+		bwResponse(bwResponse{
+			Args:  "^send receive https://send.bitwarden.com/#def/key --output " + regexp.QuoteMeta(output) + "/$",
+			Files: map[string]string{"report.pdf": "report"},
+		})
+	feedback = h.runFeedback("-send", "https://send.bitwarden.com/#def/key")
+	if out, err := h.run("-sendreceive", feedback.Items[0].Arg); err != nil || out != filepath.Join(output, "report.pdf") {
+		t.Fatalf("sendreceive file output = %q, %v", out, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(output, "report.pdf")); err != nil || string(data) != "report" {
+		t.Errorf("saved file = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/generator"
+	aw "github.com/deanishe/awgo"
+)
+
+// editablePathRgx matches the json paths of the values which can be edited
+var editablePathRgx = regexp.MustCompile(`^(name|notes|login\.username|login\.password|login\.uris\[(\d+)\]\.uri|fields\[(\d+)\]\.value)$`)
+
+// addEditModifier lets cmd edit the value of a detail row, the new value is typed in Alfred
+func addEditModifier(it *aw.Item, id string, jsonPath string, label string) {
+	it.NewModifier(aw.ModCmd).
+		Subtitle(fmt.Sprintf("Edit %s", label)).
+		Arg("").
+		Var("action", "-edit").
+		Var("action2", fmt.Sprintf("-id %s", id)).
+		Var("action3", jsonPath).
+		Var("title", fmt.Sprintf("New %s", label))
+}
+
+// editLabel returns the name of the value at the json path and if it is a secret
+func editLabel(item Item, jsonPath string) (string, bool, error) {
+	match := editablePathRgx.FindStringSubmatch(jsonPath)
+	if match == nil {
+		return "", false, fmt.Errorf("%s can't be edited", jsonPath)
+	}
+	switch {
+	case match[1] == "name":
+		return "Name", false, nil
+	case match[1] == "notes":
+		return "Notes", item.Type == 2, nil
+	case match[1] == "login.username":
+		return "Username", false, nil
+	case match[1] == "login.password":
+		return "Password", true, nil
+	case match[2] != "":
+		return "URL", false, nil
+	}
+	index, _ := strconv.Atoi(match[3])
+	if index >= len(item.Fields) {
+		return "", false, fmt.Errorf("the item has no field %d", index)
+	}
+	return item.Fields[index].Name, item.Fields[index].Type == 1, nil
+}
+
+// patchItem sets the value at the json path of the item as returned by "bw get item".
+// "bw edit item" adds changed passwords and hidden fields to the password history itself.
+func patchItem(item map[string]interface{}, jsonPath string, value string) error {
+	match := editablePathRgx.FindStringSubmatch(jsonPath)
+	if match == nil {
+		return fmt.Errorf("%s can't be edited", jsonPath)
+	}
+
+	switch {
+	case match[1] == "name" || match[1] == "notes":
+		item[match[1]] = value
+	case match[1] == "login.username" || match[1] == "login.password":
+		login, ok := item["login"].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("the item is not a login")
+		}
+		login[strings.TrimPrefix(match[1], "login.")] = value
+	case match[2] != "":
+		login, _ := item["login"].(map[string]interface{})
+		uris, _ := login["uris"].([]interface{})
+		index, _ := strconv.Atoi(match[2])
+		if index >= len(uris) {
+			return fmt.Errorf("the item has no URL %d", index)
+		}
+		uri, ok := uris[index].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid URL %d", index)
+		}
+		uri["uri"] = value
+	default:
+		fields, _ := item["fields"].([]interface{})
+		index, _ := strconv.Atoi(match[3])
+		if index >= len(fields) {
+			return fmt.Errorf("the item has no field %d", index)
+		}
+		field, ok := fields[index].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid field %d", index)
+		}
+		field["value"] = value
+	}
+	return nil
+}
+
+// cachedItem returns the item of the items cache
+func cachedItem(id string) (Item, bool) {
+	items, err := loadCacheItems()
+	if err != nil {
+		log.Println(err)
+	}
+	for _, item := range items {
+		if item.Id == id {
+			return item, true
+		}
+	}
+	return Item{}, false
+}
+
+// runEdit shows the new value of the json path, which is passed as first argument, the new
+// value follows it. ⏎ saves the value, for passwords a generated one is offered as well.
+func runEdit() {
+	wf.Configure(aw.SuppressUIDs(true))
+	if _, ok := unlockedToken(); !ok {
+		return
+	}
+	jsonPath := cli.Arg(0)
+	value := ""
+	if cli.NArg() > 1 {
+		value = strings.Join(cli.Args()[1:], " ")
+	}
+	item, ok := cachedItem(opts.Id)
+	if !ok {
+		wf.Fatal(fmt.Sprintf("Item %s not found, sync the vault.", opts.Id))
+		return
+	}
+	label, secret, err := editLabel(item, jsonPath)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+
+	title := fmt.Sprintf("Set %s to %s", label, value)
+	subtitle := fmt.Sprintf("Type the new %s ∙ ⏎ save it in %s", strings.ToLower(label), item.Name)
+	valid := true
+	if value == "" {
+		title = fmt.Sprintf("Clear %s", label)
+		// ⏎ on the empty query would lose the name or the secret
+		if secret || jsonPath == "name" {
+			title = fmt.Sprintf("Type the new %s", strings.ToLower(label))
+			subtitle = fmt.Sprintf("%s can't be cleared", label)
+			valid = false
+		}
+	}
+	wf.NewItem(title).
+		Subtitle(subtitle).
+		Icon(iconBars).
+		Arg(base64.StdEncoding.EncodeToString([]byte(value))).
+		Var("action", "-edititem").
+		Var("action2", fmt.Sprintf("-id %s", item.Id)).
+		Var("action3", jsonPath).
+		Var("notification", fmt.Sprintf("Changed %s of %s", label, item.Name)).
+		Valid(valid)
+
+	if secret && jsonPath == "login.password" {
+		passwordOpts, _, _, err := generatorOptions("")
+		var password string
+		if err == nil {
+			password, err = generator.New(nil).Password(passwordOpts)
+		}
+		if err != nil {
+			log.Printf("Error generating a password: %s", err)
+		} else {
+			wf.NewItem("Set a generated password").
+				Subtitle(fmt.Sprintf("%d characters ∙ %.0f bits ∙ ⏎ save it in %s", passwordOpts.Length, generator.PasswordEntropy(passwordOpts), item.Name)).
+				Icon(iconPassword).
+				Arg(base64.StdEncoding.EncodeToString([]byte(password))).
+				Var("action", "-edititem").
+				Var("action2", fmt.Sprintf("-id %s", item.Id)).
+				Var("action3", jsonPath).
+				Var("notification", fmt.Sprintf("Changed %s of %s", label, item.Name)).
+				Valid(true)
+		}
+	}
+	wf.SendFeedback()
+}
+
+// editItem changes the item with "bw edit item", patch gets the item as returned by "bw get item"
+// so values which the workflow doesn't know are kept
+func editItem(id string, token string, patch func(item map[string]interface{}) error) (Item, error) {
+	args := fmt.Sprintf("%s get item %s --session %s", conf.BwExec, id, token)
+	result, err := runCmd(args, "Failed to get Bitwarden item.")
+	if err != nil {
+		return Item{}, err
+	}
+	var item map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &item); err != nil {
+		return Item{}, fmt.Errorf("invalid response of bw get item, %s", err)
+	}
+	if err := patch(item); err != nil {
+		return Item{}, err
+	}
+
+	encoded, err := encodeItem(item)
+	if err != nil {
+		return Item{}, err
+	}
+	args = fmt.Sprintf("%s edit item %s --session %s", conf.BwExec, id, token)
+	result, err = runCmdWithStdin(args, encoded, "Failed to edit the Bitwarden item.")
+	if err != nil {
+		return Item{}, err
+	}
+	var edited Item
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &edited); err != nil {
+		return Item{}, fmt.Errorf("invalid response of bw edit item, %s", err)
+	}
+	return edited, nil
+}
+
+// runEditItem sets the value at the json path of the item with "bw edit item" and updates the
+// item in the items cache. The value is passed base64 encoded after the json path.
+func runEditItem() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+	jsonPath := cli.Arg(0)
+	value, err := base64.StdEncoding.DecodeString(cli.Arg(1))
+	if err != nil {
+		wf.Fatal("Invalid value sent.")
+		return
+	}
+
+	edited, err := editItem(opts.Id, token, func(item map[string]interface{}) error {
+		return patchItem(item, jsonPath, string(value))
+	})
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	label, _, _ := editLabel(edited, jsonPath)
+	if err := storeCacheItem(edited); err != nil {
+		log.Printf("Error updating the item in the cache: %s", err)
+		fmt.Printf("Changed %s of %s. It shows up after the next sync.", label, edited.Name)
+		return
+	}
+	fmt.Printf("Changed %s of %s.", label, edited.Name)
+}
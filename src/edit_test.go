@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_patchItem(t *testing.T) {
+	item := `{"id": "item-1", "type": 1, "name": "GitHub", "notes": "",
+		"login": {"username": "octocat", "password": "old-password", "uris": [{"match": null, "uri": "https://github.com"}]},
+		"fields": [{"name": "pin", "value": "1234", "type": 1}, {"name": "team", "value": "core", "type": 0}],
+		"passwordHistory": [{"lastUsedDate": "2022-01-01T00:00:00.000Z", "password": "1"}, {"lastUsedDate": "2021-01-01T00:00:00.000Z", "password": "2"}]}`
+	tests := []struct {
+		name      string
+		jsonPath  string
+		value     string
+		wantValue string
+		wantErr   bool
+	}{
+		{name: "username", jsonPath: "login.username", value: "hubot", wantValue: "hubot"},
+		{name: "password", jsonPath: "login.password", value: "new-password", wantValue: "new-password"},
+		{name: "uri", jsonPath: "login.uris[0].uri", value: "https://github.com/login", wantValue: "https://github.com/login"},
+		{name: "notes", jsonPath: "notes", value: "line 1\nline 2", wantValue: "line 1\nline 2"},
+		{name: "hidden field", jsonPath: "fields[0].value", value: "9876", wantValue: "9876"},
+		{name: "text field", jsonPath: "fields[1].value", value: "", wantValue: ""},
+		{name: "missing field", jsonPath: "fields[2].value", value: "x", wantErr: true},
+		{name: "missing uri", jsonPath: "login.uris[1].uri", value: "x", wantErr: true},
+		{name: "not editable", jsonPath: "login.totp", value: "x", wantErr: true},
+		{name: "id", jsonPath: "id", value: "x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patched map[string]interface{}
+			if err := json.Unmarshal([]byte(item), &patched); err != nil {
+				t.Fatal(err)
+			}
+			err := patchItem(patched, tt.jsonPath, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("patchItem() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			data, _ := json.Marshal(patched)
+			var got Item
+			var history struct {
+				PasswordHistory []struct {
+					Password string `json:"password"`
+				} `json:"passwordHistory"`
+			}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &history); err != nil {
+				t.Fatal(err)
+			}
+
+			values := map[string]string{
+				"login.username":    got.Login.Username,
+				"login.password":    got.Login.Password,
+				"login.uris[0].uri": got.Login.Uris[0].Uri,
+				"notes":             got.Notes,
+				"fields[0].value":   got.Fields[0].Value,
+				"fields[1].value":   got.Fields[1].Value,
+			}
+			if values[tt.jsonPath] != tt.wantValue {
+				t.Errorf("%s = %q, want %q", tt.jsonPath, values[tt.jsonPath], tt.wantValue)
+			}
+			// the password history is left to bw edit item
+			if len(history.PasswordHistory) != 2 || history.PasswordHistory[0].Password != "1" || history.PasswordHistory[1].Password != "2" {
+				t.Errorf("password history = %+v", history.PasswordHistory)
+			}
+		})
+	}
+}
+
+func Test_editLabel(t *testing.T) {
+	item := Item{Type: 1, Fields: []Field{{Name: "pin", Type: 1}, {Name: "team", Type: 0}}}
+	tests := []struct {
+		jsonPath   string
+		wantLabel  string
+		wantSecret bool
+		wantErr    bool
+	}{
+		{jsonPath: "name", wantLabel: "Name"},
+		{jsonPath: "notes", wantLabel: "Notes"},
+		{jsonPath: "login.username", wantLabel: "Username"},
+		{jsonPath: "login.password", wantLabel: "Password", wantSecret: true},
+		{jsonPath: "login.uris[3].uri", wantLabel: "URL"},
+		{jsonPath: "fields[0].value", wantLabel: "pin", wantSecret: true},
+		{jsonPath: "fields[1].value", wantLabel: "team"},
+		{jsonPath: "fields[2].value", wantErr: true},
+		{jsonPath: "card.number", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.jsonPath, func(t *testing.T) {
+			label, secret, err := editLabel(item, tt.jsonPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("editLabel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if label != tt.wantLabel || secret != tt.wantSecret {
+				t.Errorf("editLabel() = %q, %v, want %q, %v", label, secret, tt.wantLabel, tt.wantSecret)
+			}
+		})
+	}
+}
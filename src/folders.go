@@ -0,0 +1,309 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	aw "github.com/deanishe/awgo"
+)
+
+// addFolderModifiers lets cmd rename and alt delete the folder in the folder search, deleting asks first
+func addFolderModifiers(it *aw.Item, folder Folder, itemCount int) {
+	it.NewModifier(aw.ModCmd).
+		Subtitle(fmt.Sprintf("Rename folder %s", folder.Name)).
+		Arg("").
+		Var("action", "-renamefolder").
+		Var("action2", fmt.Sprintf("-id %s", folder.Id)).
+		Var("action3", " ").
+		Var("title", fmt.Sprintf("Rename %s", folder.Name))
+	it.NewModifier(aw.ModOpt).
+		Subtitle(fmt.Sprintf("Delete folder %s, its %d items are moved to No Folder", folder.Name, itemCount)).
+		Arg("").
+		Var("action", "-confirmdelete").
+		Var("action2", fmt.Sprintf("-id %s", folder.Id)).
+		Var("action3", "-folder").
+		Var("name", folder.Name).
+		Var("title", "Delete folder?")
+}
+
+// addNewFolderItem asks for the name of a new folder
+func addNewFolderItem() {
+	wf.NewItem("New Folder…").
+		Subtitle("Create a folder, the name is typed next").
+		Valid(true).
+		UID("newfolder").
+		Icon(iconFolder).
+		Arg("").
+		Var("action", "-newfolder").
+		Var("action2", " ").
+		Var("action3", " ").
+		Var("title", "New folder name")
+}
+
+// addMoveToFolderItem lets the item be moved to another folder
+func addMoveToFolderItem(item Item) {
+	current := "No Folder"
+	if folder, ok := cachedFolder(item.FolderId); ok {
+		current = folder.Name
+	}
+	wf.NewItem("Move to Folder…").
+		Subtitle(fmt.Sprintf("Currently in %s ∙ ⏎ pick another folder", current)).
+		Valid(true).
+		Icon(iconFolderOpen).
+		Arg("").
+		Var("action", "-movefolder").
+		Var("action2", fmt.Sprintf("-id %s", item.Id)).
+		Var("action3", " ").
+		Var("title", fmt.Sprintf("Move %s to", item.Name))
+}
+
+// cachedFolder returns the folder of the folders cache, the empty id is "No Folder"
+func cachedFolder(id string) (Folder, bool) {
+	folders, err := loadCacheFolders()
+	if err != nil {
+		log.Println(err)
+	}
+	for _, folder := range folders {
+		if folder.Id == id {
+			return folder, true
+		}
+	}
+	return Folder{}, false
+}
+
+// folderArg returns the id of the folder as used in the arguments, "null" is "No Folder"
+func folderArg(id string) string {
+	if id == "" {
+		return "null"
+	}
+	return id
+}
+
+// runNewFolder shows the folder which is created with the name typed in Alfred
+func runNewFolder() {
+	wf.Configure(aw.SuppressUIDs(true))
+	if _, ok := unlockedToken(); !ok {
+		return
+	}
+	name := strings.TrimSpace(strings.Join(cli.Args(), " "))
+	if name == "" {
+		wf.NewItem("Type the name of the new folder").
+			Icon(iconFolder).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+	wf.NewItem(fmt.Sprintf("Create folder %s", name)).
+		Subtitle("⏎ create the folder").
+		Icon(iconFolder).
+		Arg(base64.StdEncoding.EncodeToString([]byte(name))).
+		Var("action", "-createfolder").
+		Var("action2", " ").
+		Var("action3", " ").
+		Var("notification", fmt.Sprintf("Created folder %s", name)).
+		Valid(true)
+	wf.SendFeedback()
+}
+
+// runRenameFolder shows the new name of folder id which is typed in Alfred
+func runRenameFolder() {
+	wf.Configure(aw.SuppressUIDs(true))
+	if _, ok := unlockedToken(); !ok {
+		return
+	}
+	folder, ok := cachedFolder(opts.Id)
+	if !ok || opts.Id == "" {
+		wf.Fatal(fmt.Sprintf("Folder %s not found, sync the vault.", opts.Id))
+		return
+	}
+	name := strings.TrimSpace(strings.Join(cli.Args(), " "))
+	if name == "" {
+		wf.NewItem(fmt.Sprintf("Type the new name of %s", folder.Name)).
+			Icon(iconFolder).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+	wf.NewItem(fmt.Sprintf("Rename %s to %s", folder.Name, name)).
+		Subtitle("⏎ rename the folder").
+		Icon(iconFolder).
+		Arg(base64.StdEncoding.EncodeToString([]byte(name))).
+		Var("action", "-savefolder").
+		Var("action2", fmt.Sprintf("-id %s", folder.Id)).
+		Var("action3", " ").
+		Var("notification", fmt.Sprintf("Renamed %s to %s", folder.Name, name)).
+		Valid(true)
+	wf.SendFeedback()
+}
+
+// runMoveFolder shows the folders item id can be moved to, filtered by the query
+func runMoveFolder() {
+	wf.Configure(aw.SuppressUIDs(true))
+	if _, ok := unlockedToken(); !ok {
+		return
+	}
+	item, ok := cachedItem(opts.Id)
+	if !ok {
+		wf.Fatal(fmt.Sprintf("Item %s not found, sync the vault.", opts.Id))
+		return
+	}
+	folders, err := loadCacheFolders()
+	if err != nil {
+		log.Println(err)
+	}
+	for _, folder := range folders {
+		it := wf.NewItem(folder.Name).
+			Icon(iconFolderOpen).
+			Arg(folderArg(folder.Id)).
+			Var("action", "-setfolder").
+			Var("action2", fmt.Sprintf("-id %s", item.Id)).
+			Var("action3", " ").
+			Var("notification", fmt.Sprintf("Moved %s to %s", item.Name, folder.Name))
+		if folder.Id == item.FolderId {
+			it.Subtitle(fmt.Sprintf("%s is in this folder", item.Name)).Valid(false)
+		} else {
+			it.Subtitle(fmt.Sprintf("⏎ move %s to this folder", item.Name)).Valid(true)
+		}
+	}
+	if query := strings.TrimSpace(strings.Join(cli.Args(), " ")); query != "" {
+		wf.Filter(query)
+	}
+	wf.WarnEmpty("No Folders Found", "Try a different query")
+	wf.SendFeedback()
+}
+
+// saveFolder creates the folder or renames folder id with the Bitwarden CLI and updates the folders cache
+func saveFolder(id string, encodedName string, token string) (Folder, error) {
+	name, err := base64.StdEncoding.DecodeString(encodedName)
+	if err != nil || strings.TrimSpace(string(name)) == "" {
+		return Folder{}, fmt.Errorf("invalid folder name sent")
+	}
+	encoded, err := encodeItem(map[string]string{"name": strings.TrimSpace(string(name))})
+	if err != nil {
+		return Folder{}, err
+	}
+	args := fmt.Sprintf("%s create folder --session %s", conf.BwExec, token)
+	if id != "" {
+		args = fmt.Sprintf("%s edit folder %s --session %s", conf.BwExec, id, token)
+	}
+	result, err := runCmdWithStdin(args, encoded, "Failed to save the Bitwarden folder.")
+	if err != nil {
+		return Folder{}, err
+	}
+	var folder Folder
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &folder); err != nil {
+		return Folder{}, fmt.Errorf("invalid response of bw folder, %s", err)
+	}
+	if err := storeCacheFolder(folder); err != nil {
+		log.Printf("Error updating the folders cache: %s", err)
+	}
+	return folder, nil
+}
+
+// runCreateFolder creates the folder with the base64 encoded name
+func runCreateFolder() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	folder, err := saveFolder("", cli.Arg(0), token)
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	fmt.Printf("Created folder %s.", folder.Name)
+}
+
+// runSaveFolder renames folder id to the base64 encoded name
+func runSaveFolder() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+	folder, err := saveFolder(opts.Id, cli.Arg(0), token)
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	fmt.Printf("Renamed folder to %s.", folder.Name)
+}
+
+// runDeleteFolder deletes folder id, Bitwarden moves its items to "No Folder"
+func runDeleteFolder() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+	name := strings.TrimSpace(os.Getenv("name"))
+	if name == "" {
+		name = opts.Id
+	}
+	args := fmt.Sprintf("%s delete folder %s --session %s", conf.BwExec, opts.Id, token)
+	if _, err := runCmd(args, "Failed to delete the Bitwarden folder."); err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	if err := deleteCacheFolder(opts.Id); err != nil {
+		log.Printf("Error removing the folder from the cache: %s", err)
+	}
+	fmt.Printf("Deleted folder %s.", name)
+}
+
+// runSetFolder moves item id to the folder passed as argument, "null" is "No Folder"
+func runSetFolder() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+	folderId := cli.Arg(0)
+	if folderId == "null" {
+		folderId = ""
+	}
+	folder, ok := cachedFolder(folderId)
+	if !ok {
+		wf.Fatal(fmt.Sprintf("Folder %s not found, sync the vault.", folderId))
+		return
+	}
+
+	edited, err := editItem(opts.Id, token, func(item map[string]interface{}) error {
+		if folderId == "" {
+			item["folderId"] = nil
+		} else {
+			item["folderId"] = folderId
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	if err := storeCacheItem(edited); err != nil {
+		log.Printf("Error updating the item in the cache: %s", err)
+		fmt.Printf("Moved %s to %s. It shows up after the next sync.", edited.Name, folder.Name)
+		return
+	}
+	fmt.Printf("Moved %s to %s.", edited.Name, folder.Name)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/generator"
+	aw "github.com/deanishe/awgo"
+)
+
+const (
+	// GENERATOR_CANDIDATES is the number of passwords and passphrases which are offered
+	GENERATOR_CANDIDATES = 3
+	// EFF_WORDLIST is the file name of the EFF word list in the workflow folder
+	EFF_WORDLIST = "eff_large_wordlist.txt"
+	// GENERATOR_MIN_LENGTH is the shortest password which is generated, the same as in the Bitwarden clients
+	GENERATOR_MIN_LENGTH = 5
+)
+
+// generatorOptions returns the password and passphrase options of the configuration,
+// a number in the query sets the length of the passwords, the other words are the name
+// of the login which can be created with a password. A length outside of 5 to 128 characters
+// is returned as error.
+func generatorOptions(query string) (generator.PasswordOptions, generator.PassphraseOptions, string, error) {
+	password := generator.PasswordOptions{
+		Length:         conf.GeneratorLength,
+		AvoidAmbiguous: conf.GeneratorAvoidAmbiguous,
+	}
+	for _, set := range strings.Split(conf.GeneratorCharacters, ",") {
+		switch strings.TrimSpace(set) {
+		case "lower":
+			password.Lowercase = true
+		case "upper":
+			password.Uppercase = true
+		case "numbers":
+			password.Numbers = true
+		case "special":
+			password.Special = true
+		}
+	}
+	passphrase := generator.PassphraseOptions{
+		Words:         conf.PassphraseWords,
+		Separator:     conf.PassphraseSeparator,
+		Capitalize:    conf.PassphraseCapitalize,
+		IncludeNumber: conf.PassphraseNumber,
+	}
+
+	var name []string
+	for _, word := range strings.Fields(query) {
+		if length, err := strconv.Atoi(word); err == nil {
+			password.Length = length
+			continue
+		}
+		name = append(name, word)
+	}
+	var err error
+	if password.Length < GENERATOR_MIN_LENGTH || password.Length > generator.MaxLength {
+		err = fmt.Errorf("the length must be between %d and %d characters", GENERATOR_MIN_LENGTH, generator.MaxLength)
+	}
+	return password, passphrase, strings.Join(name, " "), err
+}
+
+// loadWordlist reads the word list of PASSPHRASE_WORDLIST or the EFF word list of the workflow
+func loadWordlist() ([]string, error) {
+	path := conf.PassphraseWordlist
+	if path == "" {
+		path = filepath.Join(wf.Dir(), EFF_WORDLIST)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return generator.ParseWordlist(f)
+}
+
+// runGenerate shows random passwords and passphrases which can be copied or used for a new login
+func runGenerate() {
+	wf.Configure(aw.SuppressUIDs(true))
+	passwordOpts, passphraseOpts, name, lengthErr := generatorOptions(opts.Query)
+	gen := generator.New(nil)
+
+	bits := generator.PasswordEntropy(passwordOpts)
+	for i := 0; i < GENERATOR_CANDIDATES; i++ {
+		var password string
+		err := lengthErr
+		if err == nil {
+			password, err = gen.Password(passwordOpts)
+		}
+		if err != nil {
+			wf.NewItem("Can't generate a password").
+				Subtitle(err.Error()).
+				Icon(aw.IconWarning).
+				Valid(false)
+			break
+		}
+		addGeneratedItem(password, fmt.Sprintf("Password ∙ %d characters ∙ %.0f bits", passwordOpts.Length, bits), name)
+	}
+
+	wordlist, err := loadWordlist()
+	if err != nil {
+		log.Printf("Error loading the word list: %s", err)
+		wf.NewItem("No passphrases, the word list can't be loaded").
+			Subtitle(err.Error()).
+			Icon(aw.IconWarning).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+	bits = generator.PassphraseEntropy(len(wordlist), passphraseOpts)
+	for i := 0; i < GENERATOR_CANDIDATES; i++ {
+		passphrase, err := gen.Passphrase(wordlist, passphraseOpts)
+		if err != nil {
+			wf.NewItem("Can't generate a passphrase").
+				Subtitle(err.Error()).
+				Icon(aw.IconWarning).
+				Valid(false)
+			break
+		}
+		addGeneratedItem(passphrase, fmt.Sprintf("Passphrase ∙ %d words ∙ %.0f bits", passphraseOpts.Words, bits), name)
+	}
+	wf.SendFeedback()
+}
+
+// addGeneratedItem adds a generated credential which is copied, with cmd a login with it is created
+func addGeneratedItem(secret string, subtitle string, name string) {
+	loginName := name
+	if loginName == "" {
+		loginName = GENERATED_LOGIN_NAME
+	}
+	it := wf.NewItem(secret).
+		Subtitle(fmt.Sprintf("%s ∙ ⏎ copy", subtitle)).
+		Icon(iconPassword).
+		Arg(secret).
+		Var("sound", "true").
+		Var("action", "output").
+		Valid(true)
+	it.NewModifier(aw.ModCmd).
+		Subtitle(fmt.Sprintf("Create login %q with this password", loginName)).
+		Arg(secret).
+		Var("action", "-createlogin").
+		Var("action2", " ").
+		Var("action3", " ").
+		Var("name", loginName).
+		Var("notification", fmt.Sprintf("Created login %s", loginName))
+}
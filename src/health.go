@@ -0,0 +1,320 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	aw "github.com/deanishe/awgo"
+)
+
+// The kinds of findings of the health report, in the order they are listed
+const (
+	HEALTH_REUSED   = "reused"
+	HEALTH_WEAK     = "weak"
+	HEALTH_STALE    = "stale"
+	HEALTH_INSECURE = "insecure"
+)
+
+// healthFinding is a problem of a login, it never contains the password
+type healthFinding struct {
+	Kind   string
+	ItemId string
+	Name   string
+	Detail string
+}
+
+// commonPasswords are passwords and words which are tried first by every attacker
+var commonPasswords = []string{
+	"password", "passwort", "123456", "qwerty", "azerty", "qwertz", "letmein", "welcome", "admin",
+	"iloveyou", "monkey", "dragon", "football", "baseball", "master", "login", "abc123", "secret",
+	"sunshine", "princess", "shadow", "superman", "trustno1", "changeme", "default", "hello",
+}
+
+// keyboardRows are the rows of the common keyboard layouts, typed in order they are a pattern
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm", "qwertzuiop", "yxcvbnm", "azertyuiop"}
+
+// estimateStrength returns the estimated entropy of the password in bits and the pattern which weakens
+// it most. Repeated characters and sequences of the alphabet, numbers or the keyboard only count once,
+// common passwords and the user inputs, like the username, count as a single guess.
+func estimateStrength(password string, userInputs ...string) (float64, string) {
+	lower := strings.ToLower(password)
+	if lower == "" {
+		return 0, "empty"
+	}
+	for _, common := range commonPasswords {
+		if strings.Contains(lower, common) {
+			bits, _ := estimateStrength(strings.Replace(lower, common, "", 1), userInputs...)
+			return bits + math.Log2(float64(len(commonPasswords))), "common password"
+		}
+	}
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if len(input) >= 3 && strings.Contains(lower, input) {
+			bits, _ := estimateStrength(strings.Replace(lower, input, "", 1))
+			return bits + 1, "contains the username or name"
+		}
+	}
+
+	pool := 0
+	var hasLower, hasUpper, hasDigit, hasOther bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasOther = true
+		}
+	}
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{hasLower, 26}, {hasUpper, 26}, {hasDigit, 10}, {hasOther, 33}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+
+	// characters which continue a repetition or a sequence don't add entropy
+	runes := []rune(lower)
+	effective := 1
+	skipped := map[string]int{}
+	for i := 1; i < len(runes); i++ {
+		switch {
+		case runes[i] == runes[i-1]:
+			skipped["repeated characters"]++
+		case runes[i] == runes[i-1]+1 || runes[i] == runes[i-1]-1:
+			skipped["sequence"]++
+		case isKeyboardSequence(runes[i-1], runes[i]):
+			skipped["keyboard sequence"]++
+		default:
+			effective++
+		}
+	}
+	bits := float64(effective) * math.Log2(float64(pool))
+
+	// a pattern is only named if it makes up a notable part of the password
+	pattern := ""
+	most := 0
+	for _, name := range []string{"repeated characters", "sequence", "keyboard sequence"} {
+		if skipped[name] > most && skipped[name]*4 >= len(runes) {
+			pattern, most = name, skipped[name]
+		}
+	}
+	if pattern == "" && effective < 8 {
+		pattern = "too short"
+	}
+	return bits, pattern
+}
+
+// isKeyboardSequence reports if b follows a on a keyboard row
+func isKeyboardSequence(a rune, b rune) bool {
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, a)
+		if i >= 0 && i+1 < len(row) && rune(row[i+1]) == b {
+			return true
+		}
+	}
+	return false
+}
+
+// analyzeHealth returns the findings of the logins, items need the decrypted passwords.
+// Passwords are compared by their hash so the findings can't leak them.
+func analyzeHealth(items []Item, now time.Time, maxAge time.Duration, minBits float64) []healthFinding {
+	var findings []healthFinding
+	byPassword := map[[sha256.Size]byte][]Item{}
+	for _, item := range items {
+		if item.Type != 1 {
+			continue
+		}
+		if item.Login.Password != "" {
+			hash := sha256.Sum256([]byte(item.Login.Password))
+			byPassword[hash] = append(byPassword[hash], item)
+
+			if bits, pattern := estimateStrength(item.Login.Password, item.Login.Username, item.Name); bits < minBits {
+				detail := fmt.Sprintf("About %.0f bits", bits)
+				if pattern != "" {
+					detail = fmt.Sprintf("%s, %s", detail, pattern)
+				}
+				findings = append(findings, healthFinding{Kind: HEALTH_WEAK, ItemId: item.Id, Name: item.Name, Detail: detail})
+			}
+
+			// without a password revision date the password wasn't changed since the item was
+			// created, so it is at least as old as the last revision of the item
+			changed := item.Login.PasswordRevisionDate
+			if changed.IsZero() {
+				changed = item.RevisionDate
+			}
+			if maxAge > 0 && !changed.IsZero() && now.Sub(changed) > maxAge {
+				findings = append(findings, healthFinding{Kind: HEALTH_STALE, ItemId: item.Id, Name: item.Name,
+					Detail: fmt.Sprintf("Not changed since %s", changed.Format("2006-01-02"))})
+			}
+		}
+		for _, uri := range item.Login.Uris {
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(uri.Uri)), "http://") {
+				findings = append(findings, healthFinding{Kind: HEALTH_INSECURE, ItemId: item.Id, Name: item.Name,
+					Detail: fmt.Sprintf("Unencrypted URI %s", uri.Uri)})
+				break
+			}
+		}
+	}
+
+	for _, reused := range byPassword {
+		if len(reused) < 2 {
+			continue
+		}
+		for _, item := range reused {
+			var others []string
+			for _, other := range reused {
+				if other.Id != item.Id {
+					others = append(others, other.Name)
+				}
+			}
+			sort.Strings(others)
+			findings = append(findings, healthFinding{Kind: HEALTH_REUSED, ItemId: item.Id, Name: item.Name,
+				Detail: fmt.Sprintf("Same password as %s", strings.Join(others, ", "))})
+		}
+	}
+
+	order := map[string]int{HEALTH_REUSED: 0, HEALTH_WEAK: 1, HEALTH_STALE: 2, HEALTH_INSECURE: 3}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Kind != findings[j].Kind {
+			return order[findings[i].Kind] < order[findings[j].Kind]
+		}
+		if findings[i].Name != findings[j].Name {
+			return findings[i].Name < findings[j].Name
+		}
+		return findings[i].ItemId < findings[j].ItemId
+	})
+	return findings
+}
+
+// loadLoginsWithSecrets decrypts the logins of the data.json including their passwords, they are
+// never written to a cache and only kept as long as the caller holds them. Logins which can't be
+// decrypted are skipped, their number is returned as well.
+func loadLoginsWithSecrets(token string) ([]Item, int, error) {
+	data, err := os.ReadFile(bwData.path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading file %s, %s", bwData.path, err)
+	}
+	keys, err := loadVaultKeys(data, token)
+	if err != nil {
+		return nil, 0, err
+	}
+	vault, err := readDataJsonVault(data, bwData.UserId, bwData.ActiveUserId != "")
+	if err != nil {
+		return nil, 0, err
+	}
+	var items []Item
+	skipped := 0
+	for _, cipher := range vault.Ciphers {
+		if cipher.DeletedDate != nil || cipher.Type != 1 {
+			continue
+		}
+		item, err := decryptCipher(cipher, keys, true)
+		if err != nil {
+			log.Printf("Skipping item %s, error decrypting it: %s", cipher.Id, err)
+			skipped++
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, skipped, nil
+}
+
+// addSkippedLoginsItem shows how many logins couldn't be decrypted and weren't checked
+func addSkippedLoginsItem(skipped int) {
+	if skipped == 0 {
+		return
+	}
+	title := fmt.Sprintf("%d logins couldn't be decrypted", skipped)
+	if skipped == 1 {
+		title = "1 login couldn't be decrypted"
+	}
+	wf.NewItem(title).
+		Subtitle("They weren't checked, the log of the workflow names them").
+		Icon(iconWarning).
+		Valid(false)
+}
+
+// unlockedToken returns the session of the unlocked vault, otherwise it shows the login or
+// unlock item and returns false
+func unlockedToken() (string, bool) {
+	sfaMode := -1
+	if conf.Sfa {
+		sfaMode = conf.SfaMode
+	}
+	if bwData.UserId == "" {
+		addLoginItem(conf.Email, sfaMode)
+		wf.SendFeedback()
+		return "", false
+	}
+	token, err := sessionToken()
+	if err != nil {
+		addUnlockItem(conf.Email)
+		wf.SendFeedback()
+		return "", false
+	}
+	return token, true
+}
+
+// runHealth shows the reused, weak and old passwords and the logins with unencrypted URIs
+func runHealth() {
+	wf.Configure(aw.SuppressUIDs(true))
+	token, ok := unlockedToken()
+	if !ok {
+		return
+	}
+
+	items, skipped, err := loadLoginsWithSecrets(token)
+	if err != nil {
+		wf.NewItem("Can't analyze the vault").
+			Subtitle(err.Error()).
+			Icon(iconWarning).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+	maxAge := time.Duration(conf.HealthMaxPasswordAge) * 24 * time.Hour
+	findings := analyzeHealth(items, time.Now(), maxAge, float64(conf.HealthMinBits))
+	checked := len(items)
+
+	titles := map[string]string{
+		HEALTH_REUSED:   "Reused password",
+		HEALTH_WEAK:     "Weak password",
+		HEALTH_STALE:    "Old password",
+		HEALTH_INSECURE: "Unencrypted URI",
+	}
+	for _, finding := range findings {
+		wf.NewItem(fmt.Sprintf("%s: %s", titles[finding.Kind], finding.Name)).
+			Subtitle(fmt.Sprintf("%s ∙ ⏎ show details", finding.Detail)).
+			Match(fmt.Sprintf("%s %s %s", finding.Kind, titles[finding.Kind], finding.Name)).
+			Icon(iconWarning).
+			Var("action", fmt.Sprintf("-id %s", finding.ItemId)).
+			Var("action2", " ").
+			Var("action3", " ").
+			Arg(" ").
+			Valid(true)
+	}
+	if len(findings) == 0 {
+		wf.NewItem("No issues found").
+			Subtitle(fmt.Sprintf("Checked %d logins", checked)).
+			Icon(iconOn).
+			Valid(false)
+	}
+	addSkippedLoginsItem(skipped)
+	wf.SendFeedback()
+}
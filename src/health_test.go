@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func Test_estimateStrength(t *testing.T) {
+	tests := []struct {
+		name        string
+		password    string
+		userInputs  []string
+		wantWeak    bool
+		wantPattern string
+	}{
+		{name: "random password", password: "x7#Kq9!vR2@mZ4$w"},
+		{name: "passphrase", password: "correct-horse-battery-staple"},
+		{name: "short", password: "aB3$x", wantWeak: true, wantPattern: "too short"},
+		{name: "common password", password: "Password1!", wantWeak: true, wantPattern: "common password"},
+		{name: "repeated characters", password: "aaaaaaaaaaaaaaaaaaaaaaaa", wantWeak: true, wantPattern: "repeated characters"},
+		{name: "alphabet sequence", password: "abcdefghijklmnopqrstuvwxyz", wantWeak: true, wantPattern: "sequence"},
+		{name: "number sequence", password: "9876543210", wantWeak: true, wantPattern: "sequence"},
+		{name: "keyboard sequence", password: "asdfghjkl;zxcvbnm", wantWeak: true, wantPattern: "keyboard sequence"},
+		{name: "username", password: "octocat2022", userInputs: []string{"octocat"}, wantWeak: true, wantPattern: "contains the username or name"},
+		{name: "empty", password: "", wantWeak: true, wantPattern: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bits, pattern := estimateStrength(tt.password, tt.userInputs...)
+			if (bits < 50) != tt.wantWeak {
+				t.Errorf("estimateStrength() = %.1f bits, want weak %v", bits, tt.wantWeak)
+			}
+			if pattern != tt.wantPattern {
+				t.Errorf("estimateStrength() pattern = %q, want %q", pattern, tt.wantPattern)
+			}
+		})
+	}
+}
+
+func Test_analyzeHealth(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	recent := now.AddDate(0, -1, 0)
+	old := now.AddDate(-2, 0, 0)
+	login := func(id string, name string, password string, uri string, passwordDate time.Time, revisionDate time.Time) Item {
+		item := Item{Id: id, Name: name, Type: 1, RevisionDate: revisionDate}
+		item.Login = Login{Username: "user", Password: password, Uris: []Uri{{Uri: uri}}, PasswordRevisionDate: passwordDate}
+		return item
+	}
+	items := []Item{
+		login("item-1", "GitHub", "x7#Kq9!vR2@mZ4$w", "https://github.com", time.Time{}, recent),
+		login("item-2", "GitLab", "x7#Kq9!vR2@mZ4$w", "https://gitlab.com", time.Time{}, recent),
+		login("item-3", "Forum", "letmein", "http://forum.example.com", time.Time{}, recent),
+		login("item-4", "Router", "p9$Lw2@xQ7#vN4!k", "https://192.168.1.1", old, recent),
+		login("item-5", "Mail", "m3%Tz8&yB5*cW1^j", "https://mail.example.com", time.Time{}, old),
+		login("item-6", "Bank", "b6!Rf4@hK8#sD2$q", "https://bank.example.com", recent, old),
+		{Id: "item-7", Name: "Notes", Type: 2, Notes: "letmein"},
+	}
+
+	got := analyzeHealth(items, now, 365*24*time.Hour, 50)
+	want := []string{
+		"reused item-1 GitHub: Same password as GitLab",
+		"reused item-2 GitLab: Same password as GitHub",
+		"weak item-3 Forum: About 5 bits, common password",
+		"stale item-5 Mail: Not changed since 2021-06-01",
+		"stale item-4 Router: Not changed since 2021-06-01",
+		"insecure item-3 Forum: Unencrypted URI http://forum.example.com",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("analyzeHealth() = %+v, want %d findings", got, len(want))
+	}
+	for i, finding := range got {
+		if s := fmt.Sprintf("%s %s %s: %s", finding.Kind, finding.ItemId, finding.Name, finding.Detail); s != want[i] {
+			t.Errorf("finding %d = %q, want %q", i, s, want[i])
+		}
+	}
+
+	if got := analyzeHealth(items, now, 0, 0); len(got) != 3 {
+		t.Errorf("analyzeHealth() without age and strength checks = %+v, want the reused and insecure findings", got)
+	}
+}
@@ -39,21 +39,44 @@ func addBackToNormalSearchItem() {
 		Match(".")
 }
 
+// addTotpViewItem opens the live view of the authenticator key at jsonPath
+func addTotpViewItem(id string, jsonPath string) {
+	wf.NewItem("TOTP: Show current and next code").
+		Subtitle("Live view with the seconds left").
+		Icon(iconUserClock).
+		Var("action", "-totpview").
+		Var("action2", fmt.Sprintf("-id %s", id)).
+		Var("action3", jsonPath).
+		Arg(" ").
+		Valid(true)
+}
+
+// cardExpiration returns the expiration date as MMYY, years which don't have 4 digits are kept
+func cardExpiration(card CardInfo) string {
+	year := card.ExpYear
+	if len(year) == 4 {
+		year = year[2:]
+	}
+	return fmt.Sprintf("%s%s", card.ExpMonth, year)
+}
+
 func addItemDetails(item Item, autoFetchCache bool) {
 	wf.Configure(aw.SuppressUIDs(true))
 	if (conf.EmptyDetailResults && item.Type != 2) || (item.Type != 2 && item.Notes != "") {
-		wf.NewItem(fmt.Sprintf("Note: %s", item.Notes)).
+		it := wf.NewItem(fmt.Sprintf("Note: %s", item.Notes)).
 			Arg(item.Notes).
 			Icon(iconNote).
 			Var("sound", "true").
 			Var("action", "output").Valid(true)
+		addEditModifier(it, item.Id, "notes", "Notes")
 	} else if (item.Type == 2 && conf.EmptyDetailResults) || (item.Type == 2 && item.Notes != "") {
-		wf.NewItem(fmt.Sprintf("Secure Note: %s", item.Notes)).
+		it := wf.NewItem(fmt.Sprintf("Secure Note: %s", item.Notes)).
 			Icon(iconNote).
 			Var("sound", "true").
 			Var("action", "-getitem").
 			Var("action2", fmt.Sprintf("-id %s", item.Id)).
 			Arg("notes").Valid(true) // used as jsonpath
+		addEditModifier(it, item.Id, "notes", "Secure Note")
 	}
 	if conf.EmptyDetailResults || item.Favorite {
 		wf.NewItem("Favorite").
@@ -75,21 +98,24 @@ func addItemDetails(item Item, autoFetchCache bool) {
 						Var("action2", fmt.Sprintf("-id %s", item.Id)).
 						Arg(fmt.Sprintf("fields[%d].value", k)).
 						Valid(true)
+					addTotpViewItem(item.Id, fmt.Sprintf("fields[%d].value", k))
 				} else {
-					wf.NewItem(fmt.Sprintf("%s: %s", field.Name, field.Value)).
+					it := wf.NewItem(fmt.Sprintf("%s: %s", field.Name, field.Value)).
 						Icon(iconBars).
 						Var("sound", "true").
 						Var("action", "-getitem").
 						Var("action2", fmt.Sprintf("-id %s", item.Id)).
 						Arg(fmt.Sprintf("fields[%d].value", k)). // used as jsonpath
 						Valid(true)
+					addEditModifier(it, item.Id, fmt.Sprintf("fields[%d].value", k), field.Name)
 				}
 			} else {
-				wf.NewItem(fmt.Sprintf("%s: %s", field.Name, field.Value)).
+				it := wf.NewItem(fmt.Sprintf("%s: %s", field.Name, field.Value)).
 					Arg(field.Value).
 					Icon(iconBars).
 					Var("sound", "true").
 					Var("action", "output").Valid(true)
+				addEditModifier(it, item.Id, fmt.Sprintf("fields[%d].value", k), field.Name)
 			}
 		}
 	}
@@ -97,7 +123,7 @@ func addItemDetails(item Item, autoFetchCache bool) {
 	if len(item.Attachments) > 0 {
 		for _, att := range item.Attachments {
 			// it's a secret type so we need to fetch the secret from Bitwarden
-			wf.NewItem(fmt.Sprintf("Attachment: %s (%s)", att.FileName, att.SizeName)).
+			it := wf.NewItem(fmt.Sprintf("Attachment: %s (%s)", att.FileName, att.SizeName)).
 				Subtitle(fmt.Sprintf("Save attachment to %s", conf.OutputFolder)).
 				Icon(iconPaperClip).
 				Valid(true).
@@ -105,12 +131,19 @@ func addItemDetails(item Item, autoFetchCache bool) {
 				Var("action", "-getitem").
 				Var("action2", fmt.Sprintf("-attachment %s", att.Id)).
 				Var("action3", fmt.Sprintf("-id %s", item.Id))
+			addOpenAttachmentModifier(it, item, att)
+			addDeleteAttachmentModifier(it, item, att)
 		}
 	}
 	// item.CollectionIds
 	if conf.EmptyDetailResults || len(item.CollectionIds) > 0 {
-		wf.NewItem(fmt.Sprintf("Collection Ids: %s", strings.Join(item.CollectionIds, ", "))).
-			Arg(fmt.Sprintf("%q", strings.Join(item.CollectionIds, ","))).
+		collections := searchCollections.itemCollections(item)
+		title := fmt.Sprintf("Collections: %s", strings.Join(collections, ", "))
+		if org, ok := searchCollections.orgs[item.OrganizationId]; ok {
+			title = fmt.Sprintf("Collections: %s › %s", org, strings.Join(collections, ", "))
+		}
+		wf.NewItem(title).
+			Arg(strings.Join(collections, ", ")).
 			Icon(iconBoxes).
 			Var("sound", "true").
 			Var("action", "output").Valid(true)
@@ -132,22 +165,34 @@ func addItemDetails(item Item, autoFetchCache bool) {
 
 		// item.Login.Username
 		if conf.EmptyDetailResults || item.Login.Username != "" {
-			wf.NewItem(fmt.Sprintf("Username: %s", item.Login.Username)).
+			it := wf.NewItem(fmt.Sprintf("Username: %s", item.Login.Username)).
 				Valid(true).
 				Arg(item.Login.Username).
 				Icon(iconUser).
 				Var("action", "output").Valid(true).
 				Var("sound", "true")
+			addEditModifier(it, item.Id, "login.username", "Username")
+		}
+		// item.Login.Password, the cache only knows if there is one
+		if conf.EmptyDetailResults || item.Login.Password != "" {
+			it := wf.NewItem("Password: ✳︎✳︎✳︎✳︎✳︎").
+				Valid(true).
+				Icon(iconPassword).
+				Var("sound", "true").
+				Var("action", "-getitem").
+				Var("action2", fmt.Sprintf("-id %s", item.Id)).
+				Arg("login.password") // used as jsonpath
+			addEditModifier(it, item.Id, "login.password", "Password")
 		}
 		// item.Login.Uris[*].Uri
 		if len(item.Login.Uris) > 0 {
-			for _, uri := range item.Login.Uris {
-				// counter := k + 1
-				wf.NewItem(fmt.Sprintf("URL: %s", uri.Uri)).
+			for k, uri := range item.Login.Uris {
+				it := wf.NewItem(fmt.Sprintf("URL: %s", uri.Uri)).
 					Valid(true).
 					Arg(uri.Uri).
 					Icon(icon).
 					Var("action", "-open").Valid(true)
+				addEditModifier(it, item.Id, fmt.Sprintf("login.uris[%d].uri", k), "URL")
 			}
 		}
 		// TOTP
@@ -160,6 +205,9 @@ func addItemDetails(item Item, autoFetchCache bool) {
 				Var("action2", "-totp").
 				Var("action3", fmt.Sprintf("-id %s", item.Id))
 		} */
+		if item.Login.Totp != "" {
+			addTotpViewItem(item.Id, TOTP_DEFAULT_PATH)
+		}
 		// Password Revision Date
 		// check if the set value matches the initial value of time, then we know the passwordRevisionDate hasn't been set by Bitwarden
 		d1 := time.Date(0001, 01, 01, 00, 00, 00, 00, time.UTC)
@@ -192,10 +240,10 @@ func addItemDetails(item Item, autoFetchCache bool) {
 				Arg("card.code")
 		}
 		if item.Card.ExpMonth != "" && item.Card.ExpYear != "" {
-			wf.NewItem(fmt.Sprintf("Expiration Date: %s%s", item.Card.ExpMonth, item.Card.ExpYear[2:])).
+			wf.NewItem(fmt.Sprintf("Expiration Date: %s", cardExpiration(item.Card))).
 				Valid(true).
 				Icon(iconDate).
-				Arg(fmt.Sprintf("%s%s", item.Card.ExpMonth, item.Card.ExpYear[2:])).
+				Arg(cardExpiration(item.Card)).
 				Var("sound", "true").
 				Var("action", "output")
 		} else {
@@ -378,6 +426,10 @@ func addItemDetails(item Item, autoFetchCache bool) {
 				Var("action", "output")
 		}
 	}
+	addShareInSendItem(item)
+	addAttachFileItem(item)
+	addMoveToFolderItem(item)
+	addTrashItem(item)
 	addBackToNormalSearchItem()
 }
 
@@ -388,6 +440,7 @@ func addItemsToWorkflow(item Item, autoFetchCache bool) {
 	var itemModSet = map[string]map[string]modifierActionRelation{
 		"item1": template, "item2": template, "item3": template, "item4": template,
 	}
+	var it *aw.Item
 
 	if item.Type == 1 {
 		// get icons from cache
@@ -403,16 +456,21 @@ func addItemsToWorkflow(item Item, autoFetchCache bool) {
 		}
 
 		getModifierActionRelations(itemModSet, item, "item1", icon, totp)
-		addNewItem(itemModSet["item1"], item.Name)
+		it = addNewItem(itemModSet["item1"], item.Name)
 	} else if item.Type == 2 {
 		getModifierActionRelations(itemModSet, item, "item2", nil, "")
-		addNewItem(itemModSet["item2"], item.Name)
+		it = addNewItem(itemModSet["item2"], item.Name)
 	} else if item.Type == 3 {
 		getModifierActionRelations(itemModSet, item, "item3", nil, "")
-		addNewItem(itemModSet["item3"], item.Name)
+		it = addNewItem(itemModSet["item3"], item.Name)
 	} else if item.Type == 4 {
 		getModifierActionRelations(itemModSet, item, "item4", nil, "")
-		addNewItem(itemModSet["item4"], item.Name)
+		it = addNewItem(itemModSet["item4"], item.Name)
+	}
+	// show where the items of organizations are shared
+	if location := searchCollections.itemLocation(item); it != nil && location != "" {
+		subtitle := itemModSet[fmt.Sprintf("item%d", item.Type)]["nomod"].Content.Subtitle
+		it.Subtitle(fmt.Sprintf("%s ∙ %s", subtitle, location))
 	}
 }
 
@@ -428,9 +486,16 @@ func addNewItem(item map[string]modifierActionRelation, name string) *aw.Item {
 		Var("action", item["nomod"].Content.Action).
 		Var("action2", item["nomod"].Content.Action2).
 		Var("action3", item["nomod"].Content.Action3).
+		Var("usage", item["nomod"].Content.Usage).
 		Var("sound", sound).
 		Arg(item["nomod"].Content.Arg).
 		Icon(item["nomod"].Content.Icon)
+	if searchAccount != "" {
+		// Alfred passes the variable to the following actions, so they use the account of the item
+		it.Title(fmt.Sprintf("%s [%s]", item["nomod"].Content.Title, searchAccount)).
+			UID(fmt.Sprintf("%s-%s", name, searchAccount)).
+			Var("BW_ACCOUNT", searchAccount)
+	}
 	if item["mod1"].Keys != nil {
 		addNewModifierItem(it, item["mod1"])
 	}
@@ -454,13 +519,17 @@ func addNewModifierItem(item *aw.Item, modifier modifierActionRelation) {
 	if modifier.Content.Sound {
 		sound = "true"
 	}
-	item.NewModifier(modifier.Keys[0:]...).
+	mod := item.NewModifier(modifier.Keys[0:]...).
 		Subtitle(modifier.Content.Subtitle).
 		Arg(modifier.Content.Arg).
 		Var("action", modifier.Content.Action).
 		Var("action2", modifier.Content.Action2).
 		Var("action3", modifier.Content.Action3).
+		Var("usage", modifier.Content.Usage).
 		Var("sound", sound).
 		Arg(modifier.Content.Arg).
 		Icon(modifier.Content.Icon)
+	if searchAccount != "" {
+		mod.Var("BW_ACCOUNT", searchAccount)
+	}
 }
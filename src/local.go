@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/tidwall/gjson"
+)
+
+// runGetItemsLocal decrypts all items and folders which the Bitwarden CLI stored in the data.json
+// with the key of the current session, instead of running "bw list items"
+func runGetItemsLocal(token string) ([]Item, []Folder, error) {
+	data, err := os.ReadFile(bwData.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading file %s, %s", bwData.path, err)
+	}
+	keys, err := loadVaultKeys(data, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vault, err := readDataJsonVault(data, bwData.UserId, bwData.ActiveUserId != "")
+	if err != nil {
+		return nil, nil, err
+	}
+	items, folders, err := decryptSyncResponse(vault, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if orgs, collections, err := decryptCollections(vault, keys); err != nil {
+		log.Printf("Couldn't decrypt the collections, error: %s", err)
+	} else {
+		populateCacheCollections(orgs, collections)
+	}
+	debugLog(fmt.Sprintf("Found %d items in the data.json.", len(items)))
+	return items, folders, nil
+}
+
+// readDataJsonVault returns the encrypted ciphers, folders and collections and the organizations of the user from the data.json.
+// Version 1.21.1 and above of the Bitwarden CLI store them below the user id.
+func readDataJsonVault(data []byte, userId string, accountLayout bool) (syncResponse, error) {
+	var vault syncResponse
+	ciphersPath := fmt.Sprintf("ciphers_%s", userId)
+	foldersPath := fmt.Sprintf("folders_%s", userId)
+	collectionsPath := fmt.Sprintf("collections_%s", userId)
+	orgsPath := fmt.Sprintf("organizations_%s", userId)
+	if accountLayout {
+		ciphersPath = fmt.Sprintf("%s.data.ciphers.encrypted", userId)
+		foldersPath = fmt.Sprintf("%s.data.folders.encrypted", userId)
+		collectionsPath = fmt.Sprintf("%s.data.collections.encrypted", userId)
+		orgsPath = fmt.Sprintf("%s.data.organizations", userId)
+	}
+
+	ciphers := gjson.GetBytes(data, ciphersPath)
+	if !ciphers.Exists() {
+		return vault, fmt.Errorf("no items found in the data.json, the vault wasn't synced yet")
+	}
+	var err error
+	// the ciphers and folders are stored as objects with the id as key
+	ciphers.ForEach(func(id, value gjson.Result) bool {
+		var cipher encryptedCipher
+		if err = json.Unmarshal([]byte(value.Raw), &cipher); err != nil {
+			err = fmt.Errorf("error decoding item %s of the data.json, %s", id.String(), err)
+			return false
+		}
+		vault.Ciphers = append(vault.Ciphers, cipher)
+		return true
+	})
+	if err != nil {
+		return vault, err
+	}
+	gjson.GetBytes(data, foldersPath).ForEach(func(id, value gjson.Result) bool {
+		var folder syncFolder
+		if err = json.Unmarshal([]byte(value.Raw), &folder); err != nil {
+			err = fmt.Errorf("error decoding folder %s of the data.json, %s", id.String(), err)
+			return false
+		}
+		vault.Folders = append(vault.Folders, folder)
+		return true
+	})
+	if err != nil {
+		return vault, err
+	}
+	gjson.GetBytes(data, collectionsPath).ForEach(func(id, value gjson.Result) bool {
+		var collection syncCollection
+		if err := json.Unmarshal([]byte(value.Raw), &collection); err != nil {
+			log.Printf("Skipping collection %s of the data.json, error decoding it: %s", id.String(), err)
+			return true
+		}
+		vault.Collections = append(vault.Collections, collection)
+		return true
+	})
+	gjson.GetBytes(data, orgsPath).ForEach(func(id, value gjson.Result) bool {
+		var org syncOrganization
+		if err := json.Unmarshal([]byte(value.Raw), &org); err != nil {
+			log.Printf("Skipping organization %s of the data.json, error decoding it: %s", id.String(), err)
+			return true
+		}
+		vault.Profile.Organizations = append(vault.Profile.Organizations, org)
+		return true
+	})
+	return vault, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+// testSession is an unlocked vault of the Bitwarden CLI: the protected key and the
+// encrypted user key as stored in the data.json and the session key to decrypt them
+type testSession struct {
+	session      string
+	protectedKey string
+	encKey       string
+	userKey      CryptoKey
+	// encPrivateKey and encOrgKeys are only stored in the data.json if they are set
+	encPrivateKey string
+	encOrgKeys    map[string]string
+}
+
+func newTestSession(t *testing.T) testSession {
+	t.Helper()
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		if _, err := rand.Read(b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	session := random(64)
+	sourceKey := random(64)
+
+	// the source key is encrypted with the session key
+	iv := random(aes.BlockSize)
+	plain := append(sourceKey, bytes.Repeat([]byte{aes.BlockSize}, aes.BlockSize)...)
+	block, err := aes.NewCipher(session[:32])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ct, plain)
+	mac := hmac.New(sha256.New, session[32:])
+	mac.Write(iv)
+	mac.Write(ct)
+	protected := append([]byte{AesCbc256_HmacSha256_B64}, iv...)
+	protected = append(protected, mac.Sum(nil)...)
+	protected = append(protected, ct...)
+
+	// the user key is encrypted with the keys derived from the source key
+	interKeys, err := MakeIntermediateKeys(CryptoKey{EncKey: sourceKey[:32], MacKey: sourceKey[32:], EncryptionType: AesCbc256_HmacSha256_B64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userKey := newTestKey(t)
+	encKey := encryptTestString(t, string(append(append([]byte{}, userKey.EncKey...), userKey.MacKey...)), interKeys)
+
+	return testSession{
+		session:      base64.StdEncoding.EncodeToString(session),
+		protectedKey: base64.StdEncoding.EncodeToString(protected),
+		encKey:       encKey,
+		userKey:      userKey,
+	}
+}
+
+// dataJson returns a data.json of the Bitwarden CLI with the ciphers and folders.
+// accountLayout selects the layout of version 1.21.1 and above.
+func (s testSession) dataJson(t *testing.T, userId string, accountLayout bool, ciphers map[string]interface{}, folders map[string]interface{}) string {
+	t.Helper()
+	var data map[string]interface{}
+	if accountLayout {
+		data = map[string]interface{}{
+			"activeUserId":                          userId,
+			"global":                                map[string]interface{}{"installedVersion": "2022.8.0"},
+			"__PROTECTED__" + userId + "_user_auto": s.protectedKey,
+			userId: map[string]interface{}{
+				"data": map[string]interface{}{
+					"ciphers": map[string]interface{}{"encrypted": ciphers},
+					"folders": map[string]interface{}{"encrypted": folders},
+				},
+				"keys":    map[string]interface{}{"cryptoSymmetricKey": map[string]interface{}{"encrypted": s.encKey}},
+				"profile": map[string]interface{}{"userId": userId, "email": "bitwarden@test.com", "kdfIterations": 100000, "kdfType": 0},
+			},
+		}
+	} else {
+		data = map[string]interface{}{
+			"userId":            userId,
+			"userEmail":         "bitwarden@test.com",
+			"installedVersion":  "1.20.0",
+			"__PROTECTED__key":  s.protectedKey,
+			"encKey":            s.encKey,
+			"kdf":               0,
+			"kdfIterations":     100000,
+			"ciphers_" + userId: ciphers,
+			"folders_" + userId: folders,
+		}
+	}
+	if s.encPrivateKey != "" {
+		if accountLayout {
+			keys := data[userId].(map[string]interface{})["keys"].(map[string]interface{})
+			keys["privateKey"] = map[string]interface{}{"encrypted": s.encPrivateKey}
+			orgKeys := map[string]interface{}{}
+			for id, key := range s.encOrgKeys {
+				orgKeys[id] = map[string]interface{}{"type": "organization", "key": key}
+			}
+			keys["organizationKeys"] = map[string]interface{}{"encrypted": orgKeys}
+		} else {
+			data["encPrivateKey"] = s.encPrivateKey
+			data["encOrgKeys"] = s.encOrgKeys
+		}
+	}
+	out, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// testCiphers returns a login and a note encrypted with the key as stored in the data.json
+func testCiphers(t *testing.T, key CryptoKey) (map[string]interface{}, map[string]interface{}) {
+	t.Helper()
+	enc := func(s string) string { return encryptTestString(t, s, key) }
+	ciphers := map[string]interface{}{
+		"item-1": map[string]interface{}{
+			"id": "item-1", "folderId": "folder-1", "type": 1, "name": enc("GitHub"), "favorite": true,
+			"revisionDate": "2022-03-01T12:00:00.000Z",
+			"login": map[string]interface{}{
+				"username": enc("octocat"), "password": enc("secret-password"),
+				"uris": []interface{}{map[string]interface{}{"uri": enc("https://github.com"), "match": nil}},
+			},
+		},
+		"item-2": map[string]interface{}{
+			"id": "item-2", "type": 2, "name": enc("Server notes"), "notes": enc("ssh root@example.com"),
+			"revisionDate": "2022-03-01T12:00:00.000Z", "secureNote": map[string]interface{}{"type": 0},
+		},
+		"item-3": map[string]interface{}{
+			"id": "item-3", "type": 1, "name": enc("Deleted"), "deletedDate": "2022-03-02T12:00:00.000Z",
+		},
+	}
+	folders := map[string]interface{}{
+		"folder-1": map[string]interface{}{"id": "folder-1", "name": enc("Work"), "revisionDate": "2022-03-01T12:00:00.000Z"},
+	}
+	return ciphers, folders
+}
+
+func Test_readDataJsonVault(t *testing.T) {
+	s := newTestSession(t)
+	ciphers, folders := testCiphers(t, s.userKey)
+	// the malformed collection and organization are skipped
+	var malformed map[string]interface{}
+	if err := json.Unmarshal([]byte(s.dataJson(t, "user-1", false, ciphers, folders)), &malformed); err != nil {
+		t.Fatal(err)
+	}
+	malformed["collections_user-1"] = map[string]interface{}{
+		"collection-1": map[string]interface{}{"id": "collection-1", "organizationId": "org-1", "name": "2.x"},
+		"collection-2": map[string]interface{}{"id": 2},
+	}
+	malformed["organizations_user-1"] = map[string]interface{}{
+		"org-1": map[string]interface{}{"id": "org-1", "name": "Acme", "key": "4.x"},
+		"org-2": "invalid",
+	}
+	malformedData, err := json.Marshal(malformed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		data            string
+		accountLayout   bool
+		wantItems       int
+		wantCollections int
+		wantOrgs        int
+		wantErr         bool
+	}{
+		{name: "version 1.21.0 and earlier", data: s.dataJson(t, "user-1", false, ciphers, folders), wantItems: 2},
+		{name: "version 1.21.1 and above", data: s.dataJson(t, "user-1", true, ciphers, folders), accountLayout: true, wantItems: 2},
+		{name: "empty vault", data: s.dataJson(t, "user-1", false, map[string]interface{}{}, nil), wantItems: 0},
+		{name: "never synced", data: `{"userId": "user-1"}`, wantErr: true},
+		{name: "wrong layout", data: s.dataJson(t, "user-1", false, ciphers, folders), accountLayout: true, wantErr: true},
+		{name: "malformed collection and organization", data: string(malformedData), wantItems: 2, wantCollections: 1, wantOrgs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault, err := readDataJsonVault([]byte(tt.data), "user-1", tt.accountLayout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readDataJsonVault() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(vault.Collections) != tt.wantCollections || len(vault.Profile.Organizations) != tt.wantOrgs {
+				t.Errorf("got %d collections and %d organizations, want %d and %d", len(vault.Collections), len(vault.Profile.Organizations), tt.wantCollections, tt.wantOrgs)
+			}
+			items, _, err := decryptSyncResponse(vault, vaultKeys{user: s.userKey})
+			if err != nil {
+				t.Fatalf("decryptSyncResponse() error = %v", err)
+			}
+			if len(items) != tt.wantItems {
+				t.Fatalf("got %d items, want %d", len(items), tt.wantItems)
+			}
+			for _, item := range items {
+				if item.Id == "item-1" && (item.Name != "GitHub" || item.Login.Username != "octocat" || item.Login.Uris[0].Uri != "https://github.com") {
+					t.Errorf("decrypted login = %+v", item)
+				}
+			}
+		})
+	}
+}
+
+func Test_MakeDecryptKeyFromSession(t *testing.T) {
+	oldBwData := bwData
+	defer func() { bwData = oldBwData }()
+
+	s := newTestSession(t)
+	bwData.EncKey = s.encKey
+	key, err := MakeDecryptKeyFromSession(s.protectedKey, s.session)
+	if err != nil {
+		t.Fatalf("MakeDecryptKeyFromSession() error = %v", err)
+	}
+	if !bytes.Equal(key.EncKey, s.userKey.EncKey) || !bytes.Equal(key.MacKey, s.userKey.MacKey) {
+		t.Errorf("MakeDecryptKeyFromSession() returned a different user key")
+	}
+	if _, err := MakeDecryptKeyFromSession(s.protectedKey, newTestSession(t).session); err == nil {
+		t.Errorf("MakeDecryptKeyFromSession() with another session should fail")
+	}
+}
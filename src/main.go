@@ -184,7 +184,8 @@ func run() {
 
 	checkIfJobRuns()
 
-	if !wf.IsRunning("sync") && !wf.IsRunning("icons") {
+	// the cleanup of the opened attachments must not be killed before it removed them
+	if !wf.IsRunning("sync") && !wf.IsRunning("icons") && !wf.IsRunning(ATTACHMENT_VIEWS_JOB) && !wf.IsRunning(BREACH_JOB) {
 		pidfilePath := fmt.Sprintf("/tmp/%s", WORKFLOW_NAME)
 		processName := WORKFLOW_NAME
 		pidHandler(pidfilePath)
@@ -225,6 +226,56 @@ func run() {
 		return
 	}
 
+	if opts.Accounts {
+		runAccounts()
+		return
+	}
+
+	if opts.SwitchAccount {
+		runSwitchAccount()
+		return
+	}
+
+	if opts.AddAccount {
+		runAddAccount()
+		return
+	}
+
+	if opts.RemoveAccount {
+		runRemoveAccount()
+		return
+	}
+
+	if opts.Generate {
+		runGenerate()
+		return
+	}
+
+	if opts.CreateLogin {
+		runCreateLogin()
+		return
+	}
+
+	if opts.Create {
+		runCreate()
+		return
+	}
+
+	if opts.CreateItem {
+		runCreateItem()
+		return
+	}
+
+	if opts.ResetUsage {
+		runResetUsage()
+		return
+	}
+
+	if opts.RecordUsage {
+		runRecordUsage()
+		return
+	}
+
 	if opts.Sync {
 		runSync(opts.Force, opts.Last)
 		return
@@ -270,6 +321,90 @@ func run() {
 	} else if opts.GetTotp {
 		runGetTotp()
 		return
+	} else if opts.TotpView {
+		runTotpView()
+		return
+	} else if opts.Health {
+		runHealth()
+		return
+	} else if opts.BreachCheck {
+		runBreachCheck()
+		return
+	} else if opts.Edit {
+		runEdit()
+		return
+	} else if opts.EditItem {
+		runEditItem()
+		return
+	} else if opts.Trash {
+		runTrash()
+		return
+	} else if opts.ConfirmDelete {
+		runConfirmDelete()
+		return
+	} else if opts.Delete {
+		runDelete()
+		return
+	} else if opts.Restore {
+		runRestore()
+		return
+	} else if opts.Attach {
+		runAttach()
+		return
+	} else if opts.AttachTo {
+		runAttachTo()
+		return
+	} else if opts.AttachFile {
+		runAttachFile()
+		return
+	} else if opts.DeleteAttach {
+		runDeleteAttachment()
+		return
+	} else if opts.OpenAttach {
+		runOpenAttachment()
+		return
+	} else if opts.CleanAttach {
+		runCleanAttachments()
+		return
+	} else if opts.NewFolder {
+		runNewFolder()
+		return
+	} else if opts.CreateFolder {
+		runCreateFolder()
+		return
+	} else if opts.RenameFolder {
+		runRenameFolder()
+		return
+	} else if opts.SaveFolder {
+		runSaveFolder()
+		return
+	} else if opts.DeleteFolder {
+		runDeleteFolder()
+		return
+	} else if opts.MoveFolder {
+		runMoveFolder()
+		return
+	} else if opts.SetFolder {
+		runSetFolder()
+		return
+	} else if opts.Send {
+		runSend()
+		return
+	} else if opts.SendField {
+		runSendField()
+		return
+	} else if opts.SendCreate {
+		runSendCreate()
+		return
+	} else if opts.SendRevoke {
+		runSendRevoke()
+		return
+	} else if opts.SendDelete {
+		runSendDelete()
+		return
+	} else if opts.SendReceive {
+		runSendReceive()
+		return
 	}
 	runSearch(opts.Folder, opts.Id, opts.Favorites)
 }
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/tidwall/gjson"
+)
+
+// loadVaultKeys returns the user key of the session and the keys of all organizations
+// of the user which are stored in the data.json
+func loadVaultKeys(data []byte, token string) (vaultKeys, error) {
+	userKey, err := MakeDecryptKeyFromSession(bwData.ProtectedKey, token)
+	if err != nil {
+		return vaultKeys{}, fmt.Errorf("error making source key, %s", err)
+	}
+	keys := vaultKeys{user: userKey}
+	encOrgKeys := readDataJsonOrgKeys(data, bwData.UserId, bwData.ActiveUserId != "")
+	if len(encOrgKeys) == 0 {
+		return keys, nil
+	}
+	keys.orgs, err = decryptOrgKeys(encOrgKeys, bwData.Keys.PrivateKey.Encrypted, userKey)
+	return keys, err
+}
+
+// readDataJsonOrgKeys returns the encrypted organization keys by organization id.
+// Version 1.21.1 and above of the Bitwarden CLI store them below the user id, newer versions
+// as object together with the type of the membership.
+func readDataJsonOrgKeys(data []byte, userId string, accountLayout bool) map[string]string {
+	path := "encOrgKeys"
+	if accountLayout {
+		path = fmt.Sprintf("%s.keys.organizationKeys.encrypted", userId)
+	}
+	encOrgKeys := map[string]string{}
+	gjson.GetBytes(data, path).ForEach(func(id, value gjson.Result) bool {
+		switch {
+		case value.Type == gjson.String:
+			encOrgKeys[id.String()] = value.String()
+		case value.Get("type").String() == "provider":
+			// the key is encrypted with the key of the provider, which isn't supported
+			log.Printf("Skipping the key of the provider organization %s", id.String())
+		case value.Get("key").Exists():
+			encOrgKeys[id.String()] = value.Get("key").String()
+		}
+		return true
+	})
+	return encOrgKeys
+}
+
+// decryptOrgKeys decrypts the private key of the user with the user key and unwraps the
+// organization keys with it. Keys which can't be unwrapped are skipped, only the items of
+// their organization can't be decrypted then.
+func decryptOrgKeys(encOrgKeys map[string]string, encPrivateKey string, userKey CryptoKey) (map[string]CryptoKey, error) {
+	if encPrivateKey == "" {
+		return nil, fmt.Errorf("no private key found to decrypt the organization keys")
+	}
+	privateKey, err := DecryptPrivateKey(encPrivateKey, userKey)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting the private key, %s", err)
+	}
+
+	orgs := make(map[string]CryptoKey, len(encOrgKeys))
+	for id, encKey := range encOrgKeys {
+		key, err := DecryptOrgKey(encKey, privateKey)
+		if err != nil {
+			log.Printf("Skipping the key of organization %s, error decrypting it: %s", id, err)
+			continue
+		}
+		orgs[id] = key
+	}
+	return orgs, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"testing"
+)
+
+// newTestPrivateKey returns a RSA key and the PKCS#8 encoded key encrypted with the user key
+func newTestPrivateKey(t *testing.T, userKey CryptoKey) (*rsa.PrivateKey, string) {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey, encryptTestString(t, string(der), userKey)
+}
+
+// wrapTestOrgKey encrypts the organization key with the public key like the Bitwarden server
+func wrapTestOrgKey(t *testing.T, orgKey CryptoKey, publicKey *rsa.PublicKey, encryptionType int) string {
+	t.Helper()
+	var h hash.Hash = sha1.New()
+	if encryptionType == Rsa2048_OaepSha256_B64 || encryptionType == Rsa2048_OaepSha256_HmacSha256_B64 {
+		h = sha256.New()
+	}
+	key := append(append([]byte{}, orgKey.EncKey...), orgKey.MacKey...)
+	ct, err := rsa.EncryptOAEP(h, rand.Reader, publicKey, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := fmt.Sprintf("%d.%s", encryptionType, base64.StdEncoding.EncodeToString(ct))
+	if encryptionType == Rsa2048_OaepSha256_HmacSha256_B64 || encryptionType == Rsa2048_OaepSha1_HmacSha256_B64 {
+		encrypted += "|" + base64.StdEncoding.EncodeToString([]byte("unused-mac"))
+	}
+	return encrypted
+}
+
+func Test_DecryptOrgKey(t *testing.T) {
+	userKey := newTestKey(t)
+	orgKey := newTestKey(t)
+	privateKey, encPrivateKey := newTestPrivateKey(t, userKey)
+	otherKey, _ := newTestPrivateKey(t, userKey)
+
+	decrypted, err := DecryptPrivateKey(encPrivateKey, userKey)
+	if err != nil {
+		t.Fatalf("DecryptPrivateKey() error = %v", err)
+	}
+	if !decrypted.Equal(privateKey) {
+		t.Fatalf("DecryptPrivateKey() returned a different key")
+	}
+	if _, err := DecryptPrivateKey(encPrivateKey, newTestKey(t)); err == nil {
+		t.Errorf("DecryptPrivateKey() with another user key should fail")
+	}
+
+	tests := []struct {
+		name       string
+		encrypted  string
+		privateKey *rsa.PrivateKey
+		wantErr    bool
+	}{
+		{name: "Rsa2048_OaepSha256_B64", encrypted: wrapTestOrgKey(t, orgKey, &privateKey.PublicKey, Rsa2048_OaepSha256_B64), privateKey: privateKey},
+		{name: "Rsa2048_OaepSha1_B64", encrypted: wrapTestOrgKey(t, orgKey, &privateKey.PublicKey, Rsa2048_OaepSha1_B64), privateKey: privateKey},
+		{name: "Rsa2048_OaepSha256_HmacSha256_B64", encrypted: wrapTestOrgKey(t, orgKey, &privateKey.PublicKey, Rsa2048_OaepSha256_HmacSha256_B64), privateKey: privateKey},
+		{name: "Rsa2048_OaepSha1_HmacSha256_B64", encrypted: wrapTestOrgKey(t, orgKey, &privateKey.PublicKey, Rsa2048_OaepSha1_HmacSha256_B64), privateKey: privateKey},
+		{name: "other private key", encrypted: wrapTestOrgKey(t, orgKey, &privateKey.PublicKey, Rsa2048_OaepSha1_B64), privateKey: otherKey, wantErr: true},
+		{name: "aes encrypted", encrypted: encryptTestString(t, "key", userKey), privateKey: privateKey, wantErr: true},
+		{name: "invalid body", encrypted: "4.abc|def|ghi", privateKey: privateKey, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptOrgKey(tt.encrypted, tt.privateKey)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecryptOrgKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (string(got.EncKey) != string(orgKey.EncKey) || string(got.MacKey) != string(orgKey.MacKey)) {
+				t.Errorf("DecryptOrgKey() returned a different key")
+			}
+		})
+	}
+}
+
+func Test_readDataJsonOrgKeys(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		accountLayout bool
+		want          map[string]string
+	}{
+		{
+			name: "version 1.21.0 and earlier",
+			data: `{"encOrgKeys": {"org-1": "4.key1", "org-2": "4.key2"}}`,
+			want: map[string]string{"org-1": "4.key1", "org-2": "4.key2"},
+		},
+		{
+			name:          "version 1.21.1 and above",
+			data:          `{"user-1": {"keys": {"organizationKeys": {"encrypted": {"org-1": "4.key1"}}}}}`,
+			accountLayout: true,
+			want:          map[string]string{"org-1": "4.key1"},
+		},
+		{
+			name:          "with membership type",
+			data:          `{"user-1": {"keys": {"organizationKeys": {"encrypted": {"org-1": {"type": "organization", "key": "4.key1"}, "org-2": {"type": "provider", "providerId": "p-1", "key": "2.key2"}}}}}}`,
+			accountLayout: true,
+			want:          map[string]string{"org-1": "4.key1"},
+		},
+		{name: "no organizations", data: `{"userId": "user-1"}`, want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readDataJsonOrgKeys([]byte(tt.data), "user-1", tt.accountLayout)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("readDataJsonOrgKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_loadVaultKeys(t *testing.T) {
+	oldBwData := bwData
+	defer func() { bwData = oldBwData }()
+
+	s := newTestSession(t)
+	orgKey := newTestKey(t)
+	privateKey, encPrivateKey := newTestPrivateKey(t, s.userKey)
+	s.encPrivateKey = encPrivateKey
+	// the key of org-2 is wrapped for another user, only its items can't be decrypted
+	otherPrivateKey, _ := newTestPrivateKey(t, s.userKey)
+	s.encOrgKeys = map[string]string{
+		"org-1": wrapTestOrgKey(t, orgKey, &privateKey.PublicKey, Rsa2048_OaepSha1_B64),
+		"org-2": wrapTestOrgKey(t, orgKey, &otherPrivateKey.PublicKey, Rsa2048_OaepSha1_B64),
+	}
+
+	orgCipher := encryptedCipher{Item: Item{Id: "item-1", OrganizationId: "org-1", Type: 2, Name: encryptTestString(t, "Shared notes", orgKey)}}
+	otherOrgCipher := encryptedCipher{Item: Item{Id: "item-2", OrganizationId: "org-2", Type: 2, Name: encryptTestString(t, "Other notes", orgKey)}}
+	for _, accountLayout := range []bool{false, true} {
+		t.Run(fmt.Sprintf("accountLayout=%v", accountLayout), func(t *testing.T) {
+			bwData = BwData{UserId: "user-1", ProtectedKey: s.protectedKey, EncKey: s.encKey}
+			bwData.Keys.PrivateKey.Encrypted = encPrivateKey
+			if accountLayout {
+				bwData.ActiveUserId = "user-1"
+			}
+			keys, err := loadVaultKeys([]byte(s.dataJson(t, "user-1", accountLayout, nil, nil)), s.session)
+			if err != nil {
+				t.Fatalf("loadVaultKeys() error = %v", err)
+			}
+			item, err := decryptCipher(orgCipher, keys, false)
+			if err != nil {
+				t.Fatalf("decryptCipher() error = %v", err)
+			}
+			if item.Name != "Shared notes" {
+				t.Errorf("decryptCipher() name = %q", item.Name)
+			}
+			if _, err := decryptCipher(otherOrgCipher, keys, false); err == nil {
+				t.Errorf("decryptCipher() of the organization with the skipped key should fail")
+			}
+		})
+	}
+
+	bwData.ActiveUserId = ""
+	bwData.Keys.PrivateKey.Encrypted = ""
+	if _, err := loadVaultKeys([]byte(s.dataJson(t, "user-1", false, nil, nil)), s.session); err == nil {
+		t.Errorf("loadVaultKeys() without private key should fail")
+	}
+}
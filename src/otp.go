@@ -0,0 +1,268 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	OTP_TYPE_TOTP  = "totp"
+	OTP_TYPE_HOTP  = "hotp"
+	OTP_TYPE_STEAM = "steam"
+)
+
+// STEAM_CHARS are the characters of the Steam Guard codes
+const STEAM_CHARS = "23456789BCDFGHJKMNPQRTVWXY"
+
+// errOtpCounter is returned if the counter of an HOTP key couldn't be advanced, its code must not be used
+var errOtpCounter = errors.New("error saving the HOTP counter")
+
+// otpPathRgx matches the json paths at which the authenticator key of an item can be saved
+var otpPathRgx = regexp.MustCompile(`^(login\.totp|fields\[(\d+)\]\.value)$`)
+
+// otpConfig describes how the codes of an authenticator key are generated
+type otpConfig struct {
+	Type      string
+	Secret    string
+	Digits    int
+	Period    uint
+	Algorithm otp.Algorithm
+	// Counter is only used by HOTP
+	Counter uint64
+}
+
+// parseOtp parses the authenticator key of an item like the Bitwarden clients: an otpauth://totp or
+// otpauth://hotp URI, a Steam Guard secret with the steam:// prefix or only the base32 secret
+func parseOtp(key string) (otpConfig, error) {
+	config := otpConfig{Type: OTP_TYPE_TOTP, Digits: 6, Period: 30, Algorithm: otp.AlgorithmSHA1}
+	key = strings.TrimSpace(key)
+	lower := strings.ToLower(key)
+
+	switch {
+	case strings.HasPrefix(lower, "steam://"):
+		config.Type = OTP_TYPE_STEAM
+		config.Digits = 5
+		config.Secret = key[len("steam://"):]
+	case strings.HasPrefix(lower, "otpauth://"):
+		u, err := url.Parse(key)
+		if err != nil {
+			return config, fmt.Errorf("invalid otpauth uri, %s", err)
+		}
+		query := u.Query()
+		config.Secret = query.Get("secret")
+
+		switch strings.ToLower(u.Host) {
+		case OTP_TYPE_TOTP:
+		case OTP_TYPE_HOTP:
+			config.Type = OTP_TYPE_HOTP
+			if counter := query.Get("counter"); counter != "" {
+				config.Counter, err = strconv.ParseUint(counter, 10, 64)
+				if err != nil {
+					return config, fmt.Errorf("invalid counter %q", counter)
+				}
+			}
+		case OTP_TYPE_STEAM:
+			config.Type = OTP_TYPE_STEAM
+		default:
+			return config, fmt.Errorf("unsupported otpauth type %q", u.Host)
+		}
+		// some authenticators mark Steam Guard keys only with the encoder
+		if strings.EqualFold(query.Get("encoder"), OTP_TYPE_STEAM) {
+			config.Type = OTP_TYPE_STEAM
+		}
+		if config.Type == OTP_TYPE_STEAM {
+			config.Digits = 5
+			break
+		}
+
+		if digits := query.Get("digits"); digits != "" {
+			config.Digits, err = strconv.Atoi(digits)
+			if err != nil || config.Digits < 1 || config.Digits > 10 {
+				return config, fmt.Errorf("invalid digits %q", digits)
+			}
+		}
+		if period := query.Get("period"); period != "" {
+			p, err := strconv.ParseUint(period, 10, 32)
+			if err != nil || p == 0 {
+				return config, fmt.Errorf("invalid period %q", period)
+			}
+			config.Period = uint(p)
+		}
+		switch algorithm := strings.ToLower(query.Get("algorithm")); algorithm {
+		case "", "sha1":
+		case "sha256":
+			config.Algorithm = otp.AlgorithmSHA256
+		case "sha512":
+			config.Algorithm = otp.AlgorithmSHA512
+		default:
+			return config, fmt.Errorf("unsupported algorithm %q", algorithm)
+		}
+	default:
+		config.Secret = key
+	}
+
+	config.Secret = strings.ToUpper(strings.ReplaceAll(config.Secret, " ", ""))
+	if config.Secret == "" {
+		return config, fmt.Errorf("no secret found")
+	}
+	return config, nil
+}
+
+// code returns the code which is valid at time t, for HOTP the time isn't used
+func (c otpConfig) code(t time.Time) (string, error) {
+	switch c.Type {
+	case OTP_TYPE_HOTP:
+		return hotp.GenerateCodeCustom(c.Secret, c.Counter, hotp.ValidateOpts{
+			Digits:    otp.Digits(c.Digits),
+			Algorithm: c.Algorithm,
+		})
+	case OTP_TYPE_STEAM:
+		return steamCode(c.Secret, t)
+	default:
+		return totp.GenerateCodeCustom(c.Secret, t, totp.ValidateOpts{
+			Period:    c.Period,
+			Digits:    otp.Digits(c.Digits),
+			Algorithm: c.Algorithm,
+		})
+	}
+}
+
+// steamCode returns the Steam Guard code, a TOTP with 30 seconds and SHA1 which is
+// encoded with the STEAM_CHARS instead of digits
+func steamCode(secret string, t time.Time) (string, error) {
+	secret = strings.TrimRight(secret, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return "", otp.ErrValidateSecretInvalidBase32
+	}
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(t.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	code := make([]byte, 5)
+	for i := range code {
+		code[i] = STEAM_CHARS[value%uint32(len(STEAM_CHARS))]
+		value /= uint32(len(STEAM_CHARS))
+	}
+	return string(code), nil
+}
+
+// withOtpCounter returns the otpauth://hotp key with the counter
+func withOtpCounter(key string, counter uint64) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(key))
+	if err != nil {
+		return "", fmt.Errorf("invalid otpauth uri, %s", err)
+	}
+	query := u.Query()
+	query.Set("counter", strconv.FormatUint(counter, 10))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// patchOtpCounter advances the counter of the HOTP key at the json path of the item as returned by "bw get item"
+func patchOtpCounter(item map[string]interface{}, jsonPath string, counter uint64) error {
+	match := otpPathRgx.FindStringSubmatch(jsonPath)
+	if match == nil {
+		return fmt.Errorf("%s is no authenticator key", jsonPath)
+	}
+	var values map[string]interface{}
+	name := "value"
+	if match[2] == "" {
+		values, _ = item["login"].(map[string]interface{})
+		name = "totp"
+	} else {
+		fields, _ := item["fields"].([]interface{})
+		index, _ := strconv.Atoi(match[2])
+		if index < len(fields) {
+			values, _ = fields[index].(map[string]interface{})
+		}
+	}
+	key, _ := values[name].(string)
+	config, err := parseOtp(key)
+	if err != nil {
+		return err
+	}
+	// the code of the counter was used meanwhile by another client
+	if config.Type != OTP_TYPE_HOTP || config.Counter != counter {
+		return fmt.Errorf("the HOTP key changed meanwhile, try again")
+	}
+	values[name], err = withOtpCounter(key, counter+1)
+	return err
+}
+
+// otpCode returns the current code of the authenticator key at the json path of item id, shifted by
+// the TOTP_CLOCK_OFFSET. The counter of an HOTP key is advanced with "bw edit item" before its code
+// is returned, so each code is only used once.
+func otpCode(id string, token string, jsonPath string, key string) (string, error) {
+	config, err := parseOtp(key)
+	if err != nil {
+		return "", fmt.Errorf("error parsing totp key, %s", err)
+	}
+	if config.Type == OTP_TYPE_HOTP {
+		edited, err := editItem(id, token, func(item map[string]interface{}) error {
+			return patchOtpCounter(item, jsonPath, config.Counter)
+		})
+		if err != nil {
+			return "", fmt.Errorf("%w, %s", errOtpCounter, err)
+		}
+		if err := storeCacheItem(edited); err != nil {
+			log.Printf("Error updating the item in the cache: %s", err)
+		}
+	}
+	code, err := config.code(time.Now().Add(time.Duration(conf.TotpClockOffset) * time.Second))
+	if err != nil {
+		return "", fmt.Errorf("error generating totp code, %s", err)
+	}
+	return code, nil
+}
+
+// otpWindow are the codes of an authenticator key at a point in time
+type otpWindow struct {
+	Code string
+	Next string
+	// Remaining are the seconds until Code expires, always 0 for HOTP
+	Remaining int
+}
+
+// window returns the code valid at time t, the seconds it is still valid and the code which follows it,
+// for HOTP the next code is the one of the next counter
+func (c otpConfig) window(t time.Time) (otpWindow, error) {
+	var w otpWindow
+	code, err := c.code(t)
+	if err != nil {
+		return w, err
+	}
+	w.Code = code
+
+	if c.Type == OTP_TYPE_HOTP {
+		next := c
+		next.Counter++
+		w.Next, err = next.code(t)
+		return w, err
+	}
+	period := int64(c.Period)
+	w.Remaining = int(period - t.Unix()%period)
+	w.Next, err = c.code(t.Add(time.Duration(w.Remaining) * time.Second))
+	return w, err
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseOtp_code(t *testing.T) {
+	// test vectors of RFC 4226 and RFC 6238
+	sha1Secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	sha256Secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890123456789012"))
+	sha512Secret := base32.StdEncoding.EncodeToString([]byte(strings.Repeat("1234567890", 6) + "1234"))
+
+	tests := []struct {
+		name    string
+		key     string
+		time    int64
+		want    string
+		wantErr bool
+	}{
+		{name: "plain secret", key: sha1Secret, time: 59, want: "287082"},
+		{name: "plain secret with spaces", key: strings.ToLower(sha1Secret[:8]) + " " + sha1Secret[8:], time: 59, want: "287082"},
+		{name: "totp uri", key: fmt.Sprintf("otpauth://totp/Example:alice@example.com?secret=%s&issuer=Example", sha1Secret), time: 59, want: "287082"},
+		{name: "totp 8 digits", key: fmt.Sprintf("otpauth://totp/Example?secret=%s&digits=8", sha1Secret), time: 59, want: "94287082"},
+		{name: "totp sha256", key: fmt.Sprintf("otpauth://totp/Example?secret=%s&digits=8&algorithm=SHA256", sha256Secret), time: 1111111109, want: "68084774"},
+		{name: "totp sha512", key: fmt.Sprintf("otpauth://totp/Example?secret=%s&digits=8&algorithm=SHA512", sha512Secret), time: 1234567890, want: "93441116"},
+		{name: "totp 60 seconds", key: fmt.Sprintf("otpauth://totp/Example?secret=%s&digits=8&period=60", sha1Secret), time: 118, want: "94287082"},
+		{name: "hotp counter 0", key: fmt.Sprintf("otpauth://hotp/Example?secret=%s", sha1Secret), want: "755224"},
+		{name: "hotp counter 9", key: fmt.Sprintf("otpauth://hotp/Example?secret=%s&counter=9", sha1Secret), time: 59, want: "520489"},
+		{name: "steam prefix", key: "steam://JBSWY3DPEHPK3PXP", time: 59, want: "2YXGV"},
+		{name: "steam otpauth", key: "otpauth://totp/Steam:alice?secret=JBSWY3DPEHPK3PXP&encoder=steam", time: 1111111109, want: "CWDGV"},
+		{name: "steam otpauth type", key: "otpauth://steam/Steam:alice?secret=JBSWY3DPEHPK3PXP", time: 59, want: "2YXGV"},
+		{name: "invalid digits", key: fmt.Sprintf("otpauth://totp/Example?secret=%s&digits=0", sha1Secret), wantErr: true},
+		{name: "invalid period", key: fmt.Sprintf("otpauth://totp/Example?secret=%s&period=abc", sha1Secret), wantErr: true},
+		{name: "unknown algorithm", key: fmt.Sprintf("otpauth://totp/Example?secret=%s&algorithm=MD5", sha1Secret), wantErr: true},
+		{name: "unknown type", key: fmt.Sprintf("otpauth://motp/Example?secret=%s", sha1Secret), wantErr: true},
+		{name: "no secret", key: "otpauth://totp/Example?digits=6", wantErr: true},
+		{name: "invalid steam secret", key: "steam://not-base32!", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseOtp(tt.key)
+			if err == nil {
+				var got string
+				got, err = config.code(time.Unix(tt.time, 0))
+				if err == nil && got != tt.want {
+					t.Errorf("code() = %v, want %v", got, tt.want)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_otpConfig_window(t *testing.T) {
+	sha1Secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		name          string
+		key           string
+		time          int64
+		wantCode      string
+		wantNext      string
+		wantRemaining int
+	}{
+		{name: "totp", key: fmt.Sprintf("otpauth://totp/Example?secret=%s&digits=8", sha1Secret), time: 59, wantCode: "94287082", wantNext: "37359152", wantRemaining: 1},
+		{name: "totp start of period", key: fmt.Sprintf("otpauth://totp/Example?secret=%s&digits=8", sha1Secret), time: 30, wantCode: "94287082", wantNext: "37359152", wantRemaining: 30},
+		{name: "totp 60 seconds", key: fmt.Sprintf("otpauth://totp/Example?secret=%s&digits=8&period=60", sha1Secret), time: 100, wantCode: "94287082", wantNext: "37359152", wantRemaining: 20},
+		{name: "hotp", key: fmt.Sprintf("otpauth://hotp/Example?secret=%s", sha1Secret), time: 59, wantCode: "755224", wantNext: "287082"},
+		{name: "steam", key: "steam://JBSWY3DPEHPK3PXP", time: 45, wantCode: "2YXGV", wantRemaining: 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseOtp(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := config.window(time.Unix(tt.time, 0))
+			if err != nil {
+				t.Fatalf("window() error = %v", err)
+			}
+			if got.Code != tt.wantCode || got.Remaining != tt.wantRemaining {
+				t.Errorf("window() = %+v, want code %v and %d seconds", got, tt.wantCode, tt.wantRemaining)
+			}
+			// the next code is the one of the following period
+			wantNext := tt.wantNext
+			if wantNext == "" {
+				wantNext, _ = config.code(time.Unix(tt.time+int64(tt.wantRemaining), 0))
+			}
+			if got.Next != wantNext {
+				t.Errorf("window() next = %v, want %v", got.Next, wantNext)
+			}
+		})
+	}
+}
+
+func Test_patchOtpCounter(t *testing.T) {
+	hotp := "otpauth://hotp/GitHub:octocat?secret=JBSWY3DPEHPK3PXP&counter=3"
+	tests := []struct {
+		name        string
+		item        string
+		jsonPath    string
+		counter     uint64
+		wantCounter uint64
+		wantErr     bool
+	}{
+		{name: "login", item: fmt.Sprintf(`{"login": {"totp": %q}}`, hotp), jsonPath: "login.totp", counter: 3, wantCounter: 4},
+		{name: "field", item: fmt.Sprintf(`{"fields": [{"name": "pin", "value": "1234"}, {"name": "TOTP", "value": %q}]}`, hotp), jsonPath: "fields[1].value", counter: 3, wantCounter: 4},
+		{name: "used meanwhile", item: fmt.Sprintf(`{"login": {"totp": %q}}`, hotp), jsonPath: "login.totp", counter: 2, wantErr: true},
+		{name: "totp", item: `{"login": {"totp": "JBSWY3DPEHPK3PXP"}}`, jsonPath: "login.totp", wantErr: true},
+		{name: "missing field", item: `{"fields": []}`, jsonPath: "fields[0].value", wantErr: true},
+		{name: "no authenticator key", item: `{"login": {"password": "secret"}}`, jsonPath: "login.password", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var item map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.item), &item); err != nil {
+				t.Fatal(err)
+			}
+			err := patchOtpCounter(item, tt.jsonPath, tt.counter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("patchOtpCounter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var key string
+			if tt.jsonPath == "login.totp" {
+				key = item["login"].(map[string]interface{})["totp"].(string)
+			} else {
+				key = item["fields"].([]interface{})[1].(map[string]interface{})["value"].(string)
+			}
+			config, err := parseOtp(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Counter != tt.wantCounter || config.Secret != "JBSWY3DPEHPK3PXP" || !strings.HasPrefix(key, "otpauth://hotp/GitHub:octocat?") {
+				t.Errorf("patched key = %q", key)
+			}
+		})
+	}
+}
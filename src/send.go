@@ -0,0 +1,619 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/jychri/tilde"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// SEND_MAX_DAYS is the longest time Bitwarden keeps a Send before it's deleted
+	SEND_MAX_DAYS = 31
+	// SEND_PASSWORD_ENV passes the password of a received Send to the Bitwarden CLI
+	SEND_PASSWORD_ENV = "BW_SEND_PASSWORD"
+)
+
+var (
+	// sendOptionRgx matches the options of a new Send in the query, e.g. "expires:2d max:3 password:secret"
+	sendOptionRgx = regexp.MustCompile(`(?:^|\s)(expires|max|password):(\S+)`)
+	// sendDurationRgx matches the expiry of a Send in minutes, hours or days
+	sendDurationRgx = regexp.MustCompile(`^(\d+)([mhd])$`)
+	// sendUrlRgx matches the links of Bitwarden and self-hosted Sends
+	sendUrlRgx = regexp.MustCompile(`^https?://\S+/#(/send/)?[\w-]+/[\w-]+/?$`)
+)
+
+// sendRequest is a new Send or a received one, it is passed base64 encoded between the actions
+type sendRequest struct {
+	Name           string        `json:"name,omitempty"`
+	Text           string        `json:"text,omitempty"`
+	Hidden         bool          `json:"hidden,omitempty"`
+	File           string        `json:"file,omitempty"`
+	Clipboard      bool          `json:"clipboard,omitempty"`
+	Url            string        `json:"url,omitempty"`
+	Expires        time.Duration `json:"expires,omitempty"`
+	MaxAccessCount int           `json:"maxAccessCount,omitempty"`
+	Password       string        `json:"password,omitempty"`
+}
+
+// encode returns the request as argument of the actions
+func (r sendRequest) encode() string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Println(err)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// decodeSendRequest returns the request passed as argument
+func decodeSendRequest(arg string) (sendRequest, error) {
+	var req sendRequest
+	data, err := base64.StdEncoding.DecodeString(arg)
+	if err != nil {
+		return req, fmt.Errorf("invalid Send sent")
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return req, fmt.Errorf("invalid Send sent, %s", err)
+	}
+	return req, nil
+}
+
+// parseSendDuration returns the duration of "30m", "12h" or "7d", Sends are deleted after 31 days at the latest
+func parseSendDuration(value string) (time.Duration, error) {
+	match := sendDurationRgx.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("invalid expiry %q, use e.g. 30m, 12h or 7d", value)
+	}
+	count, _ := strconv.Atoi(match[1])
+	unit := map[string]time.Duration{"m": time.Minute, "h": time.Hour, "d": 24 * time.Hour}[match[2]]
+	duration := time.Duration(count) * unit
+	if duration <= 0 || duration > SEND_MAX_DAYS*24*time.Hour {
+		return 0, fmt.Errorf("the expiry must be between 1m and %dd", SEND_MAX_DAYS)
+	}
+	return duration, nil
+}
+
+// parseSendQuery returns the options in the query and the remaining text
+func parseSendQuery(query string) (sendRequest, error) {
+	var req sendRequest
+	for _, match := range sendOptionRgx.FindAllStringSubmatch(query, -1) {
+		switch match[1] {
+		case "expires":
+			duration, err := parseSendDuration(match[2])
+			if err != nil {
+				return req, err
+			}
+			req.Expires = duration
+		case "max":
+			count, err := strconv.Atoi(match[2])
+			if err != nil || count < 1 {
+				return req, fmt.Errorf("invalid maximum access count %q", match[2])
+			}
+			req.MaxAccessCount = count
+		case "password":
+			req.Password = match[2]
+		}
+	}
+	req.Text = strings.TrimSpace(sendOptionRgx.ReplaceAllString(query, ""))
+	return req, nil
+}
+
+// sendName returns the name of a text Send, the beginning of its first line
+func sendName(text string) string {
+	name := strings.TrimSpace(strings.SplitN(strings.TrimSpace(text), "\n", 2)[0])
+	if runes := []rune(name); len(runes) > 30 {
+		name = string(runes[:30]) + "…"
+	}
+	if name == "" {
+		name = "Text"
+	}
+	return name
+}
+
+// sendSummary describes the options of the new Send
+func sendSummary(req sendRequest) string {
+	var parts []string
+	if req.Expires > 0 {
+		parts = append(parts, fmt.Sprintf("expires in %s", formatSendDuration(req.Expires)))
+	} else {
+		parts = append(parts, fmt.Sprintf("deleted in %d days", sendDeletionDays()))
+	}
+	if req.MaxAccessCount > 0 {
+		parts = append(parts, fmt.Sprintf("max %d accesses", req.MaxAccessCount))
+	}
+	if req.Password != "" {
+		parts = append(parts, "password protected")
+	}
+	return strings.Join(parts, " ∙ ")
+}
+
+// formatSendDuration returns the duration like it is typed in the query
+func formatSendDuration(duration time.Duration) string {
+	switch {
+	case duration%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", duration/(24*time.Hour))
+	case duration%time.Hour == 0:
+		return fmt.Sprintf("%dh", duration/time.Hour)
+	}
+	return fmt.Sprintf("%dm", duration/time.Minute)
+}
+
+// sendDeletionDays returns SEND_DELETION_DAYS within the limits of Bitwarden
+func sendDeletionDays() int {
+	if conf.SendDeletionDays < 1 {
+		return 1
+	} else if conf.SendDeletionDays > SEND_MAX_DAYS {
+		return SEND_MAX_DAYS
+	}
+	return conf.SendDeletionDays
+}
+
+// buildSend returns the Send as expected by "bw send create", text is ignored for file Sends.
+// An expiring Send is deleted when it expires, otherwise after SEND_DELETION_DAYS.
+func buildSend(req sendRequest, text string, now time.Time) map[string]interface{} {
+	format := func(t time.Time) string {
+		return t.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	send := map[string]interface{}{
+		"name":           req.Name,
+		"notes":          nil,
+		"type":           0,
+		"text":           map[string]interface{}{"text": text, "hidden": req.Hidden},
+		"file":           nil,
+		"maxAccessCount": nil,
+		"deletionDate":   format(now.Add(time.Duration(sendDeletionDays()) * 24 * time.Hour)),
+		"expirationDate": nil,
+		"password":       nil,
+		"disabled":       false,
+		"hideEmail":      false,
+	}
+	if req.File != "" {
+		send["type"] = 1
+		send["text"] = nil
+		send["file"] = map[string]interface{}{"fileName": req.File}
+	}
+	if req.Expires > 0 {
+		send["expirationDate"] = format(now.Add(req.Expires))
+		send["deletionDate"] = format(now.Add(req.Expires))
+	}
+	if req.MaxAccessCount > 0 {
+		send["maxAccessCount"] = req.MaxAccessCount
+	}
+	if req.Password != "" {
+		send["password"] = req.Password
+	}
+	return send
+}
+
+// sendStatus describes the accesses and expiry of a Send
+func sendStatus(send Send, now time.Time) string {
+	kind := "Text"
+	if send.Type == 1 {
+		kind = "File"
+	}
+	parts := []string{kind}
+	if send.MaxAccessCount != nil {
+		parts = append(parts, fmt.Sprintf("%d of %d accesses", send.AccessCount, *send.MaxAccessCount))
+	} else {
+		parts = append(parts, fmt.Sprintf("%d accesses", send.AccessCount))
+	}
+	switch {
+	case send.Disabled:
+		parts = append(parts, "revoked")
+	case send.ExpirationDate != nil && send.ExpirationDate.Before(now):
+		parts = append(parts, "expired")
+	case send.ExpirationDate != nil:
+		parts = append(parts, fmt.Sprintf("expires %s", send.ExpirationDate.Local().Format("2006-01-02 15:04")))
+	default:
+		parts = append(parts, fmt.Sprintf("deleted %s", send.DeletionDate.Local().Format("2006-01-02")))
+	}
+	if send.PasswordSet {
+		parts = append(parts, "password")
+	}
+	return strings.Join(parts, " ∙ ")
+}
+
+// addSendItem offers to create the Send, the link is copied
+func addSendItem(title string, req sendRequest, id string, jsonPath string) {
+	action2, action3 := " ", " "
+	if id != "" {
+		action2, action3 = fmt.Sprintf("-id %s", id), jsonPath
+	}
+	wf.NewItem(title).
+		Subtitle(fmt.Sprintf("%s ∙ ⏎ create and copy the link", sendSummary(req))).
+		Icon(iconLink).
+		Arg(req.encode()).
+		Var("action", "-sendcreate").
+		Var("action2", action2).
+		Var("action3", action3).
+		Var("notification", fmt.Sprintf("Created Send %s, the link is copied", req.Name)).
+		Valid(true)
+}
+
+// addShareInSendItem lets values of the item be shared in a Send
+func addShareInSendItem(item Item) {
+	wf.NewItem("Share in a Send…").
+		Subtitle("Create a Send with a value of this item, the link is copied").
+		Valid(true).
+		Icon(iconLink).
+		Arg("").
+		Var("action", "-sendfield").
+		Var("action2", fmt.Sprintf("-id %s", item.Id)).
+		Var("action3", " ").
+		Var("title", fmt.Sprintf("Share %s in a Send", item.Name))
+}
+
+// listSends returns the Sends of the account
+func listSends(token string) ([]Send, error) {
+	args := fmt.Sprintf("%s send list --session %s", conf.BwExec, token)
+	result, err := runCmd(args, "Failed to list the Sends.")
+	if err != nil {
+		return nil, err
+	}
+	var sends []Send
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &sends); err != nil {
+		return nil, fmt.Errorf("invalid response of bw send list, %s", err)
+	}
+	return sends, nil
+}
+
+// receiveSend returns the Send of the link, the password is passed via the environment
+func receiveSend(req sendRequest, extraArgs ...string) ([]string, error) {
+	args := append([]string{conf.BwExec, "send", "receive", req.Url}, extraArgs...)
+	if req.Password != "" {
+		if err := os.Setenv(SEND_PASSWORD_ENV, req.Password); err != nil {
+			return nil, err
+		}
+		defer os.Unsetenv(SEND_PASSWORD_ENV)
+		args = append(args, "--passwordenv", SEND_PASSWORD_ENV)
+	}
+	// the output folder is passed as one argument, it can contain spaces
+	return runCmdArgs(args, "Failed to receive the Send.")
+}
+
+// addReceiveSendItem offers to receive the Send of the link. Receiving a text Send counts as access,
+// so it is only received by the action and not while typing.
+func addReceiveSendItem(req sendRequest) {
+	subtitle := fmt.Sprintf("⏎ copy the text or save the file to %s, it counts as access", conf.OutputFolder)
+	if req.Password != "" {
+		subtitle = fmt.Sprintf("with password ∙ %s", subtitle)
+	}
+	wf.NewItem(fmt.Sprintf("Receive Send %s", req.Url)).
+		Subtitle(subtitle).
+		Icon(iconLink).
+		Arg(req.encode()).
+		Var("action", "-sendreceive").
+		Var("action2", " ").
+		Var("action3", " ").
+		Var("notification", "Received the Send").
+		Valid(true)
+}
+
+// runSend creates Sends from the query, a file path or the clipboard, receives Send links and lists the Sends
+func runSend() {
+	wf.Configure(aw.SuppressUIDs(true))
+	token, ok := unlockedToken()
+	if !ok {
+		return
+	}
+	req, err := parseSendQuery(opts.Query)
+	if err != nil {
+		wf.NewItem(err.Error()).
+			Subtitle("Options: expires:30m|12h|7d max:<accesses> password:<password>").
+			Icon(iconWarning).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+
+	if sendUrlRgx.MatchString(req.Text) {
+		req.Url = req.Text
+		req.Text = ""
+		addReceiveSendItem(req)
+		wf.SendFeedback()
+		return
+	}
+
+	if req.Text != "" {
+		if path := tilde.Abs(req.Text); filepath.IsAbs(path) {
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				file := req
+				file.Text = ""
+				file.File = path
+				file.Name = filepath.Base(path)
+				addSendItem(fmt.Sprintf("Send file %s", file.Name), file, "", "")
+			}
+		}
+		text := req
+		text.Name = sendName(req.Text)
+		addSendItem(fmt.Sprintf("Send text %s", req.Text), text, "", "")
+		wf.SendFeedback()
+		return
+	}
+
+	clipboard := req
+	clipboard.Clipboard = true
+	clipboard.Name = "Clipboard"
+	addSendItem("Send the clipboard", clipboard, "", "")
+
+	sends, err := listSends(token)
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.NewItem("Can't list the Sends").
+			Subtitle(err.Error()).
+			Icon(iconWarning).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+	now := time.Now()
+	for _, send := range sends {
+		icon := iconNote
+		if send.Type == 1 {
+			icon = iconPaperClip
+		}
+		it := wf.NewItem(send.Name).
+			Subtitle(fmt.Sprintf("%s ∙ ⏎ copy the link", sendStatus(send, now))).
+			Icon(icon).
+			Arg(send.AccessUrl).
+			Var("action", "output").
+			Var("notification", fmt.Sprintf("Copied the link of Send %s", send.Name)).
+			Valid(true)
+		if !send.Disabled {
+			it.NewModifier(aw.ModCmd).
+				Subtitle(fmt.Sprintf("Revoke Send %s, the link stops working", send.Name)).
+				Arg(" ").
+				Var("action", "-sendrevoke").
+				Var("action2", fmt.Sprintf("-id %s", send.Id)).
+				Var("action3", " ").
+				Var("name", send.Name).
+				Var("notification", fmt.Sprintf("Revoked Send %s", send.Name))
+		}
+		it.NewModifier(aw.ModOpt).
+			Subtitle(fmt.Sprintf("Delete Send %s", send.Name)).
+			Arg(" ").
+			Var("action", "-senddelete").
+			Var("action2", fmt.Sprintf("-id %s", send.Id)).
+			Var("action3", " ").
+			Var("name", send.Name).
+			Var("notification", fmt.Sprintf("Deleted Send %s", send.Name))
+	}
+	wf.SendFeedback()
+}
+
+// sendableValues returns the json paths and labels of the values of the item which can be shared
+func sendableValues(item Item) [][2]string {
+	var values [][2]string
+	switch item.Type {
+	case 1:
+		if item.Login.Username != "" {
+			values = append(values, [2]string{"login.username", "Username"})
+		}
+		values = append(values, [2]string{"login.password", "Password"})
+	case 3:
+		values = append(values, [2]string{"card.number", "Card Number"}, [2]string{"card.code", "Security Code"})
+	}
+	if item.Notes != "" || item.Type == 2 {
+		values = append(values, [2]string{"notes", "Notes"})
+	}
+	for i, field := range item.Fields {
+		values = append(values, [2]string{fmt.Sprintf("fields[%d].value", i), field.Name})
+	}
+	return values
+}
+
+// runSendField shows the values of item id which can be shared in a Send, the query holds the options
+func runSendField() {
+	wf.Configure(aw.SuppressUIDs(true))
+	if _, ok := unlockedToken(); !ok {
+		return
+	}
+	item, ok := cachedItem(opts.Id)
+	if !ok {
+		wf.Fatal(fmt.Sprintf("Item %s not found, sync the vault.", opts.Id))
+		return
+	}
+	req, err := parseSendQuery(strings.Join(cli.Args(), " "))
+	if err != nil {
+		wf.NewItem(err.Error()).
+			Subtitle("Options: expires:30m|12h|7d max:<accesses> password:<password>").
+			Icon(iconWarning).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+	for _, value := range sendableValues(item) {
+		field := req
+		field.Text = ""
+		field.Name = fmt.Sprintf("%s %s", item.Name, value[1])
+		field.Hidden = value[0] != "login.username" && value[0] != "notes"
+		addSendItem(fmt.Sprintf("Send %s", value[1]), field, item.Id, value[0])
+	}
+	wf.SendFeedback()
+}
+
+// itemValue returns the value at the json path of item id
+func itemValue(id string, jsonPath string, token string) (string, error) {
+	args := fmt.Sprintf("%s get item %s --session %s", conf.BwExec, id, token)
+	result, err := runCmd(args, "Failed to get Bitwarden item.")
+	if err != nil {
+		return "", err
+	}
+	path := strings.NewReplacer("[", ".", "]", "").Replace(jsonPath)
+	value := gjson.Get(strings.Join(result, " "), path)
+	if !value.Exists() || value.String() == "" {
+		return "", fmt.Errorf("the item has no value at %s", jsonPath)
+	}
+	return value.String(), nil
+}
+
+// runSendCreate creates the Send passed as argument and prints its link, the text is read from
+// item id and the json path or the clipboard if requested
+func runSendCreate() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	jsonPath, encoded := "", cli.Arg(0)
+	if opts.Id != "" {
+		jsonPath, encoded = cli.Arg(0), cli.Arg(1)
+	}
+	req, err := decodeSendRequest(encoded)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+
+	text := req.Text
+	switch {
+	case opts.Id != "":
+		text, err = itemValue(opts.Id, jsonPath, token)
+	case req.Clipboard:
+		var out []byte
+		out, err = exec.Command("pbpaste").Output()
+		text = string(out)
+		if err == nil && strings.TrimSpace(text) == "" {
+			err = fmt.Errorf("the clipboard is empty")
+		}
+		req.Name = fmt.Sprintf("Clipboard %s", sendName(text))
+	}
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+
+	encoded, err = encodeItem(buildSend(req, text, time.Now()))
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	args := fmt.Sprintf("%s send create --session %s", conf.BwExec, token)
+	result, err := runCmdWithStdin(args, encoded, "Failed to create the Send.")
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	var send Send
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &send); err != nil || send.AccessUrl == "" {
+		wf.FatalError(fmt.Errorf("invalid response of bw send create, %v", err))
+		return
+	}
+	fmt.Print(send.AccessUrl)
+}
+
+// runSendRevoke disables Send id, its link stops working
+func runSendRevoke() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+	args := fmt.Sprintf("%s send get %s --session %s", conf.BwExec, opts.Id, token)
+	result, err := runCmd(args, "Failed to get the Send.")
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	var send map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &send); err != nil {
+		wf.FatalError(fmt.Errorf("invalid response of bw send get, %s", err))
+		return
+	}
+	send["disabled"] = true
+	encoded, err := encodeItem(send)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	args = fmt.Sprintf("%s send edit --session %s", conf.BwExec, token)
+	if _, err := runCmdWithStdin(args, encoded, "Failed to revoke the Send."); err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	fmt.Printf("Revoked Send %s.", send["name"])
+}
+
+// runSendDelete deletes Send id
+func runSendDelete() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+	args := fmt.Sprintf("%s send delete %s --session %s", conf.BwExec, opts.Id, token)
+	if _, err := runCmd(args, "Failed to delete the Send."); err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	name := strings.TrimSpace(os.Getenv("name"))
+	if name == "" {
+		name = opts.Id
+	}
+	fmt.Printf("Deleted Send %s.", name)
+}
+
+// runSendReceive receives the Send once, the text is printed to be copied and a file is saved to OUTPUT_FOLDER
+func runSendReceive() {
+	wf.Configure(aw.TextErrors(true))
+	req, err := decodeSendRequest(cli.Arg(0))
+	if err != nil || req.Url == "" {
+		wf.Fatal("Invalid Send sent.")
+		return
+	}
+	result, err := receiveSend(req, "--obj")
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		if strings.Contains(strings.ToLower(err.Error()), "password") && req.Password == "" {
+			wf.Fatal("The Send is password protected, type password:<password> after the link.")
+			return
+		}
+		wf.FatalError(err)
+		return
+	}
+	var send Send
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &send); err != nil {
+		wf.FatalError(fmt.Errorf("invalid response of bw send receive, %s", err))
+		return
+	}
+
+	if send.Type == 1 && send.File != nil {
+		// the access of a file Send is counted when the file is downloaded
+		if _, err := receiveSend(req, "--output", conf.OutputFolder); err != nil {
+			log.Printf("Error is:\n%s", err)
+			wf.FatalError(err)
+			return
+		}
+		fmt.Print(filepath.Join(conf.OutputFolder, send.File.FileName))
+		return
+	}
+	if send.Text == nil {
+		wf.Fatal("The Send has no text.")
+		return
+	}
+	fmt.Print(send.Text.Text)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func Test_parseSendQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    sendRequest
+		wantErr bool
+	}{
+		{name: "text", query: "the wifi password is hunter2", want: sendRequest{Text: "the wifi password is hunter2"}},
+		{name: "options", query: "expires:2d hunter2 max:3 password:s3cret", want: sendRequest{Text: "hunter2", Expires: 48 * time.Hour, MaxAccessCount: 3, Password: "s3cret"}},
+		{name: "minutes and hours", query: "expires:90m x", want: sendRequest{Text: "x", Expires: 90 * time.Minute}},
+		{name: "only options", query: "expires:12h", want: sendRequest{Expires: 12 * time.Hour}},
+		{name: "option like text", query: "ratio 16:9", want: sendRequest{Text: "ratio 16:9"}},
+		{name: "too long", query: "expires:32d x", wantErr: true},
+		{name: "invalid expiry", query: "expires:2w x", wantErr: true},
+		{name: "invalid max", query: "max:0 x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSendQuery(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSendQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseSendQuery() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_buildSend(t *testing.T) {
+	defer func(days int) { conf.SendDeletionDays = days }(conf.SendDeletionDays)
+	conf.SendDeletionDays = 7
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		req  sendRequest
+		text string
+		want string
+	}{
+		{
+			name: "text",
+			req:  sendRequest{Name: "wifi"},
+			text: "hunter2",
+			want: `{"deletionDate":"2023-06-08T12:00:00.000Z","disabled":false,"expirationDate":null,"file":null,"hideEmail":false,"maxAccessCount":null,"name":"wifi","notes":null,"password":null,"text":{"hidden":false,"text":"hunter2"},"type":0}`,
+		},
+		{
+			name: "hidden text with options",
+			req:  sendRequest{Name: "GitHub Password", Hidden: true, Expires: 2 * time.Hour, MaxAccessCount: 1, Password: "s3cret"},
+			text: "hunter2",
+			want: `{"deletionDate":"2023-06-01T14:00:00.000Z","disabled":false,"expirationDate":"2023-06-01T14:00:00.000Z","file":null,"hideEmail":false,"maxAccessCount":1,"name":"GitHub Password","notes":null,"password":"s3cret","text":{"hidden":true,"text":"hunter2"},"type":0}`,
+		},
+		{
+			name: "file",
+			req:  sendRequest{Name: "report.pdf", File: "/Users/me/report.pdf"},
+			want: `{"deletionDate":"2023-06-08T12:00:00.000Z","disabled":false,"expirationDate":null,"file":{"fileName":"/Users/me/report.pdf"},"hideEmail":false,"maxAccessCount":null,"name":"report.pdf","notes":null,"password":null,"text":null,"type":1}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(buildSend(tt.req, tt.text, now))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("buildSend() = %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sendStatus(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	max := 3
+	expired := now.Add(-time.Hour)
+	tests := []struct {
+		name string
+		send Send
+		want string
+	}{
+		{name: "text", send: Send{Type: 0, AccessCount: 2, DeletionDate: now.AddDate(0, 0, 7)}, want: "Text ∙ 2 accesses ∙ deleted " + now.AddDate(0, 0, 7).Local().Format("2006-01-02")},
+		{name: "limited file", send: Send{Type: 1, AccessCount: 1, MaxAccessCount: &max, ExpirationDate: &expired, PasswordSet: true}, want: "File ∙ 1 of 3 accesses ∙ expired ∙ password"},
+		{name: "revoked", send: Send{Type: 0, Disabled: true, ExpirationDate: &expired}, want: "Text ∙ 0 accesses ∙ revoked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sendStatus(tt.send, now); got != tt.want {
+				t.Errorf("sendStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sendUrlRgx(t *testing.T) {
+	tests := map[string]bool{
+		"https://send.bitwarden.com/#dWMn3vVg-0S6ue1Gx6WLFw/lNoe_hIDGuLm8R4Q4ytqKg":      true,
+		"https://vault.example.com/#/send/dWMn3vVg-0S6ue1Gx6WLFw/lNoe_hIDGuLm8R4Q4ytqKg": true,
+		"https://vault.bitwarden.com/#/vault":                                            false,
+		"send.bitwarden.com/#abc/key":                                                    false,
+	}
+	for url, want := range tests {
+		if got := sendUrlRgx.MatchString(url); got != want {
+			t.Errorf("sendUrlRgx.MatchString(%q) = %v, want %v", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+// fakebw is a scriptable replacement for the Bitwarden CLI which is used by the end-to-end tests.
+// It is selected through BW_EXEC and replays the responses from the JSON script in FAKEBW_SCRIPT:
+//
+//	[{"args": "^unlock --raw --passwordenv PASS$", "env": {"PASS": "secret"}, "stdout": "token", "exit": 0}]
+//
+// The first response whose args regexp matches the space separated arguments and whose env
+// variables are set to the given values wins. The files of the response are written into the
+// folder passed with --output, like bw saves an attachment there, absolute paths are written as is.
+// Every call is appended to the file in FAKEBW_LOG, followed by a line with "< " and the
+// data passed to stdin if there is any.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type response struct {
+	Args   string            `json:"args"`
+	Env    map[string]string `json:"env"`
+	Stdout string            `json:"stdout"`
+	Stderr string            `json:"stderr"`
+	Files  map[string]string `json:"files"`
+	Exit   int               `json:"exit"`
+}
+
+func main() {
+	args := strings.Join(os.Args[1:], " ")
+	if err := logCall(args); err != nil {
+		fail(err)
+	}
+	stdin, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fail(err)
+	}
+	if len(stdin) > 0 {
+		if err := logCall("< " + string(stdin)); err != nil {
+			fail(err)
+		}
+	}
+
+	data, err := os.ReadFile(os.Getenv("FAKEBW_SCRIPT"))
+	if err != nil {
+		fail(err)
+	}
+	var script []response
+	if err := json.Unmarshal(data, &script); err != nil {
+		fail(err)
+	}
+
+	for _, res := range script {
+		re, err := regexp.Compile(res.Args)
+		if err != nil {
+			fail(err)
+		}
+		if !re.MatchString(args) {
+			continue
+		}
+		if !envMatches(res.Env) {
+			continue
+		}
+		if err := writeFiles(res.Files); err != nil {
+			fail(err)
+		}
+		fmt.Fprint(os.Stdout, res.Stdout)
+		fmt.Fprint(os.Stderr, res.Stderr)
+		os.Exit(res.Exit)
+	}
+	fail(fmt.Errorf("no response scripted for %q", args))
+}
+
+func envMatches(env map[string]string) bool {
+	for key, value := range env {
+		if os.Getenv(key) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func writeFiles(files map[string]string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	dir := ""
+	for i, arg := range os.Args[1:] {
+		if arg == "--output" && i+2 < len(os.Args) {
+			dir = os.Args[i+2]
+		}
+	}
+	for name, content := range files {
+		path := name
+		if !filepath.IsAbs(name) {
+			if dir == "" {
+				return fmt.Errorf("no --output folder for %s", name)
+			}
+			path = filepath.Join(dir, name)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func logCall(args string) error {
+	path := os.Getenv("FAKEBW_LOG")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, args)
+	return err
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "fakebw: %s", err)
+	os.Exit(1)
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+)
+
+const (
+	// TOTP_DEFAULT_PATH is the jsonpath of the authenticator key of a login
+	TOTP_DEFAULT_PATH = "login.totp"
+	// TOTP_ITEM_VAR passes the id and jsonpath of the authenticator key to the reruns of the view
+	TOTP_ITEM_VAR = "totp_item"
+	// TOTP_VIEW_CACHE_NAME keeps the authenticator key for the reruns, it is encrypted like the items cache
+	TOTP_VIEW_CACHE_NAME = "bw-totp-view"
+	// TOTP_VIEW_CACHE_AGE is how long the reruns use the cached key before it is decrypted again
+	TOTP_VIEW_CACHE_AGE = 5 * time.Minute
+)
+
+// totpViewKey is the authenticator key of the item and jsonpath in TOTP_ITEM_VAR
+type totpViewKey struct {
+	Item string `json:"item"`
+	Key  string `json:"key"`
+}
+
+// loadTotpViewKey returns the authenticator key which an earlier run of the view cached for the item
+func loadTotpViewKey(totpItem string) string {
+	name := cacheName(TOTP_VIEW_CACHE_NAME)
+	if !wf.Cache.Exists(name) || wf.Cache.Expired(name, TOTP_VIEW_CACHE_AGE) {
+		return ""
+	}
+	blob, err := wf.Cache.Load(name)
+	if err != nil {
+		log.Println(err)
+		return ""
+	}
+	data, err := openCache(blob, bwData.UserId, sessionCacheKey)
+	if err != nil {
+		log.Printf("The TOTP view cache can't be used: %s", err)
+		return ""
+	}
+	var keys []totpViewKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		log.Printf("The TOTP view cache can't be used: %s", err)
+		return ""
+	}
+	for _, k := range keys {
+		if k.Item == totpItem {
+			return k.Key
+		}
+	}
+	return ""
+}
+
+// storeTotpViewKey caches the authenticator key for the reruns, encrypted with the session
+func storeTotpViewKey(totpItem string, key string) error {
+	data, err := json.Marshal([]totpViewKey{{Item: totpItem, Key: key}})
+	if err != nil {
+		return err
+	}
+	sealed, err := sealCache(data, bwData.UserId, sessionCacheKey)
+	if err != nil {
+		return err
+	}
+	return wf.Cache.Store(cacheName(TOTP_VIEW_CACHE_NAME), sealed)
+}
+
+// runTotpView shows the current and the next code of an authenticator key as script filter,
+// it is rerun every second by Alfred so the countdown stays up to date. The reruns compute the
+// codes from the key which the first run cached encrypted with the session.
+func runTotpView() {
+	wf.Configure(aw.SuppressUIDs(true))
+	sfaMode := -1
+	if conf.Sfa {
+		sfaMode = conf.SfaMode
+	}
+	if bwData.UserId == "" {
+		addLoginItem(conf.Email, sfaMode)
+		wf.SendFeedback()
+		return
+	}
+	if bwData.ProtectedKey == "" {
+		addUnlockItem(conf.Email)
+		wf.SendFeedback()
+		return
+	}
+
+	opts.Query = strings.TrimSpace(opts.Query)
+	if opts.Query == "" {
+		opts.Query = TOTP_DEFAULT_PATH
+	}
+	totpItem := fmt.Sprintf("%s %s", opts.Id, opts.Query)
+	key := ""
+	if os.Getenv(TOTP_ITEM_VAR) == totpItem {
+		key = loadTotpViewKey(totpItem)
+	}
+	cached := key != ""
+	if !cached {
+		opts.Totp = false
+		key = runGetItem(true)
+		// runGetItem switches to text errors for the run script actions
+		wf.Configure(aw.TextErrors(false))
+	}
+	if key == "" {
+		wf.NewItem("No TOTP found").
+			Subtitle("The item has no authenticator key").
+			Icon(aw.IconWarning).
+			Valid(false)
+		addBackToNormalSearchItem()
+		wf.SendFeedback()
+		return
+	}
+
+	config, err := parseOtp(key)
+	if err != nil {
+		wf.NewItem("Invalid TOTP").
+			Subtitle(err.Error()).
+			Icon(aw.IconWarning).
+			Valid(false)
+		addBackToNormalSearchItem()
+		wf.SendFeedback()
+		return
+	}
+	w, err := config.window(time.Now().Add(time.Duration(conf.TotpClockOffset) * time.Second))
+	if err != nil {
+		wf.NewItem("Error generating the TOTP codes").
+			Subtitle(err.Error()).
+			Icon(aw.IconWarning).
+			Valid(false)
+		addBackToNormalSearchItem()
+		wf.SendFeedback()
+		return
+	}
+	addTotpViewItems(config, w, opts.Id, opts.Query)
+	addBackToNormalSearchItem()
+	if config.Type != OTP_TYPE_HOTP {
+		if !cached {
+			if err := storeTotpViewKey(totpItem, key); err != nil {
+				log.Printf("Couldn't cache the key of the TOTP view, error: %s", err)
+			}
+		}
+		wf.Var(TOTP_ITEM_VAR, totpItem)
+		wf.Rerun(1)
+	}
+	wf.SendFeedback()
+}
+
+// addTotpViewItems adds the current and the next code, while fewer than TOTP_WAIT_SECONDS remain
+// the current code is replaced by a countdown to the next one. The code of an HOTP key is copied
+// with -gettotp, which advances its counter and records the usage itself.
+func addTotpViewItems(config otpConfig, w otpWindow, id string, jsonPath string) {
+	if config.Type == OTP_TYPE_HOTP {
+		wf.NewItem(w.Code).
+			Subtitle(fmt.Sprintf("Copy code (counter %d), the counter is advanced", config.Counter)).
+			Icon(iconUserClock).
+			Arg(jsonPath).
+			Var("sound", "true").
+			Var("action", "-gettotp").
+			Var("action2", fmt.Sprintf("-id %s", id)).
+			Valid(true)
+		return
+	}
+
+	if w.Remaining <= conf.TotpWaitSeconds {
+		wf.NewItem(fmt.Sprintf("Waiting %ds for the next code…", w.Remaining)).
+			Subtitle(fmt.Sprintf("The current code expires in less than %ds", conf.TotpWaitSeconds)).
+			Icon(ReloadIcon()).
+			Valid(false)
+	} else {
+		wf.NewItem(w.Code).
+			Subtitle(fmt.Sprintf("Copy current code ∙ %ds left", w.Remaining)).
+			Icon(iconUserClock).
+			Arg(w.Code).
+			Var("sound", "true").
+			Var("action", "output").
+			Var("action2", fmt.Sprintf("-id %s", id)).
+			Var("usage", "totp").
+			Valid(true)
+	}
+	wf.NewItem(w.Next).
+		Subtitle(fmt.Sprintf("Copy next code ∙ valid in %ds", w.Remaining)).
+		Icon(iconUserClock).
+		Arg(w.Next).
+		Var("sound", "true").
+		Var("action", "output").
+		Var("action2", fmt.Sprintf("-id %s", id)).
+		Var("usage", "totp").
+		Valid(true)
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	aw "github.com/deanishe/awgo"
+)
+
+// addTrashItem moves the item to the trash, it can be restored from the trash view
+func addTrashItem(item Item) {
+	wf.NewItem("Move to Trash").
+		Subtitle(fmt.Sprintf("Delete %s, it can be restored from the trash", item.Name)).
+		Valid(true).
+		Icon(iconWarning).
+		Arg(" ").
+		Var("action", "-delete").
+		Var("action2", fmt.Sprintf("-id %s", item.Id)).
+		Var("action3", " ").
+		Var("name", item.Name).
+		Var("notification", fmt.Sprintf("Moved %s to the trash", item.Name))
+}
+
+// getTrashItems returns the items in the trash, the most recently deleted first
+func getTrashItems(token string) ([]Item, error) {
+	args := fmt.Sprintf("%s list items --trash --session %s", conf.BwExec, token)
+	result, err := runCmd(args, "Failed to list the trash.")
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &items); err != nil {
+		return nil, fmt.Errorf("invalid response of bw list items, %s", err)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].DeletedDate == nil || items[j].DeletedDate == nil {
+			return items[j].DeletedDate == nil && items[i].DeletedDate != nil
+		}
+		return items[i].DeletedDate.After(*items[j].DeletedDate)
+	})
+	return items, nil
+}
+
+// runTrash shows the deleted items, ⏎ restores an item and cmd deletes it permanently after a confirmation
+func runTrash() {
+	wf.Configure(aw.SuppressUIDs(true))
+	token, ok := unlockedToken()
+	if !ok {
+		return
+	}
+	items, err := getTrashItems(token)
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.NewItem("Can't list the trash").
+			Subtitle(err.Error()).
+			Icon(iconWarning).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+
+	for _, item := range items {
+		deleted := ""
+		if item.DeletedDate != nil {
+			deleted = fmt.Sprintf("Deleted on %s ∙ ", item.DeletedDate.Format("2006-01-02"))
+		}
+		it := wf.NewItem(item.Name).
+			Subtitle(fmt.Sprintf("%s⏎ restore ∙ ⌘ delete permanently", deleted)).
+			Match(item.Name).
+			Icon(itemTypeIcons[item.Type]).
+			Arg(" ").
+			Var("action", "-restore").
+			Var("action2", fmt.Sprintf("-id %s", item.Id)).
+			Var("action3", " ").
+			Var("name", item.Name).
+			Var("notification", fmt.Sprintf("Restored %s", item.Name)).
+			Valid(true)
+		it.NewModifier(aw.ModCmd).
+			Subtitle(fmt.Sprintf("Delete %s permanently, this can't be undone", item.Name)).
+			Arg("").
+			Var("action", "-confirmdelete").
+			Var("action2", fmt.Sprintf("-id %s", item.Id)).
+			Var("action3", " ").
+			Var("name", item.Name).
+			Var("title", "Delete permanently?")
+	}
+	if len(items) == 0 {
+		wf.NewItem("The trash is empty").
+			Icon(iconOn).
+			Valid(false)
+	}
+	wf.SendFeedback()
+}
+
+// runConfirmDelete asks before an item of the trash, an attachment or a folder is deleted permanently
+func runConfirmDelete() {
+	wf.Configure(aw.SuppressUIDs(true))
+	name := os.Getenv("name")
+	if name == "" {
+		name = opts.Id
+	}
+	if opts.Folder {
+		wf.NewItem(fmt.Sprintf("Yes, delete folder %s", name)).
+			Subtitle("Its items are moved to No Folder").
+			Icon(iconWarning).
+			Arg(" ").
+			Var("action", "-deletefolder").
+			Var("action2", fmt.Sprintf("-id %s", opts.Id)).
+			Var("action3", " ").
+			Var("name", name).
+			Var("notification", fmt.Sprintf("Deleted folder %s", name)).
+			Valid(true)
+		wf.NewItem("No, keep the folder").
+			Icon(iconOff).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+	if opts.Attachment != "" {
+		wf.NewItem(fmt.Sprintf("Yes, delete attachment %s", name)).
+			Subtitle("The file is deleted permanently").
+			Icon(iconWarning).
+			Arg(" ").
+			Var("action", "-deleteattachment").
+			Var("action2", fmt.Sprintf("-id %s", opts.Id)).
+			Var("action3", fmt.Sprintf("-attachment %s", opts.Attachment)).
+			Var("name", name).
+			Var("notification", fmt.Sprintf("Deleted attachment %s", name)).
+			Valid(true)
+		wf.NewItem("No, keep the attachment").
+			Icon(iconOff).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+	wf.NewItem(fmt.Sprintf("Yes, delete %s permanently", name)).
+		Subtitle("The item and its attachments can't be restored").
+		Icon(iconWarning).
+		Arg(" ").
+		Var("action", "-delete").
+		Var("action2", fmt.Sprintf("-id %s", opts.Id)).
+		Var("action3", "-permanent").
+		Var("name", name).
+		Var("notification", fmt.Sprintf("Deleted %s permanently", name)).
+		Valid(true)
+	wf.NewItem("No, keep it in the trash").
+		Icon(iconOff).
+		Valid(false)
+	wf.SendFeedback()
+}
+
+// runDelete moves the item to the trash or deletes it permanently and removes it from the items cache
+func runDelete() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+	name := strings.TrimSpace(os.Getenv("name"))
+	if name == "" {
+		name = opts.Id
+	}
+
+	args := fmt.Sprintf("%s delete item %s --session %s", conf.BwExec, opts.Id, token)
+	if opts.Permanent {
+		args = fmt.Sprintf("%s delete item %s --permanent --session %s", conf.BwExec, opts.Id, token)
+	}
+	if _, err := runCmd(args, "Failed to delete the Bitwarden item."); err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	if err := deleteCacheItem(opts.Id); err != nil {
+		log.Printf("Error removing the item from the cache: %s", err)
+	}
+	if opts.Permanent {
+		fmt.Printf("Deleted %s permanently.", name)
+		return
+	}
+	fmt.Printf("Moved %s to the trash.", name)
+}
+
+// runRestore restores the item from the trash and adds it to the items cache again
+func runRestore() {
+	token, ok := actionToken()
+	if !ok {
+		return
+	}
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+
+	args := fmt.Sprintf("%s restore item %s --session %s", conf.BwExec, opts.Id, token)
+	if _, err := runCmd(args, "Failed to restore the Bitwarden item."); err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	args = fmt.Sprintf("%s get item %s --session %s", conf.BwExec, opts.Id, token)
+	result, err := runCmd(args, "Failed to get Bitwarden item.")
+	if err != nil {
+		log.Printf("Error is:\n%s", err)
+		wf.FatalError(err)
+		return
+	}
+	var item Item
+	if err := json.Unmarshal([]byte(strings.Join(result, " ")), &item); err != nil {
+		wf.FatalError(fmt.Errorf("invalid response of bw get item, %s", err))
+		return
+	}
+	if err := storeCacheItem(item); err != nil {
+		log.Printf("Error adding the item to the cache: %s", err)
+		fmt.Printf("Restored %s. It shows up after the next sync.", item.Name)
+		return
+	}
+	fmt.Printf("Restored %s.", item.Name)
+}
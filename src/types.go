@@ -13,6 +13,19 @@ type Folder struct {
 	Name   string `json:"name"`
 }
 
+type Organization struct {
+	Object string `json:"object"`
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+}
+
+type Collection struct {
+	Object         string `json:"object"`
+	Id             string `json:"id"`
+	OrganizationId string `json:"organizationId"`
+	Name           string `json:"name"`
+}
+
 type Field struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
@@ -20,7 +33,8 @@ type Field struct {
 }
 
 type Uri struct {
-	Match int    `json:"match"`
+	// Match is nil if the default match detection is used
+	Match *int   `json:"match"`
 	Uri   string `json:"uri"`
 }
 
@@ -96,4 +110,36 @@ type Item struct {
 	CollectionIds  []string       `json:"collectionIds"`
 	RevisionDate   time.Time      `json:"revisionDate"`
 	Attachments    []Attachments  `json:"attachments,omitempty"`
+	// DeletedDate is only set for items in the trash
+	DeletedDate *time.Time `json:"deletedDate,omitempty"`
+}
+
+// https://github.com/bitwarden/clients/blob/main/libs/common/src/tools/send/enums/send-type.ts
+// 0: Text
+// 1: File
+type Send struct {
+	Object         string     `json:"object"`
+	Id             string     `json:"id"`
+	AccessId       string     `json:"accessId"`
+	AccessUrl      string     `json:"accessUrl"`
+	Name           string     `json:"name"`
+	Type           int        `json:"type"`
+	Text           *SendText  `json:"text"`
+	File           *SendFile  `json:"file"`
+	MaxAccessCount *int       `json:"maxAccessCount"`
+	AccessCount    int        `json:"accessCount"`
+	DeletionDate   time.Time  `json:"deletionDate"`
+	ExpirationDate *time.Time `json:"expirationDate"`
+	PasswordSet    bool       `json:"passwordSet"`
+	Disabled       bool       `json:"disabled"`
+}
+
+type SendText struct {
+	Text   string `json:"text"`
+	Hidden bool   `json:"hidden"`
+}
+
+type SendFile struct {
+	FileName string `json:"fileName"`
+	SizeName string `json:"sizeName,omitempty"`
 }
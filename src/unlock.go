@@ -0,0 +1,243 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The key derivation functions of the Bitwarden accounts
+const (
+	KDF_PBKDF2_SHA256 = 0
+	KDF_ARGON2ID      = 1
+)
+
+// PROTECTED_KEY_NAME is the secret store entry of the protected key of the native unlock,
+// the workflow prefers it over the one in the data.json
+const PROTECTED_KEY_NAME = "protected-key"
+
+var errWrongPassword = errors.New("invalid master password")
+
+// kdfParams are the settings of the key derivation function of the account
+type kdfParams struct {
+	Type        int
+	Iterations  int
+	Memory      int // in MiB, only Argon2id
+	Parallelism int // only Argon2id
+}
+
+// makeMasterKey derives the master key from the master password, the email is used as salt
+func makeMasterKey(password string, email string, kdf kdfParams) ([]byte, error) {
+	salt := []byte(strings.ToLower(strings.TrimSpace(email)))
+	if len(salt) == 0 {
+		return nil, fmt.Errorf("no email found to derive the master key")
+	}
+	if kdf.Iterations < 1 {
+		return nil, fmt.Errorf("invalid kdf iterations %d", kdf.Iterations)
+	}
+
+	switch kdf.Type {
+	case KDF_PBKDF2_SHA256:
+		return pbkdf2.Key([]byte(password), salt, kdf.Iterations, 32, sha256.New), nil
+	case KDF_ARGON2ID:
+		if kdf.Memory < 1 || kdf.Parallelism < 1 || kdf.Parallelism > 255 {
+			return nil, fmt.Errorf("invalid argon2id parameters, memory %d MiB, parallelism %d", kdf.Memory, kdf.Parallelism)
+		}
+		// Argon2id needs a salt of a fixed length
+		hashedSalt := sha256.Sum256(salt)
+		return argon2.IDKey([]byte(password), hashedSalt[:], uint32(kdf.Iterations), uint32(kdf.Memory*1024), uint8(kdf.Parallelism), 32), nil
+	default:
+		return nil, fmt.Errorf("unsupported kdf type %d", kdf.Type)
+	}
+}
+
+// makeUserKey decrypts the user key (encKey) with the master key. Accounts which were created before
+// 2019 encrypted the user key with the master key itself, all others with the stretched master key.
+func makeUserKey(masterKey []byte, encKey string) (CryptoKey, error) {
+	cs, err := NewCipherString(encKey)
+	if err != nil {
+		return CryptoKey{}, fmt.Errorf("error making cipherstring from encKey, %s", err)
+	}
+	key := CryptoKey{EncKey: masterKey, EncryptionType: AesCbc256_B64}
+	if cs.encryptionType != AesCbc256_B64 {
+		key, err = MakeIntermediateKeys(key)
+		if err != nil {
+			return CryptoKey{}, fmt.Errorf("error making intermediate keys, %s", err)
+		}
+	}
+	userKey, err := cs.DecryptKey(key, AesCbc256_HmacSha256_B64)
+	if err != nil {
+		debugLog(fmt.Sprintf("Decrypting the user key failed, %s", err))
+		return CryptoKey{}, errWrongPassword
+	}
+	// without MAC a wrong master key is only detected by the length of the decrypted key
+	if len(userKey.EncKey) != 32 || len(userKey.MacKey) != 32 {
+		debugLog(fmt.Sprintf("Decrypted user key has an invalid length %d", len(userKey.EncKey)+len(userKey.MacKey)))
+		return CryptoKey{}, errWrongPassword
+	}
+	return userKey, nil
+}
+
+// protectKey encrypts the key with the session key in the format of the protected key of the
+// Bitwarden CLI: encryption type, iv, mac and cipher text, see MakeDecryptKeyFromSession
+func protectKey(key []byte, session []byte) (string, error) {
+	if len(session) != 64 {
+		return "", fmt.Errorf("invalid session key length %d", len(session))
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+	padding := aes.BlockSize - len(key)%aes.BlockSize
+	plain := append(append([]byte{}, key...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	block, err := aes.NewCipher(session[:32])
+	if err != nil {
+		return "", err
+	}
+	ct := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ct, plain)
+
+	mac := hmac.New(sha256.New, session[32:])
+	mac.Write(iv)
+	mac.Write(ct)
+
+	protected := []byte{AesCbc256_HmacSha256_B64}
+	protected = append(protected, iv...)
+	protected = append(protected, mac.Sum(nil)...)
+	protected = append(protected, ct...)
+	return base64.StdEncoding.EncodeToString(protected), nil
+}
+
+// protectedKeyName returns the name under which the Bitwarden CLI stores the protected key
+func protectedKeyName() string {
+	if bwData.ActiveUserId != "" {
+		// different location for version 1.21.1 and above
+		return fmt.Sprintf("__PROTECTED__%s_user_auto", bwData.UserId)
+	}
+	return "__PROTECTED__key"
+}
+
+// storeProtectedKey writes the protected key into the data.json like "bw unlock" does so the
+// Bitwarden CLI can use the session as well, all other values are kept as they are.
+// The Bitwarden CLI rewrites the whole file too, a bw process which writes it between reading and
+// renaming loses its change or ours. The background sync of the workflow is waited for, a bw
+// started outside of the workflow isn't noticed. The workflow itself reads the key from the
+// secret store, so only the Bitwarden CLI misses the session then.
+func storeProtectedKey(path string, name string, protectedKey string) error {
+	for i := 0; wf.IsRunning("sync") && i < 60; i++ {
+		time.Sleep(500 * time.Millisecond)
+	}
+	if wf.IsRunning("sync") {
+		return fmt.Errorf("the Bitwarden CLI is still syncing")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var table map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&table); err != nil {
+		return fmt.Errorf("error decoding %s, %s", path, err)
+	}
+	table[name] = protectedKey
+	out, err := json.MarshalIndent(table, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".data.json-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(out); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runNativeUnlock unlocks the vault without the Bitwarden CLI. It derives the master key, checks it
+// against the user key and stores it protected by a new session key in the secret store and, for
+// the Bitwarden CLI, in the data.json the same way "bw unlock" does.
+func runNativeUnlock(password string) (string, error) {
+	if bwData.path == "" || bwData.UserId == "" || bwData.EncKey == "" {
+		return "", fmt.Errorf("no logged in account found in the data.json")
+	}
+	email := bwData.UserEmail
+	if email == "" {
+		email = conf.Email
+	}
+	kdf := kdfParams{
+		Type:        int(bwData.Kdf),
+		Iterations:  int(bwData.KdfIterations),
+		Memory:      int(bwData.KdfMemory),
+		Parallelism: int(bwData.KdfParallelism),
+	}
+	masterKey, err := makeMasterKey(password, email, kdf)
+	if err != nil {
+		return "", err
+	}
+	if _, err := makeUserKey(masterKey, bwData.EncKey); err != nil {
+		return "", err
+	}
+
+	session := make([]byte, 64)
+	if _, err := io.ReadFull(rand.Reader, session); err != nil {
+		return "", err
+	}
+	protectedKey, err := protectKey(masterKey, session)
+	if err != nil {
+		return "", err
+	}
+	if err := secrets.Set(PROTECTED_KEY_NAME, protectedKey); err != nil {
+		return "", fmt.Errorf("error storing the protected key, %s", err)
+	}
+	if err := storeProtectedKey(bwData.path, protectedKeyName(), protectedKey); err != nil {
+		log.Printf("Couldn't store the protected key in the data.json, the Bitwarden CLI can't use the session. Err: %s", err)
+	}
+	bwData.ProtectedKey = protectedKey
+	return base64.StdEncoding.EncodeToString(session), nil
+}
+
+// loadProtectedKey replaces the protected key of the data.json with the one of the native unlock
+func loadProtectedKey() {
+	if secrets == nil || bwData.UserId == "" {
+		return
+	}
+	if key, err := secrets.Get(PROTECTED_KEY_NAME); err == nil && key != "" {
+		bwData.ProtectedKey = key
+	}
+}
+
+// removeProtectedKey removes the protected key of the native unlock
+func removeProtectedKey() {
+	if err := secrets.Delete(PROTECTED_KEY_NAME); err != nil && !errors.Is(err, alfred.ErrSecretNotFound) {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
+)
+
+// encryptTestUserKey encrypts the user key with the stretched master key like the Bitwarden clients
+func encryptTestUserKey(t *testing.T, userKey CryptoKey, masterKey []byte) string {
+	t.Helper()
+	stretched, err := MakeIntermediateKeys(CryptoKey{EncKey: masterKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encryptTestString(t, string(append(append([]byte{}, userKey.EncKey...), userKey.MacKey...)), stretched)
+}
+
+func Test_makeMasterKey(t *testing.T) {
+	pbkdf2 := kdfParams{Type: KDF_PBKDF2_SHA256, Iterations: 1000}
+	argon2id := kdfParams{Type: KDF_ARGON2ID, Iterations: 2, Memory: 1, Parallelism: 2}
+	want, err := makeMasterKey("password", "user@example.com", pbkdf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		kdf      kdfParams
+		wantSame bool
+		wantErr  bool
+	}{
+		{name: "same password", password: "password", email: "user@example.com", kdf: pbkdf2, wantSame: true},
+		{name: "email is case insensitive", password: "password", email: " User@Example.com", kdf: pbkdf2, wantSame: true},
+		{name: "other password", password: "Password", email: "user@example.com", kdf: pbkdf2},
+		{name: "other email", password: "password", email: "other@example.com", kdf: pbkdf2},
+		{name: "other iterations", password: "password", email: "user@example.com", kdf: kdfParams{Type: KDF_PBKDF2_SHA256, Iterations: 1001}},
+		{name: "argon2id", password: "password", email: "user@example.com", kdf: argon2id},
+		{name: "argon2id without memory", password: "password", email: "user@example.com", kdf: kdfParams{Type: KDF_ARGON2ID, Iterations: 2, Parallelism: 2}, wantErr: true},
+		{name: "no iterations", password: "password", email: "user@example.com", kdf: kdfParams{Type: KDF_PBKDF2_SHA256}, wantErr: true},
+		{name: "no email", password: "password", email: "", kdf: pbkdf2, wantErr: true},
+		{name: "unknown kdf", password: "password", email: "user@example.com", kdf: kdfParams{Type: 7, Iterations: 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := makeMasterKey(tt.password, tt.email, tt.kdf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("makeMasterKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != 32 {
+				t.Errorf("makeMasterKey() length = %d, want 32", len(got))
+			}
+			if bytes.Equal(got, want) != tt.wantSame {
+				t.Errorf("makeMasterKey() same key = %v, want %v", !tt.wantSame, tt.wantSame)
+			}
+		})
+	}
+}
+
+func Test_makeUserKey(t *testing.T) {
+	masterKey, err := makeMasterKey("password", "user@example.com", kdfParams{Type: KDF_PBKDF2_SHA256, Iterations: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKey, err := makeMasterKey("wrong", "user@example.com", kdfParams{Type: KDF_PBKDF2_SHA256, Iterations: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userKey := newTestKey(t)
+
+	// accounts created before 2019 encrypted the user key with the master key without MAC
+	legacy := func(key []byte) string {
+		iv := make([]byte, aes.BlockSize)
+		if _, err := rand.Read(iv); err != nil {
+			t.Fatal(err)
+		}
+		plain := append(append(append([]byte{}, userKey.EncKey...), userKey.MacKey...), bytes.Repeat([]byte{aes.BlockSize}, aes.BlockSize)...)
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct := make([]byte, len(plain))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(ct, plain)
+		return fmt.Sprintf("%d.%s|%s", AesCbc256_B64, base64.StdEncoding.EncodeToString(iv), base64.StdEncoding.EncodeToString(ct))
+	}
+
+	tests := []struct {
+		name      string
+		masterKey []byte
+		encKey    string
+		wantErr   error
+	}{
+		{name: "stretched master key", masterKey: masterKey, encKey: encryptTestUserKey(t, userKey, masterKey)},
+		{name: "wrong password", masterKey: wrongKey, encKey: encryptTestUserKey(t, userKey, masterKey), wantErr: errWrongPassword},
+		{name: "legacy master key", masterKey: masterKey, encKey: legacy(masterKey)},
+		{name: "legacy wrong password", masterKey: wrongKey, encKey: legacy(masterKey), wantErr: errWrongPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := makeUserKey(tt.masterKey, tt.encKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("makeUserKey() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (!bytes.Equal(got.EncKey, userKey.EncKey) || !bytes.Equal(got.MacKey, userKey.MacKey)) {
+				t.Errorf("makeUserKey() returned a different user key")
+			}
+		})
+	}
+}
+
+func Test_runNativeUnlock(t *testing.T) {
+	oldBwData, oldSecrets := bwData, secrets
+	defer func() { bwData, secrets = oldBwData, oldSecrets }()
+
+	userKey := newTestKey(t)
+	pbkdf2 := kdfParams{Type: KDF_PBKDF2_SHA256, Iterations: 1000}
+	argon2id := kdfParams{Type: KDF_ARGON2ID, Iterations: 2, Memory: 1, Parallelism: 2}
+	masterKey := func(kdf kdfParams) []byte {
+		key, err := makeMasterKey("password", "bitwarden@test.com", kdf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	tests := []struct {
+		name          string
+		data          string
+		password      string
+		protectedName string
+		wantErr       error
+	}{
+		{
+			name:          "version 1.21.0 and earlier",
+			data:          fmt.Sprintf(`{"userId": "user-1", "userEmail": "bitwarden@test.com", "encKey": %q, "kdf": 0, "kdfIterations": 1000, "installedVersion": "1.20.0"}`, encryptTestUserKey(t, userKey, masterKey(pbkdf2))),
+			password:      "password",
+			protectedName: "__PROTECTED__key",
+		},
+		{
+			name: "argon2id",
+			data: fmt.Sprintf(`{"activeUserId": "user-1", "global": {"installedVersion": "2023.2.0"}, "user-1": {"keys": {"cryptoSymmetricKey": {"encrypted": %q}}, "profile": {"userId": "user-1", "email": "bitwarden@test.com", "kdfType": 1, "kdfIterations": 2, "kdfMemory": 1, "kdfParallelism": 2}}}`,
+				encryptTestUserKey(t, userKey, masterKey(argon2id))),
+			password:      "password",
+			protectedName: "__PROTECTED__user-1_user_auto",
+		},
+		{
+			name:     "wrong password",
+			data:     fmt.Sprintf(`{"userId": "user-1", "userEmail": "bitwarden@test.com", "encKey": %q, "kdf": 0, "kdfIterations": 1000}`, encryptTestUserKey(t, userKey, masterKey(pbkdf2))),
+			password: "wrong",
+			wantErr:  errWrongPassword,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			var err error
+			bwData, err = decodeBitwardenDataJson([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			bwData.path = path
+			secrets = alfred.NewMemoryStore()
+
+			token, err := runNativeUnlock(tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("runNativeUnlock() error = %v, want %v", err, tt.wantErr)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != nil {
+				if string(data) != tt.data {
+					t.Errorf("runNativeUnlock() changed the data.json after a failed unlock")
+				}
+				if _, err := secrets.Get(PROTECTED_KEY_NAME); err == nil {
+					t.Errorf("runNativeUnlock() stored a protected key after a failed unlock")
+				}
+				return
+			}
+
+			// the session works the same way as one of "bw unlock"
+			var table map[string]interface{}
+			if err := json.Unmarshal(data, &table); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := table[tt.protectedName]; !ok {
+				t.Fatalf("no protected key %s in the data.json: %s", tt.protectedName, data)
+			}
+			unlocked, err := decodeBitwardenDataJson(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if unlocked.EncKey != bwData.EncKey || unlocked.KdfIterations != bwData.KdfIterations || unlocked.UserEmail != bwData.UserEmail {
+				t.Errorf("runNativeUnlock() changed the data.json: %s", data)
+			}
+			if stored, err := secrets.Get(PROTECTED_KEY_NAME); err != nil || stored != unlocked.ProtectedKey {
+				t.Errorf("secret store protected key = %q, %v, want the one of the data.json", stored, err)
+			}
+			key, err := MakeDecryptKeyFromSession(unlocked.ProtectedKey, token)
+			if err != nil {
+				t.Fatalf("MakeDecryptKeyFromSession() error = %v", err)
+			}
+			if !bytes.Equal(key.EncKey, userKey.EncKey) || !bytes.Equal(key.MacKey, userKey.MacKey) {
+				t.Errorf("the session returned a different user key")
+			}
+		})
+	}
+}
+
+func Test_loadProtectedKey(t *testing.T) {
+	oldBwData, oldSecrets := bwData, secrets
+	defer func() { bwData, secrets = oldBwData, oldSecrets }()
+
+	tests := []struct {
+		name   string
+		userId string
+		stored string
+		want   string
+	}{
+		{name: "native unlock", userId: "user-1", stored: "stored-key", want: "stored-key"},
+		{name: "unlocked by the Bitwarden CLI", userId: "user-1", want: "data-json-key"},
+		{name: "logged out", stored: "stored-key", want: "data-json-key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bwData = BwData{UserId: tt.userId, ProtectedKey: "data-json-key"}
+			secrets = alfred.NewMemoryStore()
+			if tt.stored != "" {
+				if err := secrets.Set(PROTECTED_KEY_NAME, tt.stored); err != nil {
+					t.Fatal(err)
+				}
+			}
+			loadProtectedKey()
+			if bwData.ProtectedKey != tt.want {
+				t.Errorf("loadProtectedKey() protected key = %q, want %q", bwData.ProtectedKey, tt.want)
+			}
+		})
+	}
+}
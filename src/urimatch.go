@@ -0,0 +1,258 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jpillora/go-tld"
+	"github.com/tidwall/gjson"
+)
+
+// URI match detection types as used by Bitwarden, see Uri.Match
+const (
+	URI_MATCH_DOMAIN = iota
+	URI_MATCH_HOST
+	URI_MATCH_STARTS_WITH
+	URI_MATCH_EXACT
+	URI_MATCH_REGEX
+	URI_MATCH_NEVER
+)
+
+const DOMAINS_CACHE_NAME = "bw-equivalent-domains"
+
+var uriMatchNames = map[string]int{
+	"domain":     URI_MATCH_DOMAIN,
+	"host":       URI_MATCH_HOST,
+	"startswith": URI_MATCH_STARTS_WITH,
+	"exact":      URI_MATCH_EXACT,
+	"regex":      URI_MATCH_REGEX,
+	"never":      URI_MATCH_NEVER,
+}
+
+// uriMatchRank orders the match types from the most to the least specific,
+// a login which matches exactly is shown before one which only matches the domain
+var uriMatchRank = map[int]int{
+	URI_MATCH_EXACT:       5,
+	URI_MATCH_STARTS_WITH: 4,
+	URI_MATCH_REGEX:       3,
+	URI_MATCH_HOST:        2,
+	URI_MATCH_DOMAIN:      1,
+}
+
+// defaultUriMatch returns the match type for uris without an own match type (null)
+func defaultUriMatch() int {
+	match, ok := uriMatchNames[strings.ToLower(conf.DefaultUriMatch)]
+	if !ok {
+		log.Printf("Unknown DEFAULT_URI_MATCH %q, using domain.", conf.DefaultUriMatch)
+		return URI_MATCH_DOMAIN
+	}
+	return match
+}
+
+// parseUri parses the uri like Bitwarden does, uris without a scheme are treated as http
+func parseUri(uri string) (*url.URL, error) {
+	uri = strings.TrimSpace(uri)
+	if !strings.Contains(uri, "://") {
+		uri = fmt.Sprintf("http://%s", uri)
+	}
+	return url.Parse(uri)
+}
+
+// baseDomain returns the registrable domain of the host, e.g. "github.com" for
+// "gist.github.com". IP addresses, localhost and other hosts without a public suffix
+// are returned as they are.
+func baseDomain(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	if host == "" || net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return host
+	}
+	t, err := tld.Parse(fmt.Sprintf("http://%s", host))
+	if err != nil || t.Domain == "" {
+		return host
+	}
+	return fmt.Sprintf("%s.%s", t.Domain, t.TLD)
+}
+
+// uriMatcher matches the uris of login items against one url
+type uriMatcher struct {
+	url        string
+	parsed     *url.URL
+	domain     string
+	equivalent map[string]bool
+}
+
+// newUriMatcher prepares the matching for the url. Domains which are in the same
+// group of equivalent domains as the url match each other with the domain match type.
+func newUriMatcher(rawUrl string, equivalentDomains [][]string) (*uriMatcher, error) {
+	parsed, err := parseUri(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Hostname() == "" {
+		return nil, fmt.Errorf("no host found in url %q", rawUrl)
+	}
+	m := &uriMatcher{
+		url:        strings.TrimSpace(rawUrl),
+		parsed:     parsed,
+		domain:     baseDomain(parsed),
+		equivalent: map[string]bool{},
+	}
+	m.equivalent[m.domain] = true
+	for _, group := range equivalentDomains {
+		found := false
+		for _, domain := range group {
+			if strings.EqualFold(domain, m.domain) {
+				found = true
+				break
+			}
+		}
+		if found {
+			for _, domain := range group {
+				m.equivalent[strings.ToLower(domain)] = true
+			}
+		}
+	}
+	return m, nil
+}
+
+// match returns the match type with which the uri matches, ok is false if it doesn't match
+func (m *uriMatcher) match(uri Uri) (matchType int, ok bool) {
+	matchType = defaultUriMatch()
+	if uri.Match != nil {
+		matchType = *uri.Match
+	}
+	if strings.TrimSpace(uri.Uri) == "" {
+		return matchType, false
+	}
+
+	switch matchType {
+	case URI_MATCH_DOMAIN:
+		u, err := parseUri(uri.Uri)
+		if err != nil {
+			return matchType, false
+		}
+		return matchType, m.equivalent[baseDomain(u)]
+	case URI_MATCH_HOST:
+		u, err := parseUri(uri.Uri)
+		if err != nil {
+			return matchType, false
+		}
+		return matchType, strings.EqualFold(u.Host, m.parsed.Host)
+	case URI_MATCH_STARTS_WITH:
+		return matchType, strings.HasPrefix(m.url, uri.Uri)
+	case URI_MATCH_EXACT:
+		return matchType, m.url == uri.Uri
+	case URI_MATCH_REGEX:
+		// Bitwarden matches regular expressions case insensitive
+		rgx, err := regexp.Compile(fmt.Sprintf("(?i)%s", uri.Uri))
+		if err != nil {
+			log.Printf("Invalid regular expression %q in uri: %s", uri.Uri, err)
+			return matchType, false
+		}
+		return matchType, rgx.MatchString(m.url)
+	}
+	// URI_MATCH_NEVER and unknown match types
+	return matchType, false
+}
+
+// matchItem returns the rank of the best matching uri of the item, 0 if no uri matches
+func (m *uriMatcher) matchItem(item Item) int {
+	best := 0
+	for _, uri := range item.Login.Uris {
+		if matchType, ok := m.match(uri); ok && uriMatchRank[matchType] > best {
+			best = uriMatchRank[matchType]
+		}
+	}
+	return best
+}
+
+// matchItems returns the logins which match the url, the most specific matches first.
+// Items with the same rank keep their order.
+func matchItems(items []Item, m *uriMatcher) []Item {
+	ranks := map[string]int{}
+	var matched []Item
+	for _, item := range items {
+		if item.Type != 1 {
+			continue
+		}
+		if rank := m.matchItem(item); rank > 0 {
+			ranks[item.Id] = rank
+			matched = append(matched, item)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return ranks[matched[i].Id] > ranks[matched[j].Id]
+	})
+	return matched
+}
+
+// loadEquivalentDomains returns the groups of equivalent domains of the account.
+// They are stored by the api sync, otherwise they are read from the data.json of the Bitwarden CLI.
+func loadEquivalentDomains() [][]string {
+	var domains [][]string
+	if wf.Cache.Exists(cacheName(DOMAINS_CACHE_NAME)) {
+		if err := wf.Cache.LoadJSON(cacheName(DOMAINS_CACHE_NAME), &domains); err != nil {
+			log.Printf("Couldn't load the equivalent domains, error: %s", err)
+		}
+		return domains
+	}
+	if bwData.path == "" || bwData.UserId == "" {
+		return domains
+	}
+	data, err := os.ReadFile(bwData.path)
+	if err != nil {
+		log.Print("Error reading file ", bwData.path)
+		return domains
+	}
+	var value gjson.Result
+	if bwData.ActiveUserId != "" {
+		// different location for version 1.21.1 and above
+		value = gjson.GetBytes(data, fmt.Sprintf("%s.settings.settings.equivalentDomains", bwData.UserId))
+	} else {
+		value = gjson.GetBytes(data, fmt.Sprintf("settings_%s.equivalentDomains", bwData.UserId))
+	}
+	for _, group := range value.Array() {
+		var domainGroup []string
+		for _, domain := range group.Array() {
+			domainGroup = append(domainGroup, domain.String())
+		}
+		domains = append(domains, domainGroup)
+	}
+	return domains
+}
+
+// runMatchUrl shows the logins which match the url
+func runMatchUrl(items []Item, rawUrl string) {
+	sortItems(items, loadUsageStats())
+	m, err := newUriMatcher(rawUrl, loadEquivalentDomains())
+	if err != nil {
+		log.Printf("Error parsing url: %s", err)
+		wf.NewItem("Invalid URL").
+			Subtitle(fmt.Sprintf("Couldn't parse %q", rawUrl)).
+			Icon(iconWarning).
+			Valid(false)
+		wf.SendFeedback()
+		return
+	}
+
+	matched := matchItems(items, m)
+	if len(matched) == 0 {
+		wf.NewItem(fmt.Sprintf("No Login found for %s", m.parsed.Hostname())).
+			Subtitle("Try a different URL or sync manually").
+			Icon(iconWarning).
+			Valid(false)
+	}
+	for _, item := range matched {
+		addItemsToWorkflow(item, false)
+	}
+	wf.SendFeedback()
+}
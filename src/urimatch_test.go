@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+)
+
+func matchType(m int) *int {
+	return &m
+}
+
+func Test_uriMatcher_match(t *testing.T) {
+	oldConf := conf
+	defer func() { conf = oldConf }()
+
+	equivalent := [][]string{{"google.com", "youtube.com"}}
+	tests := []struct {
+		name         string
+		url          string
+		uri          Uri
+		defaultMatch string
+		want         bool
+	}{
+		{name: "domain same host", url: "https://github.com/login", uri: Uri{Match: matchType(URI_MATCH_DOMAIN), Uri: "https://github.com"}, want: true},
+		{name: "domain sub domain", url: "https://github.com/login", uri: Uri{Match: matchType(URI_MATCH_DOMAIN), Uri: "https://gist.github.com/"}, want: true},
+		{name: "domain without scheme", url: "https://github.com/login", uri: Uri{Match: matchType(URI_MATCH_DOMAIN), Uri: "github.com"}, want: true},
+		{name: "domain public suffix", url: "https://foo.co.uk", uri: Uri{Match: matchType(URI_MATCH_DOMAIN), Uri: "https://bar.co.uk"}, want: false},
+		{name: "domain different", url: "https://github.com", uri: Uri{Match: matchType(URI_MATCH_DOMAIN), Uri: "https://gitlab.com"}, want: false},
+		{name: "domain equivalent", url: "https://www.youtube.com/watch", uri: Uri{Match: matchType(URI_MATCH_DOMAIN), Uri: "https://accounts.google.com"}, want: true},
+		{name: "domain ip address", url: "http://192.168.1.1:8080/admin", uri: Uri{Match: matchType(URI_MATCH_DOMAIN), Uri: "192.168.1.1"}, want: true},
+		{name: "domain localhost", url: "http://localhost:3000", uri: Uri{Match: matchType(URI_MATCH_DOMAIN), Uri: "http://localhost"}, want: true},
+		{name: "default is domain", url: "https://gist.github.com", uri: Uri{Uri: "https://github.com"}, defaultMatch: "domain", want: true},
+		{name: "default host", url: "https://gist.github.com", uri: Uri{Uri: "https://github.com"}, defaultMatch: "host", want: false},
+		{name: "host same", url: "https://gist.github.com/foo", uri: Uri{Match: matchType(URI_MATCH_HOST), Uri: "https://gist.github.com"}, want: true},
+		{name: "host sub domain", url: "https://gist.github.com", uri: Uri{Match: matchType(URI_MATCH_HOST), Uri: "https://github.com"}, want: false},
+		{name: "host different port", url: "https://example.com:8443", uri: Uri{Match: matchType(URI_MATCH_HOST), Uri: "https://example.com"}, want: false},
+		{name: "starts with", url: "https://example.com/app/login", uri: Uri{Match: matchType(URI_MATCH_STARTS_WITH), Uri: "https://example.com/app"}, want: true},
+		{name: "starts with other path", url: "https://example.com/admin", uri: Uri{Match: matchType(URI_MATCH_STARTS_WITH), Uri: "https://example.com/app"}, want: false},
+		{name: "exact", url: "https://example.com/login", uri: Uri{Match: matchType(URI_MATCH_EXACT), Uri: "https://example.com/login"}, want: true},
+		{name: "exact with query", url: "https://example.com/login?next=/", uri: Uri{Match: matchType(URI_MATCH_EXACT), Uri: "https://example.com/login"}, want: false},
+		{name: "regex", url: "https://EU.example.com/login", uri: Uri{Match: matchType(URI_MATCH_REGEX), Uri: `^https://(eu|us)\.example\.com/`}, want: true},
+		{name: "invalid regex", url: "https://example.com", uri: Uri{Match: matchType(URI_MATCH_REGEX), Uri: "(example"}, want: false},
+		{name: "never", url: "https://example.com", uri: Uri{Match: matchType(URI_MATCH_NEVER), Uri: "https://example.com"}, want: false},
+		{name: "empty uri", url: "https://example.com", uri: Uri{Match: matchType(URI_MATCH_DOMAIN), Uri: ""}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.DefaultUriMatch = tt.defaultMatch
+			if conf.DefaultUriMatch == "" {
+				conf.DefaultUriMatch = "domain"
+			}
+			m, err := newUriMatcher(tt.url, equivalent)
+			if err != nil {
+				t.Fatalf("newUriMatcher() error = %v", err)
+			}
+			if _, got := m.match(tt.uri); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_matchItems(t *testing.T) {
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf.DefaultUriMatch = "domain"
+
+	login := func(id string, uris ...Uri) Item {
+		item := Item{Id: id, Type: 1}
+		item.Login.Uris = uris
+		return item
+	}
+	items := []Item{
+		login("domain", Uri{Uri: "https://example.com"}),
+		login("other", Uri{Uri: "https://example.org"}),
+		login("exact", Uri{Match: matchType(URI_MATCH_EXACT), Uri: "https://app.example.com/login"}),
+		{Id: "note", Type: 2},
+		login("host", Uri{Uri: "https://example.org"}, Uri{Match: matchType(URI_MATCH_HOST), Uri: "app.example.com"}),
+	}
+
+	m, err := newUriMatcher("https://app.example.com/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"exact", "host", "domain"}
+	got := matchItems(items, m)
+	if len(got) != len(want) {
+		t.Fatalf("matchItems() returned %d items, want %d", len(got), len(want))
+	}
+	for i, item := range got {
+		if item.Id != want[i] {
+			t.Errorf("matchItems() position %d = %v, want %v", i, item.Id, want[i])
+		}
+	}
+}
+
+func Test_syncDomains_groups(t *testing.T) {
+	tests := []struct {
+		name    string
+		domains *syncDomains
+		want    int
+	}{
+		{name: "excluded domains", domains: nil, want: 0},
+		{
+			name: "user and global",
+			domains: &syncDomains{
+				EquivalentDomains: [][]string{{"example.com", "example.org"}},
+				GlobalEquivalentDomains: []globalEquivalentDomains{
+					{Type: 1, Domains: []string{"google.com", "youtube.com"}},
+					{Type: 2, Domains: []string{"apple.com", "icloud.com"}, Excluded: true},
+				},
+			},
+			want: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.domains.groups(); len(got) != tt.want {
+				t.Errorf("groups() = %v, want %d groups", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+)
+
+const (
+	USAGE_STATS_NAME = "usage-stats"
+	RECENT_MAX_ITEMS = 20
+)
+
+// usageStat is the usage of one action of an item. Score is the frecency at the time
+// of the last use, it halves every FRECENCY_HALF_LIFE days.
+type usageStat struct {
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+	Score float64   `json:"score"`
+}
+
+// usageStats maps the item id to the usage of its actions
+type usageStats map[string]map[string]usageStat
+
+// usageStatsName returns the file name of the usage statistics of the active account
+func usageStatsName() string {
+	return accountCacheName(activeAccount.Name, USAGE_STATS_NAME) + ".json"
+}
+
+func loadUsageStats() usageStats {
+	stats := usageStats{}
+	name := usageStatsName()
+	if !wf.Data.Exists(name) {
+		return stats
+	}
+	if err := wf.Data.LoadJSON(name, &stats); err != nil {
+		log.Printf("Couldn't load the usage statistics, error: %s", err)
+		return usageStats{}
+	}
+	return stats
+}
+
+func saveUsageStats(stats usageStats) error {
+	return wf.Data.StoreJSON(usageStatsName(), stats)
+}
+
+// usageAction returns the name of the action for the jsonpath which is requested with -getitem
+func usageAction(jsonPath string, totp bool) string {
+	if totp {
+		return "totp"
+	}
+	switch jsonPath {
+	case "login.password":
+		return "password"
+	case "login.username":
+		return "username"
+	case "login.totp":
+		return "totp"
+	}
+	return jsonPath
+}
+
+// decay returns the factor a score has decayed to after the duration
+func decay(age time.Duration, halfLife time.Duration) float64 {
+	if age <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, float64(age)/float64(halfLife))
+}
+
+func frecencyHalfLife() time.Duration {
+	return time.Duration(conf.FrecencyHalfLife) * 24 * time.Hour
+}
+
+// record adds one use of the action
+func (s usageStats) record(id string, action string, now time.Time, halfLife time.Duration) {
+	if s[id] == nil {
+		s[id] = map[string]usageStat{}
+	}
+	stat := s[id][action]
+	stat.Score = stat.Score*decay(now.Sub(stat.Last), halfLife) + 1
+	stat.Count++
+	stat.Last = now
+	s[id][action] = stat
+}
+
+// score returns the frecency of an item summed up over all actions
+func (s usageStats) score(id string, now time.Time, halfLife time.Duration) float64 {
+	var score float64
+	for _, stat := range s[id] {
+		score += stat.Score * decay(now.Sub(stat.Last), halfLife)
+	}
+	return score
+}
+
+// lastUsed returns when any action of the item was used the last time
+func (s usageStats) lastUsed(id string) time.Time {
+	var last time.Time
+	for _, stat := range s[id] {
+		if stat.Last.After(last) {
+			last = stat.Last
+		}
+	}
+	return last
+}
+
+// recordUsage saves the use of an item action, it's disabled with a FRECENCY_HALF_LIFE of 0
+func recordUsage(id string, action string) {
+	if conf.FrecencyHalfLife <= 0 || id == "" || action == "" {
+		return
+	}
+	stats := loadUsageStats()
+	stats.record(id, action, time.Now(), frecencyHalfLife())
+	if err := saveUsageStats(stats); err != nil {
+		log.Printf("Couldn't save the usage statistics, error: %s", err)
+	}
+}
+
+// sortItems puts the most frequently and recently used items first, followed by the favorites
+func sortItems(items []Item, stats usageStats) {
+	now := time.Now()
+	halfLife := frecencyHalfLife()
+	scores := make(map[string]float64, len(items))
+	if conf.FrecencyHalfLife > 0 {
+		for _, item := range items {
+			scores[item.Id] = stats.score(item.Id, now, halfLife)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if scores[items[i].Id] != scores[items[j].Id] {
+			return scores[items[i].Id] > scores[items[j].Id]
+		}
+		return items[i].Favorite && !items[j].Favorite
+	})
+}
+
+// runRecent shows the recently used items
+func runRecent(items []Item) {
+	stats := loadUsageStats()
+	var recent []Item
+	for _, item := range items {
+		if _, ok := stats[item.Id]; ok {
+			recent = append(recent, item)
+		}
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return stats.lastUsed(recent[i].Id).After(stats.lastUsed(recent[j].Id))
+	})
+	if len(recent) > RECENT_MAX_ITEMS {
+		recent = recent[:RECENT_MAX_ITEMS]
+	}
+
+	if len(recent) == 0 {
+		wf.NewItem("No Recently Used Items").
+			Subtitle("Items show up here after copying a password, username or TOTP").
+			Icon(iconWarning).
+			Valid(false)
+	}
+	for _, item := range recent {
+		addItemsToWorkflow(item, false)
+	}
+	wf.NewItem("Reset Usage Statistics").
+		Subtitle("Forget how often and when the items were used").
+		UID("resetusage").
+		Valid(true).
+		Icon(aw.IconTrash).
+		Var("action", "-resetusage").
+		Var("notification", "Usage statistics reset")
+	wf.SendFeedback()
+}
+
+// runRecordUsage records the use of an item action whose value Alfred copied from the cache, like the username
+func runRecordUsage() {
+	wf.Configure(aw.TextErrors(true))
+	if opts.Id == "" || cli.NArg() == 0 {
+		wf.Fatal("No id or action sent.")
+		return
+	}
+	recordUsage(opts.Id, cli.Arg(0))
+}
+
+// runResetUsage removes the usage statistics of the active account
+func runResetUsage() {
+	wf.Configure(aw.TextErrors(true))
+	if err := wf.Data.Store(usageStatsName(), nil); err != nil {
+		wf.FatalError(err)
+	}
+	name := "the default account"
+	if activeAccount.Name != "" {
+		name = fmt.Sprintf("account %s", activeAccount.Name)
+	}
+	fmt.Printf("Usage statistics of %s reset", name)
+}
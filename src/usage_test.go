@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func Test_usageAction(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonPath string
+		totp     bool
+		want     string
+	}{
+		{name: "password", jsonPath: "login.password", want: "password"},
+		{name: "username", jsonPath: "login.username", want: "username"},
+		{name: "totp flag", jsonPath: "", totp: true, want: "totp"},
+		{name: "totp path", jsonPath: "login.totp", want: "totp"},
+		{name: "other field", jsonPath: "card.number", want: "card.number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usageAction(tt.jsonPath, tt.totp); got != tt.want {
+				t.Errorf("usageAction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_usageStats_score(t *testing.T) {
+	halfLife := 14 * 24 * time.Hour
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		uses []time.Time
+		at   time.Time
+		want float64
+	}{
+		{name: "never used", at: now, want: 0},
+		{name: "used now", uses: []time.Time{now}, at: now, want: 1},
+		{name: "used twice now", uses: []time.Time{now, now}, at: now, want: 2},
+		{name: "one half life ago", uses: []time.Time{now}, at: now.Add(halfLife), want: 0.5},
+		{name: "used again after one half life", uses: []time.Time{now, now.Add(halfLife)}, at: now.Add(halfLife), want: 1.5},
+		{name: "two half lives ago", uses: []time.Time{now, now}, at: now.Add(2 * halfLife), want: 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := usageStats{}
+			for _, use := range tt.uses {
+				stats.record("item-1", "password", use, halfLife)
+			}
+			if got := stats.score("item-1", tt.at, halfLife); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("score() = %v, want %v", got, tt.want)
+			}
+			if len(tt.uses) > 0 && stats["item-1"]["password"].Count != len(tt.uses) {
+				t.Errorf("count = %v, want %v", stats["item-1"]["password"].Count, len(tt.uses))
+			}
+		})
+	}
+}
+
+func Test_sortItems(t *testing.T) {
+	oldConf := conf
+	defer func() { conf = oldConf }()
+
+	now := time.Now()
+	stats := usageStats{}
+	stats.record("often", "password", now.Add(-time.Hour), 14*24*time.Hour)
+	stats.record("often", "username", now.Add(-time.Hour), 14*24*time.Hour)
+	stats.record("once", "totp", now.Add(-time.Hour), 14*24*time.Hour)
+	stats.record("long-ago", "password", now.Add(-365*24*time.Hour), 14*24*time.Hour)
+	stats.record("long-ago", "password", now.Add(-365*24*time.Hour), 14*24*time.Hour)
+
+	items := func() []Item {
+		return []Item{{Id: "unused"}, {Id: "favorite", Favorite: true}, {Id: "long-ago"}, {Id: "once"}, {Id: "often"}}
+	}
+	tests := []struct {
+		name     string
+		halfLife int
+		want     []string
+	}{
+		{name: "frecency first, then favorites", halfLife: 14, want: []string{"often", "once", "long-ago", "favorite", "unused"}},
+		{name: "disabled sorts favorites only", halfLife: 0, want: []string{"favorite", "unused", "long-ago", "once", "often"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.FrecencyHalfLife = tt.halfLife
+			got := items()
+			sortItems(got, stats)
+			for i, item := range got {
+				if item.Id != tt.want[i] {
+					t.Errorf("sortItems() position %d = %v, want %v", i, item.Id, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_usageStatsName(t *testing.T) {
+	oldAccount := activeAccount
+	defer func() { activeAccount = oldAccount }()
+	tests := []struct {
+		account string
+		want    string
+	}{
+		{account: "", want: "usage-stats.json"},
+		{account: "work", want: "usage-stats-work.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			activeAccount = Account{Name: tt.account}
+			if got := usageStatsName(); got != tt.want {
+				t.Errorf("usageStatsName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -78,6 +78,26 @@ func runCmd(args string, message string) ([]string, error) {
 	return checkReturn(status, message)
 }
 
+// runCmdWithStdin is runCmd which passes stdin to the process, secrets passed like this
+// don't show up in the process list
+func runCmdWithStdin(args string, stdin string, message string) ([]string, error) {
+	argSet := strings.Fields(args)
+	runCmd := cmd.NewCmd(argSet[0], argSet[1:]...)
+	runCmd.Env = append(os.Environ(), "NODE_NO_WARNINGS=1")
+	status := <-runCmd.StartWithStdin(strings.NewReader(stdin))
+
+	return checkReturn(status, message)
+}
+
+// runCmdArgs is runCmd for arguments which can contain spaces, like the paths of files
+func runCmdArgs(argSet []string, message string) ([]string, error) {
+	runCmd := cmd.NewCmd(argSet[0], argSet[1:]...)
+	runCmd.Env = append(os.Environ(), "NODE_NO_WARNINGS=1")
+	status := <-runCmd.Start()
+
+	return checkReturn(status, message)
+}
+
 func runCmdWithContext(emailMaxWait int, args string, message string) ([]string, error) {
 	// Start a long-running process, capture stdout and stderr
 	c, cancel := context.WithTimeout(context.Background(), time.Duration(emailMaxWait)*time.Second)
@@ -148,15 +168,31 @@ func map2faMode(mode int) string {
 }
 
 func clearCache() error {
-	err := wf.Cache.StoreJSON(CACHE_NAME, nil)
+	err := wf.Cache.StoreJSON(cacheName(CACHE_NAME), nil)
+	if err != nil {
+		return err
+	}
+	err = wf.Cache.StoreJSON(cacheName(FOLDER_CACHE_NAME), nil)
+	if err != nil {
+		return err
+	}
+	err = wf.Cache.StoreJSON(cacheName(ORGANIZATION_CACHE_NAME), nil)
+	if err != nil {
+		return err
+	}
+	err = wf.Cache.StoreJSON(cacheName(COLLECTION_CACHE_NAME), nil)
+	if err != nil {
+		return err
+	}
+	err = wf.Cache.StoreJSON(cacheName(BREACH_CACHE_NAME), nil)
 	if err != nil {
 		return err
 	}
-	err = wf.Cache.StoreJSON(FOLDER_CACHE_NAME, nil)
+	err = wf.Cache.StoreJSON(cacheName(TOTP_VIEW_CACHE_NAME), nil)
 	if err != nil {
 		return err
 	}
-	err = wf.Cache.StoreJSON(AUTO_FETCH_CACHE, nil)
+	err = wf.Cache.StoreJSON(cacheName(AUTO_FETCH_CACHE), nil)
 	if err != nil {
 		return err
 	}
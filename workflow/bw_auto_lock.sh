@@ -71,6 +71,14 @@ _get_var_from_plist() {
   /usr/bin/sed -n "s/.*<string>\(.*\)<\/string>.*/\1/p"
 }
 
+_get_wf_var() {
+  # 1=key, the workflow configuration in prefs.plist wins over the variables of info.plist
+  local value
+  value=$(_get_var_from_plist "${prefsplist}" "$1")
+  [ -n "${value}" ] || value=$(_get_var_from_plist "${infoplist}" "variables.$1")
+  echo "${value}"
+}
+
 # find TMP dir
 if [ -z "${TMPDIR}" ]; then
   TMPDIR=$(/usr/bin/getconf DARWIN_USER_TEMP_DIR)
@@ -114,6 +122,11 @@ export alfred_workflow_cache
 export alfred_workflow_data
 export alfred_workflow_version
 export BW_EXEC
+# the session token is read from the secret store the workflow uses
+SECRET_STORE=$(_get_wf_var SECRET_STORE)
+SECRET_STORE_KEY=$(_get_wf_var SECRET_STORE_KEY)
+[ -z "${SECRET_STORE}" ] || export SECRET_STORE
+[ -z "${SECRET_STORE_KEY}" ] || export SECRET_STORE_KEY
 
 case $1 in
   -i|--install)
@@ -134,7 +147,7 @@ uptime_string=$(/usr/sbin/sysctl -n kern.boottime | /usr/bin/awk '{print $4}' |
 now=$(/bin/date +%s)
 if [ "$((now-uptime_string))" -lt 300 ]; then
   /usr/bin/xattr -d com.apple.quarantine "$wf_bin" 2>/dev/null
-  "$wf_bin" -lock
+  "$wf_bin" -lock -allaccounts
 fi
 
 if [[ $1 =~ $re ]] && [[ -f "${alfred_workflow_cache}"/last-usage ]]; then
@@ -142,6 +155,6 @@ if [[ $1 =~ $re ]] && [[ -f "${alfred_workflow_cache}"/last-usage ]]; then
   now=$(/bin/date +%s)
   if [ "$((now-last_usage))" -gt $(($1*60)) ]; then
     /usr/bin/xattr -d com.apple.quarantine "$wf_bin" 2>/dev/null
-    "$wf_bin" -lock
+    "$wf_bin" -lock -allaccounts
   fi
 fi
@@ -135,6 +135,14 @@ _get_var_from_plist() {
   /usr/bin/sed -n "s/.*<string>\(.*\)<\/string>.*/\1/p"
 }
 
+_get_wf_var() {
+  # 1=key, the workflow configuration in prefs.plist wins over the variables of info.plist
+  local value
+  value=$(_get_var_from_plist "${prefsplist}" "$1")
+  [ -n "${value}" ] || value=$(_get_var_from_plist "${infoplist}" "variables.$1")
+  echo "${value}"
+}
+
 # find TMP dir
 if [ -z "${TMPDIR}" ]; then
   TMPDIR=$(/usr/bin/getconf DARWIN_USER_TEMP_DIR)
@@ -177,6 +185,11 @@ _setEnvVars() {
   export PATH=${WF_PATH}
   export BW_EXEC
   export DEBUG
+  # the session token is read from the secret store the workflow uses
+  SECRET_STORE=$(_get_wf_var SECRET_STORE)
+  SECRET_STORE_KEY=$(_get_wf_var SECRET_STORE_KEY)
+  [ -z "${SECRET_STORE}" ] || export SECRET_STORE
+  [ -z "${SECRET_STORE_KEY}" ] || export SECRET_STORE_KEY
   # the sync function will not open the Alfred Search window if this is set to true
   export BACKGROUND_SYNC_DAEMON=true
 }